@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// envPrefix prefixes the environment variables holding flag defaults, e.g. EPUB_SEARCH_SEARCH_THREADS for --threads
+	// of the search command
+	envPrefix = "EPUB_SEARCH_"
+
+	// defaultCommand is the command that also takes the unscoped defaults, i.e. the top-level keys of the config file and
+	// environment variables without a command, e.g. EPUB_SEARCH_THREADS
+	defaultCommand = "search"
+
+	// configFileName is the name of the config file in the user's config directory
+	configFileName = "epub-search.yaml"
+)
+
+// defaultConfigPath returns the path of the config file in the user's config directory (e.g. ~/.config/epub-search.yaml).
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, configFileName)
+}
+
+// envName returns the environment variable holding the default of a flag of a command, or of a root flag when command
+// is empty.
+func envName(command, flag string) string {
+	name := flag
+	if command != "" {
+		name = command + "_" + flag
+	}
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyDefaults sets each flag of a command that was not given on the command line from the section of the config file
+// named after the command, or else from its environment variable, so flags override the config file, which overrides
+// the environment and the built-in defaults. Defaults are scoped per command because commands share flag names with
+// different meanings, e.g. --format, while the search command also takes unscoped defaults, which its own section and
+// variables override. A missing config file is ignored unless the path was set explicitly, and sections, keys and
+// environment variables that match no command or flag are rejected, so typos are not silently ignored.
+func applyDefaults(cmd *cobra.Command, configPath string, explicit bool) error {
+	config, err := readConfigFile(configPath)
+	if err != nil && (explicit || !errors.Is(err, fs.ErrNotExist)) {
+		return err
+	}
+
+	commands := make(map[string]*cobra.Command)
+	for _, command := range cmd.Root().Commands() {
+		commands[command.Name()] = command
+	}
+	for section, values := range config {
+		name := section
+		if name == "" {
+			name = defaultCommand
+		}
+		command, ok := commands[name]
+		if !ok {
+			return fmt.Errorf("unknown command %q in config file %s", section, configPath)
+		}
+		for key := range values {
+			if key == "config" || command.Flags().Lookup(key) == nil {
+				return fmt.Errorf("unknown flag %q for %s in config file %s", key, name, configPath)
+			}
+		}
+	}
+
+	// the default command owns every variable without the prefix of another command
+	unscoped := cmd.Name() == defaultCommand
+	flags := cmd.Flags()
+	known := map[string]bool{envName("", "config"): true}
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name != "config" {
+			known[envName(cmd.Name(), flag.Name)] = true
+			known[envName("", flag.Name)] = unscoped
+		}
+	})
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(name, envPrefix) || known[name] {
+			continue
+		}
+		if strings.HasPrefix(name, envName(cmd.Name(), "")) {
+			return fmt.Errorf("unknown environment variable %s: %s has no such flag", name, cmd.Name())
+		}
+		if unscoped && !slices.ContainsFunc(cmd.Root().Commands(), func(command *cobra.Command) bool {
+			return strings.HasPrefix(name, envName(command.Name(), ""))
+		}) {
+			return fmt.Errorf("unknown environment variable %s: %s has no such flag", name, cmd.Name())
+		}
+	}
+
+	var setErr error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if setErr != nil || flag.Changed || flag.Name == "config" {
+			return
+		}
+
+		values, ok := config[cmd.Name()][flag.Name]
+		if !ok && unscoped {
+			values, ok = config[""][flag.Name]
+		}
+		if ok {
+			for _, value := range values {
+				if err := flags.Set(flag.Name, value); err != nil {
+					setErr = fmt.Errorf("invalid %s for %s in config file %s: %w", flag.Name, cmd.Name(), configPath, err)
+					return
+				}
+			}
+			return
+		}
+
+		variable := envName(cmd.Name(), flag.Name)
+		value, ok := os.LookupEnv(variable)
+		if !ok && unscoped {
+			variable = envName("", flag.Name)
+			value, ok = os.LookupEnv(variable)
+		}
+		if ok {
+			if err := flags.Set(flag.Name, value); err != nil {
+				setErr = fmt.Errorf("invalid %s: %w", variable, err)
+			}
+		}
+	})
+	return setErr
+}
+
+// readConfigFile reads a config file mapping command names to their flag defaults, with the top-level flag defaults
+// under the empty name.
+func readConfigFile(path string) (map[string]map[string][]string, error) {
+	if path == "" {
+		return nil, fs.ErrNotExist
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Warn().Err(err).Str("file", path).Msg("failed to close config file")
+		}
+	}()
+
+	config, err := parseConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// parseConfig parses a YAML config file with a section of "flag: value" pairs per command, with lists for repeatable
+// flags, and top-level "flag: value" pairs, which are kept under the empty name. Values are kept as written, so they
+// are parsed by the flags themselves.
+func parseConfig(r io.Reader) (map[string]map[string][]string, error) {
+	var entries map[string]yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&entries); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	config := make(map[string]map[string][]string)
+	for key, node := range entries {
+		if node.Kind != yaml.MappingNode {
+			values, err := nodeValues(&node)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			if config[""] == nil {
+				config[""] = make(map[string][]string)
+			}
+			config[""][key] = values
+			continue
+		}
+
+		var flags map[string]yaml.Node
+		if err := node.Decode(&flags); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		config[key] = make(map[string][]string, len(flags))
+		for flag, node := range flags {
+			values, err := nodeValues(&node)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", key, flag, err)
+			}
+			config[key][flag] = values
+		}
+	}
+	return config, nil
+}
+
+// nodeValues returns the values of a scalar or a list of scalars, with null as no values.
+func nodeValues(node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return nil, nil
+		}
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: expected a value", item.Line)
+			}
+			values = append(values, item.Value)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("line %d: expected a value or a list of values", node.Line)
+	}
+}
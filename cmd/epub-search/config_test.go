@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jfenske89/go-epub-grep/pkg/epubproc"
+)
+
+// TestConfigPrecedence tests that flags override the config file, which overrides the environment and the defaults
+func TestConfigPrecedence(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_config_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	writeConfig := func(name, content string) string {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		return path
+	}
+	emptyConfig := writeConfig("empty.yaml", "")
+	threadsConfig := writeConfig("threads.yaml", "# search defaults\nsearch:\n  threads: 5\n")
+	flatConfig := writeConfig("flat.yaml", "threads: 6\n")
+	mixedConfig := writeConfig("mixed.yaml", "threads: 6\nsearch:\n  threads: 5\n")
+
+	// threads parses the arguments of the search command, applies the defaults and returns the effective threads
+	threads := func(args ...string) int {
+		t.Helper()
+
+		rootCmd := createRootCmd(context.Background())
+		searchCmd, remaining, err := rootCmd.Find(append([]string{"search"}, args...))
+		if err != nil {
+			t.Fatalf("Failed to find search command: %v", err)
+		}
+		if err := searchCmd.ParseFlags(remaining); err != nil {
+			t.Fatalf("Failed to parse flags: %v", err)
+		}
+		if err := rootCmd.PersistentPreRunE(searchCmd, nil); err != nil {
+			t.Fatalf("Failed to apply defaults: %v", err)
+		}
+
+		value, err := strconv.Atoi(searchCmd.Flags().Lookup("threads").Value.String())
+		if err != nil {
+			t.Fatalf("Failed to get threads: %v", err)
+		}
+		return value
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		if got := threads("--config", emptyConfig); got != runtime.NumCPU() {
+			t.Errorf("Expected %d threads, got %d", runtime.NumCPU(), got)
+		}
+	})
+
+	t.Run("Environment", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_SEARCH_THREADS", "3")
+		if got := threads("--config", emptyConfig); got != 3 {
+			t.Errorf("Expected 3 threads, got %d", got)
+		}
+	})
+
+	t.Run("UnscopedEnvironment", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_THREADS", "3")
+		if got := threads("--config", emptyConfig); got != 3 {
+			t.Errorf("Expected 3 threads, got %d", got)
+		}
+
+		t.Setenv("EPUB_SEARCH_SEARCH_THREADS", "4")
+		if got := threads("--config", emptyConfig); got != 4 {
+			t.Errorf("Expected the scoped variable to override with 4 threads, got %d", got)
+		}
+	})
+
+	t.Run("FlatConfig", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_SEARCH_THREADS", "3")
+		if got := threads("--config", flatConfig); got != 6 {
+			t.Errorf("Expected 6 threads, got %d", got)
+		}
+		if got := threads("--config", mixedConfig); got != 5 {
+			t.Errorf("Expected the search section to override with 5 threads, got %d", got)
+		}
+	})
+
+	t.Run("ConfigOverridesEnvironment", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_SEARCH_THREADS", "3")
+		if got := threads("--config", threadsConfig); got != 5 {
+			t.Errorf("Expected 5 threads, got %d", got)
+		}
+	})
+
+	t.Run("ConfigFromEnvironment", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_CONFIG", threadsConfig)
+		if got := threads(); got != 5 {
+			t.Errorf("Expected 5 threads, got %d", got)
+		}
+	})
+
+	t.Run("FlagOverridesConfig", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_SEARCH_THREADS", "3")
+		if got := threads("--config", threadsConfig, "--threads", "7"); got != 7 {
+			t.Errorf("Expected 7 threads, got %d", got)
+		}
+	})
+
+	t.Run("Auto", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_SEARCH_THREADS", "auto")
+		if got := threads("--config", emptyConfig); got != epubproc.AutoThreads() {
+			t.Errorf("Expected %d threads, got %d", epubproc.AutoThreads(), got)
+		}
+		if got := threads("--config", emptyConfig, "--threads", "AUTO"); got <= 0 {
+			t.Errorf("Expected a positive number of threads, got %d", got)
+		}
+	})
+
+	t.Run("InvalidValue", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_SEARCH_THREADS", "many")
+
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetArgs([]string{"search", "-d", tempDir, "-p", "Holmes", "--config", emptyConfig})
+		rootCmd.SetOut(&strings.Builder{})
+		rootCmd.SetErr(&strings.Builder{})
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "EPUB_SEARCH_SEARCH_THREADS") {
+			t.Errorf("Expected an error naming EPUB_SEARCH_SEARCH_THREADS, got %v", err)
+		}
+	})
+
+	t.Run("MissingExplicitConfig", func(t *testing.T) {
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetArgs([]string{"search", "-d", tempDir, "-p", "Holmes", "--config", filepath.Join(tempDir, "missing.yaml")})
+		rootCmd.SetOut(&strings.Builder{})
+		rootCmd.SetErr(&strings.Builder{})
+		if err := rootCmd.Execute(); err == nil {
+			t.Error("Expected an error for a missing config file")
+		}
+	})
+}
+
+// TestParseConfig tests parsing scalars, lists, quotes and comments from the command sections of a config file
+func TestParseConfig(t *testing.T) {
+	config, err := parseConfig(strings.NewReader(`
+# top-level defaults for search
+threads: 4
+search:
+  directory: "/books/My Library" # quoted
+  ignore-case: true
+  context: 2
+  modified-since: 2024-05-01T00:00:00Z
+  files-in: [a.epub, 'b.epub']
+  pattern:
+    - Holmes
+    - "Watson #2"
+verify:
+  format: table
+`))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+
+	expected := map[string]map[string][]string{
+		"search": {
+			"directory":      {"/books/My Library"},
+			"ignore-case":    {"true"},
+			"context":        {"2"},
+			"modified-since": {"2024-05-01T00:00:00Z"},
+			"files-in":       {"a.epub", "b.epub"},
+			"pattern":        {"Holmes", "Watson #2"},
+		},
+		"verify": {"format": {"table"}},
+		"":       {"threads": {"4"}},
+	}
+	if len(config) != len(expected) {
+		t.Errorf("Expected %d sections, got %v", len(expected), config)
+	}
+	for section, flags := range expected {
+		if len(config[section]) != len(flags) {
+			t.Errorf("Expected %d keys in %s, got %v", len(flags), section, config[section])
+		}
+		for key, values := range flags {
+			if !slices.Equal(config[section][key], values) {
+				t.Errorf("Expected %s.%s to be %q, got %q", section, key, values, config[section][key])
+			}
+		}
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, input := range []string{"- threads", "threads: [[5]]", "search:\n  pattern: [[a]]", "search: {"} {
+			if _, err := parseConfig(strings.NewReader(input)); err == nil {
+				t.Errorf("Expected an error for %q", input)
+			}
+		}
+	})
+}
+
+// TestConfigScopedPerCommand tests that each command only takes the defaults of its own section and environment
+// variables, so flags with the same name do not collide, and that unknown sections, flags and variables are rejected
+func TestConfigScopedPerCommand(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_config_scope_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	writeConfig := func(name, content string) string {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		return path
+	}
+	formatsConfig := writeConfig("formats.yaml", "search:\n  format: atom\nverify:\n  format: table\n")
+
+	// applyTo parses the arguments of a command, applies the defaults and returns the command
+	applyTo := func(command string, args ...string) (*cobra.Command, error) {
+		t.Helper()
+
+		rootCmd := createRootCmd(context.Background())
+		cmd, remaining, err := rootCmd.Find(append([]string{command}, args...))
+		if err != nil {
+			t.Fatalf("Failed to find %s command: %v", command, err)
+		}
+		if err := cmd.ParseFlags(remaining); err != nil {
+			t.Fatalf("Failed to parse flags: %v", err)
+		}
+		return cmd, rootCmd.PersistentPreRunE(cmd, nil)
+	}
+
+	t.Run("SameFlagPerCommand", func(t *testing.T) {
+		for command, expected := range map[string]string{"search": "atom", "verify": "table"} {
+			cmd, err := applyTo(command, "--config", formatsConfig)
+			if err != nil {
+				t.Fatalf("Failed to apply defaults to %s: %v", command, err)
+			}
+			if got := cmd.Flags().Lookup("format").Value.String(); got != expected {
+				t.Errorf("Expected %s to use format %s, got %s", command, expected, got)
+			}
+		}
+	})
+
+	// the unscoped defaults belong to the search command only
+	t.Run("UnscopedOnlyForSearch", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_FORMAT", "atom")
+		cmd, err := applyTo("verify", "--config", writeConfig("flat.yaml", "format: atom\n"))
+		if err != nil {
+			t.Fatalf("Failed to apply defaults: %v", err)
+		}
+		if got := cmd.Flags().Lookup("format").Value.String(); got != outputFormatJSON {
+			t.Errorf("Expected verify to keep format %s, got %s", outputFormatJSON, got)
+		}
+	})
+
+	t.Run("EnvironmentPerCommand", func(t *testing.T) {
+		t.Setenv("EPUB_SEARCH_VERIFY_FORMAT", "table")
+		cmd, err := applyTo("search", "--config", writeConfig("empty.yaml", ""))
+		if err != nil {
+			t.Fatalf("Failed to apply defaults: %v", err)
+		}
+		if got := cmd.Flags().Lookup("format").Value.String(); got != outputFormatJSON {
+			t.Errorf("Expected search to keep format %s, got %s", outputFormatJSON, got)
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			config   string
+			env      string
+			expected string
+		}{
+			{name: "Command", config: "serach:\n  threads: 2\n", expected: `unknown command "serach"`},
+			{name: "Flag", config: "search:\n  thread: 2\n", expected: `unknown flag "thread"`},
+			{name: "FlagOfOtherCommand", config: "verify:\n  pattern: Holmes\n", expected: `unknown flag "pattern"`},
+			{name: "TopLevelFlag", config: "thread: 2\n", expected: `unknown flag "thread"`},
+			{name: "EnvironmentVariable", config: "", env: "EPUB_SEARCH_SEARCH_THREDS", expected: "EPUB_SEARCH_SEARCH_THREDS"},
+			{name: "UnscopedEnvironmentVariable", config: "", env: "EPUB_SEARCH_THREDS", expected: "EPUB_SEARCH_THREDS"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if tt.env != "" {
+					t.Setenv(tt.env, "2")
+				}
+				_, err := applyTo("search", "--config", writeConfig(tt.name+".yaml", tt.config))
+				if err == nil || !strings.Contains(err.Error(), tt.expected) {
+					t.Errorf("Expected an error containing %q, got %v", tt.expected, err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// diffFlags holds command-line flags for the diff command
+type diffFlags struct {
+	baseline string
+	current  string
+	pretty   bool
+	indent   int
+	jsonCase string
+	logLevel string
+}
+
+// diffOutput represents the differences between two searches in JSON format
+type diffOutput struct {
+	Added   []bookDiff  `json:"added"`
+	Removed []bookDiff  `json:"removed"`
+	Changed []bookDiff  `json:"changed"`
+	Summary diffSummary `json:"summary"`
+}
+
+// bookDiff compares the number of matches of a book in the baseline and current searches
+type bookDiff struct {
+	Path            string `json:"path"`
+	BaselineMatches int    `json:"baselineMatches"`
+	CurrentMatches  int    `json:"currentMatches"`
+	Delta           int    `json:"delta"`
+}
+
+// diffSummary provides the totals of both searches and the number of books in each category
+type diffSummary struct {
+	BaselineFiles   int `json:"baselineFiles"`
+	CurrentFiles    int `json:"currentFiles"`
+	BaselineMatches int `json:"baselineMatches"`
+	CurrentMatches  int `json:"currentMatches"`
+	Added           int `json:"added"`
+	Removed         int `json:"removed"`
+	Changed         int `json:"changed"`
+	Unchanged       int `json:"unchanged"`
+}
+
+// savedSearch is the part of a saved search output needed to compare it, in either JSON case, with or without
+// --group-by-file
+type savedSearch struct {
+	Results *[]struct {
+		Path    string            `json:"path"`
+		Matches []json.RawMessage `json:"matches"`
+		Files   []struct {
+			Matches []json.RawMessage `json:"matches"`
+		} `json:"files"`
+		ContentError      string `json:"contentError"`
+		ContentErrorSnake string `json:"content_error"`
+	} `json:"results"`
+	Error string `json:"error"`
+}
+
+// createDiffCmd creates the diff command with flags
+func createDiffCmd() *cobra.Command {
+	flags := &diffFlags{}
+
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare two saved search outputs",
+		Long: `Compare the JSON output of two searches, such as the same search before and after a library or version change,
+and report the books only found by one of them along with the books whose number of matches changed.`,
+		Example: `  # Compare a search against a saved baseline
+  epub-search search -d /path/to/epubs -p "Holmes" > baseline.json
+  epub-search search -d /path/to/epubs -p "Holmes" > current.json
+  epub-search diff --baseline baseline.json --current current.json --pretty`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiff(cmd, flags)
+		},
+	}
+
+	diffCmd.Flags().StringVar(&flags.baseline, "baseline", "", "Saved search output to compare against (required)")
+	diffCmd.Flags().StringVar(&flags.current, "current", "", "Saved search output to compare (required)")
+	diffCmd.Flags().BoolVar(&flags.pretty, "pretty", false, "Pretty-print JSON output")
+	diffCmd.Flags().IntVar(&flags.indent, "indent", defaultIndent, "Spaces per indentation level of pretty-printed JSON (0 for compact output)")
+	diffCmd.Flags().StringVar(&flags.jsonCase, "json-case", jsonCaseCamel, "Naming convention of JSON field names (camel, snake)")
+	diffCmd.Flags().StringVar(&flags.logLevel, "log-level", "warn", "Set logging level (disabled, error, warn, info, debug, trace)")
+
+	// required flags
+	for _, name := range []string{"baseline", "current"} {
+		if err := diffCmd.MarkFlagRequired(name); err != nil {
+			log.Err(err).Str("flag", name).Msg("failed to mark flag as required")
+		}
+	}
+
+	return diffCmd
+}
+
+// runDiff executes the diff command with the provided flags
+func runDiff(cmd *cobra.Command, flags *diffFlags) error {
+	configureLogging(flags.logLevel)
+
+	if flags.indent < 0 {
+		return fmt.Errorf("invalid indent %d: must not be negative", flags.indent)
+	}
+	if err := validateJSONCase(flags.jsonCase); err != nil {
+		return err
+	}
+
+	baseline, err := loadMatchCounts(flags.baseline)
+	if err != nil {
+		return err
+	}
+	current, err := loadMatchCounts(flags.current)
+	if err != nil {
+		return err
+	}
+
+	return outputJSON(cmd.OutOrStdout(), diffSearches(baseline, current), jsonIndent(flags.pretty, flags.indent), flags.jsonCase)
+}
+
+// loadMatchCounts reads a saved search output and returns the number of matches of each book, keyed by path
+func loadMatchCounts(path string) (map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search output: %w", err)
+	}
+
+	var saved savedSearch
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse search output '%s': %w", path, err)
+	}
+	if saved.Error != "" {
+		return nil, fmt.Errorf("search output '%s' is a failed search: %s", path, saved.Error)
+	}
+	if saved.Results == nil {
+		return nil, fmt.Errorf("search output '%s' has no results", path)
+	}
+
+	counts := make(map[string]int, len(*saved.Results))
+	for _, result := range *saved.Results {
+		// every result of a full search has matches unless its content could not be read, so a book without either
+		// was saved with --metadata-only-output, whose match counts are unknown rather than 0
+		if result.Matches == nil && result.Files == nil && result.ContentError == "" && result.ContentErrorSnake == "" {
+			return nil, fmt.Errorf("search output '%s' has no matches for '%s': outputs saved with --metadata-only-output cannot be compared", path, result.Path)
+		}
+
+		count := len(result.Matches)
+		for _, file := range result.Files {
+			count += len(file.Matches)
+		}
+
+		// a book is only reported once per search, but repeated paths are summed rather than overwritten
+		counts[result.Path] += count
+	}
+	return counts, nil
+}
+
+// diffSearches compares the match counts of two searches, listing each category of books in path order
+func diffSearches(baseline, current map[string]int) diffOutput {
+	output := diffOutput{
+		Added:   []bookDiff{},
+		Removed: []bookDiff{},
+		Changed: []bookDiff{},
+		Summary: diffSummary{BaselineFiles: len(baseline), CurrentFiles: len(current)},
+	}
+
+	for path, count := range baseline {
+		output.Summary.BaselineMatches += count
+
+		currentCount, found := current[path]
+		diff := bookDiff{Path: path, BaselineMatches: count, CurrentMatches: currentCount, Delta: currentCount - count}
+		switch {
+		case !found:
+			output.Removed = append(output.Removed, diff)
+		case diff.Delta != 0:
+			output.Changed = append(output.Changed, diff)
+		default:
+			output.Summary.Unchanged++
+		}
+	}
+
+	for path, count := range current {
+		output.Summary.CurrentMatches += count
+		if _, found := baseline[path]; !found {
+			output.Added = append(output.Added, bookDiff{Path: path, CurrentMatches: count, Delta: count})
+		}
+	}
+
+	for _, diffs := range [][]bookDiff{output.Added, output.Removed, output.Changed} {
+		slices.SortFunc(diffs, func(a, b bookDiff) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+	}
+	output.Summary.Added = len(output.Added)
+	output.Summary.Removed = len(output.Removed)
+	output.Summary.Changed = len(output.Changed)
+
+	return output
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/jfenske89/go-epub-grep/pkg/epubproc"
+)
+
+// duplicatesFlags holds command-line flags for the duplicates command
+type duplicatesFlags struct {
+	epubDir           string
+	maxThreads        int
+	strictIdentifiers bool
+	pretty            bool
+	indent            int
+	jsonCase          string
+	logLevel          string
+}
+
+// createDuplicatesCmd creates the duplicates command with flags
+func createDuplicatesCmd(ctx context.Context) *cobra.Command {
+	flags := &duplicatesFlags{}
+
+	duplicatesCmd := &cobra.Command{
+		Use:   "duplicates",
+		Short: "List the identifiers of a library and the books sharing an ISBN",
+		Long: `Extract the metadata of each ePUB file and report the distinct identifiers of each scheme (isbn, asin, etc.),
+along with the groups of books sharing an ISBN, which are likely duplicates of each other.`,
+		Example: `  # Report likely duplicate books in a library
+  epub-search duplicates -d /path/to/epubs --pretty`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDuplicates(ctx, cmd, flags)
+		},
+	}
+
+	duplicatesCmd.Flags().StringVarP(&flags.epubDir, "directory", "d", "", "Directory containing ePUB files (required)")
+	flags.maxThreads = runtime.NumCPU()
+	duplicatesCmd.Flags().VarP((*threadsValue)(&flags.maxThreads), "threads", "t", "Maximum number of worker threads, or auto to scale with IO")
+	duplicatesCmd.Flags().BoolVar(&flags.strictIdentifiers, "strict-identifiers", false, "Only classify identifiers without a scheme that have a valid ISBN check digit or a strict ASIN, DOI, URI or URN format")
+	duplicatesCmd.Flags().BoolVar(&flags.pretty, "pretty", false, "Pretty-print JSON output")
+	duplicatesCmd.Flags().IntVar(&flags.indent, "indent", defaultIndent, "Spaces per indentation level of pretty-printed JSON (0 for compact output)")
+	duplicatesCmd.Flags().StringVar(&flags.jsonCase, "json-case", jsonCaseCamel, "Naming convention of JSON field names (camel, snake)")
+	duplicatesCmd.Flags().StringVar(&flags.logLevel, "log-level", "warn", "Set logging level (disabled, error, warn, info, debug, trace)")
+
+	// required flags
+	if err := duplicatesCmd.MarkFlagRequired("directory"); err != nil {
+		log.Err(err).Msg("failed to mark directory flag as required")
+	}
+
+	return duplicatesCmd
+}
+
+// runDuplicates executes the duplicates command with the provided flags
+func runDuplicates(ctx context.Context, cmd *cobra.Command, flags *duplicatesFlags) error {
+	configureLogging(flags.logLevel)
+
+	if flags.indent < 0 {
+		return fmt.Errorf("invalid indent %d: must not be negative", flags.indent)
+	}
+	if err := validateJSONCase(flags.jsonCase); err != nil {
+		return err
+	}
+
+	// validate directory exists
+	if _, err := os.Stat(flags.epubDir); os.IsNotExist(err) {
+		return fmt.Errorf("directory does not exist: %s", flags.epubDir)
+	}
+
+	extractorOpts := []epubproc.MetadataExtractorOption{epubproc.WithMetadataFields(epubproc.MetadataIdentifiers)}
+	if flags.strictIdentifiers {
+		extractorOpts = append(extractorOpts, epubproc.WithIdentifierStrictness(epubproc.IdentifierStrict))
+	}
+	extractor := epubproc.NewMetadataExtractor(flags.maxThreads, extractorOpts...)
+	report, err := epubproc.ListIdentifiers(ctx, extractor, flags.epubDir)
+	if err != nil {
+		return fmt.Errorf("listing identifiers failed: %w", err)
+	}
+	return outputJSON(cmd.OutOrStdout(), report, jsonIndent(flags.pretty, flags.indent), flags.jsonCase)
+}
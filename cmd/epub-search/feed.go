@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// output formats of the search command
+const (
+	outputFormatJSON = "json"
+	outputFormatAtom = "atom"
+)
+
+// atomNamespace is the XML namespace of Atom feeds
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// atomFeed represents search results as an Atom feed, with an entry per matching book
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomEntry represents a matching book in an Atom feed
+type atomEntry struct {
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Updated string       `xml:"updated"`
+	Authors []atomAuthor `xml:"author"`
+	Link    atomLink     `xml:"link"`
+	Summary string       `xml:"summary,omitempty"`
+}
+
+// atomAuthor represents the author of a feed or entry
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// atomLink represents a link to the file of a book
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+// validateOutputFormat checks that an output format is one of the supported formats
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputFormatJSON, outputFormatAtom:
+		return nil
+	default:
+		return fmt.Errorf("invalid format %q: must be %s or %s", format, outputFormatJSON, outputFormatAtom)
+	}
+}
+
+// outputAtom writes search results as an Atom feed titled after the search patterns, with each book linked by its
+// file URL and summarized by the line of its first match
+func outputAtom(w io.Writer, results []searchResult, patterns []string, updated time.Time) error {
+	timestamp := updated.UTC().Format(time.RFC3339)
+	feed := atomFeed{
+		XMLNS:   atomNamespace,
+		ID:      "urn:epub-search:" + url.QueryEscape(strings.Join(patterns, " ")),
+		Title:   "epub-search: " + strings.Join(patterns, ", "),
+		Updated: timestamp,
+		Author:  atomAuthor{Name: "epub-search"},
+		Entries: make([]atomEntry, 0, len(results)),
+	}
+
+	for _, result := range results {
+		link := fileURL(result.Path)
+		entry := atomEntry{
+			ID:      link,
+			Title:   strings.TrimSuffix(filepath.Base(result.Path), filepath.Ext(result.Path)),
+			Updated: timestamp,
+			Link:    atomLink{Href: link},
+			Summary: firstMatchLine(result),
+		}
+		if result.Metadata != nil {
+			if result.Metadata.Title != "" {
+				entry.Title = result.Metadata.Title
+			}
+			for _, author := range result.Metadata.Authors {
+				entry.Authors = append(entry.Authors, atomAuthor{Name: author})
+			}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal Atom output: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "%s%s\n", xml.Header, data); err != nil {
+		return fmt.Errorf("failed to write Atom output: %w", err)
+	}
+	return nil
+}
+
+// fileURL returns the file URL of a path, made absolute when possible
+func fileURL(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// firstMatchLine returns the line of the first match of a result, with or without --group-by-file, or "" without
+// matches
+func firstMatchLine(result searchResult) string {
+	if len(result.Matches) > 0 {
+		return result.Matches[0].Line
+	}
+	for _, file := range result.Files {
+		if len(file.Matches) > 0 {
+			return file.Matches[0].Line
+		}
+	}
+	return ""
+}
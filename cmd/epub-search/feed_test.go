@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAtomFormat tests writing the matching books of a search as an Atom feed
+func TestAtomFormat(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_atom_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	bookPath, err := createTestEPUB(tempDir, "book.epub", "<p>Watson waited.</p><p>Holmes & Watson returned.</p>")
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	if _, err := createTestEPUB(tempDir, "other.epub", "<p>Only Watson.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	rootCmd := createRootCmd(context.Background())
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetArgs([]string{"search", "-d", tempDir, "-p", "Holmes", "--extract-metadata", "--format", "atom", "--log-level", "disabled"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+
+	if !strings.HasPrefix(stdout.String(), xml.Header) {
+		t.Errorf("Expected the output to start with an XML declaration, got %q", stdout.String())
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(stdout.Bytes(), &feed); err != nil {
+		t.Fatalf("Failed to parse output %q: %v", stdout.String(), err)
+	}
+	if feed.XMLName.Space != atomNamespace || feed.XMLName.Local != "feed" {
+		t.Errorf("Expected an Atom feed element, got %+v", feed.XMLName)
+	}
+	if feed.ID == "" || feed.Updated == "" || feed.Author.Name == "" {
+		t.Errorf("Expected the feed to have an id, updated time and author, got %+v", feed)
+	}
+	if len(feed.Entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(feed.Entries))
+	}
+
+	entry := feed.Entries[0]
+	if entry.Title != "Test Book" {
+		t.Errorf("Expected the title of the book, got %q", entry.Title)
+	}
+	if expected := "file://" + filepath.ToSlash(bookPath); entry.Link.Href != expected || entry.ID != expected {
+		t.Errorf("Expected a link and id of %s, got %q and %q", expected, entry.Link.Href, entry.ID)
+	}
+	if entry.Summary != "Holmes & Watson returned." {
+		t.Errorf("Expected the first match as the summary, got %q", entry.Summary)
+	}
+	if !strings.Contains(stdout.String(), "<summary>Holmes &amp; Watson returned.</summary>") {
+		t.Errorf("Expected an escaped summary element, got %q", stdout.String())
+	}
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(io.Discard)
+		rootCmd.SetErr(io.Discard)
+		rootCmd.SetArgs([]string{"search", "-d", tempDir, "-p", "Holmes", "--format", "rss", "--log-level", "disabled"})
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "invalid format") {
+			t.Errorf("Expected an invalid format error, got %v", err)
+		}
+	})
+}
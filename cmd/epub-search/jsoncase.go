@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode"
+)
+
+const (
+	// jsonCaseCamel keeps the camelCase field names of the JSON tags
+	jsonCaseCamel = "camel"
+
+	// jsonCaseSnake renames every field to snake_case, e.g. paragraphIndex to paragraph_index
+	jsonCaseSnake = "snake"
+)
+
+// validateJSONCase checks that a --json-case value is supported
+func validateJSONCase(jsonCase string) error {
+	switch jsonCase {
+	case jsonCaseCamel, jsonCaseSnake:
+		return nil
+	default:
+		return fmt.Errorf("invalid JSON case %q: must be camel or snake", jsonCase)
+	}
+}
+
+// snakeCaseKeys rewrites every object key of a JSON document from camelCase to snake_case, keeping the order of the
+// keys and the values as they are, so the output types keep a single set of JSON tags
+func snakeCaseKeys(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	// containers holds the open objects and arrays, with the number of keys and values written to each so far
+	type container struct {
+		object bool
+		items  int
+	}
+	var containers []*container
+
+	var out bytes.Buffer
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JSON output: %w", err)
+		}
+
+		if token == json.Delim('}') || token == json.Delim(']') {
+			containers = containers[:len(containers)-1]
+			out.WriteString(token.(json.Delim).String())
+			continue
+		}
+
+		// keys and values are separated by colons, and items by commas
+		isKey := false
+		if n := len(containers); n > 0 {
+			parent := containers[n-1]
+			switch {
+			case parent.object && parent.items%2 == 1:
+				out.WriteByte(':')
+			case parent.items > 0:
+				out.WriteByte(',')
+			}
+			isKey = parent.object && parent.items%2 == 0
+			parent.items++
+		}
+
+		switch value := token.(type) {
+		case json.Delim:
+			containers = append(containers, &container{object: value == '{'})
+			out.WriteString(value.String())
+		case string:
+			if isKey {
+				value = toSnakeCase(value)
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write JSON output: %w", err)
+			}
+			out.Write(encoded)
+		default:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write JSON output: %w", err)
+			}
+			out.Write(encoded)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// toSnakeCase converts a camelCase name to snake_case, keeping acronyms together (e.g. includeHTMLText to
+// include_html_text)
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+
+	var snake []rune
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// a word starts at an upper case letter after a lower case one, or at the last letter of an acronym
+			afterLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			endsAcronym := i > 0 && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if afterLower || endsAcronym {
+				snake = append(snake, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		snake = append(snake, r)
+	}
+	return string(snake)
+}
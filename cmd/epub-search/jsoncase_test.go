@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestSnakeCaseKeys tests renaming keys while keeping their order and the values as they are
+func TestSnakeCaseKeys(t *testing.T) {
+	input := `{"zetaValue":1.50,"includeHTML":true,"paragraphIndex":[{"fileName":"a\u003cb","isbn13":null}],"identifiers":{"isbn":"1"},"textValue":"camelCase"}`
+	expected := `{"zeta_value":1.50,"include_html":true,"paragraph_index":[{"file_name":"a\u003cb","isbn13":null}],"identifiers":{"isbn":"1"},"text_value":"camelCase"}`
+
+	got, err := snakeCaseKeys([]byte(input))
+	if err != nil {
+		t.Fatalf("snakeCaseKeys failed: %v", err)
+	}
+	if string(got) != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	for name, snake := range map[string]string{"totalMatches": "total_matches", "HTMLText": "html_text", "perPattern": "per_pattern", "path": "path"} {
+		if got := toSnakeCase(name); got != snake {
+			t.Errorf("Expected %s for %s, got %s", snake, name, got)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// jsonArrayWriter writes a JSON object holding an array of elements written as they arrive, followed by a trailing
+// field such as the summary, so the output is one JSON document without holding every element in memory. The output is
+// the same as writing the whole object at once with outputJSON.
+type jsonArrayWriter struct {
+	w        io.Writer
+	key      string
+	indent   int
+	jsonCase string
+
+	// mu serializes writes from concurrent handlers
+	mu sync.Mutex
+
+	// count is the number of elements written so far
+	count int
+}
+
+// newJSONArrayWriter creates a writer for an object whose first field is the array with this key, indented by this many
+// spaces per level or compact when indent is 0, with its field names in the given JSON case
+func newJSONArrayWriter(w io.Writer, key string, indent int, jsonCase string) *jsonArrayWriter {
+	return &jsonArrayWriter{w: w, key: key, indent: indent, jsonCase: jsonCase}
+}
+
+// Write marshals an element and writes it to the array, opening the object before the first element
+func (a *jsonArrayWriter) Write(element any) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// elements are nested in the array of the object, two levels deep
+	data, err := marshalJSON(element, a.indent, a.prefix(2), a.jsonCase)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if a.count == 0 {
+		a.open(&out)
+	} else {
+		out.WriteByte(',')
+	}
+	if a.indent > 0 {
+		out.WriteString("\n" + a.prefix(2))
+	}
+	out.Write(data)
+	a.count++
+
+	if _, err := a.w.Write(out.Bytes()); err != nil {
+		return fmt.Errorf("failed to write JSON output: %w", err)
+	}
+	return nil
+}
+
+// Close ends the array and writes the trailing field with this key and value, then closes the object
+func (a *jsonArrayWriter) Close(key string, value any) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := marshalJSON(value, a.indent, a.prefix(1), a.jsonCase)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if a.count == 0 {
+		a.open(&out)
+	} else if a.indent > 0 {
+		out.WriteString("\n" + a.prefix(1))
+	}
+	out.WriteString("],")
+	a.field(&out, key)
+	out.Write(data)
+	if a.indent > 0 {
+		out.WriteByte('\n')
+	}
+	out.WriteString("}\n")
+
+	if _, err := a.w.Write(out.Bytes()); err != nil {
+		return fmt.Errorf("failed to write JSON output: %w", err)
+	}
+	return nil
+}
+
+// open writes the start of the object up to the opening bracket of the array
+func (a *jsonArrayWriter) open(out *bytes.Buffer) {
+	out.WriteByte('{')
+	a.field(out, a.key)
+	out.WriteByte('[')
+}
+
+// field writes a key of the object on its own line when indenting, with the separator before its value
+func (a *jsonArrayWriter) field(out *bytes.Buffer, key string) {
+	if a.jsonCase == jsonCaseSnake {
+		key = toSnakeCase(key)
+	}
+	encoded, _ := json.Marshal(key)
+
+	if a.indent > 0 {
+		out.WriteString("\n" + a.prefix(1))
+	}
+	out.Write(encoded)
+	out.WriteByte(':')
+	if a.indent > 0 {
+		out.WriteByte(' ')
+	}
+}
+
+// prefix returns the indentation of this nesting level, or "" for compact output
+func (a *jsonArrayWriter) prefix(level int) string {
+	return strings.Repeat(" ", a.indent*level)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// TestJSONArrayWriter tests that streamed elements and the trailing field match the output of the whole object
+func TestJSONArrayWriter(t *testing.T) {
+	type element struct {
+		Path           string   `json:"path"`
+		ParagraphIndex int      `json:"paragraphIndex"`
+		Lines          []string `json:"lines"`
+		Empty          []string `json:"empty"`
+	}
+	type summary struct {
+		TotalFiles int `json:"totalFiles"`
+	}
+	type document struct {
+		Results []element `json:"results"`
+		Summary summary   `json:"summary"`
+	}
+
+	elements := []element{
+		{Path: "a.epub", ParagraphIndex: 1, Lines: []string{"Holmes", "<Watson>"}, Empty: []string{}},
+		{Path: "b.epub", ParagraphIndex: 2},
+	}
+
+	for _, count := range []int{0, 1, 2} {
+		for _, indent := range []int{0, 2, 4} {
+			for _, jsonCase := range []string{jsonCaseCamel, jsonCaseSnake} {
+				t.Run(fmt.Sprintf("%dElements%dIndent%s", count, indent, jsonCase), func(t *testing.T) {
+					var streamed bytes.Buffer
+					writer := newJSONArrayWriter(&streamed, "results", indent, jsonCase)
+					for _, e := range elements[:count] {
+						if err := writer.Write(e); err != nil {
+							t.Fatalf("Write failed: %v", err)
+						}
+					}
+					if err := writer.Close("summary", summary{TotalFiles: count}); err != nil {
+						t.Fatalf("Close failed: %v", err)
+					}
+
+					var whole bytes.Buffer
+					results := append([]element{}, elements[:count]...)
+					if err := outputJSON(&whole, document{Results: results, Summary: summary{TotalFiles: count}}, indent, jsonCase); err != nil {
+						t.Fatalf("outputJSON failed: %v", err)
+					}
+
+					if streamed.String() != whole.String() {
+						t.Errorf("Expected %q, got %q", whole.String(), streamed.String())
+					}
+				})
+			}
+		}
+	}
+}
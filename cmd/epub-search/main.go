@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,17 +26,80 @@ import (
 // searchFlags holds command-line flags for the search command
 type searchFlags struct {
 	epubDir         string
-	pattern         string
+	filesFrom       string
+	patterns        []string
 	isRegex         bool
 	ignoreCase      bool
+	fuzzy           int
+	strictWalk      bool
+	failFast        bool
+	openRetries     int
+	maxBytes        int64
+	maxBlockBytes   int
+	maxBlocks       int
+	minLineLength   int
+	section         string
+	maxFiles        int
+	spineFrom       int
+	spineTo         int
+	followSymlinks  bool
+	modifiedSince   string
+	limitPerDir     int
+	slowFile        time.Duration
+	phrase          bool
+	document        bool
 	context         int
+	contextJoiner   string
+	includeHTML     bool
+	highlight       bool
+	highlightStart  string
+	highlightEnd    string
+	markHTML        bool
 	maxThreads      int
+	scanWorkers     int
+	metadataWorkers int
 	extractMetadata bool
+	metadataOnly    bool
+	detectLanguage  bool
+	preview         bool
+	searchDesc      bool
+	searchMeta      bool
 	authorEquals    string
 	seriesEquals    string
 	titleEquals     string
+	titleContains   string
+	normalizeTitle  bool
 	filesIn         []string
+	includeFiles    []string
+	excludeFiles    []string
+	ignoreGlobCase  bool
+	extraTextExts   []string
+	includeSkipped  []string
+	promoKeywords   []string
+	promoSubstring  bool
+	contentTypes    map[string]string
+	contentErrors   bool
+	offset          int
+	limit           int
+	minMatches      int
+	firstMatch      bool
+	sortBy          string
 	pretty          bool
+	indent          int
+	jsonCase        string
+	format          string
+	stream          bool
+	groupByFile     bool
+	groupBy         string
+	readingOrder    bool
+	percentage      bool
+	mediaType       bool
+	dedupe          bool
+	repairText      bool
+	aggregate       bool
+	explain         bool
+	jsonErrors      bool
+	analyze         bool
 	logLevel        string
 }
 
@@ -42,15 +111,71 @@ type searchOutput struct {
 
 // searchResult represents a search result with metadata and matches
 type searchResult struct {
-	Path     string             `json:"path"`
-	Metadata *epubproc.Metadata `json:"metadata,omitempty"`
-	Matches  []epubproc.Match   `json:"matches"`
+	Path                   string             `json:"path"`
+	Metadata               *epubproc.Metadata `json:"metadata,omitempty"`
+	Matches                []epubproc.Match   `json:"matches,omitempty"`
+	Files                  []fileMatches      `json:"files,omitempty"`
+	Sizes                  *bookSizes         `json:"sizes,omitempty"`
+	DistinctPatternMatches int                `json:"distinctPatternMatches,omitempty"`
+	ContentError           string             `json:"contentError,omitempty"`
+	Truncated              bool               `json:"truncated,omitempty"`
+	Repaired               bool               `json:"repaired,omitempty"`
+}
+
+// authorOutput represents search output grouped by author in JSON format
+type authorOutput struct {
+	Authors []authorResults `json:"authors"`
+	Summary summaryInfo     `json:"summary"`
+}
+
+// authorResults groups the results of the books by a single author
+type authorResults struct {
+	Author  string         `json:"author"`
+	Results []searchResult `json:"results"`
+}
+
+// errorOutput represents a failed search in JSON format
+type errorOutput struct {
+	Error string `json:"error"`
+}
+
+// streamedError is a search error that was already written to a streamed output as its "error" field, so it is not
+// written again as a second document
+type streamedError struct {
+	error
+}
+
+// Unwrap returns the search error
+func (e streamedError) Unwrap() error {
+	return e.error
+}
+
+// fileMatches groups the matches found in a single file inside an ePUB
+type fileMatches struct {
+	FileName string           `json:"fileName"`
+	Matches  []epubproc.Match `json:"matches"`
+}
+
+// bookSizes summarizes the compressed and uncompressed sizes of the content files in a book
+type bookSizes struct {
+	CompressedSize   uint64                `json:"compressedSize"`
+	UncompressedSize uint64                `json:"uncompressedSize"`
+	CompressionRatio float64               `json:"compressionRatio"`
+	Entries          []epubproc.EntryStats `json:"entries"`
 }
 
 // summaryInfo provides search result summary
 type summaryInfo struct {
-	TotalFiles   int `json:"totalFiles"`
-	TotalMatches int `json:"totalMatches"`
+	TotalFiles   int              `json:"totalFiles"`
+	TotalMatches int              `json:"totalMatches"`
+	PerPattern   []patternSummary `json:"perPattern,omitempty"`
+}
+
+// patternSummary provides the search result summary for a single pattern when several are given
+type patternSummary struct {
+	Pattern      string `json:"pattern"`
+	FilesMatched int    `json:"filesMatched"`
+	TotalMatches int    `json:"totalMatches"`
 }
 
 func main() {
@@ -64,6 +189,7 @@ func main() {
 // createRootCmd creates the root command with flags
 func createRootCmd(ctx context.Context) *cobra.Command {
 	flags := &searchFlags{}
+	var configPath string
 
 	rootCmd := &cobra.Command{
 		Use:   "epub-search",
@@ -80,11 +206,27 @@ Supports plain text and regex pattern matching with metadata extraction and filt
   epub-search search -d /path/to/epubs -p "text" --author "Author Name" --extract-metadata
 
   # Enable logging for debugging
-  epub-search search -d /path/to/epubs -p "text" --log-level info`,
+  epub-search search -d /path/to/epubs -p "text" --log-level info
+
+Flags not given on the command line default to the section of the command in the config file (--config,
+$EPUB_SEARCH_CONFIG or epub-search.yaml in the user config directory), then to EPUB_SEARCH_<COMMAND>_<FLAG>
+environment variables. The search command also defaults to the top-level keys of the config file and to
+EPUB_SEARCH_<FLAG> environment variables, which its own section and variables override.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			explicit := cmd.Flags().Changed("config")
+			if value, ok := os.LookupEnv(envName("", "config")); ok && !explicit {
+				configPath, explicit = value, true
+			}
+			return applyDefaults(cmd, configPath, explicit)
+		},
 	}
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", defaultConfigPath(), "Config file with flag defaults")
 
 	searchCmd := createSearchCmd(ctx, flags)
 	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(createVerifyCmd(ctx))
+	rootCmd.AddCommand(createDuplicatesCmd(ctx))
+	rootCmd.AddCommand(createDiffCmd())
 
 	return rootCmd
 }
@@ -92,12 +234,27 @@ Supports plain text and regex pattern matching with metadata extraction and filt
 // createSearchCmd creates the search command with flags
 func createSearchCmd(ctx context.Context, flags *searchFlags) *cobra.Command {
 	searchCmd := &cobra.Command{
-		Use:   "search",
+		Use:   "search [pattern]",
 		Short: "Search for text patterns in ePUB files",
 		Long: `Search for text patterns within ePUB files using plain text or regex matching.
+The pattern is given as the only argument, or with one or more --pattern flags.
 Supports concurrent processing, metadata extraction, and filtering options.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSearch(ctx, flags)
+			err := runSearch(ctx, cmd, flags, args)
+			if errors.As(err, new(streamedError)) {
+				// keep the usage text out of the output, which already ends with the error
+				cmd.SilenceUsage = true
+			} else if err != nil && flags.jsonErrors {
+				// keep the usage text out of the output, which must hold only the error object
+				cmd.SilenceUsage = true
+
+				// the error is still returned, so it is also printed to stderr and the exit code is nonzero
+				if outErr := outputJSON(cmd.OutOrStdout(), errorOutput{Error: err.Error()}, jsonIndent(flags.pretty, flags.indent), flags.jsonCase); outErr != nil {
+					log.Err(outErr).Msg("failed to write error output")
+				}
+			}
+			return err
 		},
 	}
 
@@ -108,165 +265,705 @@ Supports concurrent processing, metadata extraction, and filtering options.`,
 // setupSearchFlags configures flags for the search command
 func setupSearchFlags(cmd *cobra.Command, flags *searchFlags) {
 	// required flags
-	cmd.Flags().StringVarP(&flags.epubDir, "directory", "d", "", "Directory containing ePUB files (required)")
-	cmd.Flags().StringVarP(&flags.pattern, "pattern", "p", "", "Search pattern (required)")
+	cmd.Flags().StringVarP(&flags.epubDir, "directory", "d", "", "Directory containing ePUB files, or a single ePUB file (required unless --files-from is set)")
+	cmd.Flags().StringVar(&flags.filesFrom, "files-from", "", "Read newline-separated ePUB paths to search from a file, or '-' for stdin")
+	cmd.Flags().StringArrayVarP(&flags.patterns, "pattern", "p", nil, "Search pattern, instead of the positional argument (repeat to match any of several patterns)")
 
 	// search options
 	cmd.Flags().BoolVar(&flags.isRegex, "regex", false, "Treat pattern as regular expression")
 	cmd.Flags().BoolVarP(&flags.ignoreCase, "ignore-case", "i", false, "Case-insensitive search (text mode only)")
+	cmd.Flags().IntVar(&flags.fuzzy, "fuzzy", 0, "Match whole words within this edit distance (text mode only, slower)")
+	cmd.Flags().BoolVar(&flags.phrase, "phrase", false, "Match across line and block breaks, collapsing whitespace in each file")
+	cmd.Flags().BoolVar(&flags.document, "document", false, "Match across the whole book in reading order, with lines joined by newlines and . matching them")
 	cmd.Flags().IntVarP(&flags.context, "context", "c", 0, "Number of context lines around each match")
+	cmd.Flags().StringVar(&flags.contextJoiner, "context-joiner", "", "Separator between the lines of a match with context (default: newline)")
+	cmd.Flags().BoolVar(&flags.includeHTML, "include-html", false, "Include the original HTML of matching blocks")
+	cmd.Flags().BoolVar(&flags.highlight, "highlight", false, "Wrap each occurrence of the pattern in matched lines with markers")
+	cmd.Flags().StringVar(&flags.highlightStart, "highlight-start", "", "Marker inserted before each highlighted occurrence (default: \\x02)")
+	cmd.Flags().StringVar(&flags.highlightEnd, "highlight-end", "", "Marker inserted after each highlighted occurrence (default: \\x03)")
+	cmd.Flags().BoolVar(&flags.markHTML, "mark-html", false, "Include each matched line as escaped HTML with every occurrence of the pattern wrapped in <mark>")
 
 	// performance options
-	cmd.Flags().IntVarP(&flags.maxThreads, "threads", "t", runtime.NumCPU(), "Maximum number of worker threads")
+	flags.maxThreads = runtime.NumCPU()
+	cmd.Flags().VarP((*threadsValue)(&flags.maxThreads), "threads", "t", "Maximum number of worker threads, or auto to scale with IO")
+	cmd.Flags().IntVar(&flags.scanWorkers, "scan-workers", 0, "Number of workers scanning ePUB content (default: --threads)")
+	cmd.Flags().IntVar(&flags.metadataWorkers, "metadata-workers", 0, "Maximum concurrent metadata extractions (default: no extra limit)")
 	cmd.Flags().BoolVar(&flags.extractMetadata, "extract-metadata", false, "Extract and include metadata in results")
+	cmd.Flags().BoolVar(&flags.detectLanguage, "detect-language", false, "Guess the language of books without a dc:language from a sample of their text (requires --extract-metadata)")
+	cmd.Flags().BoolVar(&flags.preview, "preview", false, "Include the first 500 words of each book's text in its metadata (requires --extract-metadata)")
+	cmd.Flags().BoolVar(&flags.metadataOnly, "metadata-only-output", false, "Output only the path and metadata of matching books, without their matches (requires --extract-metadata)")
+	cmd.Flags().BoolVar(&flags.searchDesc, "search-description", false, "Also search each book's description (requires --extract-metadata)")
+	cmd.Flags().BoolVar(&flags.searchMeta, "search-metadata", false, "Also search each book's title, authors and series as one text (requires --extract-metadata)")
 
 	// filter options
-	cmd.Flags().StringVar(&flags.authorEquals, "author", "", "Filter by author (requires --extract-metadata)")
-	cmd.Flags().StringVar(&flags.seriesEquals, "series", "", "Filter by series (requires --extract-metadata)")
-	cmd.Flags().StringVar(&flags.titleEquals, "title", "", "Filter by title (requires --extract-metadata)")
+	cmd.Flags().StringVar(&flags.authorEquals, "author", "", "Filter by author (metadata is only included in the output with --extract-metadata)")
+	cmd.Flags().StringVar(&flags.seriesEquals, "series", "", "Filter by series (metadata is only included in the output with --extract-metadata)")
+	cmd.Flags().StringVar(&flags.titleEquals, "title", "", "Filter by title (metadata is only included in the output with --extract-metadata)")
+	cmd.Flags().StringVar(&flags.titleContains, "title-contains", "", "Filter by text contained in the title")
+	cmd.Flags().BoolVar(&flags.normalizeTitle, "normalize-title", false, "Compare titles without subtitles after a colon, punctuation or case")
+	cmd.Flags().BoolVar(&flags.strictWalk, "strict-walk", false, "Fail on unreadable directories instead of skipping them")
+	cmd.Flags().BoolVar(&flags.failFast, "fail-fast", false, "Stop at the first epub that cannot be read instead of skipping it")
+	cmd.Flags().Int64Var(&flags.maxBytes, "max-bytes-per-epub", 0, "Stop scanning an ePUB after this many decompressed content bytes, marking the result truncated (0 for no limit)")
+	cmd.Flags().IntVar(&flags.maxFiles, "max-files-per-epub", 0, "Only scan the first N content files of each ePUB, in reading order (0 for no limit)")
+	cmd.Flags().IntVar(&flags.spineFrom, "spine-from", 0, "Only scan files from this 1-based position of the reading order (spine) onward")
+	cmd.Flags().IntVar(&flags.spineTo, "spine-to", 0, "Only scan files up to this 1-based position of the reading order (spine)")
+	cmd.Flags().IntVar(&flags.maxBlockBytes, "max-block-bytes", 0, "Split HTML blocks longer than this, and stop scanning a file at any longer tag or text run (0 for no limit)")
+	cmd.Flags().IntVar(&flags.maxBlocks, "max-blocks", 0, "Stop scanning an HTML file after this many blocks, marking the result truncated (0 for no limit)")
+	cmd.Flags().StringVar(&flags.section, "section", "", "Search only the front matter or body of each book, located by its landmarks (all, front, body)")
+	cmd.Flags().IntVar(&flags.minLineLength, "min-line-length", 0, "Ignore matched lines shorter than this many characters, such as stray markup fragments (0 for no minimum)")
+	cmd.Flags().IntVar(&flags.openRetries, "open-retries", 0, "Retry opening ePUB files this many times after transient errors (e.g. network mounts)")
+	cmd.Flags().BoolVar(&flags.followSymlinks, "follow-symlinks", false, "Follow symlinked directories while searching the directory")
+	cmd.Flags().StringVar(&flags.modifiedSince, "modified-since", "", "Only search ePUBs modified since an RFC3339 time or a duration ago (e.g. 24h)")
+	cmd.Flags().IntVar(&flags.limitPerDir, "limit-per-directory", 0, "Search at most this many ePUBs in each directory, to sample a large library (0 for no limit)")
+	cmd.Flags().DurationVar(&flags.slowFile, "slow-file-threshold", 0, "Log a warning for each ePUB whose scan takes at least this long, e.g. 1s (0 to disable)")
 	cmd.Flags().StringSliceVar(&flags.filesIn, "files-in", nil, "Filter to specific ePUB files")
+	cmd.Flags().StringSliceVar(&flags.includeFiles, "include-internal", nil, "Only scan files inside each ePUB matching these globs (e.g. chapter*.xhtml)")
+	cmd.Flags().StringSliceVar(&flags.excludeFiles, "exclude-internal", nil, "Skip files inside each ePUB matching these globs (e.g. notes*.xhtml)")
+	cmd.Flags().BoolVar(&flags.ignoreGlobCase, "ignore-glob-case", false, "Match --include-internal and --exclude-internal globs regardless of case")
+	cmd.Flags().StringSliceVar(&flags.extraTextExts, "extra-text-ext", nil, "Also scan files inside each ePUB with these extensions as plain text (e.g. .css,.json)")
+	cmd.Flags().StringSliceVar(&flags.includeSkipped, "include-skipped", nil, "Also search files skipped by default in these categories (cover, navigation, legal, notes, extra, promo)")
+	cmd.Flags().StringSliceVar(&flags.promoKeywords, "promo-keywords", nil, "Words in file names that mark promotional files to skip (default: sample, advert, advertisement, promo, teaser)")
+	cmd.Flags().BoolVar(&flags.promoSubstring, "promo-substring", false, "Match --promo-keywords anywhere in file names instead of as whole words")
+	cmd.Flags().StringToStringVar(&flags.contentTypes, "content-type", nil, "Replace the scanned file types inside each ePUB with this mapping of extensions to text or html (e.g. .md=text,.svg=html)")
+	cmd.Flags().BoolVar(&flags.contentErrors, "content-errors", false, "Report books whose content could not be read instead of skipping them")
+
+	// pagination options
+	cmd.Flags().IntVar(&flags.offset, "offset", 0, "Skip this many results, in --sort order (path by default)")
+	cmd.Flags().IntVar(&flags.limit, "limit", 0, "Maximum number of results to return (0 for no limit)")
+	cmd.Flags().IntVar(&flags.minMatches, "min-matches", 0, "Skip books with fewer than this many matches (0 for no minimum)")
+	cmd.Flags().BoolVar(&flags.firstMatch, "first-match", false, "Report only the first match of each book in reading order")
+	cmd.Flags().StringVar(&flags.sortBy, "sort", "", "Sort results by path or relevance (most matches first)")
 
 	// output options
 	cmd.Flags().BoolVar(&flags.pretty, "pretty", false, "Pretty-print JSON output")
+	cmd.Flags().IntVar(&flags.indent, "indent", defaultIndent, "Spaces per indentation level of pretty-printed JSON (0 for compact output)")
+	cmd.Flags().StringVar(&flags.jsonCase, "json-case", jsonCaseCamel, "Naming convention of JSON field names (camel, snake)")
+	cmd.Flags().StringVar(&flags.format, "format", outputFormatJSON, "Output format (json, atom for a feed of the matching books)")
+	cmd.Flags().BoolVar(&flags.stream, "stream", false, "Write each result as soon as it is found instead of holding all results in memory")
+	cmd.Flags().BoolVar(&flags.readingOrder, "reading-order", false, "Order the matches of each ePUB by the spine (reading order) instead of the archive order")
+	cmd.Flags().BoolVar(&flags.dedupe, "dedupe", false, "Skip matches repeating the text of an earlier match in the same file")
+	cmd.Flags().BoolVar(&flags.repairText, "repair-text", false, "Repair invalid UTF-8 and mojibake in the text before matching")
+	cmd.Flags().BoolVar(&flags.percentage, "percentage", false, "Include the approximate position of each match through the book as a percentage")
+	cmd.Flags().BoolVar(&flags.mediaType, "media-type", false, "Include the media type of the file of each match")
+	cmd.Flags().BoolVar(&flags.groupByFile, "group-by-file", false, "Nest matches under the file inside each ePUB they were found in")
+	cmd.Flags().StringVar(&flags.groupBy, "group-by", "", "Group results by author (requires --extract-metadata)")
+	cmd.Flags().BoolVar(&flags.explain, "explain", false, "Print the effective compiled pattern to stderr before searching")
+	cmd.Flags().BoolVar(&flags.aggregate, "aggregate", false, "Report the total number of occurrences and a per-book count instead of matches")
+	cmd.Flags().BoolVar(&flags.jsonErrors, "json-errors", false, "Also write errors to stdout as a JSON object ({\"error\": \"...\"})")
+	cmd.Flags().BoolVar(&flags.analyze, "analyze", false, "Include compressed and uncompressed content sizes for each book with matches")
 
 	// logging options
 	cmd.Flags().StringVar(&flags.logLevel, "log-level", "warn", "Set logging level (disabled, error, warn, info, debug, trace)")
-
-	// required flags
-	if err := cmd.MarkFlagRequired("directory"); err != nil {
-		log.Err(err).Msg("failed to mark directory flag as required")
-	}
-	if err := cmd.MarkFlagRequired("pattern"); err != nil {
-		log.Err(err).Msg("failed to mark pattern flag as required")
-	}
 }
 
-// runSearch executes the search command with the provided flags
-func runSearch(ctx context.Context, flags *searchFlags) error {
+// runSearch executes the search command with the provided flags and positional arguments
+func runSearch(ctx context.Context, cmd *cobra.Command, flags *searchFlags, args []string) error {
 	// configure logging
 	configureLogging(flags.logLevel)
 
-	// validate that metadata extraction is enabled when using metadata filters
-	if (flags.authorEquals != "" || flags.seriesEquals != "" || flags.titleEquals != "") && !flags.extractMetadata {
-		return fmt.Errorf("metadata filters (--author, --series, --title) require --extract-metadata")
+	// the pattern is given positionally like grep, or with --pattern for scripts, but not both
+	if len(args) > 0 {
+		if len(flags.patterns) > 0 {
+			return fmt.Errorf("the pattern must be given either as an argument or with --pattern, not both")
+		}
+		flags.patterns = args
+	} else if len(flags.patterns) == 0 {
+		return fmt.Errorf("a pattern is required, as an argument or with --pattern")
 	}
 
-	// validate directory exists
-	if _, err := os.Stat(flags.epubDir); os.IsNotExist(err) {
+	if flags.indent < 0 {
+		return fmt.Errorf("invalid indent %d: must not be negative", flags.indent)
+	}
+	if err := validateJSONCase(flags.jsonCase); err != nil {
+		return err
+	}
+	modifiedSince, err := parseModifiedSince(flags.modifiedSince, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if flags.searchDesc && !flags.extractMetadata {
+		return fmt.Errorf("--search-description requires --extract-metadata")
+	}
+	if flags.searchMeta && !flags.extractMetadata {
+		return fmt.Errorf("--search-metadata requires --extract-metadata")
+	}
+	if flags.metadataOnly && !flags.extractMetadata {
+		return fmt.Errorf("--metadata-only-output requires --extract-metadata")
+	}
+	if flags.detectLanguage && !flags.extractMetadata {
+		return fmt.Errorf("--detect-language requires --extract-metadata")
+	}
+	if flags.preview && !flags.extractMetadata {
+		return fmt.Errorf("--preview requires --extract-metadata")
+	}
+	if err := validateOutputFormat(flags.format); err != nil {
+		return err
+	}
+	if flags.format == outputFormatAtom {
+		// a feed lists books, so it is written once every book has been found
+		switch {
+		case flags.stream:
+			return fmt.Errorf("--format atom cannot be combined with --stream")
+		case flags.aggregate:
+			return fmt.Errorf("--format atom cannot be combined with --aggregate")
+		case flags.groupBy != "":
+			return fmt.Errorf("--format atom cannot be combined with --group-by")
+		}
+	}
+	if flags.groupBy != "" {
+		if flags.groupBy != groupByAuthor {
+			return fmt.Errorf("invalid group by %q: must be %s", flags.groupBy, groupByAuthor)
+		}
+		if !flags.extractMetadata {
+			return fmt.Errorf("--group-by requires --extract-metadata")
+		}
+		if flags.stream {
+			return fmt.Errorf("--group-by cannot be combined with --stream")
+		}
+	}
+
+	// validate that fuzzy matching is only used with text patterns
+	if flags.fuzzy > 0 && flags.isRegex {
+		return fmt.Errorf("--fuzzy cannot be combined with --regex")
+	}
+	if flags.fuzzy > 0 && flags.phrase {
+		return fmt.Errorf("--fuzzy cannot be combined with --phrase")
+	}
+
+	// a file list replaces the directory walk
+	var files []string
+	if flags.filesFrom != "" {
+		var err error
+		if files, err = loadFileList(flags.filesFrom, cmd.InOrStdin()); err != nil {
+			return err
+		}
+	} else if flags.epubDir == "" {
+		return fmt.Errorf("--directory is required unless --files-from is set")
+	} else if _, err := os.Stat(flags.epubDir); os.IsNotExist(err) {
+		// validate directory exists
 		return fmt.Errorf("directory does not exist: %s", flags.epubDir)
 	}
 
+	// an empty file list has nothing to search, and must not fall back to walking a directory
+	if flags.filesFrom != "" && len(files) == 0 {
+		log.Warn().Str("files_from", flags.filesFrom).Msg("no ePUB paths to search")
+		if flags.format == outputFormatAtom {
+			return outputAtom(cmd.OutOrStdout(), nil, flags.patterns, time.Now())
+		}
+		return outputJSON(cmd.OutOrStdout(), searchOutput{Results: []searchResult{}}, jsonIndent(flags.pretty, flags.indent), flags.jsonCase)
+	}
+
 	// build search request
 	request := buildSearchRequest(flags)
+	request.Files = files
+	request.ModifiedSince = modifiedSince
+
+	if flags.explain {
+		explained, err := epubproc.ExplainQuery(request.Query)
+		if err != nil {
+			return fmt.Errorf("search failed: %w", err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "Effective pattern: %s\n", explained)
+	}
 
 	// create a file search instance
-	fileSearch := epubproc.NewFileSearch(flags.epubDir, flags.maxThreads, flags.extractMetadata)
+	searchOpts := []epubproc.FileSearchOption{
+		epubproc.WithScanWorkers(flags.scanWorkers),
+		epubproc.WithMetadataWorkers(flags.metadataWorkers),
+	}
+	if flags.detectLanguage {
+		searchOpts = append(searchOpts, epubproc.WithMetadataOptions(epubproc.WithLanguageDetection()))
+	}
+	if flags.preview {
+		searchOpts = append(searchOpts, epubproc.WithMetadataOptions(epubproc.WithPreview()))
+	}
+	fileSearch := epubproc.NewFileSearch(flags.epubDir, flags.maxThreads, flags.extractMetadata, searchOpts...)
+
+	// aggregate mode reports occurrence counts instead of matches
+	if flags.aggregate {
+		report, err := epubproc.CountOccurrences(ctx, fileSearch, request)
+		if err != nil {
+			return fmt.Errorf("search failed: %w", err)
+		}
+		return outputJSON(cmd.OutOrStdout(), report, jsonIndent(flags.pretty, flags.indent), flags.jsonCase)
+	}
 
 	startedAt := time.Now()
 	log.Debug().
 		Str("directory", flags.epubDir).
-		Str("pattern", flags.pattern).
+		Strs("patterns", flags.patterns).
 		Bool("regex", flags.isRegex).
 		Bool("extract_metadata", flags.extractMetadata).
 		Int("max_threads", flags.maxThreads).
 		Msg("starting ePUB search")
 
+	// with --stream, results are written as they are found instead of being held until the search completes
+	var stream *jsonArrayWriter
+	if flags.stream {
+		stream = newJSONArrayWriter(cmd.OutOrStdout(), "results", jsonIndent(flags.pretty, flags.indent), flags.jsonCase)
+	}
+
 	// collect results with pre-allocated capacity for improved performance
 	results := make([]searchResult, 0, 16)
-	var totalMatches int
+	summary := summaryInfo{}
+	if len(flags.patterns) > 1 {
+		summary.PerPattern = summarizePatterns(flags.patterns, nil)
+	}
 	var mu sync.Mutex
 
 	if err := fileSearch.Search(ctx, request, func(result *epubproc.SearchResult) error {
 		searchRes := searchResult{
-			Path:    result.Path,
-			Matches: result.Matches,
+			Path:                   result.Path,
+			Matches:                result.Matches,
+			DistinctPatternMatches: result.DistinctPatternMatches,
+			ContentError:           result.ContentError,
+			Truncated:              result.Truncated,
+			Repaired:               result.Repaired,
 		}
 
 		if flags.extractMetadata {
-			searchRes.Metadata = &result.Metadata
+			searchRes.Metadata = result.Metadata
+		}
+
+		if flags.analyze {
+			searchRes.Sizes = summarizeSizes(result.EntryStats)
 		}
 
 		mu.Lock()
-		results = append(results, searchRes)
-		totalMatches += len(result.Matches)
-		mu.Unlock()
+		defer mu.Unlock()
+
+		summary.TotalFiles++
+		summary.TotalMatches += len(result.Matches)
+		if summary.PerPattern != nil {
+			addPatternSummaries(summary.PerPattern, summarizePatterns(flags.patterns, []searchResult{searchRes}))
+		}
 
+		if flags.groupByFile {
+			searchRes.Files = groupMatchesByFile(searchRes.Matches)
+			searchRes.Matches = nil
+		}
+
+		// the matches are still counted in the summary, but only the catalog row of the book is output
+		if flags.metadataOnly {
+			searchRes.Matches = nil
+			searchRes.Files = nil
+		}
+
+		if stream != nil {
+			return stream.Write(searchRes)
+		}
+		results = append(results, searchRes)
 		return nil
 	}); err != nil {
-		return fmt.Errorf("search failed: %w", err)
+		err = fmt.Errorf("search failed: %w", err)
+		if stream == nil {
+			return err
+		}
+
+		// the results already written are kept, and the document is closed with the error instead of the summary
+		if closeErr := stream.Close("error", err.Error()); closeErr != nil {
+			log.Err(closeErr).Msg("failed to write error output")
+			return err
+		}
+		return streamedError{err}
 	}
 
 	log.Debug().
-		Int("files_with_matches", len(results)).
-		Int("total_matches", totalMatches).
+		Int("files_with_matches", summary.TotalFiles).
+		Int("total_matches", summary.TotalMatches).
 		Str("duration", time.Since(startedAt).String()).
 		Msg("ePUB search completed")
 
-	// process results and write output
+	if stream != nil {
+		return stream.Close("summary", summary)
+	}
+
+	if flags.format == outputFormatAtom {
+		return outputAtom(cmd.OutOrStdout(), results, flags.patterns, time.Now())
+	}
+
+	// grouping is applied once all results are collected, since a book is only complete when its result is
+	if flags.groupBy == groupByAuthor {
+		output := authorOutput{
+			Authors: groupResultsByAuthor(results),
+			Summary: summary,
+		}
+		return outputJSON(cmd.OutOrStdout(), output, jsonIndent(flags.pretty, flags.indent), flags.jsonCase)
+	}
+
+	// write the collected results
 	output := searchOutput{
 		Results: results,
-		Summary: summaryInfo{
-			TotalFiles:   len(results),
-			TotalMatches: totalMatches,
-		},
+		Summary: summary,
 	}
-	return outputJSON(output, flags.pretty)
+	return outputJSON(cmd.OutOrStdout(), output, jsonIndent(flags.pretty, flags.indent), flags.jsonCase)
 }
 
-// outputJSON marshals and outputs the search results as JSON
-func outputJSON(output searchOutput, pretty bool) error {
-	var jsonData []byte
-	var err error
+// loadFileList reads newline-separated ePUB paths from a file, or from stdin when the source is "-"
+func loadFileList(source string, stdin io.Reader) ([]string, error) {
+	if source == "-" {
+		return readFileList(stdin)
+	}
 
-	if pretty {
-		jsonData, err = json.MarshalIndent(output, "", "  ")
-	} else {
-		jsonData, err = json.Marshal(output)
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file list: %w", err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warn().Err(err).Str("file", source).Msg("failed to close file list")
+		}
+	}()
+
+	return readFileList(f)
+}
+
+// readFileList reads newline-separated paths, skipping blank lines
+func readFileList(r io.Reader) ([]string, error) {
+	var files []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if path := strings.TrimSpace(scanner.Text()); path != "" {
+			files = append(files, path)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+	return files, nil
+}
+
+// parseModifiedSince parses a --modified-since value, either an RFC3339 time or a duration before now such as 24h, and
+// returns the zero time for an empty value
+func parseModifiedSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return time.Time{}, fmt.Errorf("invalid modified since %q: must be an RFC3339 time or a duration like 24h", value)
+	}
+	return now.Add(-age), nil
+}
+
+// threadsValue is the value of --threads: a number of worker threads, or "auto" for epubproc.AutoThreads
+type threadsValue int
+
+// String returns the number of threads
+func (v *threadsValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+// Set parses a number of threads, resolving "auto" to a count that scales with IO
+func (v *threadsValue) Set(value string) error {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "auto") {
+		*v = threadsValue(epubproc.AutoThreads())
+		return nil
 	}
 
+	threads, err := strconv.Atoi(value)
 	if err != nil {
-		return fmt.Errorf("failed to marshal JSON output: %w", err)
+		return fmt.Errorf("invalid threads %q: must be a number or auto", value)
+	}
+	*v = threadsValue(threads)
+	return nil
+}
+
+// Type returns the name of the value type shown in help output
+func (v *threadsValue) Type() string {
+	return "threads"
+}
+
+// skipCategories converts the --include-skipped values to skip categories
+func skipCategories(values []string) []epubproc.SkipCategory {
+	categories := make([]epubproc.SkipCategory, 0, len(values))
+	for _, value := range values {
+		categories = append(categories, epubproc.SkipCategory(strings.ToLower(strings.TrimSpace(value))))
 	}
+	return categories
+}
 
-	fmt.Println(string(jsonData))
+// groupByAuthor is the --group-by value grouping results by the authors of their book
+const groupByAuthor = "author"
+
+// defaultIndent is the number of spaces per indentation level of pretty-printed JSON
+const defaultIndent = 2
+
+// jsonIndent returns the indentation width of the JSON output, or 0 for compact output
+func jsonIndent(pretty bool, indent int) int {
+	if !pretty {
+		return 0
+	}
+	return indent
+}
+
+// outputJSON marshals and writes the search output (or an error object) as JSON, indented by this many spaces per level
+// or compact when indent is 0, with its field names in the given JSON case
+func outputJSON(w io.Writer, output any, indent int, jsonCase string) error {
+	jsonData, err := marshalJSON(output, indent, "", jsonCase)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(w, string(jsonData)); err != nil {
+		return fmt.Errorf("failed to write JSON output: %w", err)
+	}
 	return nil
 }
 
+// marshalJSON marshals a value indented by this many spaces per level, with every line after the first starting with
+// prefix, or compact when indent is 0, with its field names in the given JSON case
+func marshalJSON(value any, indent int, prefix, jsonCase string) ([]byte, error) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON output: %w", err)
+	}
+
+	if jsonCase == jsonCaseSnake {
+		if jsonData, err = snakeCaseKeys(jsonData); err != nil {
+			return nil, err
+		}
+	}
+
+	if indent > 0 {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, jsonData, prefix, strings.Repeat(" ", indent)); err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON output: %w", err)
+		}
+		jsonData = indented.Bytes()
+	}
+	return jsonData, nil
+}
+
+// summarizeSizes totals the size statistics of the content files in a book
+func summarizeSizes(entries []epubproc.EntryStats) *bookSizes {
+	sizes := &bookSizes{
+		Entries: entries,
+	}
+
+	for _, entry := range entries {
+		sizes.CompressedSize += entry.CompressedSize
+		sizes.UncompressedSize += entry.UncompressedSize
+	}
+
+	if sizes.CompressedSize > 0 {
+		sizes.CompressionRatio = float64(sizes.UncompressedSize) / float64(sizes.CompressedSize)
+	}
+
+	return sizes
+}
+
 // buildSearchRequest constructs a SearchRequest from command-line flags
 func buildSearchRequest(flags *searchFlags) *epubproc.SearchRequest {
 	request := &epubproc.SearchRequest{
-		Context: flags.context,
+		Context:              flags.context,
+		ContextJoiner:        flags.contextJoiner,
+		SearchDescription:    flags.searchDesc,
+		SearchMetadata:       flags.searchMeta,
+		IncludeInternalGlobs: flags.includeFiles,
+		ExcludeInternalGlobs: flags.excludeFiles,
+		IgnoreGlobCase:       flags.ignoreGlobCase,
+		PhraseMode:           flags.phrase,
+		DocumentMode:         flags.document,
+		IncludeHTML:          flags.includeHTML,
+		ReadingOrder:         flags.readingOrder,
+		IncludePercentage:    flags.percentage,
+		IncludeMediaType:     flags.mediaType,
+		DedupeLines:          flags.dedupe,
+		RepairText:           flags.repairText,
+		Highlight:            flags.highlight,
+		HighlightStart:       flags.highlightStart,
+		HighlightEnd:         flags.highlightEnd,
+		MarkHTML:             flags.markHTML,
+		ExtraTextExtensions:  flags.extraTextExts,
+		ContentTypes:         flags.contentTypes,
+		IncludeSkipped:       skipCategories(flags.includeSkipped),
+		PromoKeywords:        flags.promoKeywords,
+		PromoSubstring:       flags.promoSubstring,
+		IncludeEntryStats:    flags.analyze,
+		ReportContentErrors:  flags.contentErrors,
+		StrictWalk:           flags.strictWalk,
+		FailFast:             flags.failFast,
+		FollowSymlinks:       flags.followSymlinks,
+		LimitPerDirectory:    flags.limitPerDir,
+		SlowFileThreshold:    flags.slowFile,
+		OpenRetries:          flags.openRetries,
+		MaxBytesPerEpub:      flags.maxBytes,
+		MaxFilesPerEpub:      flags.maxFiles,
+		SpineFrom:            flags.spineFrom,
+		SpineTo:              flags.spineTo,
+		MaxHTMLBlockBytes:    flags.maxBlockBytes,
+		MaxHTMLBlocks:        flags.maxBlocks,
+		MinLineLength:        flags.minLineLength,
+		Section:              epubproc.BookSection(flags.section),
+		Offset:               flags.offset,
+		Limit:                flags.limit,
+		MinMatches:           flags.minMatches,
+		FirstMatchOnly:       flags.firstMatch,
+		SortBy:               epubproc.ResultSort(flags.sortBy),
+	}
+
+	// several patterns are combined as sub-queries, so matches are tagged with the pattern they matched
+	if len(flags.patterns) == 1 {
+		request.Query = buildQuery(flags.patterns[0], flags)
+	} else {
+		for _, pattern := range flags.patterns {
+			request.Query.SubQueries = append(request.Query.SubQueries, buildQuery(pattern, flags))
+		}
+		request.Query.Combine = epubproc.CombineOr
+	}
+
+	// metadata filters read the metadata even when it is not extracted for the output
+	metadataFilters := flags.authorEquals != "" || flags.seriesEquals != "" || flags.titleEquals != "" || flags.titleContains != ""
+	if metadataFilters {
+		request.ExtractForFilter = true
+	}
+
+	// configure filters
+	if metadataFilters || len(flags.filesIn) > 0 {
+		request.Filters = &epubproc.SearchRequestFilters{
+			AuthorEquals:   flags.authorEquals,
+			SeriesEquals:   flags.seriesEquals,
+			TitleEquals:    flags.titleEquals,
+			TitleContains:  flags.titleContains,
+			NormalizeTitle: flags.normalizeTitle,
+			FilesIn:        flags.filesIn,
+		}
 	}
 
-	// configure search query as regex or plain text
+	return request
+}
+
+// buildQuery constructs a regex or plain text query for a single pattern
+func buildQuery(pattern string, flags *searchFlags) epubproc.SearchRequestQuery {
 	if flags.isRegex {
-		request.Query = epubproc.SearchRequestQuery{
+		return epubproc.SearchRequestQuery{
 			IsRegex: true,
 			Regex: &epubproc.SearchRequestRegex{
-				Pattern: flags.pattern,
+				Pattern: pattern,
 			},
 		}
-	} else {
-		request.Query = epubproc.SearchRequestQuery{
-			IsRegex: false,
-			Text: &epubproc.SearchRequestText{
-				Value:      flags.pattern,
-				IgnoreCase: flags.ignoreCase,
-			},
+	}
+
+	query := epubproc.SearchRequestQuery{
+		IsRegex: false,
+		Text: &epubproc.SearchRequestText{
+			Value:      pattern,
+			IgnoreCase: flags.ignoreCase,
+		},
+	}
+
+	if flags.fuzzy > 0 {
+		query.Text.Fuzzy = &epubproc.FuzzyConfig{MaxDistance: flags.fuzzy}
+	}
+
+	return query
+}
+
+// summarizePatterns counts the books and matches attributed to each pattern, in flag order
+func summarizePatterns(patterns []string, results []searchResult) []patternSummary {
+	summaries := make([]patternSummary, len(patterns))
+	for i, pattern := range patterns {
+		summaries[i].Pattern = pattern
+	}
+
+	for _, result := range results {
+		for i := range summaries {
+			var count int
+			for _, match := range result.Matches {
+				if slices.Contains(match.Patterns, summaries[i].Pattern) {
+					count++
+				}
+			}
+
+			if count > 0 {
+				summaries[i].FilesMatched++
+				summaries[i].TotalMatches += count
+			}
 		}
 	}
 
-	// configure filters
-	if flags.authorEquals != "" || flags.seriesEquals != "" || flags.titleEquals != "" || len(flags.filesIn) > 0 {
-		request.Filters = &epubproc.SearchRequestFilters{
-			AuthorEquals: flags.authorEquals,
-			SeriesEquals: flags.seriesEquals,
-			TitleEquals:  flags.titleEquals,
-			FilesIn:      flags.filesIn,
+	return summaries
+}
+
+// addPatternSummaries adds the counts of the per-pattern summaries of some results to running totals for the same patterns
+func addPatternSummaries(totals, summaries []patternSummary) {
+	for i := range totals {
+		totals[i].FilesMatched += summaries[i].FilesMatched
+		totals[i].TotalMatches += summaries[i].TotalMatches
+	}
+}
+
+// groupMatchesByFile groups matches by the file they were found in, keeping the order in which files first appear
+func groupMatchesByFile(matches []epubproc.Match) []fileMatches {
+	var groups []fileMatches
+	indexes := make(map[string]int)
+
+	for _, match := range matches {
+		i, ok := indexes[match.FileName]
+		if !ok {
+			i = len(groups)
+			indexes[match.FileName] = i
+			groups = append(groups, fileMatches{FileName: match.FileName})
 		}
+		groups[i].Matches = append(groups[i].Matches, match)
 	}
 
-	return request
+	return groups
+}
+
+// groupResultsByAuthor groups results under each author of their book, sorted by author in collation order (so "Émile"
+// sorts next to "Emile" rather than after "Zoë"), keeping the order of the results within each author. A book by several authors appears under each of them, and books without authors are
+// grouped under an empty author.
+func groupResultsByAuthor(results []searchResult) []authorResults {
+	groups := []authorResults{}
+	indexes := make(map[string]int)
+
+	for _, result := range results {
+		var authors []string
+		if result.Metadata != nil {
+			for _, author := range result.Metadata.Authors {
+				if author = strings.TrimSpace(author); !slices.Contains(authors, author) {
+					authors = append(authors, author)
+				}
+			}
+		}
+		if len(authors) == 0 {
+			authors = []string{""}
+		}
+
+		for _, author := range authors {
+			i, ok := indexes[author]
+			if !ok {
+				i = len(groups)
+				indexes[author] = i
+				groups = append(groups, authorResults{Author: author})
+			}
+			groups[i].Results = append(groups[i].Results, result)
+		}
+	}
+
+	authors := make([]string, 0, len(groups))
+	for _, group := range groups {
+		authors = append(authors, group.Author)
+	}
+	epubproc.SortFacetValues(authors, "")
+
+	sorted := make([]authorResults, 0, len(groups))
+	for _, author := range authors {
+		sorted = append(sorted, groups[indexes[author]])
+	}
+	return sorted
 }
 
 // configureLogging sets up zerolog based on the specified level
@@ -0,0 +1,1042 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jfenske89/go-epub-grep/pkg/epubproc"
+)
+
+// createTestEPUB creates a minimal ePUB with a single chapter for CLI tests
+func createTestEPUB(dir, filename, content string) (string, error) {
+	return createTestEPUBWithChapters(dir, filename, content)
+}
+
+// createTestEPUBWithChapters creates a minimal ePUB with chapter1.html, chapter2.html, etc. in order
+func createTestEPUBWithChapters(dir, filename string, chapters ...string) (string, error) {
+	epubPath := filepath.Join(dir, filename)
+
+	zipFile, err := os.Create(epubPath)
+	if err != nil {
+		return "", err
+	}
+	defer zipFile.Close()
+
+	writer := zip.NewWriter(zipFile)
+	defer writer.Close()
+
+	files := []struct{ name, content string }{
+		{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`},
+		{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Test Book</dc:title></metadata>
+</package>`},
+	}
+	for i, content := range chapters {
+		files = append(files, struct{ name, content string }{fmt.Sprintf("OEBPS/chapter%d.html", i+1), content})
+	}
+
+	for _, file := range files {
+		f, err := writer.Create(file.name)
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write([]byte(file.content)); err != nil {
+			return "", err
+		}
+	}
+
+	return epubPath, nil
+}
+
+// runCommand executes the root command with the given arguments and stdin, returning its output
+func runCommand(t *testing.T, stdin *bytes.Buffer, args ...string) searchOutput {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	rootCmd := createRootCmd(context.Background())
+	rootCmd.SetIn(stdin)
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetArgs(args)
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+
+	var output searchOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		t.Fatalf("Failed to parse output %q: %v", stdout.String(), err)
+	}
+	return output
+}
+
+// TestReadFileList tests reading newline-separated paths
+func TestReadFileList(t *testing.T) {
+	input := bytes.NewBufferString("a.epub\n\n  b.epub  \r\n\t\nc d.epub")
+
+	files, err := readFileList(input)
+	if err != nil {
+		t.Fatalf("readFileList failed: %v", err)
+	}
+
+	expected := []string{"a.epub", "b.epub", "c d.epub"}
+	if !slices.Equal(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
+
+// TestFilesFromStdin tests searching the paths piped to stdin
+func TestFilesFromStdin(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_files_from_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	book1, err := createTestEPUB(tempDir, "book1.epub", "<p>Holmes in book one.</p>")
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	book2, err := createTestEPUB(tempDir, "book2.epub", "<p>Holmes in book two.</p>")
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	if _, err := createTestEPUB(tempDir, "unlisted.epub", "<p>Holmes is not listed.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	t.Run("SearchesListedFiles", func(t *testing.T) {
+		stdin := bytes.NewBufferString(book1 + "\n\n" + filepath.Join(tempDir, "missing.epub") + "\n" + book2 + "\n")
+		output := runCommand(t, stdin, "search", "-p", "Holmes", "--files-from", "-", "--log-level", "disabled")
+
+		var paths []string
+		for _, result := range output.Results {
+			paths = append(paths, result.Path)
+		}
+		slices.Sort(paths)
+
+		expected := []string{book1, book2}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("Expected %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("EmptyList", func(t *testing.T) {
+		output := runCommand(t, bytes.NewBufferString("\n\n"), "search", "-p", "Holmes", "--files-from", "-", "--log-level", "disabled")
+		if len(output.Results) != 0 {
+			t.Errorf("Expected no results, got %d", len(output.Results))
+		}
+	})
+}
+
+// TestPerPatternSummary tests the summary breakdown when several patterns are given
+func TestPerPatternSummary(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_per_pattern_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{
+		"book1.epub": "<p>Holmes and Watson.</p><p>Holmes alone.</p>",
+		"book2.epub": "<p>Holmes again.</p>",
+		"book3.epub": "<p>Nobody here.</p>",
+	}
+	for name, content := range books {
+		if _, err := createTestEPUB(tempDir, name, content); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	output := runCommand(t, &bytes.Buffer{}, "search", "-d", tempDir, "-p", "Holmes", "-p", "Watson", "--log-level", "disabled")
+
+	if output.Summary.TotalFiles != 2 {
+		t.Errorf("Expected 2 files, got %d", output.Summary.TotalFiles)
+	}
+
+	expected := []patternSummary{
+		{Pattern: "Holmes", FilesMatched: 2, TotalMatches: 3},
+		{Pattern: "Watson", FilesMatched: 1, TotalMatches: 1},
+	}
+	if !slices.Equal(output.Summary.PerPattern, expected) {
+		t.Errorf("Expected per-pattern summary %+v, got %+v", expected, output.Summary.PerPattern)
+	}
+
+	// a single pattern has no breakdown
+	output = runCommand(t, &bytes.Buffer{}, "search", "-d", tempDir, "-p", "Holmes", "--log-level", "disabled")
+	if output.Summary.PerPattern != nil {
+		t.Errorf("Expected no per-pattern summary, got %+v", output.Summary.PerPattern)
+	}
+}
+
+// TestJSONErrors tests that failures are written to stdout as a JSON error object
+func TestJSONErrors(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "json_errors_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	run := func(args ...string) (string, error) {
+		var stdout bytes.Buffer
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(&stdout)
+		rootCmd.SetErr(io.Discard)
+		rootCmd.SetArgs(args)
+		err := rootCmd.Execute()
+		return stdout.String(), err
+	}
+
+	t.Run("BadRegex", func(t *testing.T) {
+		stdout, err := run("search", "-d", tempDir, "-p", "(unclosed", "--regex", "--json-errors")
+		if err == nil {
+			t.Fatal("Expected an error for an invalid regex")
+		}
+
+		var output errorOutput
+		if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+			t.Fatalf("Failed to parse output %q: %v", stdout, err)
+		}
+		if !strings.Contains(output.Error, "regex") {
+			t.Errorf("Expected error about the regex, got %q", output.Error)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		stdout, err := run("search", "-d", tempDir, "-p", "(unclosed", "--regex")
+		if err == nil {
+			t.Fatal("Expected an error for an invalid regex")
+		}
+		if strings.HasPrefix(stdout, "{") {
+			t.Errorf("Expected no error object, got %q", stdout)
+		}
+	})
+}
+
+// TestVerifyCommand tests the verify report for a valid and a corrupt ePUB
+func TestVerifyCommand(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "verify_cmd_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	validPath, err := createTestEPUB(tempDir, "valid.epub", "<p>Some content</p>")
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	corruptPath := filepath.Join(tempDir, "corrupt.epub")
+	if err := os.WriteFile(corruptPath, []byte("not a zip archive"), 0o644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	run := func(args ...string) string {
+		var stdout bytes.Buffer
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(&stdout)
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Command failed: %v", err)
+		}
+		return stdout.String()
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		var output verifyOutput
+		stdout := run("verify", "-d", tempDir)
+		if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+			t.Fatalf("Failed to parse output %q: %v", stdout, err)
+		}
+
+		if output.Summary.TotalFiles != 2 || output.Summary.CorruptFiles != 1 {
+			t.Errorf("Expected 2 files with 1 corrupt, got %+v", output.Summary)
+		}
+		for _, result := range output.Results {
+			switch result.Path {
+			case validPath:
+				if !result.OK {
+					t.Errorf("Expected valid ePUB to be ok, got %+v", result)
+				}
+			case corruptPath:
+				if result.OK || result.Error == "" {
+					t.Errorf("Expected corrupt ePUB to have an error, got %+v", result)
+				}
+			default:
+				t.Errorf("Unexpected result path %s", result.Path)
+			}
+		}
+	})
+
+	t.Run("Table", func(t *testing.T) {
+		stdout := run("verify", "-d", tempDir, "--format", "table")
+		if !strings.Contains(stdout, "corrupt  "+corruptPath) {
+			t.Errorf("Expected a corrupt row for %s, got %q", corruptPath, stdout)
+		}
+		if !strings.Contains(stdout, "ok       "+validPath) {
+			t.Errorf("Expected an ok row for %s, got %q", validPath, stdout)
+		}
+		if !strings.Contains(stdout, "2 files, 1 corrupt") {
+			t.Errorf("Expected a summary line, got %q", stdout)
+		}
+	})
+}
+
+// TestGroupByFile tests nesting matches under the internal file they were found in
+func TestGroupByFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_group_by_file_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	_, err = createTestEPUBWithChapters(tempDir, "book.epub",
+		"<p>Holmes arrives.</p><p>Holmes leaves.</p>",
+		"<p>Nobody here.</p>",
+		"<p>Holmes returns.</p>",
+	)
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	output := runCommand(t, &bytes.Buffer{}, "search", "-d", tempDir, "-p", "Holmes", "--group-by-file", "--log-level", "disabled")
+
+	if len(output.Results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(output.Results))
+	}
+	if output.Summary.TotalMatches != 3 {
+		t.Errorf("Expected 3 total matches, got %d", output.Summary.TotalMatches)
+	}
+
+	result := output.Results[0]
+	if result.Matches != nil {
+		t.Errorf("Expected no flat matches when grouping, got %v", result.Matches)
+	}
+
+	if len(result.Files) != 2 {
+		t.Fatalf("Expected 2 file groups, got %d", len(result.Files))
+	}
+
+	expected := []struct {
+		fileName string
+		lines    []string
+	}{
+		{"OEBPS/chapter1.html", []string{"Holmes arrives.", "Holmes leaves."}},
+		{"OEBPS/chapter3.html", []string{"Holmes returns."}},
+	}
+	for i, group := range result.Files {
+		if group.FileName != expected[i].fileName {
+			t.Errorf("Expected group %d for %s, got %s", i, expected[i].fileName, group.FileName)
+		}
+
+		var lines []string
+		for _, match := range group.Matches {
+			lines = append(lines, match.Line)
+		}
+		if !slices.Equal(lines, expected[i].lines) {
+			t.Errorf("Expected lines %v in %s, got %v", expected[i].lines, group.FileName, lines)
+		}
+	}
+}
+
+// TestAggregate tests reporting occurrence counts across books
+func TestAggregate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_aggregate_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{
+		"book1.epub": "<p>Holmes, Holmes and Holmes.</p><p>Watson.</p>",
+		"book2.epub": "<p>Holmes again.</p>",
+	}
+	for name, content := range books {
+		if _, err := createTestEPUB(tempDir, name, content); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	var stdout bytes.Buffer
+	rootCmd := createRootCmd(context.Background())
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetArgs([]string{"search", "-d", tempDir, "-p", "Holmes", "--aggregate", "--log-level", "disabled"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+
+	var report epubproc.OccurrenceReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse output %q: %v", stdout.String(), err)
+	}
+
+	expected := []epubproc.BookOccurrences{
+		{Path: filepath.Join(tempDir, "book1.epub"), Occurrences: 3},
+		{Path: filepath.Join(tempDir, "book2.epub"), Occurrences: 1},
+	}
+	if report.Total != 4 {
+		t.Errorf("Expected 4 occurrences, got %d", report.Total)
+	}
+	if !slices.Equal(report.Books, expected) {
+		t.Errorf("Expected %v, got %v", expected, report.Books)
+	}
+}
+
+// TestExplain tests printing the effective pattern to stderr
+func TestExplain(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_explain_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var stdout, stderr bytes.Buffer
+	rootCmd := createRootCmd(context.Background())
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	rootCmd.SetArgs([]string{"search", "-d", tempDir, "-p", "Mr. Holmes", "-i", "--explain", "--log-level", "disabled"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+
+	expected := "Effective pattern: (?i)Mr\\. Holmes\n"
+	if stderr.String() != expected {
+		t.Errorf("Expected stderr %q, got %q", expected, stderr.String())
+	}
+
+	var output searchOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		t.Errorf("Expected stdout to hold only JSON, got %q: %v", stdout.String(), err)
+	}
+}
+
+// TestHighlight tests wrapping occurrences in matched lines with custom markers
+func TestHighlight(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_highlight_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes and Watson met Holmes.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	output := runCommand(t, nil, "search", "-d", tempDir, "-p", "Holmes", "--highlight", "--highlight-start", "<<", "--highlight-end", ">>", "--log-level", "disabled")
+	if len(output.Results) != 1 || len(output.Results[0].Matches) != 1 {
+		t.Fatalf("Expected 1 result with 1 match, got %+v", output.Results)
+	}
+
+	expected := "<<Holmes>> and Watson met <<Holmes>>."
+	if line := output.Results[0].Matches[0].Line; line != expected {
+		t.Errorf("Expected %q, got %q", expected, line)
+	}
+}
+
+// TestPositionalPattern tests giving the pattern as an argument instead of with --pattern
+func TestPositionalPattern(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_positional_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes and Watson.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	t.Run("Positional", func(t *testing.T) {
+		output := runCommand(t, nil, "search", "-d", tempDir, "Watson", "--log-level", "disabled")
+		if output.Summary.TotalMatches != 1 {
+			t.Errorf("Expected 1 match, got %d", output.Summary.TotalMatches)
+		}
+	})
+
+	errorCases := []struct {
+		name string
+		args []string
+	}{
+		{name: "Both", args: []string{"-p", "Holmes", "Watson"}},
+		{name: "Neither", args: nil},
+		{name: "TooMany", args: []string{"Holmes", "Watson"}},
+	}
+
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			rootCmd := createRootCmd(context.Background())
+			rootCmd.SetOut(&stdout)
+			rootCmd.SetErr(&stderr)
+			rootCmd.SetArgs(append([]string{"search", "-d", tempDir, "--log-level", "disabled"}, tc.args...))
+			if err := rootCmd.Execute(); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// TestFilterWithoutExtractMetadata tests metadata filters without including metadata in the output
+func TestFilterWithoutExtractMetadata(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_filter_only_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes and Watson.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	t.Run("Matching", func(t *testing.T) {
+		output := runCommand(t, nil, "search", "-d", tempDir, "-p", "Holmes", "--title", "Test Book", "--log-level", "disabled")
+		if len(output.Results) != 1 {
+			t.Fatalf("Expected 1 result, got %d", len(output.Results))
+		}
+		if output.Results[0].Metadata != nil {
+			t.Errorf("Expected no metadata without --extract-metadata, got %+v", output.Results[0].Metadata)
+		}
+	})
+
+	t.Run("NotMatching", func(t *testing.T) {
+		output := runCommand(t, nil, "search", "-d", tempDir, "-p", "Holmes", "--title", "Other Book", "--log-level", "disabled")
+		if len(output.Results) != 0 {
+			t.Errorf("Expected no results, got %d", len(output.Results))
+		}
+	})
+}
+
+// TestMetadataOnlyOutput tests that only the path and metadata of matching books are output
+func TestMetadataOnlyOutput(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_metadata_only_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes and Watson.</p><p>Holmes again.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	if _, err := createTestEPUB(tempDir, "other.epub", "<p>Only Watson.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	modes := []struct {
+		name  string
+		extra []string
+	}{
+		{name: "Matches"},
+		{name: "GroupByFile", extra: []string{"--group-by-file"}},
+	}
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			args := append([]string{
+				"search", "-d", tempDir, "-p", "Holmes", "--extract-metadata", "--metadata-only-output", "--log-level", "disabled",
+			}, mode.extra...)
+			output := runCommand(t, nil, args...)
+
+			if len(output.Results) != 1 {
+				t.Fatalf("Expected 1 result, got %d", len(output.Results))
+			}
+			result := output.Results[0]
+			if result.Metadata == nil || result.Metadata.Title != "Test Book" {
+				t.Errorf("Expected the metadata of the book, got %+v", result.Metadata)
+			}
+			if len(result.Matches) != 0 || len(result.Files) != 0 {
+				t.Errorf("Expected no matches, got %+v and %+v", result.Matches, result.Files)
+			}
+			if output.Summary.TotalMatches != 2 {
+				t.Errorf("Expected 2 matches in the summary, got %d", output.Summary.TotalMatches)
+			}
+		})
+	}
+
+	t.Run("RequiresExtractMetadata", func(t *testing.T) {
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(io.Discard)
+		rootCmd.SetErr(io.Discard)
+		rootCmd.SetArgs([]string{"search", "-d", tempDir, "-p", "Holmes", "--metadata-only-output", "--log-level", "disabled"})
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "requires --extract-metadata") {
+			t.Errorf("Expected a requires --extract-metadata error, got %v", err)
+		}
+	})
+}
+
+// TestGroupResultsByAuthor tests grouping results under each author of their book, with books by overlapping authors
+func TestGroupResultsByAuthor(t *testing.T) {
+	book := func(path string, authors ...string) searchResult {
+		return searchResult{Path: path, Metadata: &epubproc.Metadata{Authors: authors}}
+	}
+	results := []searchResult{
+		book("study.epub", "Arthur Conan Doyle"),
+		book("anthology.epub", "Edgar Allan Poe", " Arthur Conan Doyle "),
+		book("raven.epub", "Edgar Allan Poe", "Edgar Allan Poe"),
+		book("anonymous.epub"),
+		{Path: "untagged.epub"},
+	}
+
+	groups := groupResultsByAuthor(results)
+
+	expected := map[string][]string{
+		"":                   {"anonymous.epub", "untagged.epub"},
+		"Arthur Conan Doyle": {"study.epub", "anthology.epub"},
+		"Edgar Allan Poe":    {"anthology.epub", "raven.epub"},
+	}
+	var authors []string
+	for _, group := range groups {
+		authors = append(authors, group.Author)
+
+		var paths []string
+		for _, result := range group.Results {
+			paths = append(paths, result.Path)
+		}
+		if !slices.Equal(paths, expected[group.Author]) {
+			t.Errorf("Expected %v under %q, got %v", expected[group.Author], group.Author, paths)
+		}
+	}
+	if expectedAuthors := []string{"", "Arthur Conan Doyle", "Edgar Allan Poe"}; !slices.Equal(authors, expectedAuthors) {
+		t.Errorf("Expected authors %q, got %q", expectedAuthors, authors)
+	}
+
+	// authors are sorted in collation order, ignoring case and accents before breaking ties with them
+	t.Run("Collation", func(t *testing.T) {
+		groups := groupResultsByAuthor([]searchResult{
+			book("a.epub", "Zoë Ward"),
+			book("b.epub", "émile Zola"),
+			book("c.epub", "Eve Adams"),
+			book("d.epub", "Emile Zola"),
+		})
+
+		var authors []string
+		for _, group := range groups {
+			authors = append(authors, group.Author)
+		}
+		if expected := []string{"Emile Zola", "émile Zola", "Eve Adams", "Zoë Ward"}; !slices.Equal(authors, expected) {
+			t.Errorf("Expected authors %q, got %q", expected, authors)
+		}
+	})
+}
+
+// TestGroupByValidation tests rejecting invalid --group-by values and unsupported combinations
+func TestGroupByValidation(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_group_by_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "InvalidValue", args: []string{"--group-by", "title", "--extract-metadata"}, expected: "invalid group by"},
+		{name: "RequiresExtractMetadata", args: []string{"--group-by", "author"}, expected: "requires --extract-metadata"},
+		{name: "Stream", args: []string{"--group-by", "author", "--extract-metadata", "--stream"}, expected: "cannot be combined with --stream"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rootCmd := createRootCmd(context.Background())
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetErr(io.Discard)
+			rootCmd.SetArgs(append([]string{"search", "-d", tempDir, "-p", "Holmes", "--log-level", "disabled"}, tc.args...))
+			if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected a %q error, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+// TestIndent tests the indentation width of pretty-printed output
+func TestIndent(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_indent_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes and Watson.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	output := func(args ...string) string {
+		var stdout bytes.Buffer
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(&stdout)
+		rootCmd.SetArgs(append([]string{"search", "-d", tempDir, "-p", "Holmes", "--log-level", "disabled"}, args...))
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Command failed: %v", err)
+		}
+		return stdout.String()
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "DefaultWidth", args: []string{"--pretty"}, expected: "{\n  \"results\": [\n    {\n"},
+		{name: "CustomWidth", args: []string{"--pretty", "--indent", "4"}, expected: "{\n    \"results\": [\n        {\n"},
+		{name: "ZeroWidth", args: []string{"--pretty", "--indent", "0"}, expected: "{\"results\":[{"},
+		{name: "WithoutPretty", args: []string{"--indent", "4"}, expected: "{\"results\":[{"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := output(tc.args...)
+			if !strings.HasPrefix(got, tc.expected) {
+				t.Errorf("Expected output starting with %q, got %q", tc.expected, got)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Errorf("Expected valid JSON, got %q", got)
+			}
+		})
+	}
+
+	t.Run("Negative", func(t *testing.T) {
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(&bytes.Buffer{})
+		rootCmd.SetErr(&bytes.Buffer{})
+		rootCmd.SetArgs([]string{"search", "-d", tempDir, "-p", "Holmes", "--pretty", "--indent", "-1"})
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "invalid indent") {
+			t.Errorf("Expected an invalid indent error, got %v", err)
+		}
+	})
+}
+
+// TestJSONCase tests renaming the JSON output fields to snake_case
+func TestJSONCase(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_json_case_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes and Watson.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	output := func(args ...string) string {
+		var stdout bytes.Buffer
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(&stdout)
+		rootCmd.SetArgs(append([]string{"search", "-d", tempDir, "-p", "Holmes", "--log-level", "disabled"}, args...))
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Command failed: %v", err)
+		}
+		return stdout.String()
+	}
+
+	t.Run("Snake", func(t *testing.T) {
+		got := output("--json-case", "snake", "--pretty")
+		for _, key := range []string{`"paragraph_index": 1`, `"file_name": "OEBPS/chapter1.html"`, `"total_files": 1`, `"total_matches": 1`} {
+			if !strings.Contains(got, key) {
+				t.Errorf("Expected output to contain %s, got %s", key, got)
+			}
+		}
+		if strings.Contains(got, "paragraphIndex") || strings.Contains(got, "totalFiles") {
+			t.Errorf("Expected no camelCase keys, got %s", got)
+		}
+		if !json.Valid([]byte(got)) {
+			t.Errorf("Expected valid JSON, got %q", got)
+		}
+	})
+
+	t.Run("CamelByDefault", func(t *testing.T) {
+		if got := output(); !strings.Contains(got, `"paragraphIndex":1`) {
+			t.Errorf("Expected camelCase keys, got %s", got)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(&bytes.Buffer{})
+		rootCmd.SetErr(&bytes.Buffer{})
+		rootCmd.SetArgs([]string{"search", "-d", tempDir, "-p", "Holmes", "--json-case", "kebab"})
+		if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "invalid JSON case") {
+			t.Errorf("Expected an invalid JSON case error, got %v", err)
+		}
+	})
+}
+
+// TestStream tests that streamed results form one JSON document identical to the buffered output
+func TestStream(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "cli_stream_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for i := 1; i <= 3; i++ {
+		if _, err := createTestEPUB(tempDir, fmt.Sprintf("book%d.epub", i), "<p>Holmes and Watson.</p><p>Holmes alone.</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	output := func(args ...string) string {
+		var stdout bytes.Buffer
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(&stdout)
+		rootCmd.SetArgs(append([]string{"search", "-d", tempDir, "-p", "Holmes", "-p", "Watson", "--sort", "path", "--log-level", "disabled"}, args...))
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Command failed: %v", err)
+		}
+		return stdout.String()
+	}
+
+	streamed := output("--stream", "--pretty")
+
+	// the output must decode as exactly one document
+	decoder := json.NewDecoder(strings.NewReader(streamed))
+	var parsed searchOutput
+	if err := decoder.Decode(&parsed); err != nil {
+		t.Fatalf("Failed to parse streamed output: %v", err)
+	}
+	if decoder.More() {
+		t.Errorf("Expected a single JSON document, got %s", streamed)
+	}
+	if len(parsed.Results) != 3 || parsed.Summary.TotalMatches != 6 || len(parsed.Summary.PerPattern) != 2 {
+		t.Errorf("Expected 3 results with 6 matches and 2 pattern summaries, got %+v", parsed)
+	}
+
+	if buffered := output("--pretty"); streamed != buffered {
+		t.Errorf("Expected streamed output to equal buffered output %q, got %q", buffered, streamed)
+	}
+
+	// a search failing after results were streamed still writes one document, ending with the error
+	t.Run("Failure", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(tempDir, "book4.epub"), []byte("not a zip archive"), 0o644); err != nil {
+			t.Fatalf("Failed to write corrupt ePUB: %v", err)
+		}
+		defer os.Remove(filepath.Join(tempDir, "book4.epub"))
+
+		var stdout bytes.Buffer
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(&stdout)
+		rootCmd.SetErr(io.Discard)
+		rootCmd.SetArgs([]string{
+			"search", "-d", tempDir, "-p", "Holmes", "-t", "1", "--stream", "--fail-fast", "--json-errors", "--log-level", "disabled",
+		})
+		if err := rootCmd.Execute(); err == nil {
+			t.Fatal("Expected the search to fail")
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(stdout.Bytes()))
+		var parsed struct {
+			Results []searchResult `json:"results"`
+			Summary *summaryInfo   `json:"summary"`
+			Error   string         `json:"error"`
+		}
+		if err := decoder.Decode(&parsed); err != nil {
+			t.Fatalf("Failed to parse streamed output %q: %v", stdout.String(), err)
+		}
+		if decoder.More() {
+			t.Errorf("Expected a single JSON document, got %s", stdout.String())
+		}
+		if len(parsed.Results) != 3 {
+			t.Errorf("Expected the 3 results found before the failure, got %d", len(parsed.Results))
+		}
+		if !strings.Contains(parsed.Error, "book4.epub") || parsed.Summary != nil {
+			t.Errorf("Expected an error about book4.epub and no summary, got %+v", parsed)
+		}
+	})
+}
+
+// TestParseModifiedSince tests parsing --modified-since as an RFC3339 time or a duration before now
+func TestParseModifiedSince(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{name: "Empty", value: "", expected: time.Time{}},
+		{name: "RFC3339", value: "2024-05-01T08:30:00Z", expected: time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)},
+		{name: "Duration", value: " 24h ", expected: now.Add(-24 * time.Hour)},
+		{name: "Negative", value: "-1h", wantErr: true},
+		{name: "Invalid", value: "yesterday", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseModifiedSince(test.value, now)
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "invalid modified since") {
+					t.Errorf("Expected an invalid modified since error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseModifiedSince failed: %v", err)
+			}
+			if !got.Equal(test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+// TestDuplicatesCommand tests reporting the identifiers of a library as JSON
+func TestDuplicatesCommand(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "duplicates_cmd_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// the test books have no identifiers, so nothing is reported as a duplicate
+	for _, name := range []string{"a.epub", "b.epub"} {
+		if _, err := createTestEPUB(tempDir, name, "<p>Some content</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	var stdout bytes.Buffer
+	rootCmd := createRootCmd(context.Background())
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetArgs([]string{"duplicates", "-d", tempDir, "--log-level", "disabled"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+
+	var report epubproc.IdentifierReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse output %q: %v", stdout.String(), err)
+	}
+	if report.Duplicates == nil || len(report.Duplicates) != 0 {
+		t.Errorf("Expected an empty list of duplicates, got %q", stdout.String())
+	}
+}
+
+// TestDiffCommand tests comparing saved search outputs by book path
+func TestDiffCommand(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "diff_cmd_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// the current search was saved with snake case keys and matches grouped by file
+	files := map[string]string{
+		"baseline.json": `{"results": [
+			{"path": "a.epub", "matches": [{"line": "one"}, {"line": "two"}]},
+			{"path": "b.epub", "matches": [{"line": "one"}]},
+			{"path": "c.epub", "matches": [{"line": "one"}, {"line": "two"}, {"line": "three"}]}
+		], "summary": {"totalFiles": 3, "totalMatches": 6}}`,
+		"current.json": `{"results": [
+			{"path": "a.epub", "files": [{"file_name": "one.xhtml", "matches": [{"line": "one"}]}, {"file_name": "two.xhtml", "matches": [{"line": "two"}]}]},
+			{"path": "b.epub", "matches": [{"line": "one"}, {"line": "two"}, {"line": "three"}, {"line": "four"}]},
+			{"path": "d.epub", "matches": [{"line": "one"}]}
+		], "summary": {"total_files": 3, "total_matches": 7}}`,
+		"failed.json": `{"error": "directory does not exist: /missing"}`,
+		"unreadable.json": `{"results": [
+			{"path": "a.epub", "matches": [{"line": "one"}, {"line": "two"}]},
+			{"path": "b.epub", "content_error": "zip: not a valid zip file"}
+		]}`,
+		"metadata.json": `{"results": [
+			{"path": "a.epub", "metadata": {"title": "A"}},
+			{"path": "b.epub", "metadata": {"title": "B"}}
+		]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	diff := func(baseline, current string) (diffOutput, error) {
+		var stdout bytes.Buffer
+		rootCmd := createRootCmd(context.Background())
+		rootCmd.SetOut(&stdout)
+		rootCmd.SetErr(io.Discard)
+		rootCmd.SetArgs([]string{
+			"diff", "--baseline", filepath.Join(tempDir, baseline), "--current", filepath.Join(tempDir, current),
+			"--log-level", "disabled",
+		})
+		if err := rootCmd.Execute(); err != nil {
+			return diffOutput{}, err
+		}
+
+		var output diffOutput
+		if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+			t.Fatalf("Failed to parse output %q: %v", stdout.String(), err)
+		}
+		return output, nil
+	}
+
+	t.Run("Changes", func(t *testing.T) {
+		output, err := diff("baseline.json", "current.json")
+		if err != nil {
+			t.Fatalf("Command failed: %v", err)
+		}
+
+		if expected := []bookDiff{{Path: "d.epub", CurrentMatches: 1, Delta: 1}}; !slices.Equal(output.Added, expected) {
+			t.Errorf("Expected added %v, got %v", expected, output.Added)
+		}
+		if expected := []bookDiff{{Path: "c.epub", BaselineMatches: 3, Delta: -3}}; !slices.Equal(output.Removed, expected) {
+			t.Errorf("Expected removed %v, got %v", expected, output.Removed)
+		}
+		if expected := []bookDiff{{Path: "b.epub", BaselineMatches: 1, CurrentMatches: 4, Delta: 3}}; !slices.Equal(output.Changed, expected) {
+			t.Errorf("Expected changed %v, got %v", expected, output.Changed)
+		}
+
+		expected := diffSummary{
+			BaselineFiles: 3, CurrentFiles: 3, BaselineMatches: 6, CurrentMatches: 7,
+			Added: 1, Removed: 1, Changed: 1, Unchanged: 1,
+		}
+		if output.Summary != expected {
+			t.Errorf("Expected summary %+v, got %+v", expected, output.Summary)
+		}
+	})
+
+	t.Run("Identical", func(t *testing.T) {
+		output, err := diff("baseline.json", "baseline.json")
+		if err != nil {
+			t.Fatalf("Command failed: %v", err)
+		}
+		if len(output.Added) != 0 || len(output.Removed) != 0 || len(output.Changed) != 0 || output.Summary.Unchanged != 3 {
+			t.Errorf("Expected no differences, got %+v", output)
+		}
+	})
+
+	t.Run("FailedSearch", func(t *testing.T) {
+		if _, err := diff("baseline.json", "failed.json"); err == nil || !strings.Contains(err.Error(), "failed search") {
+			t.Errorf("Expected a failed search error, got %v", err)
+		}
+	})
+
+	t.Run("ContentError", func(t *testing.T) {
+		output, err := diff("baseline.json", "unreadable.json")
+		if err != nil {
+			t.Fatalf("Command failed: %v", err)
+		}
+		if expected := []bookDiff{{Path: "b.epub", BaselineMatches: 1, Delta: -1}}; !slices.Equal(output.Changed, expected) {
+			t.Errorf("Expected changed %v, got %v", expected, output.Changed)
+		}
+	})
+
+	t.Run("MetadataOnly", func(t *testing.T) {
+		if _, err := diff("baseline.json", "metadata.json"); err == nil || !strings.Contains(err.Error(), "--metadata-only-output") {
+			t.Errorf("Expected a metadata-only output error, got %v", err)
+		}
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		if _, err := diff("missing.json", "current.json"); err == nil {
+			t.Error("Expected an error for a missing file")
+		}
+	})
+}
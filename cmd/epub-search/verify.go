@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/jfenske89/go-epub-grep/pkg/epubproc"
+)
+
+// verifyFlags holds command-line flags for the verify command
+type verifyFlags struct {
+	epubDir  string
+	format   string
+	pretty   bool
+	indent   int
+	jsonCase string
+	logLevel string
+}
+
+// verifyOutput represents verify output in JSON format
+type verifyOutput struct {
+	Results []epubproc.VerifyResult `json:"results"`
+	Summary verifySummary           `json:"summary"`
+}
+
+// verifySummary provides the verify result summary
+type verifySummary struct {
+	TotalFiles   int `json:"totalFiles"`
+	CorruptFiles int `json:"corruptFiles"`
+}
+
+// createVerifyCmd creates the verify command with flags
+func createVerifyCmd(ctx context.Context) *cobra.Command {
+	flags := &verifyFlags{}
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check ePUB files for corruption",
+		Long: `Check that each ePUB file can be opened and that its package file can be located and parsed,
+without searching its content. Every file is reported as ok or corrupt.`,
+		Example: `  # Report the integrity of a library as JSON
+  epub-search verify -d /path/to/epubs
+
+  # Report the integrity of a library as a table
+  epub-search verify -d /path/to/epubs --format table`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerify(ctx, cmd, flags)
+		},
+	}
+
+	verifyCmd.Flags().StringVarP(&flags.epubDir, "directory", "d", "", "Directory containing ePUB files (required)")
+	verifyCmd.Flags().StringVar(&flags.format, "format", "json", "Output format (json, table)")
+	verifyCmd.Flags().BoolVar(&flags.pretty, "pretty", false, "Pretty-print JSON output")
+	verifyCmd.Flags().IntVar(&flags.indent, "indent", defaultIndent, "Spaces per indentation level of pretty-printed JSON (0 for compact output)")
+	verifyCmd.Flags().StringVar(&flags.jsonCase, "json-case", jsonCaseCamel, "Naming convention of JSON field names (camel, snake)")
+	verifyCmd.Flags().StringVar(&flags.logLevel, "log-level", "warn", "Set logging level (disabled, error, warn, info, debug, trace)")
+
+	// required flags
+	if err := verifyCmd.MarkFlagRequired("directory"); err != nil {
+		log.Err(err).Msg("failed to mark directory flag as required")
+	}
+
+	return verifyCmd
+}
+
+// runVerify executes the verify command with the provided flags
+func runVerify(ctx context.Context, cmd *cobra.Command, flags *verifyFlags) error {
+	configureLogging(flags.logLevel)
+
+	if flags.format != "json" && flags.format != "table" {
+		return fmt.Errorf("invalid format %q: must be json or table", flags.format)
+	}
+	if flags.indent < 0 {
+		return fmt.Errorf("invalid indent %d: must not be negative", flags.indent)
+	}
+	if err := validateJSONCase(flags.jsonCase); err != nil {
+		return err
+	}
+
+	// validate directory exists
+	if _, err := os.Stat(flags.epubDir); os.IsNotExist(err) {
+		return fmt.Errorf("directory does not exist: %s", flags.epubDir)
+	}
+
+	output := verifyOutput{Results: []epubproc.VerifyResult{}}
+	if err := epubproc.VerifyDirectory(ctx, flags.epubDir, func(result *epubproc.VerifyResult) error {
+		output.Results = append(output.Results, *result)
+		if !result.OK {
+			output.Summary.CorruptFiles++
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("verify failed: %w", err)
+	}
+	output.Summary.TotalFiles = len(output.Results)
+
+	if flags.format == "table" {
+		return outputVerifyTable(cmd.OutOrStdout(), output)
+	}
+	return outputJSON(cmd.OutOrStdout(), output, jsonIndent(flags.pretty, flags.indent), flags.jsonCase)
+}
+
+// outputVerifyTable writes the verify results as a table with one row per file
+func outputVerifyTable(w io.Writer, output verifyOutput) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	if _, err := fmt.Fprintln(tw, "STATUS\tPATH\tERROR"); err != nil {
+		return fmt.Errorf("failed to write table output: %w", err)
+	}
+	for _, result := range output.Results {
+		status := "ok"
+		if !result.OK {
+			status = "corrupt"
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", status, result.Path, result.Error); err != nil {
+			return fmt.Errorf("failed to write table output: %w", err)
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write table output: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(w, "\n%d files, %d corrupt\n", output.Summary.TotalFiles, output.Summary.CorruptFiles); err != nil {
+		return fmt.Errorf("failed to write table output: %w", err)
+	}
+	return nil
+}
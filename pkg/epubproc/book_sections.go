@@ -0,0 +1,151 @@
+package epubproc
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/html"
+)
+
+// bodyLandmarks are the EPUB3 landmark and EPUB2 guide types marking the start of the body of a book.
+var bodyLandmarks = []string{"bodymatter", "text"}
+
+// backLandmarks are the EPUB3 landmark and EPUB2 guide types marking back matter, which ends the body of a book.
+var backLandmarks = []string{
+	"backmatter", "appendix", "index", "glossary", "bibliography", "colophon", "notes", "endnotes", "rearnotes",
+}
+
+// landmark is a structural part of a book named by the nav document or guide, with the archive path it starts in.
+type landmark struct {
+	kind   string
+	target string
+}
+
+// validateSection checks that a book section is one of the supported sections.
+func validateSection(section BookSection) error {
+	switch section {
+	case "", SectionAll, SectionFront, SectionBody:
+		return nil
+	default:
+		return fmt.Errorf("invalid book section '%s': must be %s, %s or %s", section, SectionAll, SectionFront, SectionBody)
+	}
+}
+
+// sectionFiles maps the archive path of each spine file of a book section to its 0-based reading order position, or
+// returns nil when the epub has no readable spine or lacks the landmarks bounding the section.
+func sectionFiles(r *zip.Reader, section BookSection) map[string]int {
+	opfPath, opfData, err := readPackage(r)
+	if err != nil {
+		log.Debug().Err(err).Msg("no readable spine, ignoring the book section")
+		return nil
+	}
+	positions := packageSpinePositions(opfPath, opfData)
+	if positions == nil {
+		return nil
+	}
+
+	// the body starts at its earliest landmark, and ends at the first back matter after that
+	bodyStart, backStart := -1, -1
+	landmarks := findLandmarks(r, opfPath, opfData)
+	for _, mark := range landmarks {
+		if pos, ok := positions[mark.target]; ok && slices.Contains(bodyLandmarks, mark.kind) && (bodyStart < 0 || pos < bodyStart) {
+			bodyStart = pos
+		}
+	}
+	for _, mark := range landmarks {
+		if pos, ok := positions[mark.target]; ok && slices.Contains(backLandmarks, mark.kind) && pos > bodyStart &&
+			(backStart < 0 || pos < backStart) {
+			backStart = pos
+		}
+	}
+
+	from, to := 0, len(positions)
+	switch section {
+	case SectionFront:
+		if bodyStart < 0 {
+			return nil
+		}
+		to = bodyStart
+	case SectionBody:
+		if bodyStart < 0 && backStart < 0 {
+			return nil
+		}
+		from = max(bodyStart, 0)
+		if backStart >= 0 {
+			to = backStart
+		}
+	}
+
+	files := make(map[string]int, to-from)
+	for name, pos := range positions {
+		if pos >= from && pos < to {
+			files[name] = pos
+		}
+	}
+	return files
+}
+
+// findLandmarks returns the landmarks of the EPUB2 guide and the EPUB3 nav document of an epub, with their targets
+// resolved to archive paths without fragments.
+func findLandmarks(r *zip.Reader, opfPath string, opfData *opfPackageFile) []landmark {
+	opfDir := path.Dir(opfPath)
+
+	var landmarks []landmark
+	for _, reference := range opfData.Guide {
+		target, _, _ := strings.Cut(resolveHref(opfDir, reference.Href), "#")
+		landmarks = append(landmarks, landmark{kind: strings.ToLower(strings.TrimSpace(reference.Type)), target: target})
+	}
+
+	navPath, isNCX := findNavPath(opfPath, opfData)
+	if navPath == "" || isNCX {
+		return landmarks
+	}
+	navFile := findZipFile(r, navPath)
+	if navFile == nil {
+		return landmarks
+	}
+
+	rc, err := navFile.Open()
+	if err != nil {
+		log.Debug().Err(err).Str("file", navPath).Msg("failed to open nav document for landmarks")
+		return landmarks
+	}
+	defer func() {
+		if err := rc.Close(); err != nil {
+			log.Warn().Err(err).Str("file", navPath).Msg("failed to close nav document")
+		}
+	}()
+
+	doc, err := html.Parse(rc)
+	if err != nil {
+		log.Debug().Err(err).Str("file", navPath).Msg("failed to parse nav document for landmarks")
+		return landmarks
+	}
+
+	navDir := path.Dir(navPath)
+	var walk func(n *html.Node, inLandmarks bool)
+	walk = func(n *html.Node, inLandmarks bool) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "nav":
+				inLandmarks = containsField(nodeAttr(n, "epub:type"), "landmarks")
+			case n.Data == "a" && inLandmarks:
+				target, _, _ := strings.Cut(resolveHref(navDir, nodeAttr(n, "href")), "#")
+				for _, kind := range strings.Fields(nodeAttr(n, "epub:type")) {
+					landmarks = append(landmarks, landmark{kind: kind, target: target})
+				}
+			}
+		}
+
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child, inLandmarks)
+		}
+	}
+	walk(doc, false)
+
+	return landmarks
+}
@@ -0,0 +1,121 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// TestGrepInEpubSection tests restricting a scan to the front matter or body located by EPUB3 landmarks or an EPUB2 guide
+func TestGrepInEpubSection(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "book_section_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// createEPUB creates a book with a foreword, two chapters and two back matter files in the spine, plus a file outside it
+	createEPUB := func(name, manifestExtra, guide, nav string) string {
+		opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Sections</dc:title></metadata>
+  <manifest>
+    <item id="foreword" href="text/foreword.xhtml" media-type="application/xhtml+xml"/>
+    <item id="one" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="two" href="text/two.xhtml" media-type="application/xhtml+xml"/>
+    <item id="index" href="text/back-index.xhtml" media-type="application/xhtml+xml"/>
+    <item id="credits" href="text/credits.xhtml" media-type="application/xhtml+xml"/>
+    ` + manifestExtra + `
+  </manifest>
+  <spine>
+    <itemref idref="foreword"/><itemref idref="one"/><itemref idref="two"/><itemref idref="index"/><itemref idref="credits"/>
+  </spine>
+  ` + guide + `
+</package>`
+
+		entries := [][2]string{
+			{"META-INF/container.xml", tocContainerXML},
+			{"OEBPS/content.opf", opf},
+			{"OEBPS/text/foreword.xhtml", "<p>Holmes in the foreword.</p>"},
+			{"OEBPS/text/one.xhtml", "<p>Holmes in chapter one.</p>"},
+			{"OEBPS/text/two.xhtml", "<p>Holmes in chapter two.</p>"},
+			{"OEBPS/text/back-index.xhtml", "<p>Holmes, Sherlock, 1, 2.</p>"},
+			{"OEBPS/text/credits.xhtml", "<p>Holmes in the credits.</p>"},
+			{"OEBPS/text/loose.xhtml", "<p>Holmes outside the spine.</p>"},
+		}
+		if nav != "" {
+			entries = append(entries, [2]string{"OEBPS/nav.xhtml", nav})
+		}
+
+		epubPath := filepath.Join(tempDir, name)
+		if err := createOrderedTestZIP(epubPath, entries); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+		return epubPath
+	}
+
+	nav := `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><body>
+  <nav epub:type="toc"><ol><li><a href="text/back-index.xhtml">Index</a></li></ol></nav>
+  <nav epub:type="landmarks"><ol>
+    <li><a epub:type="bodymatter" href="text/one.xhtml#start">Start</a></li>
+    <li><a epub:type="backmatter" href="text/back-index.xhtml">Back matter</a></li>
+  </ol></nav>
+</body></html>`
+	epub3 := createEPUB("epub3.epub", `<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`, "", nav)
+	epub2 := createEPUB("epub2.epub", "", `<guide>
+    <reference type="text" href="text/one.xhtml"/>
+    <reference type="index" href="text/back-index.xhtml"/>
+  </guide>`, "")
+	plain := createEPUB("plain.epub", "", "", "")
+
+	all := []string{
+		"OEBPS/text/back-index.xhtml", "OEBPS/text/credits.xhtml", "OEBPS/text/foreword.xhtml", "OEBPS/text/loose.xhtml",
+		"OEBPS/text/one.xhtml", "OEBPS/text/two.xhtml",
+	}
+	tests := []struct {
+		name     string
+		path     string
+		section  BookSection
+		expected []string
+	}{
+		{name: "EPUB3/All", path: epub3, section: SectionAll, expected: all},
+		{name: "EPUB3/Body", path: epub3, section: SectionBody, expected: []string{"OEBPS/text/one.xhtml", "OEBPS/text/two.xhtml"}},
+		{name: "EPUB3/Front", path: epub3, section: SectionFront, expected: []string{"OEBPS/text/foreword.xhtml"}},
+		{name: "EPUB2/Body", path: epub2, section: SectionBody, expected: []string{"OEBPS/text/one.xhtml", "OEBPS/text/two.xhtml"}},
+		{name: "EPUB2/Front", path: epub2, section: SectionFront, expected: []string{"OEBPS/text/foreword.xhtml"}},
+		{name: "NoLandmarks/Body", path: plain, section: SectionBody, expected: all},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, _, err := grepInEpub(context.Background(), tt.path, regexp.MustCompile("Holmes"), scanOptions{section: tt.section}, nil)
+			if err != nil {
+				t.Fatalf("grepInEpub failed: %v", err)
+			}
+
+			var files []string
+			for _, match := range matches {
+				files = append(files, match.FileName)
+			}
+			slices.Sort(files)
+			if !slices.Equal(files, tt.expected) {
+				t.Errorf("Expected matches in %v, got %v", tt.expected, files)
+			}
+		})
+	}
+}
+
+// TestValidateSection tests accepting only the supported book sections
+func TestValidateSection(t *testing.T) {
+	for _, section := range []BookSection{"", SectionAll, SectionFront, SectionBody} {
+		if err := validateSection(section); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", section, err)
+		}
+	}
+	if err := validateSection("appendix"); err == nil {
+		t.Error("Expected an error for an unsupported section")
+	}
+}
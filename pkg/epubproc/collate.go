@@ -0,0 +1,29 @@
+package epubproc
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// SortFacetValues sorts facet values, such as author or series names for a browse UI, in the collation order of a
+// locale (a BCP 47 tag like "sv", or "" for the language-neutral order). Letters are compared before case and accents,
+// so "Ángel" sorts right after "Angel" instead of after "Zoe", and values the collation considers equal keep a stable
+// byte order.
+func SortFacetValues(values []string, locale string) {
+	tag := language.Und
+	if locale != "" {
+		tag = language.Make(locale)
+	}
+
+	// a collator holds buffers, so each sort gets its own to be safe for concurrent use
+	collator := collate.New(tag)
+	slices.SortStableFunc(values, func(a, b string) int {
+		if order := collator.CompareString(a, b); order != 0 {
+			return order
+		}
+		return strings.Compare(a, b)
+	})
+}
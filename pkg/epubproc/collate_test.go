@@ -0,0 +1,30 @@
+package epubproc
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestSortFacetValues tests sorting accented and differently cased names in collation order
+func TestSortFacetValues(t *testing.T) {
+	t.Run("Neutral", func(t *testing.T) {
+		values := []string{"Zoë", "Émile", "Ángel", "bob", "Angel", "Eve", "angel", "Ångström", "Ängel"}
+		SortFacetValues(values, "")
+
+		expected := []string{"angel", "Angel", "Ángel", "Ängel", "Ångström", "bob", "Émile", "Eve", "Zoë"}
+		if !slices.Equal(values, expected) {
+			t.Errorf("Expected %q, got %q", expected, values)
+		}
+	})
+
+	// Swedish sorts å and ä as letters of their own after z
+	t.Run("Locale", func(t *testing.T) {
+		values := []string{"Ängel", "Zoë", "Angel", "Ångström"}
+		SortFacetValues(values, "sv")
+
+		expected := []string{"Angel", "Zoë", "Ångström", "Ängel"}
+		if !slices.Equal(values, expected) {
+			t.Errorf("Expected %q, got %q", expected, values)
+		}
+	})
+}
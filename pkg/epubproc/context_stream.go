@@ -0,0 +1,144 @@
+package epubproc
+
+import "strings"
+
+// contextLine is a line of a file held while building context windows, with its raw HTML (if enabled), the byte
+// offset where it starts (if percentages are computed) and whether it matched the pattern.
+type contextLine struct {
+	text    string
+	html    string
+	offset  int64
+	matched bool
+}
+
+// contextStream groups lines into context windows as they are read, producing the same windows as
+// buildContextWindows without retaining the whole file. Only the open window and a ring of the last contextLines lines
+// outside it are held, so memory is bounded by the context size rather than the size of the file.
+type contextStream struct {
+	contextLines int
+
+	// ring holds the most recent lines outside a window, which become the leading context of the next match
+	ring  []contextLine
+	head  int
+	count int
+
+	// window holds the lines of the open window, starting at line start of the file, with the position of its first
+	// matched line within it
+	window     []contextLine
+	start      int
+	firstMatch int
+	open       bool
+
+	// lines is the number of lines added so far
+	lines int
+
+	// after is the number of trailing context lines still to add to the open window
+	after int
+
+	// emit receives each window once no later match can merge into it
+	emit func(window []contextLine, start, firstMatch int)
+}
+
+// newContextStream creates a stream for windows of contextLines lines around each match, which must be positive.
+func newContextStream(contextLines int, emit func(window []contextLine, start, firstMatch int)) *contextStream {
+	return &contextStream{
+		contextLines: contextLines,
+		ring:         make([]contextLine, contextLines),
+		emit:         emit,
+	}
+}
+
+// add passes the next line of the file to the stream, with whether it matched the pattern.
+func (s *contextStream) add(line contextLine, matched bool) {
+	index := s.lines
+	s.lines++
+	line.matched = matched
+
+	switch {
+	case matched:
+		if !s.open {
+			s.window = s.window[:0]
+			s.start = index - s.count
+			s.firstMatch = s.count
+			s.open = true
+		}
+
+		// the lines since the end of the open window are close enough to merge, as the ring would have closed it otherwise
+		s.window = s.drainRing(s.window)
+		s.window = append(s.window, line)
+		s.after = s.contextLines
+
+	case s.open && s.after > 0:
+		s.window = append(s.window, line)
+		s.after--
+
+	default:
+		if s.open && s.count == s.contextLines {
+			// a match on the next line would start its window past the end of this one, so it is complete
+			s.flush()
+		}
+		s.push(line)
+	}
+}
+
+// close emits the open window, if any, at the end of the file.
+func (s *contextStream) close() {
+	if s.open {
+		s.flush()
+	}
+}
+
+// flush emits the open window and starts a new one on the next match.
+func (s *contextStream) flush() {
+	s.emit(s.window, s.start, s.firstMatch)
+	s.open = false
+	s.window = nil
+}
+
+// push adds a line to the ring, dropping the oldest line when it is full.
+func (s *contextStream) push(line contextLine) {
+	if s.count < s.contextLines {
+		s.ring[(s.head+s.count)%s.contextLines] = line
+		s.count++
+		return
+	}
+	s.ring[s.head] = line
+	s.head = (s.head + 1) % s.contextLines
+}
+
+// drainRing appends the lines of the ring to lines, oldest first, and empties the ring.
+func (s *contextStream) drainRing(lines []contextLine) []contextLine {
+	for i := range s.count {
+		lines = append(lines, s.ring[(s.head+i)%s.contextLines])
+	}
+	clear(s.ring)
+	s.head, s.count = 0, 0
+	return lines
+}
+
+// windowMatch creates the match of a context window, as createWindowMatches does, with the offset of its first
+// matched line when percentages are computed.
+func windowMatch(window []contextLine, firstMatch int, fileName string, opts scanOptions) Match {
+	joiner := opts.contextJoiner
+	if joiner == "" {
+		joiner = "\n"
+	}
+
+	texts := make([]string, len(window))
+	var hits []string
+	for i, line := range window {
+		texts[i] = line.text
+		if line.matched {
+			hits = append(hits, line.text)
+		}
+	}
+	match := Match{
+		Line:     strings.TrimSpace(strings.Join(texts, joiner)),
+		FileName: fileName,
+		hits:     hits,
+	}
+	if opts.percentage {
+		match.offset = window[firstMatch].offset
+	}
+	return match
+}
@@ -0,0 +1,161 @@
+package epubproc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestContextStream tests building the same context windows as buildContextWindows while the lines are read
+func TestContextStream(t *testing.T) {
+	// each pattern marks the matching lines of a file with 'x'
+	patterns := []string{
+		"x",
+		"....",
+		"x....",
+		"....x",
+		"..x..",
+		"x.x",
+		"x..x",
+		"x...x",
+		"x....x",
+		"xx..x...x....x",
+		".x.....x.x......x",
+		"xxxxx",
+	}
+
+	for _, pattern := range patterns {
+		for contextLines := 1; contextLines <= 3; contextLines++ {
+			t.Run(fmt.Sprintf("%s/%d", pattern, contextLines), func(t *testing.T) {
+				var matchedLines []int
+				for i, c := range pattern {
+					if c == 'x' {
+						matchedLines = append(matchedLines, i)
+					}
+				}
+				expected := buildContextWindows(matchedLines, len(pattern), contextLines)
+				expectedFirsts := firstMatchedLines(expected, matchedLines)
+
+				var got []contextWindow
+				var gotFirsts []int
+				stream := newContextStream(contextLines, func(window []contextLine, start, firstMatch int) {
+					got = append(got, contextWindow{start: start, end: start + len(window)})
+					gotFirsts = append(gotFirsts, start+firstMatch)
+					for i, line := range window {
+						if line.text != fmt.Sprint(start+i) {
+							t.Errorf("Expected line %d at position %d of the window, got %s", start+i, i, line.text)
+						}
+					}
+				})
+				for i, c := range pattern {
+					stream.add(contextLine{text: fmt.Sprint(i)}, c == 'x')
+				}
+				stream.close()
+
+				if !slices.Equal(got, expected) {
+					t.Errorf("Expected windows %v, got %v", expected, got)
+				}
+				if !slices.Equal(gotFirsts, expectedFirsts) {
+					t.Errorf("Expected first matched lines %v, got %v", expectedFirsts, gotFirsts)
+				}
+			})
+		}
+	}
+}
+
+// generatedReader produces a head followed by repeated lines up to size bytes, without holding them in memory, and
+// records the peak heap allocation after each mebibyte read
+type generatedReader struct {
+	head      []byte
+	line      []byte
+	remaining int64
+	pos       int
+	sampled   int64
+	peakHeap  uint64
+}
+
+func (g *generatedReader) Read(p []byte) (int, error) {
+	if g.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p[:min(int64(len(p)), g.remaining)], g.head)
+	g.head = g.head[n:]
+	for n < len(p) && g.remaining > int64(n) {
+		copied := copy(p[n:min(int64(len(p)), g.remaining)], g.line[g.pos:])
+		g.pos = (g.pos + copied) % len(g.line)
+		n += copied
+	}
+	g.remaining -= int64(n)
+
+	if g.sampled += int64(n); g.sampled >= 1<<20 {
+		g.sampled = 0
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		g.peakHeap = max(g.peakHeap, stats.HeapAlloc)
+	}
+	return n, nil
+}
+
+// TestScanLargeEntryBoundedMemory tests that scanning an entry many times larger than the scan buffers keeps the heap
+// bounded, with and without context lines
+func TestScanLargeEntryBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large entry scan in short mode")
+	}
+
+	const entrySize = 64 << 20
+	const heapLimit = 16 << 20
+
+	scans := []struct {
+		name string
+		head string
+		line string
+		scan func(r io.Reader, opts scanOptions) ([]Match, error)
+	}{
+		{
+			name: "Text",
+			head: "Holmes lit his pipe.\n",
+			line: "The quick brown fox jumps over the lazy dog, again and again and again.\n",
+			scan: func(r io.Reader, opts scanOptions) ([]Match, error) {
+				return scanTextFile(context.Background(), r, regexp.MustCompile("Holmes"), "large.txt", opts)
+			},
+		},
+		{
+			name: "HTML",
+			head: "<html><body><p>Holmes lit his pipe.</p>\n",
+			line: "<p>The quick brown fox jumps over the lazy dog, again and again.</p>\n",
+			scan: func(r io.Reader, opts scanOptions) ([]Match, error) {
+				return scanHTMLFile(context.Background(), r, regexp.MustCompile("Holmes"), "large.html", opts)
+			},
+		},
+	}
+
+	for _, scan := range scans {
+		for _, contextLines := range []int{0, 2} {
+			t.Run(fmt.Sprintf("%s/Context%d", scan.name, contextLines), func(t *testing.T) {
+				runtime.GC()
+				var baseline runtime.MemStats
+				runtime.ReadMemStats(&baseline)
+
+				reader := &generatedReader{head: []byte(scan.head), line: []byte(scan.line), remaining: entrySize}
+				matches, err := scan.scan(reader, scanOptions{contextLines: contextLines})
+				if err != nil {
+					t.Fatalf("Scan failed: %v", err)
+				}
+				if len(matches) != 1 || !strings.Contains(matches[0].Line, "Holmes") {
+					t.Fatalf("Expected 1 match of Holmes, got %d", len(matches))
+				}
+
+				if reader.peakHeap > baseline.HeapAlloc+heapLimit {
+					t.Errorf("Expected the heap to grow by at most %d bytes, got %d", heapLimit, reader.peakHeap-baseline.HeapAlloc)
+				}
+			})
+		}
+	}
+}
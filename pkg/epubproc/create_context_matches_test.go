@@ -13,6 +13,7 @@ func TestCreateContextMatches(t *testing.T) {
 		lines        []string
 		fileName     string
 		contextLines int
+		joiner       string
 		wantCount    int
 		wantLines    []string
 	}{
@@ -25,6 +26,16 @@ func TestCreateContextMatches(t *testing.T) {
 			wantCount:    1,
 			wantLines:    []string{"line1\nMATCH\nline3"},
 		},
+		{
+			name:         "single match with custom joiner",
+			matchedLines: []int{2},
+			lines:        []string{"line0", "line1", "MATCH", "line3", "line4"},
+			fileName:     "test.txt",
+			contextLines: 1,
+			joiner:       " | ",
+			wantCount:    1,
+			wantLines:    []string{"line1 | MATCH | line3"},
+		},
 		{
 			name:         "single match at start",
 			matchedLines: []int{0},
@@ -127,7 +138,7 @@ func TestCreateContextMatches(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			matches := createContextMatches(tt.matchedLines, tt.lines, tt.fileName, tt.contextLines)
+			matches := createContextMatches(tt.matchedLines, tt.lines, tt.fileName, scanOptions{contextLines: tt.contextLines, contextJoiner: tt.joiner})
 
 			if len(matches) != tt.wantCount {
 				t.Fatalf("expected %d matches, got %d", tt.wantCount, len(matches))
@@ -0,0 +1,77 @@
+package epubproc
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// openZipReader opens a zip archive; it is a variable so tests can simulate flaky file systems.
+var openZipReader = zip.OpenReader
+
+// closeZipReader closes a zip archive opened by openZipReader; it is a variable so tests can track how long archives stay
+// open.
+var closeZipReader = (*zip.ReadCloser).Close
+
+// openRetryBaseDelay is the delay before the first retry of a failed open, doubling for each further retry.
+var openRetryBaseDelay = 100 * time.Millisecond
+
+// openEpub opens an epub as a zip archive, including the file size in the error for context.
+func openEpub(epubPath string) (*zip.ReadCloser, error) {
+	// get file info for better error context
+	fileInfo, fileErr := os.Stat(epubPath)
+
+	r, err := openZipReader(epubPath)
+	if err != nil {
+		if fileErr == nil {
+			return nil, fmt.Errorf("failed to open epub '%s' (size: %d bytes): %w", epubPath, fileInfo.Size(), err)
+		}
+		return nil, fmt.Errorf("failed to open epub '%s': %w", epubPath, err)
+	}
+
+	return r, nil
+}
+
+// openEpubWithRetry opens an epub, retrying up to retries times with exponential backoff when the error looks transient.
+func openEpubWithRetry(ctx context.Context, epubPath string, retries int) (*zip.ReadCloser, error) {
+	delay := openRetryBaseDelay
+
+	for attempt := 0; ; attempt++ {
+		r, err := openEpub(epubPath)
+		if err == nil || attempt >= retries || !isTransientOpenError(err) {
+			return r, err
+		}
+
+		log.Debug().Err(err).Str("epub", epubPath).Int("attempt", attempt+1).Dur("delay", delay).Msg("retrying epub open")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, errors.Join(err, ctx.Err())
+		}
+		delay *= 2
+	}
+}
+
+// isTransientOpenError reports whether an open error may succeed on retry, i.e. it is not a missing file, a permission
+// problem or an invalid archive, which retrying cannot fix.
+func isTransientOpenError(err error) bool {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission):
+		return false
+	case errors.Is(err, zip.ErrFormat), errors.Is(err, zip.ErrAlgorithm), errors.Is(err, zip.ErrChecksum), errors.Is(err, zip.ErrInsecurePath):
+		return false
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		// truncated archives stay truncated
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,114 @@
+package epubproc
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// useFlakyOpener makes opening an epub fail with a transient error the first failures times, restoring the opener on cleanup
+func useFlakyOpener(t *testing.T, failures int) *int {
+	t.Helper()
+
+	attempts := 0
+	originalOpener, originalDelay := openZipReader, openRetryBaseDelay
+	openZipReader = func(name string) (*zip.ReadCloser, error) {
+		attempts++
+		if attempts <= failures {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("stale file handle")}
+		}
+		return zip.OpenReader(name)
+	}
+	openRetryBaseDelay = time.Millisecond
+
+	t.Cleanup(func() {
+		openZipReader, openRetryBaseDelay = originalOpener, originalDelay
+	})
+	return &attempts
+}
+
+// TestOpenRetries tests retrying transient errors when opening epubs
+func TestOpenRetries(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open_retries_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	epubPath, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes and Watson.</p>")
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	pattern := regexp.MustCompile("Holmes")
+
+	t.Run("SucceedsAfterTransientErrors", func(t *testing.T) {
+		attempts := useFlakyOpener(t, 2)
+
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{openRetries: 3}, nil)
+		if err != nil {
+			t.Fatalf("Expected the open to succeed after retries, got %v", err)
+		}
+		if len(matches) != 1 {
+			t.Errorf("Expected 1 match, got %d", len(matches))
+		}
+		if *attempts != 3 {
+			t.Errorf("Expected 3 attempts, got %d", *attempts)
+		}
+	})
+
+	t.Run("GivesUpAfterRetries", func(t *testing.T) {
+		attempts := useFlakyOpener(t, 5)
+
+		if _, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{openRetries: 1}, nil); err == nil {
+			t.Fatal("Expected an error after the retries were used up")
+		}
+		if *attempts != 2 {
+			t.Errorf("Expected 2 attempts, got %d", *attempts)
+		}
+	})
+
+	t.Run("NoRetriesByDefault", func(t *testing.T) {
+		attempts := useFlakyOpener(t, 1)
+
+		if _, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil); err == nil {
+			t.Fatal("Expected an error without retries")
+		}
+		if *attempts != 1 {
+			t.Errorf("Expected 1 attempt, got %d", *attempts)
+		}
+	})
+
+	t.Run("InvalidArchiveNotRetried", func(t *testing.T) {
+		attempts := useFlakyOpener(t, 0)
+
+		invalidPath := filepath.Join(tempDir, "invalid.epub")
+		if err := os.WriteFile(invalidPath, []byte("not a zip archive"), 0o644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+
+		_, _, err := grepInEpub(context.Background(), invalidPath, pattern, scanOptions{openRetries: 3}, nil)
+		if !errors.Is(err, zip.ErrFormat) {
+			t.Errorf("Expected a zip format error, got %v", err)
+		}
+		if *attempts != 1 {
+			t.Errorf("Expected 1 attempt, got %d", *attempts)
+		}
+	})
+
+	t.Run("ProcessFile", func(t *testing.T) {
+		attempts := useFlakyOpener(t, 1)
+
+		if _, err := NewMetadataExtractor(1, WithOpenRetries(1)).ProcessFile(context.Background(), epubPath); err != nil {
+			t.Fatalf("Expected metadata extraction to succeed after a retry, got %v", err)
+		}
+		if *attempts != 2 {
+			t.Errorf("Expected 2 attempts, got %d", *attempts)
+		}
+	})
+}
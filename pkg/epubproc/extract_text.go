@@ -0,0 +1,147 @@
+package epubproc
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ExtractFileText returns the normalized text of a single text or html file inside an epub, one line per line of a text
+// file or block of an html file, without reading any other entry of the book.
+func ExtractFileText(ctx context.Context, epubPath, internalName string) (string, error) {
+	if !isSafeArchivePath(internalName) {
+		return "", fmt.Errorf("invalid internal path '%s'", internalName)
+	}
+
+	r, err := openEpub(epubPath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := closeZipReader(r); err != nil {
+			log.Warn().Err(err).Str("epub", epubPath).Msg("failed to close epub reader")
+		}
+	}()
+
+	f, err := r.Open(internalName)
+	if err != nil {
+		return "", fmt.Errorf("failed to open '%s' in epub '%s': %w", internalName, epubPath, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warn().Err(err).Str("file", internalName).Msg("failed to close file")
+		}
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to open '%s' in epub '%s': %w", internalName, epubPath, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("'%s' in epub '%s' is a directory", internalName, epubPath)
+	}
+
+	reader := &errorRecordingReader{r: f}
+
+	var lines []string
+	switch getFileType(internalName) {
+	case "text":
+		lines, _, err = readTextLines(ctx, reader, internalName, scanOptions{})
+	case "html":
+		var blocks *htmlBlocks
+		if blocks, _, err = readHTMLBlocks(ctx, reader, internalName, scanOptions{}); err == nil {
+			lines = blocks.lines
+		}
+	default:
+		return "", fmt.Errorf("unsupported file type of '%s': must be text or html", internalName)
+	}
+
+	if reader.err != nil {
+		return "", fmt.Errorf("failed to read '%s' in epub '%s': %w", internalName, epubPath, reader.err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// walkContentText calls emit with each line of a text file or block of an html file of the content files of an epub,
+// in reading order (archive order without a readable spine), until emit returns false. Files that are not part of the
+// text, such as the cover or table of contents, are skipped unless their category is included.
+func walkContentText(ctx context.Context, r *zip.Reader, includeSkipped []SkipCategory, emit func(line string) bool) error {
+	opts := scanOptions{includeSkipped: includeSkipped}
+
+	var files []*zip.File
+	for _, f := range r.File {
+		fileType := getFileType(f.Name)
+		if fileType != "html" && fileType != "text" || !isSafeArchivePath(f.Name) {
+			continue
+		}
+		if _, skip := opts.skipReason(f.Name); skip {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	if position := spineOrder(r); position != nil {
+		slices.SortStableFunc(files, func(a, b *zip.File) int {
+			return position(a.Name) - position(b.Name)
+		})
+	}
+
+	for _, f := range files {
+		more, err := walkContentFile(ctx, f, emit)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+// walkContentFile calls emit with each line of a single content file, reporting whether emit wants more lines.
+func walkContentFile(ctx context.Context, f *zip.File, emit func(line string) bool) (bool, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return false, fmt.Errorf("failed to open '%s': %w", f.Name, err)
+	}
+	defer func() {
+		if err := rc.Close(); err != nil {
+			log.Warn().Err(err).Str("file", f.Name).Msg("failed to close file")
+		}
+	}()
+
+	more := true
+	if getFileType(f.Name) == "text" {
+		pooledSc := scannerPool.Get().(*pooledScanner)
+		defer scannerPool.Put(pooledSc)
+		pooledSc.reset(skipBOM(rc))
+		scanner := pooledSc.scanner
+
+		for more && scanner.Scan() {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+			more = emit(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return false, fmt.Errorf("failed to read '%s': %w", f.Name, err)
+		}
+		return more, nil
+	}
+
+	_, err = walkHTMLBlocks(ctx, rc, f.Name, scanOptions{}, func(line, _ string, _ int64) bool {
+		more = emit(line)
+		return more
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to read '%s': %w", f.Name, err)
+	}
+	return more, nil
+}
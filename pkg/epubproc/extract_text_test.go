@@ -0,0 +1,70 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExtractFileText tests extracting the text of a single file inside an epub
+func TestExtractFileText(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "extract_text_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	epubPath := filepath.Join(tempDir, "book.epub")
+	entries := [][2]string{
+		{"OEBPS/", ""},
+		{"OEBPS/chapter1.xhtml", "<html><body><h1>Chapter One</h1><p>It was a  dark\n night.</p></body></html>"},
+		{"OEBPS/chapter2.xhtml", "<p>Chapter two.</p>"},
+		{"OEBPS/notes.txt", "First note\nSecond note"},
+		{"OEBPS/cover.png", "binary data"},
+	}
+	if err := createOrderedTestZIP(epubPath, entries); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		internal string
+		expected string
+	}{
+		{"HTML", "OEBPS/chapter1.xhtml", "Chapter One\nIt was a dark night."},
+		{"Text", "OEBPS/notes.txt", "First note\nSecond note"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			text, err := ExtractFileText(context.Background(), epubPath, tc.internal)
+			if err != nil {
+				t.Fatalf("ExtractFileText failed: %v", err)
+			}
+			if text != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, text)
+			}
+		})
+	}
+
+	errorCases := []struct {
+		name     string
+		internal string
+		expected string
+	}{
+		{"Missing", "OEBPS/chapter3.xhtml", "failed to open"},
+		{"Directory", "OEBPS", "is a directory"},
+		{"UnsupportedType", "OEBPS/cover.png", "unsupported file type"},
+		{"UnsafePath", "../outside.xhtml", "invalid internal path"},
+	}
+
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ExtractFileText(context.Background(), epubPath, tc.internal); err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -4,26 +4,67 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/fs"
-	"path/filepath"
-	"regexp"
+	"os"
 	"runtime"
 	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/sourcegraph/conc/pool"
 )
 
+const (
+	// descriptionFileName is the FileName of matches found in the book description.
+	descriptionFileName = "description"
+
+	// metadataFileName is the FileName of matches found in the title, authors and series of a book.
+	metadataFileName = "metadata"
+
+	// defaultHighlightStart is inserted before highlighted occurrences when SearchRequest.HighlightStart is empty.
+	defaultHighlightStart = "\x02"
+
+	// defaultHighlightEnd is inserted after highlighted occurrences when SearchRequest.HighlightEnd is empty.
+	defaultHighlightEnd = "\x03"
+)
+
 // ResultHandler defines a handler function for epub results.
 type ResultHandler func(result *SearchResult) error
 
+// ContextResultHandler defines a handler function for epub results that receives the context of the search, which is
+// cancelled when the caller cancels the search or another worker fails, so handlers doing IO can stop early.
+type ContextResultHandler func(ctx context.Context, result *SearchResult) error
+
+// withContext adapts a ResultHandler to a ContextResultHandler that ignores the context.
+func (h ResultHandler) withContext() ContextResultHandler {
+	return func(_ context.Context, result *SearchResult) error {
+		return h(result)
+	}
+}
+
+// MatchHandler defines a handler function for matches streamed as they are found, with the path of their epub.
+type MatchHandler func(path string, match Match) error
+
+// ProgressHandler defines a handler function for search progress events.
+type ProgressHandler func(event ProgressEvent)
+
 // FileSearch defines the interface for searching within epub files.
 type FileSearch interface {
 	// Search performs a search across multiple epub files, streaming results via a handler function.
 	Search(ctx context.Context, request *SearchRequest, handler ResultHandler) error
+
+	// SearchContext performs a search like Search, passing the context of the search to the handler.
+	SearchContext(ctx context.Context, request *SearchRequest, handler ContextResultHandler) error
+
+	// Reset clears the compiled pattern cache, e.g. to release memory in a long-lived server.
+	// The cache is shared by every FileSearch in the process, and searches in progress are unaffected.
+	Reset()
 }
 
+// newSearchMetadataExtractor creates the metadata extractor of a search; it is a variable so tests can observe extraction.
+var newSearchMetadataExtractor = NewMetadataExtractor
+
 type fileSearchImpl struct {
 	// epubDir is a directory containing epub files to search
 	epubDir string
@@ -33,45 +74,260 @@ type fileSearchImpl struct {
 
 	// extractMetadata controls whether to extract metadata for search results
 	extractMetadata bool
+
+	// options holds optional search settings
+	options fileSearchOptions
+}
+
+// fileSearchOptions holds optional settings used while searching.
+type fileSearchOptions struct {
+	// scanWorkers is the number of goroutines scanning epub content, or 0 to use maxThreads
+	scanWorkers int
+
+	// metadataWorkers limits how many files have their metadata extracted at once, or 0 for no extra limit
+	metadataWorkers int
+
+	// metadataOptions configures the metadata extractor used for search results
+	metadataOptions []MetadataExtractorOption
+
+	// progress is called as each epub file is started, or nil for no progress events
+	progress ProgressHandler
+}
+
+// FileSearchOption configures optional behavior of a FileSearch.
+type FileSearchOption func(options *fileSearchOptions)
+
+// WithScanWorkers sets the number of goroutines scanning epub content, independently of maxThreads.
+// Scanning is mostly IO-bound, so SSDs often benefit from more workers than CPU cores, while HDDs do better with fewer.
+// The default is maxThreads.
+func WithScanWorkers(workers int) FileSearchOption {
+	return func(options *fileSearchOptions) {
+		options.scanWorkers = workers
+	}
+}
+
+// WithMetadataWorkers limits how many files have their metadata extracted at the same time.
+// The default is no extra limit, so up to one extraction per scan worker runs at once.
+func WithMetadataWorkers(workers int) FileSearchOption {
+	return func(options *fileSearchOptions) {
+		options.metadataWorkers = workers
+	}
+}
+
+// WithMetadataOptions configures the metadata extractor used for search results, e.g. WithMetadataFields to extract less.
+// Metadata filters, SearchDescription and SearchMetadata only see the fields that are extracted.
+func WithMetadataOptions(opts ...MetadataExtractorOption) FileSearchOption {
+	return func(options *fileSearchOptions) {
+		options.metadataOptions = append(options.metadataOptions, opts...)
+	}
+}
+
+// WithProgress calls handler as each epub file is started, tagged with its directory relative to the search directory.
+// Calls are serialized, so the handler does not need to be safe for concurrent use, but it should return quickly.
+func WithProgress(handler ProgressHandler) FileSearchOption {
+	return func(options *fileSearchOptions) {
+		options.progress = handler
+	}
+}
+
+const (
+	// autoThreadsPerCPU is the number of worker threads per CPU core picked by AutoThreads. It is a heuristic rather than a
+	// measured optimum: scanning waits on reads between bursts of regex and HTML work, so a second thread per core keeps
+	// cores busy, while the best multiplier depends on the storage (see BenchmarkSearchThreads to tune it).
+	autoThreadsPerCPU = 2
+
+	// maxAutoThreads caps AutoThreads, so machines with many cores do not open hundreds of files at once
+	maxAutoThreads = 64
+)
+
+// AutoThreads returns a worker thread count for NewFileSearch that scales with IO rather than only with CPU cores:
+// two threads per core, capped at a sane maximum. This is a heuristic, and slow storage may benefit from more threads.
+func AutoThreads() int {
+	return min(runtime.NumCPU()*autoThreadsPerCPU, maxAutoThreads)
 }
 
 // NewFileSearch creates a new FileSearch instance for the specified epub directory.
-func NewFileSearch(epubDir string, maxThreads int, extractMetadata bool) FileSearch {
+// If epubDir is an epub file instead of a directory, only that file is searched.
+func NewFileSearch(epubDir string, maxThreads int, extractMetadata bool, opts ...FileSearchOption) FileSearch {
 	if maxThreads <= 0 {
 		// default to number of CPU cores if not specified
 		maxThreads = runtime.NumCPU()
 	}
 
+	var options fileSearchOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	return &fileSearchImpl{
 		epubDir:         epubDir,
 		maxThreads:      maxThreads,
 		extractMetadata: extractMetadata,
+		options:         options,
+	}
+}
+
+// scanWorkers returns the number of goroutines used to scan epub content.
+func (s *fileSearchImpl) scanWorkers() int {
+	if s.options.scanWorkers > 0 {
+		return s.options.scanWorkers
 	}
+	return s.maxThreads
+}
+
+// Reset clears the compiled pattern cache shared by every FileSearch.
+// Pooled scanner buffers are held in a sync.Pool, which the garbage collector already empties when they are unused.
+func (s *fileSearchImpl) Reset() {
+	patternCache.clear()
 }
 
 // Search performs a full-text search across all epub files in the configured directory.
 func (s *fileSearchImpl) Search(ctx context.Context, request *SearchRequest, handler ResultHandler) error {
-	var pattern string
-	if request.Query.IsRegex {
-		if request.Query.Regex == nil {
-			return fmt.Errorf("regex configuration is required when IsRegex is true")
+	return s.SearchContext(ctx, request, handler.withContext())
+}
+
+// SearchContext performs a full-text search across all epub files in the configured directory, passing the context of
+// the search to the handler.
+func (s *fileSearchImpl) SearchContext(ctx context.Context, request *SearchRequest, handler ContextResultHandler) error {
+	query, err := compileQuery(request.Query, request.PhraseMode)
+	if err != nil {
+		return err
+	}
+
+	// in document mode, content is scanned (and highlighted) with a pattern matching across lines
+	if request.DocumentMode {
+		if query.pattern, err = query.documentPattern(); err != nil {
+			return err
 		}
+	}
+
+	if err := validateGlobs(request.IncludeInternalGlobs); err != nil {
+		return err
+	}
+	if err := validateGlobs(request.ExcludeInternalGlobs); err != nil {
+		return err
+	}
 
-		pattern = request.Query.Regex.Pattern
-	} else {
-		if request.Query.Text == nil {
-			return fmt.Errorf("text configuration is required when IsRegex is false")
+	// metadata may be extracted only to evaluate filters, in which case it is left out of the results
+	extractMetadata := s.extractMetadata || request.ExtractForFilter
+
+	if request.SearchDescription && !extractMetadata {
+		return fmt.Errorf("description search requires metadata extraction")
+	}
+	if request.SearchMetadata && !extractMetadata {
+		return fmt.Errorf("metadata search requires metadata extraction")
+	}
+
+	if request.MarkHTML {
+		if _, ok := query.pattern.(phraseMatcher); !ok {
+			return fmt.Errorf("marking HTML is not supported with fuzzy matching")
 		}
+	}
 
-		pattern = regexp.QuoteMeta(request.Query.Text.Value)
-		if request.Query.Text.IgnoreCase {
-			pattern = "(?i)" + pattern
+	highlightStart, highlightEnd := request.HighlightStart, request.HighlightEnd
+	if request.Highlight {
+		if _, ok := query.pattern.(phraseMatcher); !ok {
+			return fmt.Errorf("highlighting is not supported with fuzzy matching")
+		}
+		if highlightStart == "" {
+			highlightStart = defaultHighlightStart
+		}
+		if highlightEnd == "" {
+			highlightEnd = defaultHighlightEnd
 		}
 	}
 
-	patternRegex, err := patternCache.get(pattern)
-	if err != nil {
-		return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	for ext, fileType := range request.ContentTypes {
+		if t := strings.ToLower(strings.TrimSpace(fileType)); t != "text" && t != "html" {
+			return fmt.Errorf("invalid content type %q for extension %q: must be text or html", fileType, ext)
+		}
+	}
+
+	if request.MaxBytesPerEpub < 0 {
+		return fmt.Errorf("invalid byte limit %d: must not be negative", request.MaxBytesPerEpub)
+	}
+	if request.MaxFilesPerEpub < 0 {
+		return fmt.Errorf("invalid file limit %d: must not be negative", request.MaxFilesPerEpub)
+	}
+	if request.LimitPerDirectory < 0 {
+		return fmt.Errorf("invalid directory limit %d: must not be negative", request.LimitPerDirectory)
+	}
+	if request.SlowFileThreshold < 0 {
+		return fmt.Errorf("invalid slow file threshold %s: must not be negative", request.SlowFileThreshold)
+	}
+	if request.SpineFrom < 0 || request.SpineTo < 0 {
+		return fmt.Errorf("invalid spine range %d-%d: must not be negative", request.SpineFrom, request.SpineTo)
+	}
+	if request.SpineTo > 0 && request.SpineTo < request.SpineFrom {
+		return fmt.Errorf("invalid spine range %d-%d: must not end before it starts", request.SpineFrom, request.SpineTo)
+	}
+	if request.MaxHTMLBlockBytes < 0 {
+		return fmt.Errorf("invalid html block size limit %d: must not be negative", request.MaxHTMLBlockBytes)
+	}
+	if request.MaxHTMLBlocks < 0 {
+		return fmt.Errorf("invalid html block limit %d: must not be negative", request.MaxHTMLBlocks)
+	}
+	if request.MinLineLength < 0 {
+		return fmt.Errorf("invalid minimum line length %d: must not be negative", request.MinLineLength)
+	}
+	if request.MinLineLength > 0 && (request.PhraseMode || request.DocumentMode) {
+		return fmt.Errorf("a minimum line length is not supported in phrase or document mode")
+	}
+
+	if request.Offset < 0 {
+		return fmt.Errorf("invalid offset %d: must not be negative", request.Offset)
+	}
+	if request.Limit < 0 {
+		return fmt.Errorf("invalid limit %d: must not be negative", request.Limit)
+	}
+	if request.MinMatches < 0 {
+		return fmt.Errorf("invalid minimum match count %d: must not be negative", request.MinMatches)
+	}
+	if request.FirstMatchOnly {
+		if query.combine == CombineAnd {
+			return fmt.Errorf("first match only is not supported with combine mode '%s'", CombineAnd)
+		}
+		if request.MinMatches > 1 {
+			return fmt.Errorf("first match only is not supported with a minimum match count above 1")
+		}
+	}
+	if err := validateSort(request.SortBy); err != nil {
+		return err
+	}
+	if err := validateSection(request.Section); err != nil {
+		return err
+	}
+	if err := validateSkipCategories(request.IncludeSkipped); err != nil {
+		return err
+	}
+
+	// streamed matches cannot be taken back, so books must be known to be reported before their matches are found
+	if request.MatchHandler != nil {
+		if query.combine == CombineAnd {
+			return fmt.Errorf("streaming matches is not supported with combine mode '%s'", CombineAnd)
+		}
+		if request.Offset > 0 || request.Limit > 0 {
+			return fmt.Errorf("streaming matches is not supported with an offset or limit")
+		}
+		if request.MinMatches > 0 {
+			return fmt.Errorf("streaming matches is not supported with a minimum match count")
+		}
+	}
+
+	scanOpts := newScanOptions(request)
+
+	// pagination needs a deterministic order, so results are buffered and sorted before they reach the handler
+	paginate := request.Offset > 0 || request.Limit > 0 || request.SortBy != ""
+	emit := handler
+	var buffered []*SearchResult
+	var bufferedMutex sync.Mutex
+	if paginate {
+		emit = func(_ context.Context, result *SearchResult) error {
+			bufferedMutex.Lock()
+			buffered = append(buffered, result)
+			bufferedMutex.Unlock()
+			return nil
+		}
 	}
 
 	p := pool.New().WithContext(ctx).WithCancelOnError()
@@ -80,39 +336,120 @@ func (s *fileSearchImpl) Search(ctx context.Context, request *SearchRequest, han
 	// producer goroutine to find all .epub files
 	p.Go(func(ctx context.Context) error {
 		defer close(paths)
-		return filepath.WalkDir(s.epubDir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				// an error during walk is fatal
-				return err
-			}
 
-			if !d.IsDir() && strings.HasSuffix(strings.ToLower(d.Name()), ".epub") {
-				// apply FilesIn filter if provided
-				if request.Filters != nil && len(request.Filters.FilesIn) > 0 {
-					if !slices.Contains(request.Filters.FilesIn, path) {
-						// skip files not in the FilesIn list
-						return nil
-					}
-				}
+		// seen holds the canonical path of every file sent, so a file reachable through several paths is searched once
+		seen := make(map[string]bool)
 
-				select {
-				case paths <- path:
-				case <-ctx.Done():
-					return ctx.Err()
+		// send passes an epub path to the workers, applying the FilesIn filter if provided
+		send := func(path string) error {
+			if request.Filters != nil && len(request.Filters.FilesIn) > 0 {
+				if !slices.Contains(request.Filters.FilesIn, path) {
+					// skip files not in the FilesIn list
+					return nil
 				}
 			}
 
+			// the first path found for a file wins, which is deterministic since walks are in lexical order
+			canonical := canonicalPath(path)
+			if seen[canonical] {
+				log.Debug().Str("path", path).Str("canonical", canonical).Msg("skipping duplicate epub path")
+				return nil
+			}
+			seen[canonical] = true
+
+			select {
+			case paths <- path:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
 			return nil
-		})
+		}
+
+		walkOpts := walkOptions{
+			strict:            request.StrictWalk,
+			followSymlinks:    request.FollowSymlinks,
+			modifiedSince:     request.ModifiedSince,
+			limitPerDirectory: request.LimitPerDirectory,
+		}
+
+		// an explicit list of files bypasses the directory walk
+		if len(request.Files) > 0 {
+			return forEachExplicitFile(request.Files, walkOpts, send)
+		}
+		// a common mistake is passing a single epub as the search directory, which is searched on its own
+		if isEpubFile(s.epubDir) {
+			return forEachExplicitFile([]string{s.epubDir}, walkOpts, send)
+		}
+		return walkEpubFiles(os.DirFS(s.epubDir), s.epubDir, walkOpts, send)
 	})
 
 	var metaExtractor MetadataExtractor
-	if s.extractMetadata {
-		metaExtractor = NewMetadataExtractor(s.maxThreads)
+	if extractMetadata {
+		metadataOpts := s.options.metadataOptions
+		if request.OpenRetries > 0 {
+			metadataOpts = append(slices.Clone(metadataOpts), WithOpenRetries(request.OpenRetries))
+		}
+		metaExtractor = newSearchMetadataExtractor(s.maxThreads, metadataOpts...)
 	}
 
-	// worker goroutines to process files
-	for i := 0; i < s.maxThreads; i++ {
+	// metadataSlots bounds concurrent metadata extraction when a separate limit is configured
+	var metadataSlots chan struct{}
+	if s.options.metadataWorkers > 0 {
+		metadataSlots = make(chan struct{}, s.options.metadataWorkers)
+	}
+
+	// loadMetadata extracts metadata and applies the metadata filters, reporting whether the book should be kept.
+	// Extraction errors only fail the search with FailFast, and otherwise skip the book.
+	loadMetadata := func(ctx context.Context, path string) (*Metadata, bool, error) {
+		if metadataSlots != nil {
+			select {
+			case metadataSlots <- struct{}{}:
+				defer func() { <-metadataSlots }()
+			case <-ctx.Done():
+				return nil, false, nil
+			}
+		}
+
+		extractedMetadata, err := metaExtractor.ProcessFile(ctx, path)
+		if err != nil {
+			if request.FailFast && ctx.Err() == nil {
+				return nil, false, fmt.Errorf("failed to extract metadata of '%s': %w", path, err)
+			}
+			log.Err(err).Str("path", path).Msg("error extracting metadata")
+			return nil, false, nil
+		}
+
+		// apply metadata-based filters if provided
+		if request.Filters != nil && !matchesMetadataFilters(*extractedMetadata, request.Filters) {
+			return nil, false, nil
+		}
+
+		return extractedMetadata, true, nil
+	}
+
+	// reportProgress passes a progress event for path to the progress handler, if one is configured
+	var progressMutex sync.Mutex
+	started := 0
+	reportProgress := func(path string) {
+		if s.options.progress == nil {
+			return
+		}
+
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+
+		started++
+		s.options.progress(ProgressEvent{
+			Path:      path,
+			Directory: relativeDir(s.epubDir, path),
+			Started:   started,
+		})
+	}
+
+	// worker goroutines to process files, each handling one file at a time by extracting its metadata and scanning its
+	// content in turn, so no more than scanWorkers files are open at once without a separate semaphore
+	for i := 0; i < s.scanWorkers(); i++ {
 		p.Go(func(ctx context.Context) error {
 			for path := range paths {
 				select {
@@ -126,46 +463,169 @@ func (s *fileSearchImpl) Search(ctx context.Context, request *SearchRequest, han
 				default:
 				}
 
-				matches, err := grepInEpub(ctx, path, patternRegex, request.Context)
+				reportProgress(path)
+
+				// metadata is extracted up front when content errors are reported, so unreadable books are still catalogued,
+				// when the description or metadata is searched, so books matching only there are found, and when matches
+				// are streamed, so matches of books excluded by the metadata filters are not
+				metadataFirst := extractMetadata &&
+					(request.ReportContentErrors || request.SearchDescription || request.SearchMetadata || request.MatchHandler != nil)
+				var metadata *Metadata
+				if metadataFirst {
+					var ok bool
+					var err error
+					if metadata, ok, err = loadMetadata(ctx, path); err != nil {
+						return err
+					} else if !ok {
+						continue
+					}
+				}
+
+				// sink passes each match to the match handler, tagged, captured and highlighted as in the result
+				var sink func(Match) error
+				var sinkErr error
+				if request.MatchHandler != nil {
+					sink = func(match Match) error {
+						streamed := []Match{match}
+						query.tagMatches(streamed)
+						query.captureMatches(streamed)
+						// the line is marked before highlighting adds its markers to it
+						if request.MarkHTML {
+							query.markMatches(streamed)
+						}
+						if request.Highlight {
+							query.highlightMatches(streamed, highlightStart, highlightEnd)
+						}
+						sinkErr = request.MatchHandler(path, streamed[0])
+						return sinkErr
+					}
+				}
+
+				started := time.Now()
+				matches, info, err := grepInEpub(ctx, path, query.pattern, scanOpts, sink)
+				logScanDuration(path, time.Since(started), request.SlowFileThreshold)
+				if sinkErr != nil {
+					return sinkErr
+				}
 				if err != nil && errors.Is(err, context.Canceled) {
 					break
-				} else if err != nil {
+				}
+
+				// with FailFast, an unreadable book or entry fails the search and cancels the remaining work
+				if request.FailFast {
+					if err != nil {
+						return fmt.Errorf("failed to search '%s': %w", path, err)
+					}
+					if len(info.contentErrors) > 0 {
+						return fmt.Errorf("failed to search '%s': %w", path, errors.Join(info.contentErrors...))
+					}
+				}
+
+				var contentErr error
+				if err != nil {
 					log.Err(err).Str("path", path).Msg("error searching in epub")
-					continue
+					if !request.ReportContentErrors {
+						continue
+					}
+					contentErr = err
+				} else if request.ReportContentErrors && len(info.contentErrors) > 0 {
+					contentErr = errors.Join(info.contentErrors...)
 				}
 
-				if len(matches) > 0 {
-					var metadata Metadata
-					if s.extractMetadata {
-						extractedMetadata, err := metaExtractor.ProcessFile(ctx, path)
-						if err != nil {
-							log.Err(err).Str("path", path).Msg("error extracting metadata")
-							continue
+				// with FirstMatchOnly, a match in the content is already the first match of the book
+				searchDescription := request.SearchDescription && !(request.FirstMatchOnly && len(matches) > 0)
+				if searchDescription && metadata != nil && metadata.Description != "" {
+					descriptionMatches, err := scanHTMLFile(ctx, strings.NewReader(metadata.Description), query.pattern, descriptionFileName, scanOpts)
+					if err != nil && ctx.Err() == nil {
+						log.Warn().Err(err).Str("path", path).Msg("error searching description of epub")
+					}
+					if sink != nil {
+						for _, match := range descriptionMatches {
+							if err := sink(match); err != nil {
+								return err
+							}
 						}
-						metadata = *extractedMetadata
 					}
+					matches = append(descriptionMatches, matches...)
+				}
 
-					// apply metadata-based filters if provided and metadata is extracted
-					if request.Filters != nil && s.extractMetadata {
-						if !matchesMetadataFilters(metadata, request.Filters) {
-							continue
+				// the title, authors and series are matched as one text, so a query may span them
+				searchMetadata := request.SearchMetadata && !(request.FirstMatchOnly && len(matches) > 0)
+				if searchMetadata && metadata != nil {
+					if text := metadataText(metadata); text != "" && query.pattern.MatchString(text) {
+						match := Match{Line: text, FileName: metadataFileName, hits: []string{text}}
+						if sink != nil {
+							if err := sink(match); err != nil {
+								return err
+							}
 						}
+						matches = append([]Match{match}, matches...)
 					}
+				}
 
-					// send this result to the handler
-					result := &SearchResult{
-						Path:     path,
-						Metadata: metadata,
-						Matches:  matches,
+				// books below the minimum match count are low-signal and skipped like books that do not match
+				if !query.matchesCombined(matches) || len(matches) < request.MinMatches {
+					if contentErr == nil {
+						continue
 					}
-					if err := handler(result); err != nil {
+					matches = nil
+				}
+				query.tagMatches(matches)
+				query.captureMatches(matches)
+				if request.MarkHTML {
+					query.markMatches(matches)
+				}
+				if request.Highlight {
+					query.highlightMatches(matches, highlightStart, highlightEnd)
+				}
+
+				if extractMetadata && !metadataFirst {
+					var ok bool
+					var err error
+					if metadata, ok, err = loadMetadata(ctx, path); err != nil {
 						return err
+					} else if !ok {
+						continue
 					}
 				}
+				if !s.extractMetadata {
+					metadata = nil
+				}
+
+				// send this result to the handler
+				result := &SearchResult{
+					Path:                   path,
+					Metadata:               metadata,
+					Matches:                matches,
+					DistinctPatternMatches: query.distinctPatterns(matches),
+				}
+				if info != nil {
+					result.EntryStats = info.entryStats
+					result.Truncated = info.truncated
+					result.Repaired = info.repairedLines > 0
+				}
+				if contentErr != nil {
+					result.ContentError = contentErr.Error()
+				}
+				if err := emit(ctx, result); err != nil {
+					return err
+				}
 			}
 			return nil
 		})
 	}
 
-	return p.Wait()
+	if err := p.Wait(); err != nil {
+		return err
+	}
+
+	if paginate {
+		for _, result := range paginateResults(buffered, request.SortBy, request.Offset, request.Limit) {
+			if err := handler(ctx, result); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
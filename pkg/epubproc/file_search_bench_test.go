@@ -3,6 +3,7 @@ package epubproc
 import (
 	"context"
 	"fmt"
+	"os"
 	"regexp"
 	"runtime"
 	"strings"
@@ -58,7 +59,7 @@ func BenchmarkScanTextFile_Small(b *testing.B) {
 
 	for b.Loop() {
 		reader := strings.NewReader(content)
-		matches := scanTextFile(reader, pattern, "test.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 		if len(matches) == 0 {
 			b.Fatal("Expected matches but got none")
 		}
@@ -74,7 +75,7 @@ func BenchmarkScanTextFile_Medium(b *testing.B) {
 
 	for b.Loop() {
 		reader := strings.NewReader(content)
-		matches := scanTextFile(reader, pattern, "test.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 		if len(matches) == 0 {
 			b.Fatal("Expected matches but got none")
 		}
@@ -90,7 +91,7 @@ func BenchmarkScanTextFile_Large(b *testing.B) {
 
 	for b.Loop() {
 		reader := strings.NewReader(content)
-		matches := scanTextFile(reader, pattern, "test.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 		if len(matches) == 0 {
 			b.Fatal("Expected matches but got none")
 		}
@@ -106,7 +107,7 @@ func BenchmarkScanTextFile_WithContext(b *testing.B) {
 
 	for b.Loop() {
 		reader := strings.NewReader(content)
-		matches := scanTextFile(reader, pattern, "test.txt", 2)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{contextLines: 2})
 		if len(matches) == 0 {
 			b.Fatal("Expected matches but got none")
 		}
@@ -123,7 +124,7 @@ func BenchmarkScanHTMLFile_Small(b *testing.B) {
 
 	for b.Loop() {
 		reader := strings.NewReader(content)
-		matches := scanHTMLFile(ctx, reader, pattern, "test.html", 0)
+		matches, _ := scanHTMLFile(ctx, reader, pattern, "test.html", scanOptions{})
 		if len(matches) == 0 {
 			b.Fatal("Expected matches but got none")
 		}
@@ -140,7 +141,7 @@ func BenchmarkScanHTMLFile_Medium(b *testing.B) {
 
 	for b.Loop() {
 		reader := strings.NewReader(content)
-		matches := scanHTMLFile(ctx, reader, pattern, "test.html", 0)
+		matches, _ := scanHTMLFile(ctx, reader, pattern, "test.html", scanOptions{})
 		if len(matches) == 0 {
 			b.Fatal("Expected matches but got none")
 		}
@@ -157,7 +158,7 @@ func BenchmarkScanHTMLFile_Large(b *testing.B) {
 
 	for b.Loop() {
 		reader := strings.NewReader(content)
-		matches := scanHTMLFile(ctx, reader, pattern, "test.html", 0)
+		matches, _ := scanHTMLFile(ctx, reader, pattern, "test.html", scanOptions{})
 		if len(matches) == 0 {
 			b.Fatal("Expected matches but got none")
 		}
@@ -174,13 +175,49 @@ func BenchmarkScanHTMLFile_WithContext(b *testing.B) {
 
 	for b.Loop() {
 		reader := strings.NewReader(content)
-		matches := scanHTMLFile(ctx, reader, pattern, "test.html", 2)
+		matches, _ := scanHTMLFile(ctx, reader, pattern, "test.html", scanOptions{contextLines: 2})
 		if len(matches) == 0 {
 			b.Fatal("Expected matches but got none")
 		}
 	}
 }
 
+// BenchmarkScanHTMLNoContext compares matching html blocks as they are read, as scanHTMLFile does without context
+// lines, against reading every block of the file first.
+func BenchmarkScanHTMLNoContext(b *testing.B) {
+	content := generateLargeHTMLContent(5000, "target")
+	pattern, _ := regexp.Compile("target")
+	ctx := context.Background()
+
+	b.Run("Streamed", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for b.Loop() {
+			matches, _ := scanHTMLFile(ctx, strings.NewReader(content), pattern, "test.html", scanOptions{})
+			if len(matches) == 0 {
+				b.Fatal("Expected matches but got none")
+			}
+		}
+	})
+
+	b.Run("Buffered", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for b.Loop() {
+			blocks, _, _ := readHTMLBlocks(ctx, strings.NewReader(content), "test.html", scanOptions{})
+			var matches []Match
+			for i, line := range blocks.lines {
+				if pattern.MatchString(line) {
+					matches = append(matches, Match{Line: line, FileName: "test.html", ParagraphIndex: i + 1})
+				}
+			}
+			if len(matches) == 0 {
+				b.Fatal("Expected matches but got none")
+			}
+		}
+	})
+}
+
 // BenchmarkConcurrentTextScanning benchmarks concurrent text file scanning.
 func BenchmarkConcurrentTextScanning(b *testing.B) {
 	content := generateLargeTextContent(500, "target")
@@ -194,7 +231,7 @@ func BenchmarkConcurrentTextScanning(b *testing.B) {
 		for range numWorkers {
 			wg.Go(func() {
 				reader := strings.NewReader(content)
-				matches := scanTextFile(reader, pattern, "test.txt", 0)
+				matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 				if len(matches) == 0 {
 					b.Error("Expected matches but got none")
 				}
@@ -219,7 +256,7 @@ func BenchmarkConcurrentHTMLScanning(b *testing.B) {
 		for range numWorkers {
 			wg.Go(func() {
 				reader := strings.NewReader(content)
-				matches := scanHTMLFile(ctx, reader, pattern, "test.html", 0)
+				matches, _ := scanHTMLFile(ctx, reader, pattern, "test.html", scanOptions{})
 				if len(matches) == 0 {
 					b.Error("Expected matches but got none")
 				}
@@ -241,7 +278,7 @@ func BenchmarkRegexVsTextSearch(b *testing.B) {
 
 		for b.Loop() {
 			reader := strings.NewReader(content)
-			matches := scanTextFile(reader, pattern, "test.txt", 0)
+			matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 			if len(matches) == 0 {
 				b.Fatal("Expected matches but got none")
 			}
@@ -255,7 +292,7 @@ func BenchmarkRegexVsTextSearch(b *testing.B) {
 
 		for b.Loop() {
 			reader := strings.NewReader(content)
-			matches := scanTextFile(reader, pattern, "test.txt", 0)
+			matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 			if len(matches) == 0 {
 				b.Fatal("Expected matches but got none")
 			}
@@ -269,7 +306,7 @@ func BenchmarkRegexVsTextSearch(b *testing.B) {
 
 		for b.Loop() {
 			reader := strings.NewReader(content)
-			matches := scanTextFile(reader, pattern, "test.txt", 0)
+			matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 			if len(matches) == 0 {
 				b.Fatal("Expected matches but got none")
 			}
@@ -288,7 +325,7 @@ func BenchmarkPoolEffectiveness(b *testing.B) {
 
 		for b.Loop() {
 			reader := strings.NewReader(content)
-			matches := scanTextFile(reader, pattern, "test.txt", 0)
+			matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 			if len(matches) == 0 {
 				b.Fatal("Expected matches but got none")
 			}
@@ -322,7 +359,7 @@ func BenchmarkMemoryUsage(b *testing.B) {
 
 			for b.Loop() {
 				reader := strings.NewReader(content)
-				matches := scanTextFile(reader, pattern, "test.txt", 0)
+				matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 				if len(matches) == 0 {
 					b.Fatal("Expected matches but got none")
 				}
@@ -346,7 +383,7 @@ func BenchmarkMemoryUsage(b *testing.B) {
 
 			for b.Loop() {
 				reader := strings.NewReader(content)
-				matches := scanHTMLFile(ctx, reader, pattern, "test.html", 0)
+				matches, _ := scanHTMLFile(ctx, reader, pattern, "test.html", scanOptions{})
 				if len(matches) == 0 {
 					b.Fatal("Expected matches but got none")
 				}
@@ -376,7 +413,7 @@ func BenchmarkHighConcurrency(b *testing.B) {
 				for range concurrency {
 					wg.Go(func() {
 						reader := strings.NewReader(content)
-						matches := scanTextFile(reader, pattern, "test.txt", 0)
+						matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 						if len(matches) == 0 {
 							b.Error("Expected matches but got none")
 						}
@@ -388,3 +425,84 @@ func BenchmarkHighConcurrency(b *testing.B) {
 		})
 	}
 }
+
+// BenchmarkSearchWorkers compares scan worker counts against a fixed corpus of epub files.
+func BenchmarkSearchWorkers(b *testing.B) {
+	tempDir, err := os.MkdirTemp("", "search_workers_bench_*")
+	if err != nil {
+		b.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	content := generateLargeHTMLContent(2000, "target")
+	for i := range 32 {
+		if _, err := createTestEPUB(tempDir, fmt.Sprintf("book%02d.epub", i), content); err != nil {
+			b.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	request := &SearchRequest{
+		Query: SearchRequestQuery{
+			Text: &SearchRequestText{
+				Value: "target",
+			},
+		},
+	}
+
+	for _, workers := range []int{1, 2, 4, 8, 16, 32} {
+		b.Run(fmt.Sprintf("Workers%d", workers), func(b *testing.B) {
+			fs := NewFileSearch(tempDir, runtime.NumCPU(), false, WithScanWorkers(workers))
+			b.ReportAllocs()
+
+			for b.Loop() {
+				err := fs.Search(context.Background(), request, func(result *SearchResult) error {
+					return nil
+				})
+				if err != nil {
+					b.Fatalf("Search failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSearchThreads compares thread counts in multiples of the CPU count, which AutoThreads is based on.
+// Extra threads only pay off while others wait on reads, so run it with the corpus on the storage to tune for.
+func BenchmarkSearchThreads(b *testing.B) {
+	tempDir, err := os.MkdirTemp("", "search_threads_bench_*")
+	if err != nil {
+		b.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	content := generateLargeHTMLContent(2000, "target")
+	for i := range 64 {
+		if _, err := createTestEPUB(tempDir, fmt.Sprintf("book%02d.epub", i), content); err != nil {
+			b.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	request := &SearchRequest{
+		Query: SearchRequestQuery{
+			Text: &SearchRequestText{
+				Value: "target",
+			},
+		},
+	}
+
+	for _, multiplier := range []int{1, 2, 3, 4, 8} {
+		b.Run(fmt.Sprintf("%dxCPU", multiplier), func(b *testing.B) {
+			fs := NewFileSearch(tempDir, runtime.NumCPU()*multiplier, true)
+			b.ReportAllocs()
+
+			for b.Loop() {
+				err := fs.Search(context.Background(), request, func(result *SearchResult) error {
+					return nil
+				})
+				if err != nil {
+					b.Fatalf("Search failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -2,14 +2,23 @@ package epubproc
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 // createTestEPUB creates a minimal test file with specified content
@@ -364,6 +373,46 @@ func TestFileSearchErrorCases(t *testing.T) {
 		}
 	})
 
+	// test invalid internal glob pattern
+	t.Run("InvalidInternalGlob", func(t *testing.T) {
+		request := &SearchRequest{
+			Query: SearchRequestQuery{
+				Text: &SearchRequestText{
+					Value: "test",
+				},
+			},
+			IncludeInternalGlobs: []string{"chapter[*.html"},
+		}
+
+		err := fs.Search(ctx, request, func(result *SearchResult) error {
+			return nil
+		})
+
+		if err == nil || !strings.Contains(err.Error(), "invalid glob") {
+			t.Errorf("Expected invalid glob error, got: %v", err)
+		}
+	})
+
+	// test negative pagination values
+	t.Run("InvalidPagination", func(t *testing.T) {
+		request := &SearchRequest{
+			Query: SearchRequestQuery{
+				Text: &SearchRequestText{
+					Value: "test",
+				},
+			},
+			Offset: -1,
+		}
+
+		err := fs.Search(ctx, request, func(result *SearchResult) error {
+			return nil
+		})
+
+		if err == nil || !strings.Contains(err.Error(), "invalid offset") {
+			t.Errorf("Expected invalid offset error, got: %v", err)
+		}
+	})
+
 	// test handler error propagation
 	t.Run("HandlerError", func(t *testing.T) {
 		// create a test file
@@ -412,3 +461,1372 @@ func TestFileSearchErrorCases(t *testing.T) {
 		}
 	})
 }
+
+// TestFileSearchPagination tests that Offset and Limit return stable pages of results
+func TestFileSearchPagination(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_pagination_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// five matching books and one without a match
+	for i := 1; i <= 5; i++ {
+		if _, err := createTestEPUB(tempDir, fmt.Sprintf("book%d.epub", i), "<p>Holmes was here.</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+	if _, err := createTestEPUB(tempDir, "book0.epub", "<p>Nobody was here.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	fs := NewFileSearch(tempDir, 4, false)
+
+	search := func(offset, limit int) []string {
+		request := &SearchRequest{
+			Query: SearchRequestQuery{
+				Text: &SearchRequestText{
+					Value: "Holmes",
+				},
+			},
+			Offset: offset,
+			Limit:  limit,
+		}
+
+		var names []string
+		err := fs.Search(context.Background(), request, func(result *SearchResult) error {
+			names = append(names, filepath.Base(result.Path))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return names
+	}
+
+	testCases := []struct {
+		name     string
+		offset   int
+		limit    int
+		expected []string
+	}{
+		{"FirstPage", 0, 2, []string{"book1.epub", "book2.epub"}},
+		{"SecondPage", 2, 2, []string{"book3.epub", "book4.epub"}},
+		{"PartialLastPage", 4, 2, []string{"book5.epub"}},
+		{"PastEnd", 6, 2, nil},
+		{"OffsetOnly", 3, 0, []string{"book4.epub", "book5.epub"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			names := search(tc.offset, tc.limit)
+			if !slices.Equal(names, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+// TestFileSearchSortByRelevance tests ordering results by match count, with ties broken by path
+func TestFileSearchSortByRelevance(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_relevance_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{
+		"a_one.epub":   "<p>Holmes.</p>",
+		"b_three.epub": "<p>Holmes.</p><p>Holmes again.</p><p>Holmes once more.</p>",
+		"c_two.epub":   "<p>Holmes.</p><p>Holmes again.</p>",
+		"d_one.epub":   "<p>Holmes.</p>",
+		"e_none.epub":  "<p>Nobody.</p>",
+	}
+	for name, content := range books {
+		if _, err := createTestEPUB(tempDir, name, content); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	fs := NewFileSearch(tempDir, 4, false)
+
+	search := func(sortBy ResultSort, limit int) ([]string, error) {
+		request := &SearchRequest{
+			Query:  SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}},
+			SortBy: sortBy,
+			Limit:  limit,
+		}
+
+		var names []string
+		err := fs.Search(context.Background(), request, func(result *SearchResult) error {
+			names = append(names, filepath.Base(result.Path))
+			return nil
+		})
+		return names, err
+	}
+
+	testCases := []struct {
+		name     string
+		sortBy   ResultSort
+		limit    int
+		expected []string
+	}{
+		{"Relevance", SortByRelevance, 0, []string{"b_three.epub", "c_two.epub", "a_one.epub", "d_one.epub"}},
+		{"RelevanceWithLimit", SortByRelevance, 2, []string{"b_three.epub", "c_two.epub"}},
+		{"Path", SortByPath, 0, []string{"a_one.epub", "b_three.epub", "c_two.epub", "d_one.epub"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			names, err := search(tc.sortBy, tc.limit)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if !slices.Equal(names, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, names)
+			}
+		})
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		if _, err := search("size", 0); err == nil || !strings.Contains(err.Error(), "unsupported sort order") {
+			t.Errorf("Expected an unsupported sort order error, got %v", err)
+		}
+	})
+}
+
+// TestFileSearchMinMatches tests skipping books with fewer matches than the minimum
+func TestFileSearchMinMatches(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_min_matches_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{
+		"one.epub":  "<p>Holmes.</p>",
+		"five.epub": strings.Repeat("<p>Holmes again.</p>", 5),
+	}
+	for name, content := range books {
+		if _, err := createTestEPUB(tempDir, name, content); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	search := func(minMatches int) (map[string]int, error) {
+		request := &SearchRequest{
+			Query:      SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}},
+			MinMatches: minMatches,
+		}
+
+		counts := make(map[string]int)
+		var mutex sync.Mutex
+		err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			counts[filepath.Base(result.Path)] = len(result.Matches)
+			return nil
+		})
+		return counts, err
+	}
+
+	t.Run("Threshold", func(t *testing.T) {
+		counts, err := search(3)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(counts) != 1 || counts["five.epub"] != 5 {
+			t.Errorf("Expected only five.epub with 5 matches, got %v", counts)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		counts, err := search(0)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(counts) != 2 {
+			t.Errorf("Expected 2 results, got %v", counts)
+		}
+	})
+
+	t.Run("Negative", func(t *testing.T) {
+		if _, err := search(-1); err == nil || !strings.Contains(err.Error(), "must not be negative") {
+			t.Errorf("Expected a negative minimum error, got %v", err)
+		}
+	})
+}
+
+// TestFileSearchFailFast tests returning the first file error instead of skipping the unreadable book
+func TestFileSearchFailFast(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_fail_fast_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "valid.epub", "<p>Holmes.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "corrupt.epub"), []byte("not a zip archive"), 0o644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	search := func(dir string, failFast, extractMetadata bool) (int, error) {
+		request := &SearchRequest{
+			Query:    SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}},
+			FailFast: failFast,
+		}
+
+		var results atomic.Int64
+		err := NewFileSearch(dir, 2, extractMetadata).Search(context.Background(), request, func(result *SearchResult) error {
+			results.Add(1)
+			return nil
+		})
+		return int(results.Load()), err
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		results, err := search(tempDir, false, false)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if results != 1 {
+			t.Errorf("Expected 1 result, got %d", results)
+		}
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		_, err := search(tempDir, true, false)
+		if err == nil || !strings.Contains(err.Error(), "corrupt.epub") {
+			t.Errorf("Expected an error for corrupt.epub, got %v", err)
+		}
+	})
+
+	t.Run("EnabledWithMetadata", func(t *testing.T) {
+		_, err := search(tempDir, true, true)
+		if err == nil || !strings.Contains(err.Error(), "corrupt.epub") {
+			t.Errorf("Expected an error for corrupt.epub, got %v", err)
+		}
+	})
+
+	t.Run("UnreadableChapter", func(t *testing.T) {
+		chapterDir := filepath.Join(tempDir, "chapters")
+		if err := os.Mkdir(chapterDir, 0o755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if _, err := createTestEPUBWithUnreadableChapter(chapterDir, "broken.epub", "<p>Holmes.</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		_, err := search(chapterDir, true, false)
+		if err == nil || !strings.Contains(err.Error(), "broken.epub") {
+			t.Errorf("Expected an error for broken.epub, got %v", err)
+		}
+	})
+}
+
+// TestFileSearchSearchContext tests that the handler receives the search context, which is cancelled when another
+// handler fails or the caller cancels the search
+func TestFileSearchSearchContext(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_search_context_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, name := range []string{"one.epub", "two.epub"} {
+		if _, err := createTestEPUB(tempDir, name, "<p>Holmes.</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	request := &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}}}
+
+	t.Run("HandlerError", func(t *testing.T) {
+		// the first handler waits for the search to be cancelled by the second one failing
+		handlerErr := errors.New("handler failed")
+		var calls atomic.Int32
+		var cancelled atomic.Bool
+		err := NewFileSearch(tempDir, 2, false).SearchContext(context.Background(), request, func(ctx context.Context, result *SearchResult) error {
+			if calls.Add(1) > 1 {
+				return handlerErr
+			}
+			select {
+			case <-ctx.Done():
+				cancelled.Store(true)
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+				return nil
+			}
+		})
+		if !errors.Is(err, handlerErr) {
+			t.Errorf("Expected the handler error, got %v", err)
+		}
+		if !cancelled.Load() {
+			t.Error("Expected the waiting handler to see the search context cancelled")
+		}
+	})
+
+	t.Run("CallerCancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var handlerErr error
+		err := NewFileSearch(tempDir, 1, false).SearchContext(ctx, request, func(ctx context.Context, result *SearchResult) error {
+			cancel()
+			handlerErr = ctx.Err()
+			return handlerErr
+		})
+		if !errors.Is(handlerErr, context.Canceled) {
+			t.Errorf("Expected the handler context to be cancelled, got %v", handlerErr)
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected a cancelled search, got %v", err)
+		}
+	})
+}
+
+// createTestEPUBWithUnreadableChapter creates an ePUB with valid metadata, a readable chapter, and a corrupt chapter
+func createTestEPUBWithUnreadableChapter(dir, filename, readable string) (string, error) {
+	epubPath := filepath.Join(dir, filename)
+
+	zipFile, err := os.Create(epubPath)
+	if err != nil {
+		return "", err
+	}
+	defer zipFile.Close()
+
+	writer := zip.NewWriter(zipFile)
+	defer writer.Close()
+
+	files := map[string]string{
+		"mimetype": "application/epub+zip",
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`,
+		"OEBPS/content.opf": `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>The Lost Chapter</dc:title>
+    <dc:creator>Arthur Conan Doyle</dc:creator>
+  </metadata>
+</package>`,
+		"OEBPS/chapter1.html": readable,
+	}
+
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			return "", err
+		}
+		file.Write([]byte(content))
+	}
+
+	// store the chapter with corrupt deflate data so reading it fails
+	broken := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	file, err := writer.CreateRaw(&zip.FileHeader{
+		Name:               "OEBPS/chapter2.html",
+		Method:             zip.Deflate,
+		CompressedSize64:   uint64(len(broken)),
+		UncompressedSize64: uint64(len(broken)),
+	})
+	if err != nil {
+		return "", err
+	}
+	file.Write(broken)
+
+	return epubPath, nil
+}
+
+// TestFileSearchMatchHandler tests streaming each match to a match handler before the result of its book
+func TestFileSearchMatchHandler(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_match_handler_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for i := range 3 {
+		content := strings.Repeat("<p>Holmes was here.</p><p>Watson was not.</p>", i+1)
+		if _, err := createTestEPUB(tempDir, fmt.Sprintf("book%d.epub", i), content); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	query := SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}}
+
+	t.Run("CountsMatches", func(t *testing.T) {
+		var mu sync.Mutex
+		streamed := make(map[string]int)
+		var results []*SearchResult
+
+		request := &SearchRequest{
+			Query: query,
+			MatchHandler: func(path string, match Match) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if slices.ContainsFunc(results, func(result *SearchResult) bool { return result.Path == path }) {
+					t.Errorf("Expected matches of %s before its result", path)
+				}
+				if match.Metadata == nil || match.Metadata.Chapter == nil || *match.Metadata.Chapter != "chapter1" {
+					t.Errorf("Expected chapter 'chapter1' on a streamed match, got %+v", match.Metadata)
+				}
+				streamed[path]++
+				return nil
+			},
+		}
+
+		err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			results = append(results, result)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+
+		if len(results) != 3 {
+			t.Fatalf("Expected 3 results, got %d", len(results))
+		}
+		total := 0
+		for _, result := range results {
+			if streamed[result.Path] != len(result.Matches) {
+				t.Errorf("Expected %d streamed matches for %s, got %d", len(result.Matches), result.Path, streamed[result.Path])
+			}
+			total += streamed[result.Path]
+		}
+		if total != 6 {
+			t.Errorf("Expected 6 streamed matches, got %d", total)
+		}
+	})
+
+	t.Run("HandlerError", func(t *testing.T) {
+		errStop := errors.New("stop")
+		request := &SearchRequest{
+			Query: query,
+			MatchHandler: func(path string, match Match) error {
+				return errStop
+			},
+		}
+
+		err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+			t.Errorf("Expected no results, got %s", result.Path)
+			return nil
+		})
+		if !errors.Is(err, errStop) {
+			t.Errorf("Expected the match handler error, got %v", err)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		handler := func(path string, match Match) error { return nil }
+		requests := map[string]*SearchRequest{
+			"CombineAnd": {
+				Query: SearchRequestQuery{
+					Combine:    CombineAnd,
+					SubQueries: []SearchRequestQuery{query, {Text: &SearchRequestText{Value: "Watson"}}},
+				},
+				MatchHandler: handler,
+			},
+			"Limit": {Query: query, Limit: 1, MatchHandler: handler},
+		}
+		for name, request := range requests {
+			err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(*SearchResult) error { return nil })
+			if err == nil || !strings.Contains(err.Error(), "streaming matches") {
+				t.Errorf("%s: expected a streaming error, got %v", name, err)
+			}
+		}
+	})
+}
+
+// TestFileSearchContentErrors tests reporting of books whose content could not be fully read
+func TestFileSearchContentErrors(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_content_errors_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUBWithUnreadableChapter(tempDir, "broken.epub", "<p>Nothing to see here.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	search := func(t *testing.T, extractMetadata bool, request *SearchRequest) []*SearchResult {
+		fs := NewFileSearch(tempDir, 2, extractMetadata)
+
+		var results []*SearchResult
+		var mu sync.Mutex
+		err := fs.Search(context.Background(), request, func(result *SearchResult) error {
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return results
+	}
+
+	query := SearchRequestQuery{
+		Text: &SearchRequestText{
+			Value: "Holmes",
+		},
+	}
+
+	// test that the book is skipped by default
+	t.Run("SkippedByDefault", func(t *testing.T) {
+		results := search(t, true, &SearchRequest{Query: query})
+		if len(results) != 0 {
+			t.Errorf("Expected no results, got %d", len(results))
+		}
+	})
+
+	// test that the book is reported with its metadata and content error
+	t.Run("ReportedWithMetadata", func(t *testing.T) {
+		results := search(t, true, &SearchRequest{Query: query, ReportContentErrors: true})
+		if len(results) != 1 {
+			t.Fatalf("Expected 1 result, got %d", len(results))
+		}
+
+		result := results[0]
+		if result.Metadata.Title != "The Lost Chapter" {
+			t.Errorf("Expected title 'The Lost Chapter', got '%s'", result.Metadata.Title)
+		}
+		if !strings.Contains(result.ContentError, "chapter2.html") {
+			t.Errorf("Expected content error for chapter2.html, got '%s'", result.ContentError)
+		}
+		if len(result.Matches) != 0 {
+			t.Errorf("Expected no matches, got %v", result.Matches)
+		}
+	})
+
+	// test that metadata filters still apply before the content is read
+	t.Run("MetadataFilterApplied", func(t *testing.T) {
+		request := &SearchRequest{
+			Query:               query,
+			ReportContentErrors: true,
+			Filters: &SearchRequestFilters{
+				AuthorEquals: "Agatha Christie",
+			},
+		}
+
+		results := search(t, true, request)
+		if len(results) != 0 {
+			t.Errorf("Expected no results, got %d", len(results))
+		}
+	})
+
+	// test that matches from readable chapters are still returned
+	t.Run("ReadableMatchesKept", func(t *testing.T) {
+		if _, err := createTestEPUBWithUnreadableChapter(tempDir, "partial.epub", "<p>Holmes is in the readable chapter.</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+		defer os.Remove(filepath.Join(tempDir, "partial.epub"))
+
+		request := &SearchRequest{
+			Query:               query,
+			ReportContentErrors: true,
+			Filters: &SearchRequestFilters{
+				FilesIn: []string{filepath.Join(tempDir, "partial.epub")},
+			},
+		}
+
+		results := search(t, false, request)
+		if len(results) != 1 {
+			t.Fatalf("Expected 1 result, got %d", len(results))
+		}
+		if len(results[0].Matches) != 1 || results[0].ContentError == "" {
+			t.Errorf("Expected 1 match and a content error, got %v and '%s'", results[0].Matches, results[0].ContentError)
+		}
+	})
+}
+
+// trackingExtractor wraps a MetadataExtractor to record the peak number of concurrent ProcessFile calls
+type trackingExtractor struct {
+	MetadataExtractor
+	active, highWater *atomic.Int64
+}
+
+// ProcessFile extracts the metadata of a file, holding the extraction long enough for concurrent calls to overlap.
+func (e trackingExtractor) ProcessFile(ctx context.Context, epubPath string) (*Metadata, error) {
+	current := e.active.Add(1)
+	defer e.active.Add(-1)
+	for {
+		peak := e.highWater.Load()
+		if current <= peak || e.highWater.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return e.MetadataExtractor.ProcessFile(ctx, epubPath)
+}
+
+// TestFileSearchMetadataWorkers tests limiting concurrent metadata extraction separately from scanning
+func TestFileSearchMetadataWorkers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_workers_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for i := range 6 {
+		if _, err := createTestEPUB(tempDir, fmt.Sprintf("book%d.epub", i), "<p>Holmes was here.</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	var active, highWater atomic.Int64
+	originalExtractor := newSearchMetadataExtractor
+	defer func() { newSearchMetadataExtractor = originalExtractor }()
+	newSearchMetadataExtractor = func(maxThreads int, opts ...MetadataExtractorOption) MetadataExtractor {
+		return trackingExtractor{MetadataExtractor: NewMetadataExtractor(maxThreads, opts...), active: &active, highWater: &highWater}
+	}
+
+	request := &SearchRequest{
+		Query: SearchRequestQuery{
+			Text: &SearchRequestText{
+				Value: "Holmes",
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		opts    []FileSearchOption
+		atMost  int64
+		atLeast int64
+	}{
+		{name: "Limited", opts: []FileSearchOption{WithScanWorkers(6), WithMetadataWorkers(1)}, atMost: 1, atLeast: 1},
+		{name: "Unlimited", opts: []FileSearchOption{WithScanWorkers(6)}, atMost: 6, atLeast: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			highWater.Store(0)
+
+			var results []*SearchResult
+			var mu sync.Mutex
+			err := NewFileSearch(tempDir, 2, true, test.opts...).Search(context.Background(), request, func(result *SearchResult) error {
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+
+			if len(results) != 6 {
+				t.Fatalf("Expected 6 results, got %d", len(results))
+			}
+			for _, result := range results {
+				if result.Metadata.Title == "" {
+					t.Errorf("Expected metadata for %s", result.Path)
+				}
+			}
+			if peak := highWater.Load(); peak < test.atLeast || peak > test.atMost {
+				t.Errorf("Expected %d to %d concurrent metadata extractions, got %d", test.atLeast, test.atMost, peak)
+			}
+		})
+	}
+}
+
+// TestFileSearchExplicitFiles tests searching an explicit list of files instead of walking the directory
+func TestFileSearchExplicitFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_files_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	listed, err := createTestEPUB(tempDir, "listed.epub", "<p>Holmes is listed.</p>")
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	if _, err := createTestEPUB(tempDir, "unlisted.epub", "<p>Holmes is not listed.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	// the directory is never walked, so it does not need to exist
+	fs := NewFileSearch(filepath.Join(tempDir, "missing"), 2, false)
+	request := &SearchRequest{
+		Query: SearchRequestQuery{
+			Text: &SearchRequestText{
+				Value: "Holmes",
+			},
+		},
+		Files: []string{"", listed, "  ", filepath.Join(tempDir, "nonexistent.epub"), tempDir},
+	}
+
+	var paths []string
+	var mu sync.Mutex
+	err = fs.Search(context.Background(), request, func(result *SearchResult) error {
+		mu.Lock()
+		paths = append(paths, result.Path)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	if len(paths) != 1 || paths[0] != listed {
+		t.Errorf("Expected only %s, got %v", listed, paths)
+	}
+}
+
+// TestFileSearchModifiedSince tests searching only the epubs modified after a given time
+func TestFileSearchModifiedSince(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_modified_since_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// every book is two days old except the one touched now
+	old := time.Now().Add(-48 * time.Hour)
+	var paths []string
+	for _, name := range []string{"old1.epub", "touched.epub", "old2.epub"} {
+		path, err := createTestEPUB(tempDir, name, "<p>Holmes.</p>")
+		if err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	touched := filepath.Join(tempDir, "touched.epub")
+	now := time.Now()
+	if err := os.Chtimes(touched, now, now); err != nil {
+		t.Fatalf("Failed to touch file: %v", err)
+	}
+
+	search := func(request *SearchRequest) []string {
+		request.Query = SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}}
+
+		var found []string
+		var mu sync.Mutex
+		err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+			mu.Lock()
+			found = append(found, result.Path)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return found
+	}
+
+	since := now.Add(-24 * time.Hour)
+
+	t.Run("Walk", func(t *testing.T) {
+		if found := search(&SearchRequest{ModifiedSince: since}); len(found) != 1 || found[0] != touched {
+			t.Errorf("Expected only %s, got %v", touched, found)
+		}
+	})
+
+	t.Run("ExplicitFiles", func(t *testing.T) {
+		if found := search(&SearchRequest{ModifiedSince: since, Files: paths}); len(found) != 1 || found[0] != touched {
+			t.Errorf("Expected only %s, got %v", touched, found)
+		}
+	})
+
+	t.Run("ZeroSearchesAll", func(t *testing.T) {
+		if found := search(&SearchRequest{}); len(found) != 3 {
+			t.Errorf("Expected 3 results, got %v", found)
+		}
+	})
+}
+
+// TestFileSearchDescription tests matching the query against the book description
+func TestFileSearchDescription(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_description_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// the chapter of this book only contains "Test content"
+	if _, err := createTestEPUBWithMetadata(tempDir, "blurb.epub", TestEPUBMetadata{
+		Title:       "The Lighthouse",
+		Description: "<p>A keeper discovers the <b>haunted lighthouse</b> is not empty.</p><p>A gripping tale.</p>",
+	}); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	query := SearchRequestQuery{
+		Text: &SearchRequestText{
+			Value: "haunted lighthouse",
+		},
+	}
+
+	search := func(t *testing.T, request *SearchRequest) []*SearchResult {
+		var results []*SearchResult
+		var mu sync.Mutex
+		err := NewFileSearch(tempDir, 2, true).Search(context.Background(), request, func(result *SearchResult) error {
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return results
+	}
+
+	t.Run("NotSearchedByDefault", func(t *testing.T) {
+		results := search(t, &SearchRequest{Query: query})
+		if len(results) != 0 {
+			t.Errorf("Expected no results, got %d", len(results))
+		}
+	})
+
+	t.Run("DescriptionOnlyMatch", func(t *testing.T) {
+		results := search(t, &SearchRequest{Query: query, SearchDescription: true})
+		if len(results) != 1 {
+			t.Fatalf("Expected 1 result, got %d", len(results))
+		}
+
+		matches := results[0].Matches
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+		if matches[0].FileName != "description" {
+			t.Errorf("Expected FileName 'description', got '%s'", matches[0].FileName)
+		}
+		if matches[0].Line != "A keeper discovers the haunted lighthouse is not empty." {
+			t.Errorf("Expected the description paragraph, got '%s'", matches[0].Line)
+		}
+	})
+
+	t.Run("RequiresMetadataExtraction", func(t *testing.T) {
+		err := NewFileSearch(tempDir, 2, false).Search(context.Background(), &SearchRequest{Query: query, SearchDescription: true}, func(result *SearchResult) error {
+			return nil
+		})
+		if err == nil {
+			t.Error("Expected an error without metadata extraction")
+		}
+	})
+}
+
+// TestFileSearchMetadata tests matching the query against the title, authors and series of a book as one text
+func TestFileSearchMetadata(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_metadata_search_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// the chapters of these books only contain "Test content"
+	if _, err := createTestEPUBWithMetadata(tempDir, "scarlet.epub", TestEPUBMetadata{
+		Title:    "A Study in Scarlet",
+		Authors:  []string{"Arthur Conan Doyle"},
+		MetaTags: map[string]string{"calibre:series": "Sherlock Holmes"},
+	}); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	if _, err := createTestEPUBWithMetadata(tempDir, "other.epub", TestEPUBMetadata{
+		Title:   "Scarlet Letters",
+		Authors: []string{"Nathaniel Hawthorne"},
+	}); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	search := func(t *testing.T, value string, request *SearchRequest) []*SearchResult {
+		var results []*SearchResult
+		var mu sync.Mutex
+		request.Query = SearchRequestQuery{Text: &SearchRequestText{Value: value, IgnoreCase: true}}
+		err := NewFileSearch(tempDir, 2, true).Search(context.Background(), request, func(result *SearchResult) error {
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return results
+	}
+
+	t.Run("NotSearchedByDefault", func(t *testing.T) {
+		if results := search(t, "Scarlet Arthur", &SearchRequest{}); len(results) != 0 {
+			t.Errorf("Expected no results, got %d", len(results))
+		}
+	})
+
+	t.Run("TitleAndAuthor", func(t *testing.T) {
+		results := search(t, "scarlet arthur conan", &SearchRequest{SearchMetadata: true})
+		if len(results) != 1 {
+			t.Fatalf("Expected 1 result, got %d", len(results))
+		}
+		if filepath.Base(results[0].Path) != "scarlet.epub" {
+			t.Errorf("Expected scarlet.epub, got %s", results[0].Path)
+		}
+
+		matches := results[0].Matches
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+		if matches[0].FileName != "metadata" {
+			t.Errorf("Expected FileName 'metadata', got '%s'", matches[0].FileName)
+		}
+		if expected := "A Study in Scarlet Arthur Conan Doyle Sherlock Holmes"; matches[0].Line != expected {
+			t.Errorf("Expected '%s', got '%s'", expected, matches[0].Line)
+		}
+	})
+
+	t.Run("AuthorAndSeries", func(t *testing.T) {
+		if results := search(t, "Doyle Sherlock", &SearchRequest{SearchMetadata: true}); len(results) != 1 {
+			t.Errorf("Expected 1 result, got %d", len(results))
+		}
+	})
+
+	t.Run("SharedTitleWord", func(t *testing.T) {
+		if results := search(t, "Scarlet", &SearchRequest{SearchMetadata: true}); len(results) != 2 {
+			t.Errorf("Expected 2 results, got %d", len(results))
+		}
+	})
+
+	t.Run("RequiresMetadataExtraction", func(t *testing.T) {
+		request := &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "Scarlet"}}, SearchMetadata: true}
+		err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+			return nil
+		})
+		if err == nil {
+			t.Error("Expected an error without metadata extraction")
+		}
+	})
+}
+
+// TestFileSearchDuplicatePaths tests that a file reachable through several paths is searched once
+func TestFileSearchDuplicatePaths(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_duplicate_paths_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	bookPath, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes and Watson.</p>")
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	aliasPath := filepath.Join(tempDir, "alias.epub")
+	if err := os.Symlink(bookPath, aliasPath); err != nil {
+		t.Skipf("Symlinks are not supported: %v", err)
+	}
+
+	search := func(t *testing.T, request *SearchRequest) []string {
+		var paths []string
+		var mu sync.Mutex
+		err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+			mu.Lock()
+			paths = append(paths, result.Path)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return paths
+	}
+
+	query := SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}}
+
+	t.Run("Walk", func(t *testing.T) {
+		paths := search(t, &SearchRequest{Query: query})
+
+		// the walk is in lexical order, so the symlink is found first
+		expected := []string{aliasPath}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("Expected %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("ExplicitFiles", func(t *testing.T) {
+		relativePath := filepath.Join(tempDir, ".", "book.epub")
+		paths := search(t, &SearchRequest{Query: query, Files: []string{bookPath, aliasPath, relativePath, bookPath}})
+
+		expected := []string{bookPath}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("Expected %v, got %v", expected, paths)
+		}
+	})
+}
+
+// TestFileSearchProgress tests that progress events are tagged with the directory of each file
+func TestFileSearchProgress(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_progress_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{
+		".":                  "root.epub",
+		"Arthur Conan Doyle": "holmes.epub",
+		filepath.Join("Agatha Christie", "Poirot"): "styles.epub",
+	}
+	for dir, name := range books {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if _, err := createTestEPUB(filepath.Join(tempDir, dir), name, "<p>Nothing to see.</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	var events []ProgressEvent
+	fs := NewFileSearch(tempDir, 2, false, WithProgress(func(event ProgressEvent) {
+		events = append(events, event)
+	}))
+	request := &SearchRequest{
+		Query: SearchRequestQuery{
+			Text: &SearchRequestText{
+				Value: "Holmes",
+			},
+		},
+	}
+	if err := fs.Search(context.Background(), request, func(result *SearchResult) error { return nil }); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	if len(events) != len(books) {
+		t.Fatalf("Expected %d progress events, got %d", len(books), len(events))
+	}
+	for i, event := range events {
+		if event.Started != i+1 {
+			t.Errorf("Expected event %d to have started %d files, got %d", i, i+1, event.Started)
+		}
+		if books[event.Directory] != filepath.Base(event.Path) {
+			t.Errorf("Expected %s to be tagged with its directory, got %q", event.Path, event.Directory)
+		}
+	}
+}
+
+// TestFileSearchSingleFile tests passing an epub file instead of a directory to NewFileSearch
+func TestFileSearchSingleFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_single_file_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	bookPath, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes and Watson.</p>")
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	if _, err := createTestEPUB(tempDir, "other.epub", "<p>Holmes alone.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	request := &SearchRequest{
+		Query: SearchRequestQuery{
+			Text: &SearchRequestText{
+				Value: "Holmes",
+			},
+		},
+	}
+
+	var paths []string
+	err = NewFileSearch(bookPath, 2, true).Search(context.Background(), request, func(result *SearchResult) error {
+		paths = append(paths, result.Path)
+		if result.Metadata == nil {
+			t.Errorf("Expected metadata for %s", result.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	if len(paths) != 1 || paths[0] != bookPath {
+		t.Errorf("Expected only %s, got %v", bookPath, paths)
+	}
+}
+
+// TestFileSearchExtractForFilter tests applying metadata filters without including metadata in the results
+func TestFileSearchExtractForFilter(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_extract_for_filter_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{"doyle.epub": "Arthur Conan Doyle", "christie.epub": "Agatha Christie"}
+	for name, author := range books {
+		if _, err := createTestEPUBWithMetadata(tempDir, name, TestEPUBMetadata{Title: name, Authors: []string{author}}); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	search := func(t *testing.T, extractMetadata bool, request *SearchRequest) []*SearchResult {
+		var results []*SearchResult
+		var mu sync.Mutex
+		err := NewFileSearch(tempDir, 2, extractMetadata).Search(context.Background(), request, func(result *SearchResult) error {
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return results
+	}
+
+	// every test book contains this text
+	query := SearchRequestQuery{Text: &SearchRequestText{Value: "Test content"}}
+	filters := &SearchRequestFilters{AuthorEquals: "Agatha Christie"}
+
+	t.Run("FilterOnly", func(t *testing.T) {
+		results := search(t, false, &SearchRequest{Query: query, Filters: filters, ExtractForFilter: true})
+		if len(results) != 1 || filepath.Base(results[0].Path) != "christie.epub" {
+			t.Fatalf("Expected only christie.epub, got %v", results)
+		}
+		if results[0].Metadata != nil {
+			t.Errorf("Expected no metadata in the result, got %+v", results[0].Metadata)
+		}
+	})
+
+	t.Run("FilterAndExtract", func(t *testing.T) {
+		results := search(t, true, &SearchRequest{Query: query, Filters: filters, ExtractForFilter: true})
+		if len(results) != 1 || results[0].Metadata == nil || results[0].Metadata.Title != "christie.epub" {
+			t.Fatalf("Expected christie.epub with metadata, got %v", results)
+		}
+	})
+
+	t.Run("FiltersIgnoredWithoutExtraction", func(t *testing.T) {
+		results := search(t, false, &SearchRequest{Query: query, Filters: filters})
+		if len(results) != 2 {
+			t.Errorf("Expected metadata filters to be ignored without extraction, got %d results", len(results))
+		}
+	})
+}
+
+// TestFileSearchConcurrencyLimit tests that metadata extraction and content scanning together stay within the worker limit
+func TestFileSearchConcurrencyLimit(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_concurrency_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for i := range 12 {
+		if _, err := createTestEPUBWithMetadata(tempDir, fmt.Sprintf("book%d.epub", i), TestEPUBMetadata{Title: "Book"}); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	// an epub counts as open from opening it until it is closed, and opening it is slowed down so that books held open
+	// at the same time overlap
+	var active, highWater atomic.Int64
+	originalOpener, originalCloser := openZipReader, closeZipReader
+	defer func() { openZipReader, closeZipReader = originalOpener, originalCloser }()
+	openZipReader = func(name string) (*zip.ReadCloser, error) {
+		time.Sleep(2 * time.Millisecond)
+		r, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+
+		current := active.Add(1)
+		for {
+			peak := highWater.Load()
+			if current <= peak || highWater.CompareAndSwap(peak, current) {
+				break
+			}
+		}
+		return r, nil
+	}
+	closeZipReader = func(r *zip.ReadCloser) error {
+		active.Add(-1)
+		return r.Close()
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		opts  []FileSearchOption
+	}{
+		{name: "MaxThreads", limit: 2},
+		{name: "ScanWorkers", limit: 3, opts: []FileSearchOption{WithScanWorkers(3)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			highWater.Store(0)
+
+			request := &SearchRequest{
+				Query:               SearchRequestQuery{Text: &SearchRequestText{Value: "Test content"}},
+				ReportContentErrors: true,
+			}
+			var results atomic.Int64
+			err := NewFileSearch(tempDir, 2, true, test.opts...).Search(context.Background(), request, func(result *SearchResult) error {
+				results.Add(1)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+
+			if results.Load() != 12 {
+				t.Errorf("Expected 12 results, got %d", results.Load())
+			}
+			if peak := highWater.Load(); peak < 1 || peak > int64(test.limit) {
+				t.Errorf("Expected at most %d epubs open at once, got %d", test.limit, peak)
+			}
+			if open := active.Load(); open != 0 {
+				t.Errorf("Expected every epub to be closed, got %d still open", open)
+			}
+		})
+	}
+}
+
+// TestFileSearchDistinctPatternMatches tests counting how many sub-queries of an OR query each book matched
+func TestFileSearchDistinctPatternMatches(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_distinct_patterns_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{
+		"one.epub":   "<p>Holmes smoked.</p><p>Holmes again.</p>",
+		"two.epub":   "<p>Holmes and Watson.</p><p>Watson wrote.</p>",
+		"three.epub": "<p>Holmes met Watson.</p><p>Lestrade arrived.</p>",
+		"none.epub":  "<p>Nobody here.</p>",
+	}
+	for name, content := range books {
+		if _, err := createTestEPUB(tempDir, name, content); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	request := &SearchRequest{
+		Query: SearchRequestQuery{
+			SubQueries: []SearchRequestQuery{
+				{Text: &SearchRequestText{Value: "Holmes"}},
+				{Text: &SearchRequestText{Value: "Watson"}},
+				{Text: &SearchRequestText{Value: "Lestrade"}},
+			},
+		},
+	}
+
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	err = NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[filepath.Base(result.Path)] = result.DistinctPatternMatches
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	expected := map[string]int{"one.epub": 1, "two.epub": 2, "three.epub": 3}
+	if !maps.Equal(counts, expected) {
+		t.Errorf("Expected distinct pattern matches %v, got %v", expected, counts)
+	}
+
+	// queries without sub-queries leave the count unset
+	request = &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}}}
+	err = NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+		if result.DistinctPatternMatches != 0 {
+			t.Errorf("Expected no distinct pattern matches for %s, got %d", result.Path, result.DistinctPatternMatches)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+}
+
+// TestFileSearchSlowFileThreshold tests that a warning with the path and duration is logged for an epub whose scan takes
+// at least the slow file threshold
+func TestFileSearchSlowFileThreshold(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "epub_slow_file_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// a large book takes measurably long to scan, so it is slow against a threshold of a nanosecond
+	bookPath, err := createTestEPUB(tempDir, "large.epub", strings.Repeat("<p>Watson waited in Baker Street.</p>", 20000))
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	originalLogger, originalLevel := log.Logger, zerolog.GlobalLevel()
+	defer func() {
+		log.Logger = originalLogger
+		zerolog.SetGlobalLevel(originalLevel)
+	}()
+
+	var output bytes.Buffer
+	log.Logger = zerolog.New(&output)
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	search := func(threshold time.Duration) []map[string]any {
+		output.Reset()
+		request := &SearchRequest{
+			Query:             SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}},
+			SlowFileThreshold: threshold,
+		}
+		if err := NewFileSearch(tempDir, 1, false).Search(context.Background(), request, func(*SearchResult) error {
+			return nil
+		}); err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+
+		var events []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			var event map[string]any
+			if line != "" && json.Unmarshal([]byte(line), &event) == nil && event["message"] == "slow epub scan" {
+				events = append(events, event)
+			}
+		}
+		return events
+	}
+
+	t.Run("Slow", func(t *testing.T) {
+		events := search(time.Nanosecond)
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 slow file warning, got %d in %q", len(events), output.String())
+		}
+		if events[0]["level"] != "warn" || events[0]["path"] != bookPath {
+			t.Errorf("Expected a warning for %s, got %v", bookPath, events[0])
+		}
+		if _, ok := events[0]["duration"].(float64); !ok {
+			t.Errorf("Expected a duration, got %v", events[0]["duration"])
+		}
+	})
+
+	t.Run("Fast", func(t *testing.T) {
+		if events := search(time.Hour); len(events) != 0 {
+			t.Errorf("Expected no slow file warning, got %v", events)
+		}
+	})
+
+	t.Run("NegativeThreshold", func(t *testing.T) {
+		request := &SearchRequest{
+			Query:             SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}},
+			SlowFileThreshold: -time.Second,
+		}
+		err := NewFileSearch(tempDir, 1, false).Search(context.Background(), request, func(*SearchResult) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "slow file threshold") {
+			t.Errorf("Expected an invalid threshold error, got %v", err)
+		}
+	})
+}
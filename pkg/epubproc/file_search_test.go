@@ -1,6 +1,9 @@
 package epubproc
 
 import (
+	"context"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -51,3 +54,85 @@ func TestFileSearchDefaultThreads(t *testing.T) {
 		t.Errorf("Expected positive thread count, got %d", fs.maxThreads)
 	}
 }
+
+// TestAutoThreads verifies that the automatic thread count is a positive multiple of the CPU count within the cap.
+func TestAutoThreads(t *testing.T) {
+	threads := AutoThreads()
+	if threads <= 0 || threads > maxAutoThreads {
+		t.Errorf("Expected between 1 and %d threads, got %d", maxAutoThreads, threads)
+	}
+	if expected := min(runtime.NumCPU()*autoThreadsPerCPU, maxAutoThreads); threads != expected {
+		t.Errorf("Expected %d threads, got %d", expected, threads)
+	}
+	if threads < min(runtime.NumCPU(), maxAutoThreads) {
+		t.Errorf("Expected at least as many threads as CPU cores, got %d", threads)
+	}
+
+	fs := NewFileSearch("/test", AutoThreads(), false).(*fileSearchImpl)
+	if fs.maxThreads != threads {
+		t.Errorf("Expected maxThreads %d, got %d", threads, fs.maxThreads)
+	}
+}
+
+// TestFileSearchWorkerOptions verifies that worker options are applied.
+func TestFileSearchWorkerOptions(t *testing.T) {
+	// scan workers default to maxThreads
+	fs := NewFileSearch("/test", 4, true).(*fileSearchImpl)
+	if fs.scanWorkers() != 4 {
+		t.Errorf("Expected 4 scan workers, got %d", fs.scanWorkers())
+	}
+	if fs.options.metadataWorkers != 0 {
+		t.Errorf("Expected no metadata worker limit, got %d", fs.options.metadataWorkers)
+	}
+
+	// scan workers can be decoupled from maxThreads
+	fs = NewFileSearch("/test", 4, true, WithScanWorkers(16), WithMetadataWorkers(2)).(*fileSearchImpl)
+	if fs.scanWorkers() != 16 {
+		t.Errorf("Expected 16 scan workers, got %d", fs.scanWorkers())
+	}
+	if fs.options.metadataWorkers != 2 {
+		t.Errorf("Expected 2 metadata workers, got %d", fs.options.metadataWorkers)
+	}
+	if fs.maxThreads != 4 {
+		t.Errorf("Expected maxThreads 4, got %d", fs.maxThreads)
+	}
+}
+
+// TestFileSearchInvalidContentType verifies that content types other than text and html are rejected.
+func TestFileSearchInvalidContentType(t *testing.T) {
+	fs := NewFileSearch("/test", 1, false)
+	request := &SearchRequest{
+		Query:        SearchRequestQuery{Text: &SearchRequestText{Value: "target"}},
+		ContentTypes: map[string]string{".md": "markdown"},
+	}
+
+	err := fs.Search(context.Background(), request, func(result *SearchResult) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "invalid content type") {
+		t.Errorf("Expected an invalid content type error, got %v", err)
+	}
+}
+
+// TestFileSearchInvalidMinLineLength verifies that negative minimum line lengths and phrase or document mode are rejected.
+func TestFileSearchInvalidMinLineLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  *SearchRequest
+		expected string
+	}{
+		{name: "Negative", request: &SearchRequest{MinLineLength: -1}, expected: "must not be negative"},
+		{name: "PhraseMode", request: &SearchRequest{MinLineLength: 3, PhraseMode: true}, expected: "not supported in phrase or document mode"},
+		{name: "DocumentMode", request: &SearchRequest{MinLineLength: 3, DocumentMode: true}, expected: "not supported in phrase or document mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewFileSearch("/test", 1, false)
+			tt.request.Query = SearchRequestQuery{Text: &SearchRequestText{Value: "target"}}
+
+			err := fs.Search(context.Background(), tt.request, func(result *SearchResult) error { return nil })
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected a %q error, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -2,35 +2,495 @@ package epubproc
 
 import (
 	"archive/zip"
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"slices"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/kapmahc/epub"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/net/html"
 )
 
-// grepInEpub searches for a compiled regex pattern within a single epub file.
-func grepInEpub(ctx context.Context, epubPath string, pattern *regexp.Regexp, contextLines int) ([]Match, error) {
-	// get file info for better error context
-	fileInfo, fileErr := os.Stat(epubPath)
+// scanOptions holds the per-search settings used while scanning the content of an epub.
+type scanOptions struct {
+	// contextLines is the number of context lines to include around each match
+	contextLines int
 
-	r, err := zip.OpenReader(epubPath)
-	if err != nil {
-		if fileErr == nil {
-			return nil, fmt.Errorf("failed to open epub '%s' (size: %d bytes): %w", epubPath, fileInfo.Size(), err)
+	// contextJoiner separates the lines joined into a single match
+	contextJoiner string
+
+	// openRetries is the number of times opening an epub is retried after a transient error
+	openRetries int
+
+	// entryStats controls whether size statistics are collected for each scanned entry
+	entryStats bool
+
+	// includeGlobs limits scanning to entries whose base name matches one of these globs
+	includeGlobs []string
+
+	// excludeGlobs skips entries whose base name matches one of these globs
+	excludeGlobs []string
+
+	// ignoreGlobCase matches the include and exclude globs without regard to case
+	ignoreGlobCase bool
+
+	// includeHTML controls whether the raw HTML of the matching blocks is captured
+	includeHTML bool
+
+	// phraseMode controls whether matches are found across the whitespace-collapsed text of the whole file
+	phraseMode bool
+
+	// documentMode controls whether matches are found across the text of the whole epub in reading order
+	documentMode bool
+
+	// extraTextExtensions are lowercase extensions (with a leading dot) that are also scanned as plain text
+	extraTextExtensions []string
+
+	// includeSkipped are the categories of files that are scanned even though they are skipped by default
+	includeSkipped []SkipCategory
+
+	// contentTypes replaces the default mapping of lowercase extensions (with a leading dot) to "text" or "html"
+	contentTypes map[string]string
+
+	// maxBytes stops scanning an epub once this many decompressed content bytes were read, or 0 for no limit
+	maxBytes int64
+
+	// readingOrder sorts the matches of an epub by the spine position of their file
+	readingOrder bool
+
+	// percentage controls whether the approximate position of each match through the book is computed
+	percentage bool
+
+	// mediaType controls whether the media type of the file of each match is set
+	mediaType bool
+
+	// dedupeLines drops matches repeating the whitespace-normalized line of an earlier match in the same file
+	dedupeLines bool
+
+	// maxBlockBytes splits longer blocks of an html file into several lines and stops scanning the file at any single
+	// tag or text run longer than this, or 0 for no limit
+	maxBlockBytes int
+
+	// maxBlocks stops scanning an html file after this many non-empty blocks, or 0 for no limit
+	maxBlocks int
+
+	// section limits scanning to the spine files of a section of the book, located by its landmarks
+	section BookSection
+
+	// minLineLength ignores matched lines with fewer characters than this after trimming, or 0 for no minimum
+	minLineLength int
+
+	// maxFiles limits scanning to the first content files of an epub in reading order, or 0 for no limit
+	maxFiles int
+
+	// spineFrom and spineTo limit scanning to the files at these 1-based spine positions, inclusive, with 0 leaving the
+	// range open at that end
+	spineFrom int
+	spineTo   int
+
+	// repairText decodes invalid UTF-8 as Windows-1252 and fixes double-encoded UTF-8 in scanned lines before matching
+	repairText bool
+
+	// repairedLines counts the lines changed by repairText, shared with the scanners of other entries when set
+	repairedLines *int
+
+	// firstMatchOnly stops scanning an epub at its first match in reading order
+	firstMatchOnly bool
+
+	// promo decides which files are skipped as promotional content
+	promo promoRule
+}
+
+// newScanOptions builds scan options from a search request.
+func newScanOptions(request *SearchRequest) scanOptions {
+	return scanOptions{
+		contextLines:  request.Context,
+		contextJoiner: request.ContextJoiner,
+		openRetries:   request.OpenRetries,
+		entryStats:    request.IncludeEntryStats,
+		includeGlobs:  request.IncludeInternalGlobs,
+		excludeGlobs:  request.ExcludeInternalGlobs,
+		includeHTML:   request.IncludeHTML,
+		phraseMode:    request.PhraseMode,
+		documentMode:  request.DocumentMode,
+
+		extraTextExtensions: normalizeExtensions(request.ExtraTextExtensions),
+		ignoreGlobCase:      request.IgnoreGlobCase,
+		contentTypes:        normalizeContentTypes(request.ContentTypes),
+		includeSkipped:      request.IncludeSkipped,
+		maxBytes:            request.MaxBytesPerEpub,
+		readingOrder:        request.ReadingOrder,
+		percentage:          request.IncludePercentage,
+		mediaType:           request.IncludeMediaType,
+		dedupeLines:         request.DedupeLines,
+		maxBlockBytes:       request.MaxHTMLBlockBytes,
+		maxBlocks:           request.MaxHTMLBlocks,
+		minLineLength:       request.MinLineLength,
+		section:             request.Section,
+		maxFiles:            request.MaxFilesPerEpub,
+		spineFrom:           request.SpineFrom,
+		spineTo:             request.SpineTo,
+		repairText:          request.RepairText,
+		firstMatchOnly:      request.FirstMatchOnly,
+		promo:               newPromoRule(request.PromoKeywords, request.PromoSubstring),
+	}
+}
+
+// inSpineRange reports whether a 1-based spine position is within the spine range.
+func (o scanOptions) inSpineRange(position int) bool {
+	return position >= o.spineFrom && (o.spineTo == 0 || position <= o.spineTo)
+}
+
+// matchLine reports whether a line matches the pattern and is long enough to be considered.
+func (o scanOptions) matchLine(pattern lineMatcher, line string) bool {
+	if o.minLineLength > 0 && utf8.RuneCountInString(strings.TrimSpace(line)) < o.minLineLength {
+		return false
+	}
+	return pattern.MatchString(line)
+}
+
+// normalizeExtensions lowercases extensions and ensures they start with a dot.
+func normalizeExtensions(extensions []string) []string {
+	if len(extensions) == 0 {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(extensions))
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
 		}
-		return nil, fmt.Errorf("failed to open epub '%s': %w", epubPath, err)
+		normalized = append(normalized, ext)
+	}
+	return normalized
+}
+
+// normalizeContentTypes normalizes the extensions of a content type mapping like normalizeExtensions.
+func normalizeContentTypes(contentTypes map[string]string) map[string]string {
+	if contentTypes == nil {
+		return nil
+	}
+
+	normalized := make(map[string]string, len(contentTypes))
+	for ext, fileType := range contentTypes {
+		if exts := normalizeExtensions([]string{ext}); len(exts) > 0 {
+			normalized[exts[0]] = strings.ToLower(strings.TrimSpace(fileType))
+		}
+	}
+	return normalized
+}
+
+// fileType determines the file type of an entry from the content type mapping (or the default one), treating any
+// extra text extensions as plain text.
+func (o scanOptions) fileType(name string) string {
+	if o.contentTypes != nil {
+		if fileType := o.contentTypes[strings.ToLower(filepath.Ext(name))]; fileType != "" {
+			return fileType
+		}
+	} else if fileType := getFileType(name); fileType != "" {
+		return fileType
+	}
+
+	if slices.Contains(o.extraTextExtensions, strings.ToLower(filepath.Ext(name))) {
+		return "text"
+	}
+	return ""
+}
+
+// epubScanInfo holds details gathered while scanning an epub, other than the matches themselves.
+type epubScanInfo struct {
+	// entryStats contains size statistics for each scanned content entry (if enabled)
+	entryStats []EntryStats
+
+	// contentErrors contains errors for content entries that could not be opened or fully read
+	contentErrors []error
+
+	// truncated records that scanning stopped at the byte limit before all content was read
+	truncated bool
+
+	// repairedLines is the number of scanned lines changed by text repair
+	repairedLines int
+}
+
+// errorRecordingReader wraps a reader and remembers the first non-EOF read error.
+type errorRecordingReader struct {
+	r   io.Reader
+	err error
+}
+
+// Read reads from the wrapped reader, recording the first read error other than io.EOF.
+func (e *errorRecordingReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF && e.err == nil {
+		e.err = err
+	}
+	return n, err
+}
+
+// cappedReader wraps a reader and stops reading once a byte budget shared by all entries of an epub is used up.
+type cappedReader struct {
+	r io.Reader
+
+	// remaining is the number of bytes that may still be read, shared with the readers of other entries
+	remaining *int64
+
+	// truncated records that content was left unread when the budget ran out
+	truncated bool
+}
+
+// Read reads from the wrapped reader until the budget is used up, then reports io.EOF.
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if *c.remaining <= 0 {
+		// probe for more content, so content ending exactly at the limit is not reported as truncated
+		var probe [1]byte
+		if n, _ := c.r.Read(probe[:]); n > 0 {
+			c.truncated = true
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > *c.remaining {
+		p = p[:*c.remaining]
+	}
+	n, err := c.r.Read(p)
+	*c.remaining -= int64(n)
+	return n, err
+}
+
+// logScanDuration logs how long scanning an epub took at debug level, or as a warning when it took at least threshold
+// (if set), so pathological books can be found.
+func logScanDuration(path string, elapsed, threshold time.Duration) {
+	if threshold > 0 && elapsed >= threshold {
+		log.Warn().Str("path", path).Dur("duration", elapsed).Dur("threshold", threshold).Msg("slow epub scan")
+		return
+	}
+	log.Debug().Str("path", path).Dur("duration", elapsed).Msg("epub scanned")
+}
+
+// walkOptions controls how walkEpubFiles traverses a directory tree.
+type walkOptions struct {
+	// strict returns any directory error instead of logging and skipping the directory
+	strict bool
+
+	// followSymlinks descends into symlinked directories, which requires fsys to be rooted at root on the OS file system
+	followSymlinks bool
+
+	// modifiedSince skips epub files last modified before this time, unless it is zero
+	modifiedSince time.Time
+
+	// limitPerDirectory skips the epub files of a directory after this many, unless it is 0
+	limitPerDirectory int
+}
+
+// modifiedTooEarly reports whether a file was last modified before the modifiedSince time.
+func (o walkOptions) modifiedTooEarly(modTime time.Time) bool {
+	return !o.modifiedSince.IsZero() && modTime.Before(o.modifiedSince)
+}
+
+// walkEpubFiles walks a directory tree and calls fn with the path of every epub file found, joined to root.
+// Unreadable directories are logged and skipped unless strict is set, while errors reading the root itself are always returned.
+func walkEpubFiles(fsys fs.FS, root string, opts walkOptions, fn func(path string) error) error {
+	var visited map[string]bool
+	if opts.followSymlinks {
+		// directories are tracked by their resolved path, so symlink cycles and duplicate links are walked only once
+		visited = make(map[string]bool)
+	}
+
+	if opts.limitPerDirectory > 0 {
+		// counts maps each directory to the number of its epub files passed to fn so far
+		counts := make(map[string]int)
+		next := fn
+		fn = func(path string) error {
+			dir := filepath.Dir(path)
+			if counts[dir] >= opts.limitPerDirectory {
+				log.Debug().Str("path", path).Int("limit", opts.limitPerDirectory).Msg("skipping epub beyond the directory limit")
+				return nil
+			}
+			counts[dir]++
+			return next(path)
+		}
+	}
+	return walkEpubDir(fsys, root, true, opts, visited, fn)
+}
+
+// walkEpubDir walks a single directory tree for walkEpubFiles, recursing into symlinked directories if enabled.
+// Errors at the root are only returned for the top-level walk, since symlinked directories are skipped like any other.
+func walkEpubDir(fsys fs.FS, root string, top bool, opts walkOptions, visited map[string]bool, fn func(path string) error) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if err != nil {
+			if opts.strict || (top && name == ".") {
+				return err
+			}
+
+			log.Warn().Err(err).Str("path", path).Msg("skipping unreadable path")
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if visited != nil {
+				realPath, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					if opts.strict || (top && name == ".") {
+						return err
+					}
+					log.Warn().Err(err).Str("path", path).Msg("skipping unresolvable directory")
+					return fs.SkipDir
+				}
+
+				if visited[realPath] {
+					log.Debug().Str("path", path).Str("target", realPath).Msg("skipping already visited directory")
+					return fs.SkipDir
+				}
+				visited[realPath] = true
+			}
+			return nil
+		}
+
+		if visited != nil && d.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(path)
+			if err != nil {
+				if opts.strict {
+					return err
+				}
+				log.Warn().Err(err).Str("path", path).Msg("skipping broken symlink")
+				return nil
+			}
+
+			if info.IsDir() {
+				realPath, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					if opts.strict {
+						return err
+					}
+					log.Warn().Err(err).Str("path", path).Msg("skipping unresolvable symlink")
+					return nil
+				}
+
+				// paths below the link are reported through the link, not the resolved target
+				return walkEpubDir(os.DirFS(realPath), path, false, opts, visited, fn)
+			}
+		}
+
+		if strings.HasSuffix(strings.ToLower(d.Name()), ".epub") {
+			if !opts.modifiedSince.IsZero() {
+				// the modification time of a symlink is that of the file it points to
+				var info fs.FileInfo
+				if d.Type()&fs.ModeSymlink != 0 {
+					info, err = os.Stat(path)
+				} else {
+					info, err = d.Info()
+				}
+				if err != nil {
+					if opts.strict {
+						return err
+					}
+					log.Warn().Err(err).Str("path", path).Msg("skipping unreadable path")
+					return nil
+				}
+				if opts.modifiedTooEarly(info.ModTime()) {
+					return nil
+				}
+			}
+			return fn(path)
+		}
+
+		return nil
+	})
+}
+
+// isEpubFile reports whether path is a regular file, or a symlink to one, with the .epub extension.
+func isEpubFile(path string) bool {
+	if !strings.HasSuffix(strings.ToLower(path), ".epub") {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// canonicalPath resolves symlinks and relative segments in a path, falling back to the cleaned absolute path.
+func canonicalPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// relativeDir returns the directory of path relative to root, or the directory as is when it is not inside root.
+func relativeDir(root, path string) string {
+	dir := filepath.Dir(path)
+	if rel, err := filepath.Rel(root, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel
+	}
+	return dir
+}
+
+// forEachExplicitFile calls fn with each path in an explicit file list, skipping blank entries and paths that are not files.
+func forEachExplicitFile(files []string, opts walkOptions, fn func(path string) error) error {
+	for _, path := range files {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("skipping unreadable file")
+			continue
+		}
+		if info.IsDir() {
+			log.Warn().Str("path", path).Msg("skipping directory in file list")
+			continue
+		}
+		if opts.modifiedTooEarly(info.ModTime()) {
+			continue
+		}
+
+		if err := fn(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// grepInEpub searches for a compiled regex pattern within a single epub file.
+// When sink is not nil, the matches of each content file are also passed to it as soon as the file has been scanned
+// (or the whole book, in document mode), with their chapter and percentage set, and its error stops the scan.
+func grepInEpub(ctx context.Context, epubPath string, pattern lineMatcher, opts scanOptions, sink func(Match) error) ([]Match, *epubScanInfo, error) {
+	r, err := openEpubWithRetry(ctx, epubPath, opts.openRetries)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer func() {
-		if err := r.Close(); err != nil {
+		if err := closeZipReader(r); err != nil {
 			log.Warn().Err(err).
 				Str("epub", epubPath).
 				Msg("failed to close epub reader")
@@ -40,10 +500,15 @@ func grepInEpub(ctx context.Context, epubPath string, pattern *regexp.Regexp, co
 	fileToChapter := make(map[string]string, 10)
 
 	var matches []Match
+	info := &epubScanInfo{}
+	opts.repairedLines = &info.repairedLines
+
+	// remaining is the content byte budget shared by every entry when a limit is set
+	remaining := opts.maxBytes
 
 	// 1st pass to process toc.ncx for priority chapter info
 	for _, f := range r.File {
-		if f.FileInfo().IsDir() {
+		if f.FileInfo().IsDir() || !isSafeArchivePath(f.Name) {
 			continue
 		}
 
@@ -53,43 +518,179 @@ func grepInEpub(ctx context.Context, epubPath string, pattern *regexp.Regexp, co
 		}
 	}
 
+	// chapter names are complete before any content is scanned when matches are streamed, or when scanning stops at the
+	// first match before content.opf may be reached
+	opfFirst := sink != nil || opts.firstMatchOnly
+	if opfFirst {
+		for _, f := range r.File {
+			if !f.FileInfo().IsDir() && isSafeArchivePath(f.Name) && strings.Contains(strings.ToLower(f.Name), "content.opf") {
+				processContentOpf(f, fileToChapter)
+			}
+		}
+	}
+
+	// stream passes matches to the sink, with the fields otherwise set once the whole book was scanned
+	stream := func(matches []Match) error {
+		if opts.percentage {
+			setPercentages(&r.Reader, matches, opts)
+		}
+		if opts.mediaType {
+			setMediaTypes(&r.Reader, matches)
+		}
+		setChapters(matches, fileToChapter)
+		for _, match := range matches {
+			if err := sink(match); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// with a file limit, the first files in reading order are the ones scanned, and a document is read in reading order,
+	// as are streamed matches and the first match
+	files := r.File
+	if opts.maxFiles > 0 || opts.documentMode || sink != nil || opts.firstMatchOnly {
+		if position := spineOrder(&r.Reader); position != nil {
+			files = slices.Clone(files)
+			slices.SortStableFunc(files, func(a, b *zip.File) int {
+				return position(a.Name) - position(b.Name)
+			})
+		}
+	}
+
+	// with a spine range, only files at those spine positions are scanned, unless the epub has no readable spine
+	var spineRange map[string]int
+	if opts.spineFrom > 0 || opts.spineTo > 0 {
+		if spineRange = spinePositions(&r.Reader); spineRange == nil {
+			log.Debug().Str("epub", epubPath).Msg("no readable spine, ignoring the spine range")
+		}
+	}
+
+	// with a book section, only the spine files of that section are scanned, unless the epub lacks its landmarks
+	var sectionRange map[string]int
+	if opts.section != "" && opts.section != SectionAll {
+		if sectionRange = sectionFiles(&r.Reader, opts.section); sectionRange == nil {
+			log.Debug().Str("epub", epubPath).Str("section", string(opts.section)).Msg("no landmarks, ignoring the book section")
+		}
+	}
+
+	// in document mode, the text of every file is collected and searched at once after the loop
+	var document *bookDocument
+	if opts.documentMode {
+		document = &bookDocument{}
+	}
+
 	// process all other files
-	for _, f := range r.File {
+	scannedFiles := 0
+	for _, f := range files {
 		if f.FileInfo().IsDir() {
 			continue
 		}
 
+		// ignore entries that would escape the archive root (zip slip)
+		if !isSafeArchivePath(f.Name) {
+			log.Warn().Str("file", f.Name).
+				Str("epub", epubPath).
+				Msg("skipping unsafe path in epub")
+			continue
+		}
+
 		// secondary chapter processing
 		if strings.Contains(strings.ToLower(f.Name), "content.opf") {
-			processContentOpf(f, fileToChapter)
+			if !opfFirst {
+				processContentOpf(f, fileToChapter)
+			}
 			continue
 		}
 
-		// skip non-content files (metadata, navigation, promotional content)
-		if shouldSkipFile(f.Name) {
+		// skip non-content files (metadata, navigation, promotional content), unless their category is included
+		if category, skip := opts.skipReason(f.Name); skip {
+			if category != "" {
+				log.Trace().Str("epub", epubPath).
+					Str("file", f.Name).
+					Str("reason", string(category)).
+					Msg("skipping non-content file")
+			}
+			continue
+		}
+
+		// apply the caller's internal file globs
+		if !matchesInternalGlobs(f.Name, opts) {
 			continue
 		}
 
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return nil, nil, ctx.Err()
 		default:
 		}
 
+		fileType := opts.fileType(f.Name)
+		if fileType == "" {
+			continue
+		}
+
+		if spineRange != nil {
+			if i, ok := spineRange[f.Name]; !ok || !opts.inSpineRange(i+1) {
+				continue
+			}
+		}
+
+		if sectionRange != nil {
+			if _, ok := sectionRange[f.Name]; !ok {
+				continue
+			}
+		}
+
+		// later content files are skipped, while the loop goes on so content.opf is still read for chapter names
+		if opts.maxFiles > 0 && scannedFiles >= opts.maxFiles {
+			continue
+		}
+		scannedFiles++
+
 		rc, err := f.Open()
 		if err != nil {
 			log.Warn().Str("file", f.Name).
 				Str("epub", epubPath).
 				Msg("failed to open file in epub")
+			info.contentErrors = append(info.contentErrors, fmt.Errorf("failed to open '%s': %w", f.Name, err))
 			continue
 		}
 
+		reader := &errorRecordingReader{r: rc}
+
+		var content io.Reader = reader
+		var capped *cappedReader
+		if opts.maxBytes > 0 {
+			capped = &cappedReader{r: reader, remaining: &remaining}
+			content = capped
+		}
+
 		var fileMatches []Match
-		switch getFileType(f.Name) {
-		case "text":
-			fileMatches = scanTextFile(rc, pattern, f.Name, contextLines)
-		case "html":
-			fileMatches = scanHTMLFile(ctx, rc, pattern, f.Name, contextLines)
+		var htmlTruncated bool
+		var scanErr error
+		switch {
+		case document != nil:
+			htmlTruncated, scanErr = document.add(ctx, content, f.Name, fileType, opts)
+		case fileType == "text":
+			fileMatches, scanErr = scanTextFile(ctx, content, pattern, f.Name, opts)
+		case fileType == "html":
+			fileMatches, htmlTruncated, scanErr = scanHTMLContent(ctx, content, pattern, f.Name, opts)
+		}
+		if htmlTruncated {
+			log.Debug().Str("epub", epubPath).Str("file", f.Name).Msg("stopped scanning html file at a limit")
+			info.truncated = true
+		}
+
+		// a failed read is reported as such, while other scan errors (e.g. a line too long to buffer) are reported as they are
+		if reader.err != nil {
+			info.contentErrors = append(info.contentErrors, fmt.Errorf("failed to read '%s': %w", f.Name, reader.err))
+		} else if scanErr != nil && ctx.Err() == nil {
+			log.Warn().Err(scanErr).
+				Str("file", f.Name).
+				Str("epub", epubPath).
+				Msg("failed to scan file in epub")
+			info.contentErrors = append(info.contentErrors, scanErr)
 		}
 
 		// Close the file immediately after processing
@@ -99,9 +700,86 @@ func grepInEpub(ctx context.Context, epubPath string, pattern *regexp.Regexp, co
 				Msg("failed to close file in epub")
 		}
 
+		// scanners stop early on cancellation, so their partial results are discarded
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		if opts.entryStats {
+			info.entryStats = append(info.entryStats, newEntryStats(f))
+		}
+
+		if opts.dedupeLines {
+			fileMatches = dedupeMatchLines(fileMatches)
+		}
+		if opts.firstMatchOnly && len(fileMatches) > 1 {
+			fileMatches = fileMatches[:1]
+		}
+		if sink != nil && len(fileMatches) > 0 {
+			if err := stream(fileMatches); err != nil {
+				return nil, nil, err
+			}
+		}
 		matches = append(matches, fileMatches...)
+
+		// the remaining entries are not read once the first match is found
+		if opts.firstMatchOnly && len(matches) > 0 {
+			break
+		}
+
+		// the remaining entries are not read once the limit is reached
+		if capped != nil && capped.truncated {
+			log.Debug().Str("epub", epubPath).
+				Str("file", f.Name).
+				Int64("max_bytes", opts.maxBytes).
+				Msg("stopped scanning epub at the byte limit")
+			info.truncated = true
+			break
+		}
+	}
+
+	if document != nil {
+		matches = document.matches(pattern, opts)
+		if opts.firstMatchOnly && len(matches) > 1 {
+			matches = matches[:1]
+		}
+		if sink != nil {
+			if err := stream(matches); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if opts.percentage {
+		setPercentages(&r.Reader, matches, opts)
+	}
+
+	if opts.readingOrder {
+		sortByReadingOrder(&r.Reader, matches)
+	}
+
+	if opts.mediaType {
+		setMediaTypes(&r.Reader, matches)
 	}
 
+	setChapters(matches, fileToChapter)
+
+	// the level is checked up front, so matches are not walked again unless tracing
+	if traceEnabled() {
+		for _, match := range matches {
+			log.Trace().Str("epub", epubPath).
+				Str("file", match.FileName).
+				Int("paragraph", match.ParagraphIndex).
+				Str("line", match.Line).
+				Msg("match found")
+		}
+	}
+
+	return matches, info, nil
+}
+
+// setChapters sets the chapter name of each match whose file has one, keyed by the base name of the file.
+func setChapters(matches []Match, fileToChapter map[string]string) {
 	for i := range matches {
 		match := matches[i]
 
@@ -116,8 +794,26 @@ func grepInEpub(ctx context.Context, epubPath string, pattern *regexp.Regexp, co
 			matches[i] = match
 		}
 	}
+}
 
-	return matches, nil
+// traceEnabled reports whether trace level events of the global logger are written.
+func traceEnabled() bool {
+	return zerolog.GlobalLevel() <= zerolog.TraceLevel && log.Logger.GetLevel() <= zerolog.TraceLevel
+}
+
+// newEntryStats builds size statistics for a single archive entry.
+func newEntryStats(f *zip.File) EntryStats {
+	stats := EntryStats{
+		FileName:         f.Name,
+		CompressedSize:   f.CompressedSize64,
+		UncompressedSize: f.UncompressedSize64,
+	}
+
+	if f.CompressedSize64 > 0 {
+		stats.CompressionRatio = float64(f.UncompressedSize64) / float64(f.CompressedSize64)
+	}
+
+	return stats
 }
 
 func processXmlFile(f *zip.File, handler func(xmlBytes []byte)) {
@@ -185,262 +881,1061 @@ func processContentOpf(f *zip.File, fileToChapter map[string]string) {
 			return
 		}
 
-		for _, manifest := range opf.Manifest {
-			paths := strings.Split(manifest.Href, "/")
-			baseName := paths[len(paths)-1]
-			if _, ok := fileToChapter[baseName]; !ok {
-				fileToChapter[baseName] = manifest.ID
+		for _, manifest := range opf.Manifest {
+			paths := strings.Split(manifest.Href, "/")
+			baseName := paths[len(paths)-1]
+			if _, ok := fileToChapter[baseName]; !ok {
+				fileToChapter[baseName] = manifest.ID
+			}
+		}
+	})
+}
+
+// spineOrder returns a function giving the reading order position of an archive path, with files outside the spine
+// placed after those in it, or nil when the epub has no readable spine.
+func spineOrder(r *zip.Reader) func(name string) int {
+	positions := spinePositions(r)
+	if positions == nil {
+		return nil
+	}
+
+	return func(name string) int {
+		if i, ok := positions[name]; ok {
+			return i
+		}
+		return len(positions)
+	}
+}
+
+// spinePositions maps the archive path of each file in the spine to its 0-based reading order position, or returns nil
+// when the epub has no readable spine.
+func spinePositions(r *zip.Reader) map[string]int {
+	opfPath, opfData, err := readPackage(r)
+	if err != nil {
+		log.Debug().Err(err).Msg("no readable spine, keeping archive order")
+		return nil
+	}
+	return packageSpinePositions(opfPath, opfData)
+}
+
+// packageSpinePositions maps the archive path of each file in the spine of a decoded package file to its 0-based reading
+// order position, or returns nil when the spine is empty.
+func packageSpinePositions(opfPath string, opfData *opfPackageFile) map[string]int {
+	// hrefs maps manifest ids to archive paths
+	opfDir := path.Dir(opfPath)
+	hrefs := make(map[string]string, len(opfData.Manifest))
+	for _, item := range opfData.Manifest {
+		target, _, _ := strings.Cut(resolveHref(opfDir, item.Href), "#")
+		hrefs[item.ID] = target
+	}
+
+	positions := make(map[string]int, len(opfData.Spine.ItemRefs))
+	for _, itemRef := range opfData.Spine.ItemRefs {
+		if target, ok := hrefs[itemRef.IDRef]; ok {
+			if _, seen := positions[target]; !seen {
+				positions[target] = len(positions)
+			}
+		}
+	}
+	if len(positions) == 0 {
+		return nil
+	}
+	return positions
+}
+
+// sortByReadingOrder stably sorts matches by the spine position of their file, keeping matches within a file in line order.
+// Files outside the spine are placed after those in it, and matches are left as they are when the spine cannot be read.
+func sortByReadingOrder(r *zip.Reader, matches []Match) {
+	position := spineOrder(r)
+	if position == nil {
+		return
+	}
+
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		return position(a.FileName) - position(b.FileName)
+	})
+}
+
+// setPercentages sets the approximate position of each match through the book, from the uncompressed sizes of the
+// content files in reading order (archive order without a readable spine) and the byte offset of the match in its file.
+// Every content file counts towards the size of the book, including files skipped by internal globs or file limits.
+func setPercentages(r *zip.Reader, matches []Match, opts scanOptions) {
+	var files []*zip.File
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !isSafeArchivePath(f.Name) || strings.Contains(strings.ToLower(f.Name), "content.opf") {
+			continue
+		}
+		if _, skip := opts.skipReason(f.Name); skip || opts.fileType(f.Name) == "" {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	if position := spineOrder(r); position != nil {
+		slices.SortStableFunc(files, func(a, b *zip.File) int {
+			return position(a.Name) - position(b.Name)
+		})
+	}
+
+	// starts maps each content file to the number of content bytes before it
+	starts := make(map[string]int64, len(files))
+	var total int64
+	for _, f := range files {
+		starts[f.Name] = total
+		total += int64(f.UncompressedSize64)
+	}
+	if total == 0 {
+		return
+	}
+
+	for i := range matches {
+		start, ok := starts[matches[i].FileName]
+		if !ok {
+			continue
+		}
+		percentage := float64(start+matches[i].offset) / float64(total) * 100
+		matches[i].Percentage = math.Round(min(percentage, 100)*10) / 10
+	}
+}
+
+// utf8BOM is the byte order mark some content files start with.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// skipBOM returns a reader of r without a leading UTF-8 byte order mark, which would otherwise be part of the first
+// line of a text file or a block of its own in an html file.
+func skipBOM(r io.Reader) io.Reader {
+	head := make([]byte, len(utf8BOM))
+	n, _ := io.ReadFull(r, head)
+	if n == len(utf8BOM) && bytes.Equal(head, utf8BOM) {
+		return r
+	}
+
+	// read errors are returned again by the next read of r
+	return io.MultiReader(bytes.NewReader(head[:n]), r)
+}
+
+// scanTextFile scans a plain text file for pattern matches.
+func scanTextFile(ctx context.Context, r io.Reader, pattern lineMatcher, fileName string, opts scanOptions) ([]Match, error) {
+	// for files without context, we can process line by line
+	if opts.contextLines == 0 && !opts.phraseMode {
+		pooledSc := scannerPool.Get().(*pooledScanner)
+		defer scannerPool.Put(pooledSc)
+		pooledSc.reset(skipBOM(r))
+		scanner := pooledSc.scanner
+
+		// offset is the byte offset of the current line, assuming single byte line endings
+		var offset int64
+
+		matches := make([]Match, 0, 16) // pre-allocate for expected matches
+		for i := 0; scanner.Scan(); i++ {
+			// check context cancellation every 100 lines for responsiveness
+			if i%100 == 0 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			raw := scanner.Text()
+			line := opts.repair(raw)
+			if opts.matchLine(pattern, line) {
+				match := Match{
+					Line:     strings.TrimSpace(line),
+					FileName: fileName,
+					offset:   offset,
+					hits:     []string{line},
+				}
+				matches = append(matches, match)
+				if opts.firstMatchOnly {
+					break
+				}
+			}
+			offset += int64(len(raw)) + 1
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to scan text file '%s': %w", fileName, err)
+		}
+		return matches, nil
+	}
+
+	// with context lines, windows are built as the lines are read, so only the lines around a match are retained
+	if !opts.phraseMode {
+		pooledSc := scannerPool.Get().(*pooledScanner)
+		defer scannerPool.Put(pooledSc)
+		pooledSc.reset(skipBOM(r))
+		scanner := pooledSc.scanner
+
+		var matches []Match
+		stream := newContextStream(opts.contextLines, func(window []contextLine, _, firstMatch int) {
+			matches = append(matches, windowMatch(window, firstMatch, fileName, opts))
+		})
+
+		// offset is the byte offset of the current line, assuming single byte line endings
+		var offset int64
+		for i := 0; scanner.Scan(); i++ {
+			// check context cancellation every 100 lines for responsiveness
+			if i%100 == 0 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			raw := scanner.Text()
+			line := opts.repair(raw)
+			stream.add(contextLine{text: line, offset: offset}, opts.matchLine(pattern, line))
+			offset += int64(len(raw)) + 1
+
+			// the window of the first match is complete once it is emitted
+			if opts.firstMatchOnly && len(matches) > 0 {
+				break
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to scan text file '%s': %w", fileName, err)
+		}
+		stream.close()
+		return matches, nil
+	}
+
+	// phrases may span lines, so the whole file is read before matching
+	lines, lineOffsets, err := readTextLines(ctx, r, fileName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	spans := findPhraseSpans(lines, pattern)
+	matchedLines := make([]int, 0, len(spans))
+	for _, span := range spans {
+		matchedLines = append(matchedLines, span.start)
+	}
+	windows := buildSpanWindows(spans, len(lines), opts.contextLines)
+
+	matches := createWindowMatches(windows, spans, lines, fileName, opts)
+	if opts.percentage {
+		for i, line := range firstMatchedLines(windows, matchedLines) {
+			if line >= 0 {
+				matches[i].offset = lineOffsets[line]
 			}
 		}
-	})
+	}
+	return matches, nil
 }
 
-// scanTextFile scans a plain text file for pattern matches.
-func scanTextFile(r io.Reader, pattern *regexp.Regexp, fileName string, contextLines int) []Match {
+// readTextLines reads the lines of a plain text file, with the byte offset of each line when percentages are computed.
+func readTextLines(ctx context.Context, r io.Reader, fileName string, opts scanOptions) ([]string, []int64, error) {
 	pooledSc := scannerPool.Get().(*pooledScanner)
 	defer scannerPool.Put(pooledSc)
-	pooledSc.reset(r)
+	pooledSc.reset(skipBOM(r))
 	scanner := pooledSc.scanner
 
-	// use sliding window approach for memory efficiency
-	lines := make([]string, 0, 512)    // pre-allocate for ~512 lines (reduces reallocations)
-	matchedLines := make([]int, 0, 16) // pre-allocate for expected matched lines
+	lines := make([]string, 0, 512) // pre-allocate for ~512 lines (reduces reallocations)
 
-	// for files without context, we can process line by line
-	if contextLines == 0 {
-		matches := make([]Match, 0, 16) // pre-allocate for expected matches
-		for scanner.Scan() {
-			line := scanner.Text()
-			if pattern.MatchString(line) {
-				match := Match{
-					Line:     strings.TrimSpace(line),
-					FileName: fileName,
-				}
-				matches = append(matches, match)
+	// offset is the byte offset of the current line, assuming single byte line endings
+	var offset int64
+
+	// lineOffsets holds the byte offset of each line, which is only tracked when percentages are computed
+	var lineOffsets []int64
+
+	for i := 0; scanner.Scan(); i++ {
+		// check context cancellation every 100 lines for responsiveness
+		if i%100 == 0 && ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
+		raw := scanner.Text()
+		lines = append(lines, opts.repair(raw))
+		if opts.percentage {
+			lineOffsets = append(lineOffsets, offset)
+			offset += int64(len(raw)) + 1
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to scan text file '%s': %w", fileName, err)
+	}
+	return lines, lineOffsets, nil
+}
+
+// scanHTMLFile extracts text content from HTML and searches for pattern matches.
+func scanHTMLFile(ctx context.Context, r io.Reader, pattern lineMatcher, fileName string, opts scanOptions) ([]Match, error) {
+	matches, _, err := scanHTMLContent(ctx, r, pattern, fileName, opts)
+	return matches, err
+}
+
+// scanHTMLContent extracts text content from HTML and searches for pattern matches, within the HTML limits of opts.
+// It also reports whether the file was truncated at a limit, in which case only the content before it was searched.
+func scanHTMLContent(ctx context.Context, r io.Reader, pattern lineMatcher, fileName string, opts scanOptions) ([]Match, bool, error) {
+	// without context lines, each block is matched as it is read, so the text of the file is not retained
+	if opts.contextLines == 0 && !opts.phraseMode {
+		var matches []Match
+		paragraph := 0
+		truncated, err := walkHTMLBlocks(ctx, r, fileName, opts, func(line, rawHTML string, offset int64) bool {
+			paragraph++
+			if opts.matchLine(pattern, line) {
+				matches = append(matches, Match{
+					Line:           strings.TrimSpace(line),
+					FileName:       fileName,
+					HTML:           rawHTML,
+					ParagraphIndex: paragraph,
+					offset:         offset,
+					hits:           []string{line},
+				})
 			}
+			return !opts.firstMatchOnly || len(matches) == 0
+		})
+		if err != nil {
+			return nil, false, err
 		}
+		return matches, truncated, nil
+	}
 
-		if err := scanner.Err(); err != nil {
-			log.Error().Err(err).Str("file", fileName).Msg("error scanning text file")
-			return nil
+	// with context lines, windows are built as the blocks are read, so only the blocks around a match are retained
+	if !opts.phraseMode {
+		var matches []Match
+		stream := newContextStream(opts.contextLines, func(window []contextLine, start, firstMatch int) {
+			match := windowMatch(window, firstMatch, fileName, opts)
+
+			// each line is a non-empty block, so the first matched line in a window is the paragraph of the match
+			match.ParagraphIndex = start + firstMatch + 1
+			if opts.includeHTML {
+				rawHTML := make([]string, len(window))
+				for i, line := range window {
+					rawHTML[i] = line.html
+				}
+				match.HTML = strings.Join(rawHTML, "\n")
+			}
+			matches = append(matches, match)
+		})
+		truncated, err := walkHTMLBlocks(ctx, r, fileName, opts, func(line, rawHTML string, offset int64) bool {
+			stream.add(contextLine{text: line, html: rawHTML, offset: offset}, opts.matchLine(pattern, line))
+
+			// the window of the first match is complete once it is emitted
+			return !opts.firstMatchOnly || len(matches) == 0
+		})
+		if err != nil {
+			return nil, false, err
 		}
-		return matches
+		stream.close()
+		return matches, truncated, nil
 	}
 
-	// compile list of lines and identify matching lines
-	for i := 0; scanner.Scan(); i++ {
-		line := scanner.Text()
-		lines = append(lines, line)
+	// phrases may span blocks, so the whole file is read before matching
+	blocks, truncated, err := readHTMLBlocks(ctx, r, fileName, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	textLines, htmlLines, blockOffsets := blocks.lines, blocks.html, blocks.offsets
 
-		if pattern.MatchString(line) {
-			matchedLines = append(matchedLines, i)
+	// matchedLines holds the first block of each match, in order, for numbering the matches
+	spans := findPhraseSpans(textLines, pattern)
+	matchedLines := make([]int, 0, len(spans))
+	for _, span := range spans {
+		matchedLines = append(matchedLines, span.start)
+	}
+	windows := buildSpanWindows(spans, len(textLines), opts.contextLines)
+
+	matches := createWindowMatches(windows, spans, textLines, fileName, opts)
+
+	// each line is a non-empty block, so the first matched line in a window is the paragraph of the match
+	for i, line := range firstMatchedLines(windows, matchedLines) {
+		if line < 0 {
+			continue
+		}
+		matches[i].ParagraphIndex = line + 1
+		if opts.percentage {
+			matches[i].offset = blockOffsets[line]
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Error().Err(err).Str("file", fileName).Msg("error scanning text file")
-		return nil
+	if opts.includeHTML {
+		for i, w := range windows {
+			matches[i].HTML = strings.Join(htmlLines[w.start:w.end], "\n")
+		}
 	}
 
-	return createContextMatches(matchedLines, lines, fileName, contextLines)
+	return matches, truncated, nil
 }
 
-// scanHTMLFile extracts text content from HTML and searches for pattern matches.
-func scanHTMLFile(ctx context.Context, r io.Reader, pattern *regexp.Regexp, fileName string, contextLines int) []Match {
-	tokenizer := html.NewTokenizer(r)
-	textLines := make([]string, 0, 256) // pre-allocate for ~256 lines (typical HTML file)
+// htmlBlocks holds the non-empty blocks (paragraphs, headings, list items, etc.) of an html file.
+type htmlBlocks struct {
+	// lines contains the whitespace-normalized text of each block
+	lines []string
+
+	// html contains the raw HTML of each block (if enabled)
+	html []string
+
+	// offsets contains the byte offset where each block starts (if percentages are computed)
+	offsets []int64
+}
+
+// readHTMLBlocks extracts the text of each block of an html file, within the HTML limits of opts.
+// It also reports whether the file was truncated at a limit, which is not an error.
+func readHTMLBlocks(ctx context.Context, r io.Reader, fileName string, opts scanOptions) (*htmlBlocks, bool, error) {
+	blocks := &htmlBlocks{
+		lines: make([]string, 0, 256), // pre-allocate for ~256 lines (typical HTML file)
+	}
+	truncated, err := walkHTMLBlocks(ctx, r, fileName, opts, func(line, rawHTML string, offset int64) bool {
+		blocks.lines = append(blocks.lines, line)
+		if opts.includeHTML {
+			blocks.html = append(blocks.html, rawHTML)
+		}
+		if opts.percentage {
+			blocks.offsets = append(blocks.offsets, offset)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return blocks, truncated, nil
+}
+
+// walkHTMLBlocks passes the text of each non-empty block of an html file to emit as it is read, within the HTML limits
+// of opts, with its raw HTML (if enabled) and the byte offset where it starts (if percentages are computed), until emit
+// returns false. It also reports whether the file was truncated at a limit, which is not an error.
+func walkHTMLBlocks(ctx context.Context, r io.Reader, fileName string, opts scanOptions, emit func(line, rawHTML string, offset int64) bool) (bool, error) {
+	tokenizer := html.NewTokenizer(skipBOM(r))
+	if opts.maxBlockBytes > 0 {
+		// a single tag or text run longer than a block may be is never buffered in full
+		tokenizer.SetMaxBuf(opts.maxBlockBytes)
+	}
+	truncated := false
+	blockCount := 0
+
+	// stopped records that emit asked for no more blocks
+	stopped := false
 	var currentLine strings.Builder
 	currentLine.Grow(512) // pre-allocate for typical line length
 
+	// raw HTML is only buffered when requested, keeping the default path allocation free
+	var currentHTML strings.Builder
+
 	// isBlockLevelTag checks if a tag is a block-level element that should create a line break
 	isBlockLevelTag := func(tagName string) bool {
 		switch tagName {
-		case "p", "div", "br", "h1", "h2", "h3", "h4", "h5", "h6", "li", "blockquote", "hr", "pre", "tr", "table":
+		case "p", "div", "br", "h1", "h2", "h3", "h4", "h5", "h6", "li", "blockquote", "hr", "pre", "tr", "table", "caption",
+			"dl", "dt", "dd":
+			return true
+		default:
+			return false
+		}
+	}
+
+	// isInlineTag checks if a tag is an inline formatting element, which can split a word without separating it
+	isInlineTag := func(tagName string) bool {
+		switch tagName {
+		case "a", "abbr", "b", "bdi", "bdo", "big", "cite", "code", "data", "del", "dfn", "em", "font", "i", "ins", "kbd",
+			"mark", "q", "s", "samp", "small", "span", "strike", "strong", "sub", "sup", "time", "tt", "u", "var", "wbr":
 			return true
 		default:
 			return false
 		}
 	}
 
-	// flushLine processes the accumulated text in currentLine, normalizes it, and appends it to textLines unless empty
+	// wordBreak records that a tag other than an inline one separated the previous text from the next
+	wordBreak := false
+
+	// offset is the byte offset after the current token, and blockStart the offset where the current block starts,
+	// which are only tracked when percentages are computed
+	var offset, blockStart int64
+
+	// cells holds the finished cells of the current table row, which is kept on one line with cells separated by tabs
+	var cells []string
+	inRow := false
+
+	// normalizeText collapses whitespace by splitting on fields and rejoining with single spaces
+	// this correctly handles text from multiple tags and removes extra whitespace
+	normalizeText := func(text string) string {
+		return strings.Join(strings.Fields(text), " ")
+	}
+
+	// flushLine processes the accumulated text in currentLine, normalizes it, and emits it unless empty
 	flushLine := func() {
-		// normalize whitespace by splitting on fields and rejoining with single spaces
-		// this correctly handles text from multiple tags and removes extra whitespace
-		line := strings.Join(strings.Fields(currentLine.String()), " ")
+		line := opts.repair(normalizeText(currentLine.String()))
+		if inRow {
+			line = strings.Join(append(cells, line), "\t")
+			if strings.Trim(line, "\t") == "" {
+				line = ""
+			}
+			cells = cells[:0]
+			inRow = false
+		}
+		if line != "" && opts.maxBlocks > 0 && blockCount >= opts.maxBlocks {
+			// the block limit is reached, so this block and everything after it is dropped
+			truncated = true
+			line = ""
+		}
 		if line != "" {
-			textLines = append(textLines, line)
+			blockCount++
+			var rawHTML string
+			if opts.includeHTML {
+				rawHTML = strings.TrimSpace(currentHTML.String())
+			}
+			stopped = !emit(line, rawHTML, blockStart)
 		}
 		currentLine.Reset()
+		currentHTML.Reset()
+		blockStart = offset
 	}
 
 	tokenCount := 0
-	for {
+	for !truncated && !stopped {
 		// check context cancellation every 100 tokens for responsiveness
 		if tokenCount%100 == 0 {
 			select {
 			case <-ctx.Done():
-				return nil
+				return false, ctx.Err()
 			default:
 			}
 		}
 		tokenCount++
 
 		tt := tokenizer.Next()
+		if opts.percentage {
+			offset += int64(len(tokenizer.Raw()))
+		}
 		if tt == html.ErrorToken {
 			// io.EOF is expected at the end of the file.
-			if tokenizer.Err() != io.EOF {
-				log.Error().Err(tokenizer.Err()).Str("file", fileName).Msg("error tokenizing html")
+			if errors.Is(tokenizer.Err(), html.ErrBufferExceeded) {
+				log.Debug().Str("file", fileName).Int("max_block_bytes", opts.maxBlockBytes).Msg("html token exceeds the block size limit")
+				truncated = true
+			} else if tokenizer.Err() != io.EOF {
+				return false, fmt.Errorf("failed to tokenize html file '%s': %w", fileName, tokenizer.Err())
 			}
 			break
 		}
 
 		switch tt {
 		case html.TextToken:
-			// add a space before the text to ensure separation between words from adjacent tags
+			// add a space before the text when a tag such as <td> or <img> separated it from the previous text,
+			// while text split by inline tags (e.g. wo<b>rd</b>) is joined as written
 			// the final whitespace normalization will handle any extra spaces
-			currentLine.WriteString(" ")
+			if wordBreak {
+				currentLine.WriteString(" ")
+				wordBreak = false
+			}
+			// copy the raw bytes before Text, which unescapes the underlying buffer in place
+			if opts.includeHTML {
+				currentHTML.Write(tokenizer.Raw())
+			}
+			// Text decodes named and numeric character references (e.g. &#8217;), so matching sees the real characters
 			currentLine.WriteString(string(tokenizer.Text()))
 
+			// a block that grows past the limit, e.g. through deeply nested inline tags, is split into several lines
+			if opts.maxBlockBytes > 0 && currentLine.Len() >= opts.maxBlockBytes {
+				flushLine()
+			}
+
 		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			// copy the raw bytes before TagName, which may modify the underlying buffer
+			var raw []byte
+			if opts.includeHTML {
+				raw = slices.Clone(tokenizer.Raw())
+			}
+
 			tagName, _ := tokenizer.TagName()
-			if isBlockLevelTag(string(tagName)) {
+			if (string(tagName) == "td" || string(tagName) == "th") && tt != html.EndTagToken {
+				// a new cell ends the previous cell of the row, if any
+				if inRow {
+					cells = append(cells, opts.repair(normalizeText(currentLine.String())))
+					currentLine.Reset()
+				}
+				inRow = true
+			}
+
+			if !isBlockLevelTag(string(tagName)) {
+				currentHTML.Write(raw)
+				if !isInlineTag(string(tagName)) {
+					wordBreak = true
+				}
+			} else if tt == html.EndTagToken {
+				// a closing block tag belongs to the block it ends
+				currentHTML.Write(raw)
 				flushLine()
+			} else {
+				// an opening block tag belongs to the block it starts
+				flushLine()
+				currentHTML.Write(raw)
 			}
 		}
 	}
 
 	// flush remaining text after the last tag
-	flushLine()
+	if !stopped {
+		flushLine()
+	}
+
+	return truncated, nil
+}
+
+// bookDocument collects the text of the content files of an epub in reading order, for matching across all of it.
+type bookDocument struct {
+	lines []documentLine
+}
+
+// documentLine is a line of a text file or a block of an html file within a bookDocument.
+type documentLine struct {
+	text      string
+	fileName  string
+	paragraph int
+	offset    int64
+}
+
+// add appends the lines of a content file to the document, reporting whether an html file was truncated at a limit.
+func (d *bookDocument) add(ctx context.Context, r io.Reader, fileName, fileType string, opts scanOptions) (bool, error) {
+	switch fileType {
+	case "text":
+		lines, offsets, err := readTextLines(ctx, r, fileName, opts)
+		if err != nil {
+			return false, err
+		}
+		for i, line := range lines {
+			d.lines = append(d.lines, documentLine{text: line, fileName: fileName})
+			if opts.percentage {
+				d.lines[len(d.lines)-1].offset = offsets[i]
+			}
+		}
+		return false, nil
+
+	case "html":
+		blocks, truncated, err := readHTMLBlocks(ctx, r, fileName, opts)
+		if err != nil {
+			return false, err
+		}
+		for i, line := range blocks.lines {
+			d.lines = append(d.lines, documentLine{text: line, fileName: fileName, paragraph: i + 1})
+			if opts.percentage {
+				d.lines[len(d.lines)-1].offset = blocks.offsets[i]
+			}
+		}
+		return truncated, nil
+	}
+	return false, nil
+}
+
+// matches finds the matches of a pattern across the lines of the document joined by newlines, reporting the lines each
+// match spans (with context) from the position where it starts, and the position where it ends.
+func (d *bookDocument) matches(pattern lineMatcher, opts scanOptions) []Match {
+	indexer, ok := pattern.(phraseMatcher)
+	if !ok || len(d.lines) == 0 {
+		return nil
+	}
 
-	var matchedLines []int
-	for i, line := range textLines {
-		if pattern.MatchString(line) {
-			matchedLines = append(matchedLines, i)
+	var text strings.Builder
+	starts := make([]int, len(d.lines))
+	lines := make([]string, len(d.lines))
+	for i, line := range d.lines {
+		if i > 0 {
+			text.WriteByte('\n')
 		}
+		starts[i] = text.Len()
+		text.WriteString(line.text)
+		lines[i] = line.text
+	}
+
+	// lineAt finds the line containing an offset in the text
+	lineAt := func(offset int) int {
+		return max(sort.Search(len(starts), func(i int) bool { return starts[i] > offset })-1, 0)
+	}
+
+	var spans []contextWindow
+	for _, loc := range indexer.FindAllStringIndex(text.String(), -1) {
+		start := lineAt(loc[0])
+		end := max(lineAt(max(loc[1]-1, loc[0])), start)
+		spans = append(spans, contextWindow{start: start, end: end + 1})
 	}
 
-	return createContextMatches(matchedLines, textLines, fileName, contextLines)
+	windows := buildSpanWindows(spans, len(lines), opts.contextLines)
+	matches := createWindowMatches(windows, spans, lines, "", opts)
+
+	// the spans are ordered by where they start, so each window starts at its first span and ends at its furthest one
+	next := 0
+	for i, w := range windows {
+		for next < len(spans) && spans[next].start < w.start {
+			next++
+		}
+		first, last := d.lines[spans[next].start], spans[next].end-1
+		for ; next < len(spans) && spans[next].start < w.end; next++ {
+			last = max(last, spans[next].end-1)
+		}
+
+		matches[i].FileName = first.fileName
+		matches[i].ParagraphIndex = first.paragraph
+		matches[i].offset = first.offset
+		matches[i].End = &MatchPosition{FileName: d.lines[last].fileName, ParagraphIndex: d.lines[last].paragraph}
+	}
+	return matches
 }
 
-// createContextMatches compiles matches with context lines, merging overlapping context windows.
-func createContextMatches(matchedLines []int, lines []string, fileName string, contextLines int) []Match {
-	// without context, each match is independent
-	if contextLines == 0 {
-		matches := make([]Match, 0, len(matchedLines))
-		for _, idx := range matchedLines {
-			match := Match{
-				Line:     strings.TrimSpace(lines[idx]),
-				FileName: fileName,
-			}
-			matches = append(matches, match)
+// findPhraseSpans matches a pattern against the whitespace-collapsed text of all lines and returns the lines each match spans.
+func findPhraseSpans(lines []string, pattern lineMatcher) []contextWindow {
+	indexer, ok := pattern.(phraseMatcher)
+	if !ok {
+		return nil
+	}
+
+	// join the lines into one document, remembering where each line starts
+	var document strings.Builder
+	starts := make([]int, len(lines))
+	for i, line := range lines {
+		normalized := strings.Join(strings.Fields(line), " ")
+		if normalized != "" && document.Len() > 0 {
+			document.WriteByte(' ')
 		}
-		return matches
+		starts[i] = document.Len()
+		document.WriteString(normalized)
+	}
+
+	// lineAt finds the last line starting at or before an offset in the document
+	lineAt := func(offset int) int {
+		return max(sort.Search(len(starts), func(i int) bool { return starts[i] > offset })-1, 0)
 	}
 
-	type window struct {
-		start int
-		end   int
+	var spans []contextWindow
+	for _, loc := range indexer.FindAllStringIndex(document.String(), -1) {
+		start := lineAt(loc[0])
+		end := max(lineAt(max(loc[1]-1, loc[0])), start)
+		spans = append(spans, contextWindow{start: start, end: end + 1})
 	}
+	return spans
+}
 
-	var windows []window
-	var windowIndex, previousEnd int
+// contextWindow is a range of lines, from start (inclusive) to end (exclusive), reported as a single match.
+type contextWindow struct {
+	start int
+	end   int
+}
 
-	// build context windows
-	for i := range matchedLines {
-		start := max(matchedLines[i]-contextLines, 0)
-		end := min(matchedLines[i]+contextLines+1, len(lines))
+// buildContextWindows groups matched lines into context windows, merging overlapping windows.
+func buildContextWindows(matchedLines []int, lineCount int, contextLines int) []contextWindow {
+	spans := make([]contextWindow, 0, len(matchedLines))
+	for _, idx := range matchedLines {
+		spans = append(spans, contextWindow{start: idx, end: idx + 1})
+	}
+	return buildSpanWindows(spans, lineCount, contextLines)
+}
 
-		if len(windows) == 0 {
-			// start the first window
-			windows = append(windows, window{
-				start: start,
-				end:   end,
-			})
+// buildSpanWindows widens ordered spans of matched lines by the context lines, merging overlapping windows.
+func buildSpanWindows(spans []contextWindow, lineCount int, contextLines int) []contextWindow {
+	windows := make([]contextWindow, 0, len(spans))
 
-			previousEnd = end
+	for _, span := range spans {
+		start := max(span.start-contextLines, 0)
+		end := min(span.end+contextLines, lineCount)
+
+		// without context, only spans sharing a line are merged; with context, adjacent windows are merged too
+		n := len(windows)
+		if n > 0 && (start < windows[n-1].end || (contextLines > 0 && start == windows[n-1].end)) {
+			// extend the window
+			windows[n-1].end = max(windows[n-1].end, end)
 			continue
 		}
 
-		if start <= previousEnd {
-			// extend the window
-			windows[windowIndex].end = end
-		} else {
-			// start a new window
-			windowIndex++
-			windows = append(windows, window{
-				start: start,
-				end:   end,
-			})
+		// start a new window
+		windows = append(windows, contextWindow{start: start, end: end})
+	}
+
+	return windows
+}
+
+// dedupeMatchLines removes matches whose whitespace-normalized line repeats an earlier match, keeping the first one.
+func dedupeMatchLines(matches []Match) []Match {
+	seen := make(map[string]bool, len(matches))
+	return slices.DeleteFunc(matches, func(match Match) bool {
+		key := strings.Join(strings.Fields(match.Line), " ")
+		if seen[key] {
+			return true
+		}
+		seen[key] = true
+		return false
+	})
+}
+
+// firstMatchedLines returns the first of the ordered matched lines within each window, or -1 for a window without one.
+func firstMatchedLines(windows []contextWindow, matchedLines []int) []int {
+	firsts := make([]int, len(windows))
+	next := 0
+	for i, w := range windows {
+		for next < len(matchedLines) && matchedLines[next] < w.start {
+			next++
+		}
+		firsts[i] = -1
+		if next < len(matchedLines) {
+			firsts[i] = matchedLines[next]
 		}
+	}
+	return firsts
+}
 
-		previousEnd = end
+// createContextMatches compiles matches with context lines, merging overlapping context windows.
+func createContextMatches(matchedLines []int, lines []string, fileName string, opts scanOptions) []Match {
+	spans := make([]contextWindow, 0, len(matchedLines))
+	for _, idx := range matchedLines {
+		spans = append(spans, contextWindow{start: idx, end: idx + 1})
+	}
+	return createWindowMatches(buildContextWindows(matchedLines, len(lines), opts.contextLines), spans, lines, fileName, opts)
+}
+
+// createWindowMatches creates a match for each context window, joining the lines it covers, with the lines of each
+// ordered span of matched lines within it as its hits.
+func createWindowMatches(windows, spans []contextWindow, lines []string, fileName string, opts scanOptions) []Match {
+	joiner := opts.contextJoiner
+	if joiner == "" {
+		joiner = "\n"
 	}
 
-	// compile matches
 	matches := make([]Match, 0, len(windows))
-	for i := range windows {
-		start := windows[i].start
-		end := windows[i].end
-		fullMatch := strings.Join(lines[start:end], "\n")
+	next := 0
+	for _, w := range windows {
+		fullMatch := strings.Join(lines[w.start:w.end], joiner)
 		match := Match{
 			Line:     strings.TrimSpace(fullMatch),
 			FileName: fileName,
 		}
+		for ; next < len(spans) && spans[next].start < w.end; next++ {
+			match.hits = append(match.hits, strings.Join(lines[spans[next].start:spans[next].end], "\n"))
+		}
 		matches = append(matches, match)
 	}
 	return matches
 }
 
+// isSafeArchivePath reports whether an archive entry name stays within the archive root once cleaned.
+func isSafeArchivePath(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	// treat windows separators as path separators so "..\evil" is caught as well
+	name = strings.ReplaceAll(name, "\\", "/")
+
+	// reject windows drive letters such as "C:/evil"
+	if len(name) >= 2 && name[1] == ':' {
+		return false
+	}
+
+	cleaned := path.Clean(name)
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return false
+	}
+
+	return true
+}
+
+// defaultContentTypes maps the extensions scanned by default to their file type.
+var defaultContentTypes = map[string]string{
+	".txt":   "text",
+	".html":  "html",
+	".xhtml": "html",
+	".xml":   "html",
+}
+
 // getFileType determines the file type for content scanning based on file extension.
 func getFileType(name string) string {
-	ext := strings.ToLower(filepath.Ext(name))
-	switch ext {
-	case ".txt":
-		return "text"
-	case ".html", ".xhtml", ".xml":
-		return "html"
-	default:
-		return ""
+	return defaultContentTypes[strings.ToLower(filepath.Ext(name))]
+}
+
+// skippedFiles lists the base names of standard epub files that are not part of the text, by category.
+var skippedFiles = map[SkipCategory][]string{
+	SkipCover:      {"cover.xhtml", "titlepage.xhtml"},
+	SkipNavigation: {"toc.xhtml", "index.xhtml"},
+	SkipLegal:      {"copyright.xhtml", "imprint.xhtml", "license.xhtml", "license-1.xhtml", "colophon.xhtml"},
+	SkipNotes:      {"notes.xhtml", "glossary.xhtml", "bibliography.xhtml", "appendix.xhtml"},
+	SkipExtra: {
+		"dedication.xhtml", "dedication-1.xhtml", "about.xhtml", "about-1.xhtml", "acknowledgments.xhtml",
+		"afterword.xhtml", "epilogue.xhtml", "extra.xhtml",
+	},
+	SkipPromo: {"ads.xhtml", "trailer.xhtml"},
+}
+
+// skipCategories lists every category of skipped files.
+var skipCategories = []SkipCategory{SkipCover, SkipNavigation, SkipLegal, SkipNotes, SkipExtra, SkipPromo}
+
+// isPackageFile reports whether a file only describes the epub container, which is never scanned.
+func isPackageFile(fileName string) bool {
+	return fileName == "mimetype" || fileName == "META-INF/container.xml"
+}
+
+// defaultPromoKeywords are the words in the base name of a file that mark it as promotional or sample content.
+var defaultPromoKeywords = []string{"sample", "advert", "advertisement", "promo", "teaser"}
+
+// promoSectionWords are the words that may accompany a promo keyword in a base name, as in "sample_chapter" or
+// "teaser-part-2", without making the file content.
+var promoSectionWords = []string{"chapter", "chap", "ch", "part", "page"}
+
+// promoRule decides which files are promotional from the words in their base name.
+type promoRule struct {
+	// keywords are the lowercase keywords to look for, or nil for defaultPromoKeywords
+	keywords []string
+
+	// substring matches the keywords anywhere in the base name instead of as whole words
+	substring bool
+}
+
+// newPromoRule builds a promo rule from keywords in any case, falling back to the defaults when none are given.
+func newPromoRule(keywords []string, substring bool) promoRule {
+	rule := promoRule{substring: substring}
+	for _, keyword := range keywords {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+			rule.keywords = append(rule.keywords, keyword)
+		}
 	}
+	return rule
 }
 
-// shouldSkipFile determines whether a file should be excluded from content scanning.
-func shouldSkipFile(fileName string) bool {
-	// Normalize the file name to lowercase for comparison
-	lowerName := strings.ToLower(fileName)
+// matches reports whether a lowercase base name is named after a keyword, or contains one when matching substrings.
+// Words are runs of letters, and a name matches when it has a keyword (or its plural) and otherwise only section words
+// such as "chapter", so "sample_chapter", "samples" and "teaser2" match while "sampler", "promotion" and
+// "sample-size-analysis" do not.
+func (r promoRule) matches(baseName string) bool {
+	keywords := r.keywords
+	if len(keywords) == 0 {
+		keywords = defaultPromoKeywords
+	}
+
+	if r.substring {
+		return slices.ContainsFunc(keywords, func(keyword string) bool {
+			return strings.Contains(baseName, keyword)
+		})
+	}
+
+	stem := strings.TrimSuffix(baseName, filepath.Ext(baseName))
+	found := false
+	for _, word := range strings.FieldsFunc(stem, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		switch {
+		case slices.Contains(keywords, word) || slices.Contains(keywords, strings.TrimSuffix(word, "s")):
+			found = true
+		case !slices.Contains(promoSectionWords, word):
+			return false
+		}
+	}
+	return found
+}
+
+// skipCategory returns the category of a file that is skipped by default, or "" for a content file.
+// Only the base name is considered, so content in a folder such as "sampler/" is not mistaken for a sample.
+func skipCategory(fileName string, promo promoRule) SkipCategory {
 	baseName := strings.ToLower(filepath.Base(fileName))
+	for _, category := range skipCategories {
+		if slices.Contains(skippedFiles[category], baseName) {
+			return category
+		}
+	}
 
-	// skip epub metadata files
-	if fileName == "mimetype" || fileName == "META-INF/container.xml" {
-		return true
+	// files named like promotional or sample content
+	if promo.matches(baseName) {
+		return SkipPromo
+	}
+
+	return ""
+}
+
+// shouldSkipFile determines whether a file should be excluded from content scanning by default.
+func shouldSkipFile(fileName string) bool {
+	return isPackageFile(fileName) || skipCategory(fileName, promoRule{}) != ""
+}
+
+// skipReason reports whether a file is excluded from content scanning and the category it was skipped for, which is
+// empty for package files. Files of the included categories are scanned.
+func (o scanOptions) skipReason(fileName string) (SkipCategory, bool) {
+	if isPackageFile(fileName) {
+		return "", true
+	}
+
+	category := skipCategory(fileName, o.promo)
+	return category, category != "" && !slices.Contains(o.includeSkipped, category)
+}
+
+// validateSkipCategories checks that every category of skipped files is known.
+func validateSkipCategories(categories []SkipCategory) error {
+	for _, category := range categories {
+		if !slices.Contains(skipCategories, category) {
+			return fmt.Errorf("unsupported skip category '%s'", category)
+		}
 	}
+	return nil
+}
 
-	// Skip standard epub navigation and metadata files
-	skipFiles := []string{
-		"cover.xhtml", "toc.xhtml", "titlepage.xhtml", "copyright.xhtml",
-		"imprint.xhtml", "dedication.xhtml", "dedication-1.xhtml",
-		"license.xhtml", "license-1.xhtml", "colophon.xhtml",
-		"about.xhtml", "about-1.xhtml", "acknowledgments.xhtml",
-		"appendix.xhtml", "afterword.xhtml", "notes.xhtml",
-		"bibliography.xhtml", "index.xhtml", "epilogue.xhtml",
-		"glossary.xhtml", "extra.xhtml", "ads.xhtml", "trailer.xhtml",
+// matchesInternalGlobs checks if a file inside the epub passes the include and exclude globs.
+func matchesInternalGlobs(fileName string, opts scanOptions) bool {
+	baseName := path.Base(fileName)
+
+	if len(opts.includeGlobs) > 0 && !matchesAnyGlob(baseName, opts.includeGlobs, opts.ignoreGlobCase) {
+		return false
 	}
 
-	if slices.Contains(skipFiles, baseName) {
-		return true
+	return !matchesAnyGlob(baseName, opts.excludeGlobs, opts.ignoreGlobCase)
+}
+
+// matchesAnyGlob checks if a name matches at least one glob pattern (invalid patterns never match), lowercasing both
+// the name and the patterns when ignoring case.
+func matchesAnyGlob(name string, globs []string, ignoreCase bool) bool {
+	if ignoreCase {
+		name = strings.ToLower(name)
 	}
 
-	// skip files containing promotional or sample content
-	promoKeywords := []string{"sample", "advert", "promo", "teaser"}
-	for _, keyword := range promoKeywords {
-		if strings.Contains(lowerName, keyword) {
+	for _, glob := range globs {
+		if ignoreCase {
+			glob = strings.ToLower(glob)
+		}
+		if ok, err := path.Match(glob, name); err == nil && ok {
 			return true
 		}
 	}
-
 	return false
 }
 
+// validateGlobs checks that every glob pattern is well formed.
+func validateGlobs(globs []string) error {
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid glob '%s': %w", glob, err)
+		}
+	}
+	return nil
+}
+
+// validateSort checks that a result order is supported.
+func validateSort(sortBy ResultSort) error {
+	switch sortBy {
+	case "", SortByPath, SortByRelevance:
+		return nil
+	default:
+		return fmt.Errorf("unsupported sort order '%s'", sortBy)
+	}
+}
+
+// paginateResults sorts results by path (or by match count, then path, for relevance) and returns the page starting at
+// offset with at most limit results.
+func paginateResults(results []*SearchResult, sortBy ResultSort, offset, limit int) []*SearchResult {
+	slices.SortFunc(results, func(a, b *SearchResult) int {
+		if sortBy == SortByRelevance {
+			if c := cmp.Compare(len(b.Matches), len(a.Matches)); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	if offset >= len(results) {
+		return nil
+	}
+	results = results[offset:]
+
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results
+}
+
+// metadataText joins the title, authors and series of a book with spaces, skipping empty fields.
+func metadataText(metadata *Metadata) string {
+	fields := make([]string, 0, len(metadata.Authors)+2)
+	for _, field := range append(append([]string{metadata.Title}, metadata.Authors...), metadata.Series) {
+		if field = strings.Join(strings.Fields(field), " "); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
 // matchesMetadataFilters checks if the given metadata matches the specified filters.
 func matchesMetadataFilters(metadata Metadata, filters *SearchRequestFilters) bool {
 	// handle AuthorEquals filter
@@ -464,12 +1959,34 @@ func matchesMetadataFilters(metadata Metadata, filters *SearchRequestFilters) bo
 		}
 	}
 
-	// handle TitleEquals filter
+	// handle TitleEquals and TitleContains filters, on the normalized titles if enabled
+	title, titleEquals, titleContains := metadata.Title, filters.TitleEquals, filters.TitleContains
+	if filters.NormalizeTitle {
+		title, titleEquals, titleContains = normalizeTitle(title), normalizeTitle(titleEquals), normalizeTitle(titleContains)
+	}
 	if filters.TitleEquals != "" {
-		if !strings.EqualFold(metadata.Title, filters.TitleEquals) {
+		if !strings.EqualFold(title, titleEquals) {
+			return false
+		}
+	}
+	if filters.TitleContains != "" {
+		if !strings.Contains(strings.ToLower(title), strings.ToLower(titleContains)) {
 			return false
 		}
 	}
 
 	return true
 }
+
+// normalizeTitle lowercases a title and drops a trailing subtitle after the first colon, along with punctuation and
+// extra whitespace, e.g. "The Hobbit: There and Back Again" becomes "the hobbit".
+func normalizeTitle(title string) string {
+	if main, _, found := strings.Cut(title, ":"); found && strings.TrimSpace(main) != "" {
+		title = main
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
@@ -14,7 +14,7 @@ func TestScanTextFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader("")
 		pattern, _ := regexp.Compile("test")
 
-		matches := scanTextFile(reader, pattern, "empty.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "empty.txt", scanOptions{})
 
 		if len(matches) != 0 {
 			t.Errorf("Expected 0 matches for empty content, got %d", len(matches))
@@ -26,7 +26,7 @@ func TestScanTextFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader("a")
 		pattern, _ := regexp.Compile("a")
 
-		matches := scanTextFile(reader, pattern, "single.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "single.txt", scanOptions{})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match for single character, got %d", len(matches))
@@ -40,7 +40,7 @@ func TestScanTextFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader(longLine)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "long.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "long.txt", scanOptions{})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match for very long line, got %d", len(matches))
@@ -61,7 +61,7 @@ func TestScanTextFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "many.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "many.txt", scanOptions{})
 
 		// every 100th line has "target"
 		expectedMatches := 100
@@ -76,7 +76,7 @@ func TestScanTextFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("🎯")
 
-		matches := scanTextFile(reader, pattern, "unicode.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "unicode.txt", scanOptions{})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match for Unicode content, got %d", len(matches))
@@ -92,7 +92,7 @@ func TestScanTextFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader("only line with target")
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "single.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "single.txt", scanOptions{})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match, got %d", len(matches))
@@ -110,7 +110,7 @@ func TestScanTextFileEdgeCases(t *testing.T) {
 		pattern, _ := regexp.Compile("target")
 
 		// context larger than content
-		matches := scanTextFile(reader, pattern, "small.txt", 10)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "small.txt", scanOptions{contextLines: 10})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match, got %d", len(matches))
@@ -133,7 +133,7 @@ func TestScanHTMLFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader("")
 		pattern, _ := regexp.Compile("test")
 
-		matches := scanHTMLFile(context.Background(), reader, pattern, "empty.html", 0)
+		matches, _ := scanHTMLFile(context.Background(), reader, pattern, "empty.html", scanOptions{})
 
 		if len(matches) != 0 {
 			t.Errorf("Expected 0 matches for empty HTML, got %d", len(matches))
@@ -146,7 +146,7 @@ func TestScanHTMLFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader(html)
 		pattern, _ := regexp.Compile("test")
 
-		matches := scanHTMLFile(context.Background(), reader, pattern, "tags.html", 0)
+		matches, _ := scanHTMLFile(context.Background(), reader, pattern, "tags.html", scanOptions{})
 
 		if len(matches) != 0 {
 			t.Errorf("Expected 0 matches for tags-only HTML, got %d", len(matches))
@@ -172,7 +172,7 @@ func TestScanHTMLFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader(html.String())
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanHTMLFile(context.Background(), reader, pattern, "nested.html", 0)
+		matches, _ := scanHTMLFile(context.Background(), reader, pattern, "nested.html", scanOptions{})
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match for deeply nested HTML, got %d", len(matches))
 		}
@@ -184,7 +184,7 @@ func TestScanHTMLFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader(malformed)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanHTMLFile(context.Background(), reader, pattern, "malformed.html", 0)
+		matches, _ := scanHTMLFile(context.Background(), reader, pattern, "malformed.html", scanOptions{})
 
 		// should still find the content despite malformed structure
 		if len(matches) != 1 {
@@ -198,7 +198,7 @@ func TestScanHTMLFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader(html)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanHTMLFile(context.Background(), reader, pattern, "entities.html", 0)
+		matches, _ := scanHTMLFile(context.Background(), reader, pattern, "entities.html", scanOptions{})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match with HTML entities, got %d", len(matches))
@@ -217,7 +217,7 @@ func TestScanHTMLFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader(html)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanHTMLFile(context.Background(), reader, pattern, "mixed.html", 0)
+		matches, _ := scanHTMLFile(context.Background(), reader, pattern, "mixed.html", scanOptions{})
 
 		// should find 2 matches, one in each block-level element
 		if len(matches) != 2 {
@@ -232,7 +232,7 @@ func TestScanHTMLFileEdgeCases(t *testing.T) {
 		reader := strings.NewReader(html)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanHTMLFile(context.Background(), reader, pattern, "whitespace.html", 0)
+		matches, _ := scanHTMLFile(context.Background(), reader, pattern, "whitespace.html", scanOptions{})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match with whitespace normalization, got %d", len(matches))
@@ -248,6 +248,73 @@ func TestScanHTMLFileEdgeCases(t *testing.T) {
 	})
 }
 
+// TestScanHTMLContentLimits tests the HTML block limits against pathological nesting and oversized content
+func TestScanHTMLContentLimits(t *testing.T) {
+	pattern := regexp.MustCompile("target")
+
+	t.Run("ExtremeBlockNesting", func(t *testing.T) {
+		// every div is a block, so each nested level adds a line
+		var html strings.Builder
+		for range 100000 {
+			html.WriteString("<div>x")
+		}
+		html.WriteString("target")
+
+		matches, truncated, _ := scanHTMLContent(context.Background(), strings.NewReader(html.String()), pattern, "nested.html", scanOptions{maxBlocks: 100})
+		if !truncated {
+			t.Error("Expected the file to be truncated at the block limit")
+		}
+		if len(matches) != 0 {
+			t.Errorf("Expected no matches past the block limit, got %d", len(matches))
+		}
+	})
+
+	t.Run("ExtremeInlineNesting", func(t *testing.T) {
+		// inline tags never end the block, so the block is split at the size limit instead
+		var html strings.Builder
+		html.WriteString("<p>")
+		for range 100000 {
+			html.WriteString("<span>word ")
+		}
+		html.WriteString("target</p>")
+
+		matches, truncated, _ := scanHTMLContent(context.Background(), strings.NewReader(html.String()), pattern, "inline.html", scanOptions{maxBlockBytes: 1024})
+		if truncated {
+			t.Error("Expected split blocks not to be reported as truncated")
+		}
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+		if len(matches[0].Line) > 1024+len("word ") {
+			t.Errorf("Expected the line to be split near 1024 bytes, got %d bytes", len(matches[0].Line))
+		}
+	})
+
+	t.Run("OversizedToken", func(t *testing.T) {
+		html := "<p>target before</p><p>" + strings.Repeat("a", 10000) + "</p><p>target after</p>"
+
+		matches, truncated, _ := scanHTMLContent(context.Background(), strings.NewReader(html), pattern, "long.html", scanOptions{maxBlockBytes: 1024})
+		if !truncated {
+			t.Error("Expected the file to be truncated at the oversized text")
+		}
+		if len(matches) != 1 || matches[0].Line != "target before" {
+			t.Errorf("Expected only the match before the oversized text, got %+v", matches)
+		}
+	})
+
+	t.Run("WithinLimits", func(t *testing.T) {
+		html := "<p>one</p><p>two target</p>"
+
+		matches, truncated, _ := scanHTMLContent(context.Background(), strings.NewReader(html), pattern, "small.html", scanOptions{maxBlocks: 2, maxBlockBytes: 1024})
+		if truncated {
+			t.Error("Expected content within the limits not to be truncated")
+		}
+		if len(matches) != 1 {
+			t.Errorf("Expected 1 match, got %d", len(matches))
+		}
+	})
+}
+
 // TestRegexPatternEdgeCases tests edge cases with different regex patterns
 func TestRegexPatternEdgeCases(t *testing.T) {
 	// test with empty pattern (matches everything)
@@ -256,7 +323,7 @@ func TestRegexPatternEdgeCases(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("")
 
-		matches := scanTextFile(reader, pattern, "test.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 
 		// empty pattern matches every line
 		if len(matches) != 3 {
@@ -270,7 +337,7 @@ func TestRegexPatternEdgeCases(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile(`\btarget\b`)
 
-		matches := scanTextFile(reader, pattern, "test.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 
 		// should match only the exact word "target", not "targeting" or "targets"
 		if len(matches) != 1 {
@@ -284,7 +351,7 @@ func TestRegexPatternEdgeCases(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile(`\p{L}+é`)
 
-		matches := scanTextFile(reader, pattern, "test.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 
 		// should match words ending with é
 		if len(matches) != 1 {
@@ -300,7 +367,7 @@ func TestRegexPatternEdgeCases(t *testing.T) {
 		// regex to match phone numbers
 		pattern, _ := regexp.Compile(`\+\d{1,3}-\d{3}-\d{3}-\d{4}`)
 
-		matches := scanTextFile(reader, pattern, "test.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match for complex pattern, got %d", len(matches))
@@ -321,11 +388,11 @@ func TestPerformanceEdgeCases(t *testing.T) {
 		reader := strings.NewReader(longLine)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "huge.txt", 0)
+		matches, err := scanTextFile(context.Background(), reader, pattern, "huge.txt", scanOptions{})
 
-		// very long lines may exceed scanner token limits, verify it doesn't crash
-		if len(matches) > 1 {
-			t.Errorf("Expected 0 or 1 match for extremely long line, got %d", len(matches))
+		// very long lines may exceed scanner token limits, which is reported as an error rather than a crash
+		if err == nil && len(matches) != 1 {
+			t.Errorf("Expected 1 match for extremely long line, got %d", len(matches))
 		}
 	})
 
@@ -340,7 +407,7 @@ func TestPerformanceEdgeCases(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "many.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "many.txt", scanOptions{})
 
 		// should find the line (which contains many matches of the pattern)
 		if len(matches) != 1 {
@@ -358,7 +425,7 @@ func TestSpecialCharacterHandling(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("👋")
 
-		matches := scanTextFile(reader, pattern, "unicode.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "unicode.txt", scanOptions{})
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match for Unicode emoji, got %d", len(matches))
 		}
@@ -371,7 +438,7 @@ func TestSpecialCharacterHandling(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "control.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "control.txt", scanOptions{})
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match with control characters, got %d", len(matches))
 		}
@@ -384,7 +451,7 @@ func TestSpecialCharacterHandling(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "mixed.txt", 0)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "mixed.txt", scanOptions{})
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match with mixed line endings, got %d", len(matches))
 		}
@@ -399,7 +466,7 @@ func TestContextBoundaryConditions(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "first.txt", 2)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "first.txt", scanOptions{contextLines: 2})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match, got %d", len(matches))
@@ -420,7 +487,7 @@ func TestContextBoundaryConditions(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "last.txt", 2)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "last.txt", scanOptions{contextLines: 2})
 
 		if len(matches) != 1 {
 			t.Errorf("Expected 1 match, got %d", len(matches))
@@ -441,7 +508,7 @@ func TestContextBoundaryConditions(t *testing.T) {
 		reader := strings.NewReader(content)
 		pattern, _ := regexp.Compile("target")
 
-		matches := scanTextFile(reader, pattern, "adjacent.txt", 1)
+		matches, _ := scanTextFile(context.Background(), reader, pattern, "adjacent.txt", scanOptions{contextLines: 1})
 
 		// overlapping context windows should merge into a single match
 		if len(matches) != 1 {
@@ -455,3 +522,46 @@ func TestContextBoundaryConditions(t *testing.T) {
 		}
 	})
 }
+
+// TestScanBOMPrefixedFiles tests that a leading UTF-8 byte order mark is not part of the scanned content
+func TestScanBOMPrefixedFiles(t *testing.T) {
+	const bom = "\uFEFF"
+
+	t.Run("Text", func(t *testing.T) {
+		pattern := regexp.MustCompile("^target")
+		for _, opts := range []scanOptions{{}, {contextLines: 1}} {
+			reader := strings.NewReader(bom + "target on the first line\nanother line")
+			matches, _ := scanTextFile(context.Background(), reader, pattern, "bom.txt", opts)
+
+			if len(matches) != 1 || !strings.HasPrefix(matches[0].Line, "target on the first line") {
+				t.Errorf("Expected the first line to match with %d context lines, got %+v", opts.contextLines, matches)
+			}
+		}
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		reader := strings.NewReader(bom + `<?xml version="1.0"?><html><body><p>target here</p></body></html>`)
+		matches, _ := scanHTMLFile(context.Background(), reader, regexp.MustCompile("^target"), "bom.xhtml", scanOptions{})
+
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+		if matches[0].ParagraphIndex != 1 {
+			t.Errorf("Expected the match in paragraph 1, got %d", matches[0].ParagraphIndex)
+		}
+	})
+
+	t.Run("BOMOnly", func(t *testing.T) {
+		matches, _ := scanTextFile(context.Background(), strings.NewReader(bom), regexp.MustCompile(".+"), "bom.txt", scanOptions{})
+		if len(matches) != 0 {
+			t.Errorf("Expected no matches, got %+v", matches)
+		}
+	})
+
+	t.Run("ShortContent", func(t *testing.T) {
+		matches, _ := scanTextFile(context.Background(), strings.NewReader("ab"), regexp.MustCompile("^ab$"), "short.txt", scanOptions{})
+		if len(matches) != 1 {
+			t.Errorf("Expected content shorter than a BOM to be kept, got %+v", matches)
+		}
+	})
+}
@@ -2,10 +2,17 @@ package epubproc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // TestScanTextFileWithPool verifies that the scanner pool implementation
@@ -22,7 +29,7 @@ func TestScanTextFileWithPool(t *testing.T) {
 	}
 
 	// test without context
-	matches := scanTextFile(reader, pattern, "test.txt", 0)
+	matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{})
 
 	// verify we found the expected matches
 	expectedMatches := 2
@@ -58,7 +65,7 @@ func TestScanTextFileWithContext(t *testing.T) {
 	}
 
 	// test with 1 line of context
-	matches := scanTextFile(reader, pattern, "test.txt", 1)
+	matches, _ := scanTextFile(context.Background(), reader, pattern, "test.txt", scanOptions{contextLines: 1})
 
 	if len(matches) != 1 {
 		t.Fatalf("Expected 1 match, got %d", len(matches))
@@ -94,7 +101,7 @@ func TestScanHTMLFileWithPool(t *testing.T) {
 
 	// test without context
 	ctx := context.Background()
-	matches := scanHTMLFile(ctx, reader, pattern, "test.html", 0)
+	matches, _ := scanHTMLFile(ctx, reader, pattern, "test.html", scanOptions{})
 
 	// should find 3 matches (paragraph, div, and span)
 	expectedMatches := 3
@@ -129,7 +136,7 @@ func TestScanHTMLFileWithContext(t *testing.T) {
 
 	// test with 1 line of context
 	ctx := context.Background()
-	matches := scanHTMLFile(ctx, reader, pattern, "test.html", 1)
+	matches, _ := scanHTMLFile(ctx, reader, pattern, "test.html", scanOptions{contextLines: 1})
 
 	if len(matches) != 1 {
 		t.Fatalf("Expected 1 match, got %d", len(matches))
@@ -146,6 +153,293 @@ func TestScanHTMLFileWithContext(t *testing.T) {
 	}
 }
 
+// TestScanHTMLFileIncludeHTML verifies that the original HTML of matching blocks is captured when enabled.
+func TestScanHTMLFileIncludeHTML(t *testing.T) {
+	testHTML := `<html><body>
+		<p>Before paragraph</p>
+		<p class="quote">This contains the <em>target</em> word</p>
+		<p>After paragraph</p>
+	</body></html>`
+
+	pattern, err := regexp.Compile("target")
+	if err != nil {
+		t.Fatalf("Failed to compile pattern: %v", err)
+	}
+
+	ctx := context.Background()
+
+	t.Run("WithoutContext", func(t *testing.T) {
+		matches, _ := scanHTMLFile(ctx, strings.NewReader(testHTML), pattern, "test.html", scanOptions{includeHTML: true})
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+
+		expected := `<p class="quote">This contains the <em>target</em> word</p>`
+		if matches[0].HTML != expected {
+			t.Errorf("Expected HTML %q, got %q", expected, matches[0].HTML)
+		}
+
+		// the stripped text should be unchanged
+		if matches[0].Line != "This contains the target word" {
+			t.Errorf("Expected stripped line, got %q", matches[0].Line)
+		}
+	})
+
+	t.Run("WithContext", func(t *testing.T) {
+		opts := scanOptions{contextLines: 1, includeHTML: true}
+		matches, _ := scanHTMLFile(ctx, strings.NewReader(testHTML), pattern, "test.html", opts)
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+
+		for _, fragment := range []string{"<p>Before paragraph</p>", "<em>target</em>", "<p>After paragraph</p>"} {
+			if !strings.Contains(matches[0].HTML, fragment) {
+				t.Errorf("Expected HTML to contain %q, got %q", fragment, matches[0].HTML)
+			}
+		}
+	})
+
+	// character references stay escaped in the HTML, which is captured exactly as written
+	t.Run("Entities", func(t *testing.T) {
+		source := `<p>Fish &amp; chips &lt;script&gt;alert(1)&lt;/script&gt; with target here</p>`
+		matches, _ := scanHTMLFile(ctx, strings.NewReader(source), pattern, "test.html", scanOptions{includeHTML: true})
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+
+		if matches[0].HTML != source {
+			t.Errorf("Expected HTML %q, got %q", source, matches[0].HTML)
+		}
+		if expected := "Fish & chips <script>alert(1)</script> with target here"; matches[0].Line != expected {
+			t.Errorf("Expected line %q, got %q", expected, matches[0].Line)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		matches, _ := scanHTMLFile(ctx, strings.NewReader(testHTML), pattern, "test.html", scanOptions{})
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+
+		if matches[0].HTML != "" {
+			t.Errorf("Expected no HTML by default, got %q", matches[0].HTML)
+		}
+	})
+}
+
+// TestScanHTMLFileNumericEntities tests that numeric character references are decoded before matching
+func TestScanHTMLFileNumericEntities(t *testing.T) {
+	content := `<p>It wasn&#x2019;t over&#8212;not yet.</p><p>Fish &amp; chips&#8230;</p>`
+
+	tests := []struct {
+		name     string
+		pattern  string
+		opts     scanOptions
+		expected string
+	}{
+		{name: "HexReference", pattern: "wasn\u2019t", expected: "It wasn\u2019t over\u2014not yet."},
+		{name: "DecimalReference", pattern: "over\u2014not", expected: "It wasn\u2019t over\u2014not yet."},
+		{name: "NamedAndDecimalReferences", pattern: "& chips\u2026", expected: "Fish & chips\u2026"},
+		{name: "PhraseMode", pattern: "wasn\u2019t over\u2014not", opts: scanOptions{phraseMode: true}, expected: "It wasn\u2019t over\u2014not yet."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern := regexp.MustCompile(regexp.QuoteMeta(tt.pattern))
+			matches, _ := scanHTMLFile(context.Background(), strings.NewReader(content), pattern, "test.html", tt.opts)
+			if len(matches) != 1 {
+				t.Fatalf("Expected 1 match, got %d", len(matches))
+			}
+			if matches[0].Line != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, matches[0].Line)
+			}
+		})
+	}
+
+	// the raw entity text must not be matchable
+	matches, _ := scanHTMLFile(context.Background(), strings.NewReader(content), regexp.MustCompile("&#"), "test.html", scanOptions{})
+	if len(matches) != 0 {
+		t.Errorf("Expected no matches for raw entity text, got %d", len(matches))
+	}
+}
+
+// TestScanHTMLFileParagraphIndex tests numbering matches by the block that contains them
+func TestScanHTMLFileParagraphIndex(t *testing.T) {
+	content := `<h1>Chapter Two</h1>
+<p>The first paragraph.</p>
+<p>The second paragraph
+   spans two source lines.</p>
+<p>The <em>third</em> paragraph holds the needle.</p>
+<div></div>
+<p>Another needle in the fifth block.</p>`
+
+	pattern := regexp.MustCompile("needle")
+
+	tests := []struct {
+		name     string
+		opts     scanOptions
+		expected []int
+	}{
+		{name: "NoContext", expected: []int{4, 5}},
+		{name: "MergedContext", opts: scanOptions{contextLines: 1}, expected: []int{4}},
+		{name: "PhraseMode", opts: scanOptions{phraseMode: true}, expected: []int{4, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, _ := scanHTMLFile(context.Background(), strings.NewReader(content), pattern, "test.html", tt.opts)
+
+			var indexes []int
+			for _, match := range matches {
+				indexes = append(indexes, match.ParagraphIndex)
+			}
+			if !slices.Equal(indexes, tt.expected) {
+				t.Errorf("Expected paragraph indexes %v, got %v", tt.expected, indexes)
+			}
+		})
+	}
+
+	t.Run("ThirdParagraph", func(t *testing.T) {
+		content := `<p>One.</p><p>Two.</p><p>Three has the needle.</p><p>Four.</p>`
+		matches, _ := scanHTMLFile(context.Background(), strings.NewReader(content), pattern, "test.html", scanOptions{})
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+		if matches[0].ParagraphIndex != 3 {
+			t.Errorf("Expected paragraph index 3, got %d", matches[0].ParagraphIndex)
+		}
+	})
+}
+
+// TestScanHTMLFileWordBoundaries tests that spaces are only inserted where tags separate words
+func TestScanHTMLFileWordBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "WordSplitByInlineTag", content: "<p>A wo<b>rd</b> split.</p>", expected: "A word split."},
+		{name: "NestedInlineTags", content: "<p>in<i>ter<span>rupt</span></i>ed</p>", expected: "interrupted"},
+		{name: "SpacesAroundInlineTags", content: "<p>Holmes <em>and</em> Watson</p>", expected: "Holmes and Watson"},
+		{name: "TableCells", content: "<table><tr><td>left</td><td>right</td></tr></table>", expected: "left\tright"},
+		{name: "Image", content: "<p>before<img src=\"x.png\"/>after</p>", expected: "before after"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, _ := scanHTMLFile(context.Background(), strings.NewReader(tt.content), regexp.MustCompile("."), "test.html", scanOptions{})
+			if len(matches) != 1 {
+				t.Fatalf("Expected 1 match, got %d", len(matches))
+			}
+			if matches[0].Line != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, matches[0].Line)
+			}
+		})
+	}
+}
+
+// TestScanMinLineLength tests that matched lines shorter than the minimum length are ignored, with and without context
+func TestScanMinLineLength(t *testing.T) {
+	scans := []struct {
+		name    string
+		content string
+		scan    func(content string, opts scanOptions) ([]Match, error)
+	}{
+		{
+			name:    "Text",
+			content: "I\n-\n-\n-\n  I  \n-\n-\n-\nI said so.\n-\n-\n-\nÉté\n",
+			scan: func(content string, opts scanOptions) ([]Match, error) {
+				return scanTextFile(context.Background(), strings.NewReader(content), regexp.MustCompile("I|É"), "test.txt", opts)
+			},
+		},
+		{
+			name: "HTML",
+			content: "<p>I</p>" + strings.Repeat("<p>-</p>", 3) + "<p>  I  </p>" + strings.Repeat("<p>-</p>", 3) + "<p>I said so.</p>" +
+				strings.Repeat("<p>-</p>", 3) + "<p>Été</p>",
+			scan: func(content string, opts scanOptions) ([]Match, error) {
+				return scanHTMLFile(context.Background(), strings.NewReader(content), regexp.MustCompile("I|É"), "test.html", opts)
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		minLineLength int
+		expected      []string
+	}{
+		{name: "Disabled", expected: []string{"I", "I", "I said so.", "Été"}},
+		{name: "ShortLinesIgnored", minLineLength: 3, expected: []string{"I said so.", "Été"}},
+		{name: "CountsCharacters", minLineLength: 4, expected: []string{"I said so."}},
+	}
+
+	for _, scan := range scans {
+		for _, tt := range tests {
+			for _, contextLines := range []int{0, 1} {
+				t.Run(fmt.Sprintf("%s/%s/Context%d", scan.name, tt.name, contextLines), func(t *testing.T) {
+					matches, err := scan.scan(scan.content, scanOptions{minLineLength: tt.minLineLength, contextLines: contextLines})
+					if err != nil {
+						t.Fatalf("Scan failed: %v", err)
+					}
+
+					// the matched lines are far enough apart that each has its own context window
+					if len(matches) != len(tt.expected) {
+						t.Fatalf("Expected %d matches, got %d", len(tt.expected), len(matches))
+					}
+					for i, match := range matches {
+						if (contextLines == 0 && match.Line != tt.expected[i]) || !strings.Contains(match.Line, tt.expected[i]) {
+							t.Errorf("Expected match %d to be %q, got %q", i, tt.expected[i], match.Line)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestScanHTMLFileTables tests that table cells and definition list entries are kept separate
+func TestScanHTMLFileTables(t *testing.T) {
+	content := `<table>
+<caption>Cases</caption>
+<tr><th>Case</th><th>Year</th></tr>
+<tr><td>A Study in <i>Scarlet</i></td><td>1887</td></tr>
+<tr><td>The Sign of the Four</td><td></td><td>1890</td></tr>
+</table>
+<dl><dt>Baker Street</dt><dd>Home of Sherlock Holmes</dd></dl>`
+
+	lines := func(t *testing.T, pattern string) []string {
+		t.Helper()
+		matches, err := scanHTMLFile(context.Background(), strings.NewReader(content), regexp.MustCompile(pattern), "test.html", scanOptions{})
+		if err != nil {
+			t.Fatalf("scanHTMLFile failed: %v", err)
+		}
+		var result []string
+		for _, match := range matches {
+			result = append(result, match.Line)
+		}
+		return result
+	}
+
+	t.Run("RowsAndCells", func(t *testing.T) {
+		expected := []string{"Cases", "Case\tYear", "A Study in Scarlet\t1887", "The Sign of the Four\t\t1890"}
+		if got := lines(t, "C|1"); !slices.Equal(got, expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("CellsNotConcatenated", func(t *testing.T) {
+		if got := lines(t, "Scarlet ?1887"); len(got) != 0 {
+			t.Errorf("Expected no matches across cells, got %q", got)
+		}
+	})
+
+	t.Run("DefinitionList", func(t *testing.T) {
+		expected := []string{"Baker Street", "Home of Sherlock Holmes"}
+		if got := lines(t, "Baker|Holmes"); !slices.Equal(got, expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+}
+
 // TestGetFileType verifies file type detection.
 func TestGetFileType(t *testing.T) {
 	tests := []struct {
@@ -180,7 +474,17 @@ func TestShouldSkipFile(t *testing.T) {
 		{"cover.xhtml", true},
 		{"toc.xhtml", true},
 		{"sample_chapter.html", true},
+		{"OEBPS/sample.xhtml", true},
+		{"sample-chapter-2.xhtml", true},
+		{"OEBPS/Samples.xhtml", true},
+		{"teaser2.xhtml", true},
+		{"advertisement.xhtml", true},
 		{"ads.xhtml", true},
+		{"sampler/chapter1.xhtml", false},
+		{"OEBPS/sampler.xhtml", false},
+		{"promotion.xhtml", false},
+		{"sample-size-analysis.xhtml", false},
+		{"OEBPS/chapter-3-teaser-trailer-analysis.xhtml", false},
 		{"content/chapter1.xhtml", false},
 		{"text/page1.txt", false},
 		{"", false},
@@ -194,6 +498,131 @@ func TestShouldSkipFile(t *testing.T) {
 	}
 }
 
+// TestPromoRule tests custom promo keywords and substring matching
+func TestPromoRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     promoRule
+		fileName string
+		expected bool
+	}{
+		{name: "CustomKeyword", rule: newPromoRule([]string{" Excerpt "}, false), fileName: "OEBPS/excerpt-1.xhtml", expected: true},
+		{name: "CustomReplacesDefaults", rule: newPromoRule([]string{"excerpt"}, false), fileName: "OEBPS/sample.xhtml", expected: false},
+		{name: "EmptyUsesDefaults", rule: newPromoRule([]string{" "}, false), fileName: "OEBPS/sample.xhtml", expected: true},
+		{name: "WordInsideName", rule: newPromoRule(nil, false), fileName: "OEBPS/sampler.xhtml", expected: false},
+		{name: "Substring", rule: newPromoRule(nil, true), fileName: "OEBPS/sampler.xhtml", expected: true},
+		{name: "SubstringBaseNameOnly", rule: newPromoRule(nil, true), fileName: "sampler/chapter1.xhtml", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := skipCategory(test.fileName, test.rule) == SkipPromo; got != test.expected {
+				t.Errorf("Expected %s to be promo: %t, got %t", test.fileName, test.expected, got)
+			}
+		})
+	}
+}
+
+// TestSkipReason tests including each category of skipped files independently
+func TestSkipReason(t *testing.T) {
+	files := map[SkipCategory]string{
+		SkipCover:      "OEBPS/titlepage.xhtml",
+		SkipNavigation: "OEBPS/toc.xhtml",
+		SkipLegal:      "OEBPS/copyright.xhtml",
+		SkipNotes:      "OEBPS/notes.xhtml",
+		SkipExtra:      "OEBPS/dedication.xhtml",
+		SkipPromo:      "OEBPS/sample_chapter.xhtml",
+	}
+
+	for _, included := range skipCategories {
+		t.Run(string(included), func(t *testing.T) {
+			opts := scanOptions{includeSkipped: []SkipCategory{included}}
+
+			for category, fileName := range files {
+				reason, skip := opts.skipReason(fileName)
+				if reason != category {
+					t.Errorf("Expected %s to be in category %s, got %s", fileName, category, reason)
+				}
+				if skip != (category != included) {
+					t.Errorf("Expected %s to be skipped: %t, got %t", fileName, category != included, skip)
+				}
+			}
+
+			// content and package files are unaffected by the included categories
+			if _, skip := opts.skipReason("OEBPS/chapter1.xhtml"); skip {
+				t.Error("Expected chapter1.xhtml to be scanned")
+			}
+			if _, skip := opts.skipReason("META-INF/container.xml"); !skip {
+				t.Error("Expected container.xml to be skipped")
+			}
+		})
+	}
+
+	t.Run("Search", func(t *testing.T) {
+		tempDir, err := os.MkdirTemp("", "skip_reason_test_*")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		epubPath := filepath.Join(tempDir, "notes.epub")
+		if err := createTestZIPWithFiles(epubPath, map[string]string{
+			"chapter1.xhtml": "<p>Holmes in the text.</p>",
+			"notes.xhtml":    "<p>Holmes in a footnote.</p>",
+			"cover.xhtml":    "<p>Holmes on the cover.</p>",
+		}); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		opts := newScanOptions(&SearchRequest{IncludeSkipped: []SkipCategory{SkipNotes}})
+		matches, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile("Holmes"), opts, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+
+		var found []string
+		for _, match := range matches {
+			found = append(found, match.FileName)
+		}
+		slices.Sort(found)
+		if expected := []string{"chapter1.xhtml", "notes.xhtml"}; !slices.Equal(found, expected) {
+			t.Errorf("Expected matches in %v, got %v", expected, found)
+		}
+
+		if err := validateSkipCategories([]SkipCategory{"footnotes"}); err == nil {
+			t.Error("Expected an error for an unknown skip category")
+		}
+	})
+}
+
+// TestIsSafeArchivePath tests detection of archive entries that escape the archive root
+func TestIsSafeArchivePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"OEBPS/chapter1.xhtml", true},
+		{"chapter1.xhtml", true},
+		{"OEBPS/../chapter1.xhtml", true},
+		{"./chapter1.xhtml", true},
+		{"", false},
+		{"..", false},
+		{"../evil", false},
+		{"OEBPS/../../evil", false},
+		{"/etc/passwd", false},
+		{"..\\evil", false},
+		{"C:/evil", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := isSafeArchivePath(test.name); result != test.expected {
+				t.Errorf("isSafeArchivePath(%q) = %t, expected %t", test.name, result, test.expected)
+			}
+		})
+	}
+}
+
 // TestMatchesMetadataFilters verifies metadata filtering logic.
 func TestMatchesMetadataFilters(t *testing.T) {
 	metadata := Metadata{
@@ -275,6 +704,54 @@ func TestMatchesMetadataFilters(t *testing.T) {
 	}
 }
 
+// TestMatchesTitleFilters tests the contains and subtitle-insensitive title filters
+func TestMatchesTitleFilters(t *testing.T) {
+	metadata := Metadata{Title: "The Hobbit: There and Back Again"}
+
+	tests := []struct {
+		name     string
+		filters  *SearchRequestFilters
+		expected bool
+	}{
+		{name: "EqualsWithoutSubtitle", filters: &SearchRequestFilters{TitleEquals: "The Hobbit"}, expected: false},
+		{name: "EqualsNormalized", filters: &SearchRequestFilters{TitleEquals: "the hobbit", NormalizeTitle: true}, expected: true},
+		{name: "EqualsNormalizedBothSubtitles", filters: &SearchRequestFilters{TitleEquals: "The Hobbit: Or There", NormalizeTitle: true}, expected: true},
+		{name: "EqualsNormalizedPunctuation", filters: &SearchRequestFilters{TitleEquals: "The  Hobbit!", NormalizeTitle: true}, expected: true},
+		{name: "EqualsNormalizedDifferent", filters: &SearchRequestFilters{TitleEquals: "The Silmarillion", NormalizeTitle: true}, expected: false},
+		{name: "Contains", filters: &SearchRequestFilters{TitleContains: "back AGAIN"}, expected: true},
+		{name: "ContainsNoMatch", filters: &SearchRequestFilters{TitleContains: "Rings"}, expected: false},
+		{name: "ContainsNormalizedIgnoresSubtitle", filters: &SearchRequestFilters{TitleContains: "back again", NormalizeTitle: true}, expected: false},
+		{name: "ContainsNormalized", filters: &SearchRequestFilters{TitleContains: "hobbit", NormalizeTitle: true}, expected: true},
+		{name: "EqualsAndContains", filters: &SearchRequestFilters{TitleEquals: "The Hobbit", TitleContains: "Hob", NormalizeTitle: true}, expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := matchesMetadataFilters(metadata, test.filters); result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
+
+// TestNormalizeTitle tests dropping subtitles, punctuation and case from titles
+func TestNormalizeTitle(t *testing.T) {
+	tests := map[string]string{
+		"The Hobbit: There and Back Again": "the hobbit",
+		"Dr. Jekyll and Mr.  Hyde":         "dr jekyll and mr hyde",
+		"Ender's Game":                     "ender s game",
+		": A Title Starting With A Colon":  "a title starting with a colon",
+		"Les Misérables — Tome I: Fantine": "les misérables tome i",
+		"":                                 "",
+	}
+
+	for title, expected := range tests {
+		if got := normalizeTitle(title); got != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, title, got)
+		}
+	}
+}
+
 // TestScanTextFileErrors tests error handling in scanTextFile
 func TestScanTextFileErrors(t *testing.T) {
 	// test with invalid reader that causes scanner errors
@@ -283,9 +760,12 @@ func TestScanTextFileErrors(t *testing.T) {
 		errorReader := &errorReader{}
 		pattern, _ := regexp.Compile("test")
 
-		matches := scanTextFile(errorReader, pattern, "test.txt", 0)
+		matches, err := scanTextFile(context.Background(), errorReader, pattern, "test.txt", scanOptions{})
 
-		// should return nil on scanner error
+		// should return the scanner error instead of matches
+		if err == nil || !strings.Contains(err.Error(), "test.txt") {
+			t.Errorf("Expected a scanner error naming the file, got %v", err)
+		}
 		if matches != nil {
 			t.Errorf("Expected nil matches on scanner error, got %v", matches)
 		}
@@ -296,15 +776,54 @@ func TestScanTextFileErrors(t *testing.T) {
 		errorReader := &errorReader{}
 		pattern, _ := regexp.Compile("test")
 
-		matches := scanTextFile(errorReader, pattern, "test.txt", 1)
+		matches, err := scanTextFile(context.Background(), errorReader, pattern, "test.txt", scanOptions{contextLines: 1})
 
-		// should return nil on scanner error
+		// should return the scanner error instead of matches
+		if err == nil {
+			t.Error("Expected a scanner error, got nil")
+		}
 		if matches != nil {
 			t.Errorf("Expected nil matches on scanner error, got %v", matches)
 		}
 	})
 }
 
+// TestScanTextFileCancellation tests that scanning a matchless file stops promptly when the context is cancelled
+func TestScanTextFileCancellation(t *testing.T) {
+	for _, contextLines := range []int{0, 2} {
+		t.Run(fmt.Sprintf("Context%d", contextLines), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// the reader never ends on its own and cancels the context once some data has been read
+			reader := &endlessReader{line: []byte("no matches on this line\n"), onRead: cancel, cancelAfter: 1000}
+			pattern, _ := regexp.Compile("Holmes")
+
+			type result struct {
+				matches []Match
+				err     error
+			}
+			done := make(chan result, 1)
+			go func() {
+				matches, err := scanTextFile(ctx, reader, pattern, "huge.txt", scanOptions{contextLines: contextLines})
+				done <- result{matches, err}
+			}()
+
+			select {
+			case got := <-done:
+				if got.matches != nil {
+					t.Errorf("Expected nil matches after cancellation, got %v", got.matches)
+				}
+				if !errors.Is(got.err, context.Canceled) {
+					t.Errorf("Expected context.Canceled, got %v", got.err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("scanTextFile did not return after context cancellation")
+			}
+		})
+	}
+}
+
 // TestScanHTMLFileErrors tests error handling in scanHTMLFile
 func TestScanHTMLFileErrors(t *testing.T) {
 	// test with context cancellation during HTML parsing
@@ -324,9 +843,12 @@ func TestScanHTMLFileErrors(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
 		cancel()
 
-		matches := scanHTMLFile(ctx, reader, pattern, "test.html", 0)
+		matches, err := scanHTMLFile(ctx, reader, pattern, "test.html", scanOptions{})
 
-		// should return nil when context is cancelled
+		// should return the context error when context is cancelled
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
 		if matches != nil {
 			t.Errorf("Expected nil matches on cancelled context, got %v", matches)
 		}
@@ -339,7 +861,7 @@ func TestScanHTMLFileErrors(t *testing.T) {
 		reader := strings.NewReader(malformedHTML)
 		pattern, _ := regexp.Compile("paragraph")
 
-		matches := scanHTMLFile(context.Background(), reader, pattern, "test.html", 0)
+		matches, _ := scanHTMLFile(context.Background(), reader, pattern, "test.html", scanOptions{})
 
 		// should handle malformed HTML gracefully and still find matches
 		if len(matches) == 0 {
@@ -351,6 +873,257 @@ func TestScanHTMLFileErrors(t *testing.T) {
 // errorReader is a helper that always returns an error when Read is called
 type errorReader struct{}
 
+// endlessReader repeats a line forever and calls onRead once cancelAfter reads have happened
+type endlessReader struct {
+	line        []byte
+	reads       int
+	cancelAfter int
+	onRead      func()
+}
+
+func (er *endlessReader) Read(p []byte) (n int, err error) {
+	er.reads++
+	if er.reads == er.cancelAfter {
+		er.onRead()
+	}
+	return copy(p, er.line), nil
+}
+
 func (er *errorReader) Read(p []byte) (n int, err error) {
 	return 0, fmt.Errorf("simulated read error")
 }
+
+// TestScanPhraseMode tests matching phrases that span lines or blocks
+func TestScanPhraseMode(t *testing.T) {
+	pattern := regexp.MustCompile("New York")
+
+	t.Run("HTMLSpansAcrossBlocks", func(t *testing.T) {
+		content := `<p>A trip to <span>New</span><br/><span>York</span> city.</p><p>Unrelated.</p>`
+
+		matches, _ := scanHTMLFile(context.Background(), strings.NewReader(content), pattern, "test.html", scanOptions{})
+		if len(matches) != 0 {
+			t.Errorf("Expected no matches without phrase mode, got %d", len(matches))
+		}
+
+		matches, _ = scanHTMLFile(context.Background(), strings.NewReader(content), pattern, "test.html", scanOptions{phraseMode: true, includeHTML: true})
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match in phrase mode, got %d", len(matches))
+		}
+		if matches[0].Line != "A trip to New\nYork city." {
+			t.Errorf("Expected both lines of the phrase, got '%s'", matches[0].Line)
+		}
+		if !strings.Contains(matches[0].HTML, "<span>New</span>") || !strings.Contains(matches[0].HTML, "<span>York</span>") {
+			t.Errorf("Expected HTML of both spans, got '%s'", matches[0].HTML)
+		}
+	})
+
+	t.Run("TextSpansAcrossLines", func(t *testing.T) {
+		content := "They sailed to New\n\n   York in spring.\nNew York again.\nThe end."
+
+		matches, _ := scanTextFile(context.Background(), strings.NewReader(content), pattern, "test.txt", scanOptions{phraseMode: true})
+		if len(matches) != 2 {
+			t.Fatalf("Expected 2 matches, got %d", len(matches))
+		}
+		if !strings.HasPrefix(matches[0].Line, "They sailed to New") || !strings.HasSuffix(matches[0].Line, "York in spring.") {
+			t.Errorf("Expected first match to span the phrase, got '%s'", matches[0].Line)
+		}
+		if matches[1].Line != "New York again." {
+			t.Errorf("Expected second match 'New York again.', got '%s'", matches[1].Line)
+		}
+	})
+
+	t.Run("WithContext", func(t *testing.T) {
+		content := "Before.\nNew\nYork\nAfter.\nLast."
+
+		matches, _ := scanTextFile(context.Background(), strings.NewReader(content), pattern, "test.txt", scanOptions{phraseMode: true, contextLines: 1})
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+		if matches[0].Line != "Before.\nNew\nYork\nAfter." {
+			t.Errorf("Expected phrase with context, got '%s'", matches[0].Line)
+		}
+	})
+
+	t.Run("FuzzyNotSupported", func(t *testing.T) {
+		query := SearchRequestQuery{
+			Text: &SearchRequestText{Value: "New York", Fuzzy: &FuzzyConfig{MaxDistance: 1}},
+		}
+		if _, err := compileQuery(query, true); err == nil {
+			t.Error("Expected error combining phrase mode with fuzzy matching")
+		}
+	})
+}
+
+// failingDirFS is a file system that fails to read the contents of one directory
+type failingDirFS struct {
+	fstest.MapFS
+	failDir string
+}
+
+func (f failingDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == f.failDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrPermission}
+	}
+	return f.MapFS.ReadDir(name)
+}
+
+// TestWalkEpubFiles tests walking a tree where one subtree cannot be read
+func TestWalkEpubFiles(t *testing.T) {
+	fsys := failingDirFS{
+		MapFS: fstest.MapFS{
+			"a.epub":             {},
+			"notes.txt":          {},
+			"shelf/b.EPUB":       {},
+			"locked/c.epub":      {},
+			"locked/deep/d.epub": {},
+		},
+		failDir: "locked",
+	}
+
+	walk := func(strict bool) ([]string, error) {
+		var paths []string
+		err := walkEpubFiles(fsys, "/library", walkOptions{strict: strict}, func(path string) error {
+			paths = append(paths, path)
+			return nil
+		})
+		return paths, err
+	}
+
+	t.Run("SkipsUnreadableDirectory", func(t *testing.T) {
+		paths, err := walk(false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := []string{filepath.Join("/library", "a.epub"), filepath.Join("/library", "shelf", "b.EPUB")}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("Expected %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("StrictWalkFails", func(t *testing.T) {
+		_, err := walk(true)
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("Expected permission error, got %v", err)
+		}
+	})
+
+	t.Run("UnreadableRootFails", func(t *testing.T) {
+		err := walkEpubFiles(failingDirFS{MapFS: fstest.MapFS{}, failDir: "."}, "/library", walkOptions{}, func(path string) error {
+			return nil
+		})
+		if err == nil {
+			t.Error("Expected error when the root cannot be read")
+		}
+	})
+}
+
+// TestWalkEpubFilesLimitPerDirectory tests skipping the epub files of a directory beyond the limit
+func TestWalkEpubFilesLimitPerDirectory(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.epub":            {},
+		"b.epub":            {},
+		"c.epub":            {},
+		"d.epub":            {},
+		"notes.txt":         {},
+		"shelf/e.epub":      {},
+		"shelf/f.epub":      {},
+		"shelf/g.epub":      {},
+		"shelf/deep/h.epub": {},
+	}
+
+	var paths []string
+	err := walkEpubFiles(fsys, "/library", walkOptions{limitPerDirectory: 2}, func(path string) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{
+		filepath.Join("/library", "a.epub"),
+		filepath.Join("/library", "b.epub"),
+		filepath.Join("/library", "shelf", "deep", "h.epub"),
+		filepath.Join("/library", "shelf", "e.epub"),
+		filepath.Join("/library", "shelf", "f.epub"),
+	}
+	if !slices.Equal(paths, expected) {
+		t.Errorf("Expected %v, got %v", expected, paths)
+	}
+}
+
+// TestWalkEpubFilesFollowSymlinks tests walking into symlinked directories without looping on cycles
+func TestWalkEpubFilesFollowSymlinks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "walk_symlinks_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	root := filepath.Join(tempDir, "root")
+	library := filepath.Join(tempDir, "library")
+	for _, dir := range []string{root, filepath.Join(library, "shelf")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	files := []string{
+		filepath.Join(root, "a.epub"),
+		filepath.Join(library, "b.epub"),
+		filepath.Join(library, "shelf", "c.epub"),
+	}
+	for _, file := range files {
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	links := map[string]string{
+		// a symlinked library outside the search root
+		filepath.Join(root, "linked"): library,
+		// a cycle back to the library from inside it
+		filepath.Join(library, "shelf", "loop"): library,
+		// a cycle back to the search root
+		filepath.Join(root, "self"): root,
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("Symlinks are not supported: %v", err)
+		}
+	}
+
+	walk := func(followSymlinks bool) []string {
+		var paths []string
+		err := walkEpubFiles(os.DirFS(root), root, walkOptions{followSymlinks: followSymlinks}, func(path string) error {
+			paths = append(paths, path)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		slices.Sort(paths)
+		return paths
+	}
+
+	t.Run("IgnoresSymlinksByDefault", func(t *testing.T) {
+		paths := walk(false)
+		expected := []string{filepath.Join(root, "a.epub")}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("Expected %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("FollowsSymlinkedDirectories", func(t *testing.T) {
+		paths := walk(true)
+		expected := []string{
+			filepath.Join(root, "a.epub"),
+			filepath.Join(root, "linked", "b.epub"),
+			filepath.Join(root, "linked", "shelf", "c.epub"),
+		}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("Expected %v, got %v", expected, paths)
+		}
+	})
+}
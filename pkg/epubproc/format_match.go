@@ -0,0 +1,66 @@
+package epubproc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Style defines how FormatMatch renders a match as text.
+type Style string
+
+const (
+	// StylePlain renders only the matched text.
+	StylePlain Style = "plain"
+
+	// StyleGrep renders each line of the match prefixed with its file and paragraph, like "OEBPS/ch1.html:3:text",
+	// leaving out the paragraph for files that are not HTML.
+	StyleGrep Style = "grep"
+
+	// StyleHuman renders a heading with the file, chapter, paragraph and position through the book, when known,
+	// followed by the lines of the match indented by two spaces.
+	StyleHuman Style = "human"
+)
+
+// FormatMatch renders a match as text in the given style, so integrators format matches consistently. Highlight markers
+// and context lines in the match are kept, and unknown styles render like StylePlain.
+func FormatMatch(m Match, style Style) string {
+	lines := strings.Split(m.Line, "\n")
+
+	switch style {
+	case StyleGrep:
+		prefix := m.FileName + ":"
+		if m.ParagraphIndex > 0 {
+			prefix += strconv.Itoa(m.ParagraphIndex) + ":"
+		}
+		for i, line := range lines {
+			lines[i] = prefix + line
+		}
+		return strings.Join(lines, "\n")
+
+	case StyleHuman:
+		var details []string
+		if m.Metadata != nil && m.Metadata.Chapter != nil && *m.Metadata.Chapter != "" {
+			details = append(details, fmt.Sprintf("chapter %q", *m.Metadata.Chapter))
+		}
+		if m.ParagraphIndex > 0 {
+			details = append(details, fmt.Sprintf("paragraph %d", m.ParagraphIndex))
+		}
+		if m.Percentage > 0 {
+			details = append(details, strconv.FormatFloat(m.Percentage, 'f', -1, 64)+"% through the book")
+		}
+
+		var b strings.Builder
+		b.WriteString(m.FileName)
+		if len(details) > 0 {
+			b.WriteString(" (" + strings.Join(details, ", ") + ")")
+		}
+		for _, line := range lines {
+			b.WriteString("\n  " + line)
+		}
+		return b.String()
+
+	default:
+		return m.Line
+	}
+}
@@ -0,0 +1,53 @@
+package epubproc
+
+import "testing"
+
+// TestFormatMatch tests rendering matches in each style
+func TestFormatMatch(t *testing.T) {
+	chapter := "A Scandal in Bohemia"
+	html := Match{
+		Line:           "To Sherlock Holmes she is always the woman.",
+		FileName:       "OEBPS/chapter1.html",
+		ParagraphIndex: 3,
+		Percentage:     34.2,
+		Metadata:       &MatchMetadata{Chapter: &chapter},
+	}
+	text := Match{
+		Line:     "first line\nHolmes in context",
+		FileName: "notes.txt",
+	}
+
+	tests := []struct {
+		name     string
+		match    Match
+		style    Style
+		expected string
+	}{
+		{name: "Plain", match: html, style: StylePlain, expected: "To Sherlock Holmes she is always the woman."},
+		{name: "PlainContext", match: text, style: StylePlain, expected: "first line\nHolmes in context"},
+		{name: "Grep", match: html, style: StyleGrep, expected: "OEBPS/chapter1.html:3:To Sherlock Holmes she is always the woman."},
+		{name: "GrepContextWithoutParagraph", match: text, style: StyleGrep, expected: "notes.txt:first line\nnotes.txt:Holmes in context"},
+		{
+			name:     "Human",
+			match:    html,
+			style:    StyleHuman,
+			expected: "OEBPS/chapter1.html (chapter \"A Scandal in Bohemia\", paragraph 3, 34.2% through the book)\n  To Sherlock Holmes she is always the woman.",
+		},
+		{name: "HumanWithoutDetails", match: text, style: StyleHuman, expected: "notes.txt\n  first line\n  Holmes in context"},
+		{
+			name:     "HighlightKept",
+			match:    Match{Line: "Mr. [Holmes] said", FileName: "a.html", ParagraphIndex: 1},
+			style:    StyleGrep,
+			expected: "a.html:1:Mr. [Holmes] said",
+		},
+		{name: "UnknownStyle", match: html, style: "fancy", expected: "To Sherlock Holmes she is always the woman."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FormatMatch(test.match, test.style); got != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package epubproc
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// fuzzyMatcher matches lines containing a run of words within a maximum edit distance of the query.
+type fuzzyMatcher struct {
+	// query is the normalized query, with its words separated by single spaces
+	query []rune
+
+	// wordCount is the number of words in the query
+	wordCount int
+
+	// maxDistance is the maximum Levenshtein distance for a match
+	maxDistance int
+
+	// ignoreCase controls whether lines are compared case-insensitively
+	ignoreCase bool
+}
+
+// newFuzzyMatcher creates a fuzzy matcher for a text query.
+func newFuzzyMatcher(text *SearchRequestText) (*fuzzyMatcher, error) {
+	if text.Fuzzy.MaxDistance < 0 {
+		return nil, fmt.Errorf("invalid fuzzy max distance %d: must not be negative", text.Fuzzy.MaxDistance)
+	}
+
+	value := text.Value
+	if text.IgnoreCase {
+		value = strings.ToLower(value)
+	}
+
+	words := splitWords(value)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("fuzzy search requires a value containing at least one word")
+	}
+
+	return &fuzzyMatcher{
+		query:       []rune(strings.Join(words, " ")),
+		wordCount:   len(words),
+		maxDistance: text.Fuzzy.MaxDistance,
+		ignoreCase:  text.IgnoreCase,
+	}, nil
+}
+
+// MatchString reports whether any run of words in the line is within the maximum distance of the query.
+func (m *fuzzyMatcher) MatchString(s string) bool {
+	if m.ignoreCase {
+		s = strings.ToLower(s)
+	}
+
+	words := splitWords(s)
+	for i := 0; i+m.wordCount <= len(words); i++ {
+		candidate := []rune(strings.Join(words[i:i+m.wordCount], " "))
+		if levenshteinWithin(candidate, m.query, m.maxDistance) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitWords splits text into words made of letters and numbers.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// levenshteinWithin checks if the Levenshtein distance between a and b is at most maxDistance.
+func levenshteinWithin(a, b []rune, maxDistance int) bool {
+	// the distance is at least the difference in length
+	if diff := len(a) - len(b); diff > maxDistance || -diff > maxDistance {
+		return false
+	}
+
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := current[0]
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			rowMin = min(rowMin, current[j])
+		}
+
+		// stop early once every path exceeds the limit
+		if rowMin > maxDistance {
+			return false
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)] <= maxDistance
+}
@@ -0,0 +1,144 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestFuzzyMatcher tests approximate matching of lines against a text query
+func TestFuzzyMatcher(t *testing.T) {
+	testCases := []struct {
+		name        string
+		value       string
+		ignoreCase  bool
+		maxDistance int
+		line        string
+		expected    bool
+	}{
+		{"OneSubstitution", "Holmes", false, 1, "Mr. Holmez entered the room.", true},
+		{"ExactWithZeroDistance", "Holmes", false, 0, "Mr. Holmes entered the room.", true},
+		{"TypoWithZeroDistance", "Holmes", false, 0, "Mr. Holmez entered the room.", false},
+		{"TooFar", "Holmes", false, 1, "Mr. Hulmez entered the room.", false},
+		{"Insertion", "Holmes", false, 1, "Mr. Hollmes entered the room.", true},
+		{"WholeWordsOnly", "Holmes", false, 1, "Sherlockholmes", false},
+		{"CaseSensitive", "Holmes", false, 1, "HOLMES", false},
+		{"IgnoreCase", "Holmes", true, 1, "HOLMEZ", true},
+		{"MultipleWords", "Sherlock Holmes", false, 2, "said Sherlok  Holmez, smiling", true},
+		{"MultipleWordsTooFar", "Sherlock Holmes", false, 1, "said Sherlok Holmez, smiling", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matcher, err := newFuzzyMatcher(&SearchRequestText{
+				Value:      tc.value,
+				IgnoreCase: tc.ignoreCase,
+				Fuzzy:      &FuzzyConfig{MaxDistance: tc.maxDistance},
+			})
+			if err != nil {
+				t.Fatalf("newFuzzyMatcher failed: %v", err)
+			}
+
+			if result := matcher.MatchString(tc.line); result != tc.expected {
+				t.Errorf("Expected %t for '%s', got %t", tc.expected, tc.line, result)
+			}
+		})
+	}
+}
+
+// TestFuzzyMatcherErrors tests validation of fuzzy configuration
+func TestFuzzyMatcherErrors(t *testing.T) {
+	t.Run("NegativeDistance", func(t *testing.T) {
+		_, err := newFuzzyMatcher(&SearchRequestText{Value: "Holmes", Fuzzy: &FuzzyConfig{MaxDistance: -1}})
+		if err == nil {
+			t.Error("Expected error for negative distance")
+		}
+	})
+
+	t.Run("NoWords", func(t *testing.T) {
+		_, err := newFuzzyMatcher(&SearchRequestText{Value: " ... ", Fuzzy: &FuzzyConfig{MaxDistance: 1}})
+		if err == nil {
+			t.Error("Expected error for value without words")
+		}
+	})
+}
+
+// TestLevenshteinWithin tests the bounded edit distance check
+func TestLevenshteinWithin(t *testing.T) {
+	testCases := []struct {
+		a, b        string
+		maxDistance int
+		expected    bool
+	}{
+		{"holmes", "holmes", 0, true},
+		{"holmes", "holmez", 1, true},
+		{"holmes", "holmez", 0, false},
+		{"kitten", "sitting", 3, true},
+		{"kitten", "sitting", 2, false},
+		{"", "abc", 3, true},
+		{"watson", "wat", 2, false},
+		{"café", "cafe", 1, true},
+	}
+
+	for _, tc := range testCases {
+		if result := levenshteinWithin([]rune(tc.a), []rune(tc.b), tc.maxDistance); result != tc.expected {
+			t.Errorf("levenshteinWithin(%s, %s, %d): expected %t, got %t", tc.a, tc.b, tc.maxDistance, tc.expected, result)
+		}
+	}
+}
+
+// TestFuzzySearch tests fuzzy matching through a full search
+func TestFuzzySearch(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fuzzy_search_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "ocr.epub", "<p>Mr. Sherlock Holmez, who was usually very late.</p><p>Dr. Watson.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	search := func(query SearchRequestQuery) []Match {
+		var matches []Match
+		err := NewFileSearch(tempDir, 1, false).Search(context.Background(), &SearchRequest{Query: query}, func(result *SearchResult) error {
+			matches = append(matches, result.Matches...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return matches
+	}
+
+	t.Run("FuzzyText", func(t *testing.T) {
+		matches := search(SearchRequestQuery{
+			Text: &SearchRequestText{Value: "Holmes", Fuzzy: &FuzzyConfig{MaxDistance: 1}},
+		})
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+	})
+
+	t.Run("ExactTextMisses", func(t *testing.T) {
+		matches := search(SearchRequestQuery{
+			Text: &SearchRequestText{Value: "Holmes"},
+		})
+		if len(matches) != 0 {
+			t.Errorf("Expected no matches, got %d", len(matches))
+		}
+	})
+
+	t.Run("FuzzySubQueryWithAnd", func(t *testing.T) {
+		matches := search(SearchRequestQuery{
+			Combine: CombineAnd,
+			SubQueries: []SearchRequestQuery{
+				{Text: &SearchRequestText{Value: "Holmes", Fuzzy: &FuzzyConfig{MaxDistance: 1}}},
+				{IsRegex: true, Regex: &SearchRequestRegex{Pattern: "Wat.on"}},
+			},
+		})
+		if len(matches) != 2 {
+			t.Errorf("Expected 2 matches, got %d", len(matches))
+		}
+	})
+}
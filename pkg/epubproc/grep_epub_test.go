@@ -2,13 +2,21 @@ package epubproc
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 // createTestZIPWithFiles creates a test ZIP file with specified files and content
@@ -33,6 +41,28 @@ func createTestZIPWithFiles(path string, files map[string]string) error {
 	return nil
 }
 
+// createOrderedTestZIP creates a test ZIP file with entries written in the given order, as name and content pairs
+func createOrderedTestZIP(path string, entries [][2]string) error {
+	zipFile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer zipFile.Close()
+
+	writer := zip.NewWriter(zipFile)
+	for _, entry := range entries {
+		file, err := writer.Create(entry[0])
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write([]byte(entry[1])); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
 // TestGrepInEpub tests the grepInEpub function with various scenarios
 func TestGrepInEpub(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "grep_epub_test_*")
@@ -59,7 +89,7 @@ func TestGrepInEpub(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -82,6 +112,97 @@ func TestGrepInEpub(t *testing.T) {
 		}
 	})
 
+	// test opting into extra text extensions
+	t.Run("ExtraTextExtensions", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "extra.epub")
+		files := map[string]string{
+			"chapter1.txt": "This is plain text with target word Holmes.",
+			"style.css":    ".target { color: red; }",
+			"data.json":    `{"target": true}`,
+			"image.png":    "binary data",
+
+			// skip list still applies to extra extensions
+			"sample.css": ".target { color: blue; }",
+		}
+
+		if err := createTestZIPWithFiles(epubPath, files); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		pattern, _ := regexp.Compile("target")
+		opts := newScanOptions(&SearchRequest{ExtraTextExtensions: []string{".CSS", "json"}})
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, opts, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+
+		foundFiles := make(map[string]bool)
+		for _, match := range matches {
+			foundFiles[match.FileName] = true
+		}
+
+		for _, expectedFile := range []string{"chapter1.txt", "style.css", "data.json"} {
+			if !foundFiles[expectedFile] {
+				t.Errorf("Expected match in %s, but not found", expectedFile)
+			}
+		}
+		if foundFiles["image.png"] || foundFiles["sample.css"] {
+			t.Errorf("Expected image.png and sample.css to be skipped, got matches in %v", foundFiles)
+		}
+	})
+
+	// test replacing the default content type mapping
+	t.Run("ContentTypes", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "content_types.epub")
+		files := map[string]string{
+			"notes.md":       "Markdown notes with target word.",
+			"figure.svg":     "<svg><text>target figure</text></svg>",
+			"chapter1.xhtml": "<html><body><p>target in html</p></body></html>",
+			"chapter2.txt":   "target in text",
+		}
+
+		if err := createTestZIPWithFiles(epubPath, files); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		pattern, _ := regexp.Compile("target")
+		opts := newScanOptions(&SearchRequest{
+			ContentTypes:        map[string]string{"MD": "text", ".svg": "HTML", ".xhtml": "html"},
+			ExtraTextExtensions: []string{".txt"},
+		})
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, opts, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+
+		lines := make(map[string]string)
+		for _, match := range matches {
+			lines[match.FileName] = match.Line
+		}
+
+		expected := map[string]string{
+			"notes.md":       "Markdown notes with target word.",
+			"figure.svg":     "target figure",
+			"chapter1.xhtml": "target in html",
+			"chapter2.txt":   "target in text",
+		}
+		for fileName, line := range expected {
+			if lines[fileName] != line {
+				t.Errorf("Expected %q in %s, got %q", line, fileName, lines[fileName])
+			}
+		}
+
+		// extensions left out of the mapping are no longer scanned
+		opts = newScanOptions(&SearchRequest{ContentTypes: map[string]string{".md": "text"}})
+		matches, _, err = grepInEpub(context.Background(), epubPath, pattern, opts, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		if len(matches) != 1 || matches[0].FileName != "notes.md" {
+			t.Errorf("Expected a single match in notes.md, got %+v", matches)
+		}
+	})
+
 	// test with context lines
 	t.Run("ContextLines", func(t *testing.T) {
 		epubPath := filepath.Join(tempDir, "context.epub")
@@ -94,7 +215,7 @@ func TestGrepInEpub(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("Target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 1)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{contextLines: 1}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -130,7 +251,7 @@ func TestGrepInEpub(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -162,13 +283,209 @@ func TestGrepInEpub(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
 		cancel()
 
-		_, err := grepInEpub(ctx, epubPath, pattern, 0)
+		_, _, err := grepInEpub(ctx, epubPath, pattern, scanOptions{}, nil)
 
 		if err != context.Canceled {
 			t.Errorf("Expected context.Canceled error, got: %v", err)
 		}
 	})
 
+	// test that entries escaping the archive root are ignored
+	t.Run("UnsafeEntryPaths", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "zipslip.epub")
+		files := map[string]string{
+			"content.html":          "<p>This should be found: target</p>",
+			"../evil.html":          "<p>This should be ignored: target</p>",
+			"OEBPS/../../evil.html": "<p>This should be ignored: target</p>",
+			"/abs/evil.html":        "<p>This should be ignored: target</p>",
+		}
+
+		if err := createTestZIPWithFiles(epubPath, files); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		pattern, _ := regexp.Compile("target")
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match (only in content.html), got %d", len(matches))
+		}
+
+		if matches[0].FileName != "content.html" {
+			t.Errorf("Expected match in content.html, got %s", matches[0].FileName)
+		}
+	})
+
+	// test that entry size statistics are collected when enabled
+	t.Run("EntryStats", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "stats.epub")
+		content := strings.Repeat("<p>Repetitive content compresses well: target</p>\n", 200)
+		files := map[string]string{
+			"chapter1.html": content,
+			"image.png":     "binary data",
+		}
+
+		if err := createTestZIPWithFiles(epubPath, files); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		pattern, _ := regexp.Compile("target")
+		_, info, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{entryStats: true}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+
+		// only scanned content files should be reported
+		if len(info.entryStats) != 1 {
+			t.Fatalf("Expected stats for 1 entry, got %d", len(info.entryStats))
+		}
+
+		stats := info.entryStats[0]
+		if stats.FileName != "chapter1.html" {
+			t.Errorf("Expected stats for chapter1.html, got %s", stats.FileName)
+		}
+		if stats.UncompressedSize != uint64(len(content)) {
+			t.Errorf("Expected uncompressed size %d, got %d", len(content), stats.UncompressedSize)
+		}
+		if stats.CompressedSize == 0 || stats.CompressedSize >= stats.UncompressedSize {
+			t.Errorf("Expected compressed size between 0 and %d, got %d", stats.UncompressedSize, stats.CompressedSize)
+		}
+		if stats.CompressionRatio <= 1 {
+			t.Errorf("Expected compression ratio above 1, got %f", stats.CompressionRatio)
+		}
+
+		// stats should not be collected unless requested
+		_, info, err = grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		if len(info.entryStats) != 0 {
+			t.Errorf("Expected no entry stats by default, got %d", len(info.entryStats))
+		}
+	})
+
+	// test restricting the search with internal file globs
+	t.Run("InternalGlobs", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "globs.epub")
+		files := map[string]string{
+			"OEBPS/chapter1.html": "<p>Chapter one: target</p>",
+			"OEBPS/chapter2.html": "<p>Chapter two: target</p>",
+			"OEBPS/notes1.xhtml":  "<p>Footnote: target</p>",
+			"OEBPS/intro.html":    "<p>Introduction: target</p>",
+		}
+
+		if err := createTestZIPWithFiles(epubPath, files); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		pattern, _ := regexp.Compile("target")
+
+		tests := []struct {
+			name     string
+			opts     scanOptions
+			expected []string
+		}{
+			{
+				name:     "IncludeChapters",
+				opts:     scanOptions{includeGlobs: []string{"chapter*.html"}},
+				expected: []string{"OEBPS/chapter1.html", "OEBPS/chapter2.html"},
+			},
+			{
+				name:     "ExcludeNotes",
+				opts:     scanOptions{excludeGlobs: []string{"notes*.xhtml"}},
+				expected: []string{"OEBPS/chapter1.html", "OEBPS/chapter2.html", "OEBPS/intro.html"},
+			},
+			{
+				name: "IncludeAndExclude",
+				opts: scanOptions{
+					includeGlobs: []string{"chapter*.html", "notes*.xhtml"},
+					excludeGlobs: []string{"chapter2.html"},
+				},
+				expected: []string{"OEBPS/chapter1.html", "OEBPS/notes1.xhtml"},
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				matches, _, err := grepInEpub(context.Background(), epubPath, pattern, test.opts, nil)
+				if err != nil {
+					t.Fatalf("grepInEpub failed: %v", err)
+				}
+
+				foundFiles := make(map[string]bool)
+				for _, match := range matches {
+					foundFiles[match.FileName] = true
+				}
+
+				if len(foundFiles) != len(test.expected) {
+					t.Errorf("Expected matches in %v, got %v", test.expected, foundFiles)
+				}
+				for _, expectedFile := range test.expected {
+					if !foundFiles[expectedFile] {
+						t.Errorf("Expected match in %s, but not found", expectedFile)
+					}
+				}
+			})
+		}
+	})
+
+	// test matching internal file globs regardless of case
+	t.Run("InternalGlobsIgnoreCase", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "globs_case.epub")
+		files := map[string]string{
+			"OEBPS/Chapter01.XHTML": "<p>Chapter one: target</p>",
+			"OEBPS/NOTES.xhtml":     "<p>Footnote: target</p>",
+		}
+
+		if err := createTestZIPWithFiles(epubPath, files); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		pattern, _ := regexp.Compile("target")
+
+		tests := []struct {
+			name     string
+			opts     scanOptions
+			expected []string
+		}{
+			{
+				name:     "CaseSensitiveByDefault",
+				opts:     scanOptions{includeGlobs: []string{"chapter*.xhtml"}},
+				expected: nil,
+			},
+			{
+				name:     "Include",
+				opts:     scanOptions{includeGlobs: []string{"chapter*.xhtml"}, ignoreGlobCase: true},
+				expected: []string{"OEBPS/Chapter01.XHTML"},
+			},
+			{
+				name:     "Exclude",
+				opts:     scanOptions{excludeGlobs: []string{"Notes.*"}, ignoreGlobCase: true},
+				expected: []string{"OEBPS/Chapter01.XHTML"},
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				matches, _, err := grepInEpub(context.Background(), epubPath, pattern, test.opts, nil)
+				if err != nil {
+					t.Fatalf("grepInEpub failed: %v", err)
+				}
+
+				var foundFiles []string
+				for _, match := range matches {
+					foundFiles = append(foundFiles, match.FileName)
+				}
+				if !slices.Equal(foundFiles, test.expected) {
+					t.Errorf("Expected matches in %v, got %v", test.expected, foundFiles)
+				}
+			})
+		}
+	})
+
 	// test with directories in ZIP
 	t.Run("DirectoriesInZip", func(t *testing.T) {
 		epubPath := filepath.Join(tempDir, "dirs.epub")
@@ -182,7 +499,7 @@ func TestGrepInEpub(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -205,7 +522,7 @@ func TestGrepInEpubErrors(t *testing.T) {
 	// test with non-existent file
 	t.Run("NonExistentFile", func(t *testing.T) {
 		pattern, _ := regexp.Compile("test")
-		_, err := grepInEpub(context.Background(), "/non/existent/file.epub", pattern, 0)
+		_, _, err := grepInEpub(context.Background(), "/non/existent/file.epub", pattern, scanOptions{}, nil)
 
 		if err == nil {
 			t.Error("Expected error for non-existent file")
@@ -229,7 +546,7 @@ func TestGrepInEpubErrors(t *testing.T) {
 		file.Close()
 
 		pattern, _ := regexp.Compile("test")
-		_, err = grepInEpub(context.Background(), invalidZipPath, pattern, 0)
+		_, _, err = grepInEpub(context.Background(), invalidZipPath, pattern, scanOptions{}, nil)
 		if err == nil {
 			t.Error("Expected error for invalid ZIP file")
 		}
@@ -256,13 +573,39 @@ func TestGrepInEpubErrors(t *testing.T) {
 		time.Sleep(10 * time.Microsecond)
 
 		// should get context timeout or cancellation
-		_, err := grepInEpub(ctx, epubPath, pattern, 0)
+		_, _, err := grepInEpub(ctx, epubPath, pattern, scanOptions{}, nil)
 		if err == nil {
 			t.Error("Expected timeout error")
 		} else if err != context.DeadlineExceeded && err != context.Canceled {
 			t.Errorf("Expected timeout or cancellation error, got: %v", err)
 		}
 	})
+
+	// test that a file the scanner cannot read is reported as a content error, keeping matches from other files
+	t.Run("ScanError", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "scan_error.epub")
+		files := map[string]string{
+			"chapter1.txt": "target in a readable file",
+			"chapter2.txt": strings.Repeat("x", 512*1024) + " target",
+		}
+
+		if err := createTestZIPWithFiles(epubPath, files); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		pattern, _ := regexp.Compile("target")
+		matches, info, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+
+		if len(matches) != 1 || matches[0].FileName != "chapter1.txt" {
+			t.Errorf("Expected 1 match in chapter1.txt, got %v", matches)
+		}
+		if len(info.contentErrors) != 1 || !strings.Contains(info.contentErrors[0].Error(), "chapter2.txt") {
+			t.Errorf("Expected a content error for chapter2.txt, got %v", info.contentErrors)
+		}
+	})
 }
 
 // TestGrepInEpubChapterMetadata tests chapter name enrichment via toc.ncx parsing.
@@ -302,7 +645,7 @@ func TestGrepInEpubChapterMetadata(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -356,7 +699,7 @@ func TestGrepInEpubChapterMetadata(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -390,7 +733,7 @@ func TestGrepInEpubChapterMetadata(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -425,7 +768,7 @@ func TestGrepInEpubChapterMetadata(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -453,7 +796,7 @@ func TestGrepInEpubChapterMetadata(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub should not return an error on malformed toc.ncx, got: %v", err)
 		}
@@ -488,7 +831,7 @@ func TestGrepInEpubChapterMetadata(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -534,7 +877,7 @@ func TestGrepInEpubContentOpfFallback(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -605,7 +948,7 @@ func TestGrepInEpubContentOpfFallback(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -639,7 +982,7 @@ func TestGrepInEpubContentOpfFallback(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -671,7 +1014,7 @@ func TestGrepInEpubContentOpfFallback(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		}
@@ -699,7 +1042,7 @@ func TestGrepInEpubContentOpfFallback(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub should not return an error on malformed content.opf, got: %v", err)
 		}
@@ -730,7 +1073,7 @@ func TestGrepInEpubEdgeCases(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		} else if len(matches) != 0 {
@@ -751,7 +1094,7 @@ func TestGrepInEpubEdgeCases(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 0)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		} else if len(matches) != 0 {
@@ -783,7 +1126,7 @@ func TestGrepInEpubEdgeCases(t *testing.T) {
 		}
 
 		pattern, _ := regexp.Compile("target")
-		matches, err := grepInEpub(context.Background(), epubPath, pattern, 20)
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{contextLines: 20}, nil)
 		if err != nil {
 			t.Fatalf("grepInEpub failed: %v", err)
 		} else if len(matches) != 1 {
@@ -797,3 +1140,796 @@ func TestGrepInEpubEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+// TestGrepInEpubCompressionMethods tests that stored and deflated entries are scanned identically
+func TestGrepInEpubCompressionMethods(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_compression_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	filler := strings.Repeat("<p>The fog rolled over the moor.</p>\n", 200)
+	contents := map[string]string{
+		".html": filler + "<p>Holmes <i>lit</i> his pipe.</p>\n" + filler,
+		".txt":  strings.Repeat("The fog rolled over the moor.\n", 200) + "Holmes lit his pipe.\n",
+	}
+	methods := map[string]uint16{"stored": zip.Store, "deflated": zip.Deflate}
+
+	epubPath := filepath.Join(tempDir, "compression.epub")
+	zipFile, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	writer := zip.NewWriter(zipFile)
+	for prefix, method := range methods {
+		for ext, content := range contents {
+			file, err := writer.CreateHeader(&zip.FileHeader{Name: prefix + ext, Method: method})
+			if err != nil {
+				t.Fatalf("Failed to create entry: %v", err)
+			}
+			if _, err := file.Write([]byte(content)); err != nil {
+				t.Fatalf("Failed to write entry: %v", err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to finish test ePUB: %v", err)
+	}
+	zipFile.Close()
+
+	pattern := regexp.MustCompile("Holmes")
+	matches, info, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{contextLines: 1, entryStats: true}, nil)
+	if err != nil {
+		t.Fatalf("grepInEpub failed: %v", err)
+	}
+
+	lines := make(map[string]string)
+	for _, match := range matches {
+		lines[match.FileName] = match.Line
+	}
+	for ext := range contents {
+		stored, deflated := lines["stored"+ext], lines["deflated"+ext]
+		if stored == "" || stored != deflated {
+			t.Errorf("Expected identical %s matches, got stored %q and deflated %q", ext, stored, deflated)
+		}
+	}
+
+	// the entry stats confirm each method was really used
+	for _, stats := range info.entryStats {
+		stored := strings.HasPrefix(stats.FileName, "stored")
+		if stored && stats.CompressedSize != stats.UncompressedSize {
+			t.Errorf("Expected %s to be stored, got %d compressed bytes for %d", stats.FileName, stats.CompressedSize, stats.UncompressedSize)
+		}
+		if !stored && stats.CompressedSize >= stats.UncompressedSize {
+			t.Errorf("Expected %s to be deflated, got %d compressed bytes for %d", stats.FileName, stats.CompressedSize, stats.UncompressedSize)
+		}
+	}
+	if len(info.entryStats) != 4 {
+		t.Errorf("Expected stats for 4 entries, got %d", len(info.entryStats))
+	}
+}
+
+// TestGrepInEpubMaxBytes tests stopping the scan of an epub at a decompressed byte limit
+func TestGrepInEpubMaxBytes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_max_bytes_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// entries are scanned in archive order, which createTestZIPWithFiles does not control, so every entry is large
+	page := strings.Repeat("<p>Holmes waited.</p>\n", 1000)
+	epubPath := filepath.Join(tempDir, "oversized.epub")
+	if err := createTestZIPWithFiles(epubPath, map[string]string{"chapter1.html": page, "chapter2.html": page}); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	pattern := regexp.MustCompile("Holmes")
+
+	t.Run("Truncated", func(t *testing.T) {
+		matches, info, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{maxBytes: 100}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		if !info.truncated {
+			t.Error("Expected the scan to be truncated")
+		}
+		// each block is 22 bytes, so 100 bytes hold 4 complete blocks and part of a 5th
+		if len(matches) == 0 || len(matches) > 5 {
+			t.Errorf("Expected the matches found before the limit, got %d", len(matches))
+		}
+	})
+
+	t.Run("ExactLimit", func(t *testing.T) {
+		_, info, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{maxBytes: int64(2 * len(page))}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		if info.truncated {
+			t.Error("Expected no truncation when the content fits the limit exactly")
+		}
+	})
+
+	t.Run("SearchResult", func(t *testing.T) {
+		request := &SearchRequest{
+			Query:           SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}},
+			MaxBytesPerEpub: 100,
+		}
+
+		var results []*SearchResult
+		if err := NewFileSearch(tempDir, 1, false).Search(context.Background(), request, func(result *SearchResult) error {
+			results = append(results, result)
+			return nil
+		}); err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+
+		if len(results) != 1 || !results[0].Truncated {
+			t.Errorf("Expected 1 truncated result, got %+v", results)
+		}
+	})
+}
+
+// TestGrepInEpubReadingOrder tests sorting matches by spine position instead of archive order
+func TestGrepInEpubReadingOrder(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_reading_order_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <manifest>
+    <item id="c1" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="text/two.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c3" href="text/three.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="c1"/><itemref idref="c2"/><itemref idref="c3"/></spine>
+</package>`
+
+	// entries are written in a deliberately shuffled order
+	entries := [][2]string{
+		{"META-INF/container.xml", tocContainerXML},
+		{"OEBPS/text/three.xhtml", "<p>Holmes three.</p>"},
+		{"OEBPS/extra.html", "<p>Holmes outside the spine.</p>"},
+		{"OEBPS/text/one.xhtml", "<p>Holmes one a.</p><p>Holmes one b.</p>"},
+		{"OEBPS/content.opf", opf},
+		{"OEBPS/text/two.xhtml", "<p>Holmes two.</p>"},
+	}
+
+	createEPUB := func(name string, entries [][2]string) string {
+		epubPath := filepath.Join(tempDir, name)
+		if err := createOrderedTestZIP(epubPath, entries); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+		return epubPath
+	}
+
+	lines := func(epubPath string, readingOrder bool) []string {
+		matches, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile("Holmes"), scanOptions{readingOrder: readingOrder}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		var result []string
+		for _, match := range matches {
+			result = append(result, match.Line)
+		}
+		return result
+	}
+
+	t.Run("SpineOrder", func(t *testing.T) {
+		expected := []string{"Holmes one a.", "Holmes one b.", "Holmes two.", "Holmes three.", "Holmes outside the spine."}
+		if got := lines(createEPUB("ordered.epub", entries), true); !slices.Equal(got, expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("ArchiveOrderByDefault", func(t *testing.T) {
+		expected := []string{"Holmes three.", "Holmes outside the spine.", "Holmes one a.", "Holmes one b.", "Holmes two."}
+		if got := lines(createEPUB("default.epub", entries), false); !slices.Equal(got, expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("NoSpine", func(t *testing.T) {
+		withoutPackage := slices.DeleteFunc(slices.Clone(entries), func(entry [2]string) bool {
+			return entry[0] == "OEBPS/content.opf"
+		})
+		expected := []string{"Holmes three.", "Holmes outside the spine.", "Holmes one a.", "Holmes one b.", "Holmes two."}
+		if got := lines(createEPUB("no_spine.epub", withoutPackage), true); !slices.Equal(got, expected) {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+}
+
+// TestGrepInEpubPercentage tests the approximate position of matches through the book in reading order
+func TestGrepInEpubPercentage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_percentage_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <manifest>
+    <item id="c1" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="text/two.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="c1"/><itemref idref="c2"/></spine>
+</package>`
+
+	// two chapters of equal size, each with a short paragraph in the middle
+	filler := "<p>" + strings.Repeat("filler text ", 100) + "</p>"
+	chapter := func(word string) string {
+		return filler + "<p>" + word + " is here.</p>" + filler
+	}
+
+	// the second chapter is written first, so the position follows the spine rather than the archive
+	entries := [][2]string{
+		{"META-INF/container.xml", tocContainerXML},
+		{"OEBPS/content.opf", opf},
+		{"OEBPS/text/two.xhtml", chapter("Holmes")},
+		{"OEBPS/text/one.xhtml", chapter("Watson")},
+	}
+
+	epubPath := filepath.Join(tempDir, "percentage.epub")
+	if err := createOrderedTestZIP(epubPath, entries); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	percentages := func(pattern string, opts scanOptions) []float64 {
+		matches, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile(pattern), opts, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		var result []float64
+		for _, match := range matches {
+			result = append(result, match.Percentage)
+		}
+		return result
+	}
+
+	t.Run("SecondChapter", func(t *testing.T) {
+		got := percentages("Holmes", scanOptions{percentage: true})
+		if len(got) != 1 || got[0] < 74 || got[0] > 76 {
+			t.Errorf("Expected a single match at about 75%%, got %v", got)
+		}
+	})
+
+	t.Run("FirstChapter", func(t *testing.T) {
+		got := percentages("Watson", scanOptions{percentage: true})
+		if len(got) != 1 || got[0] < 24 || got[0] > 26 {
+			t.Errorf("Expected a single match at about 25%%, got %v", got)
+		}
+	})
+
+	t.Run("WithContext", func(t *testing.T) {
+		got := percentages("Holmes", scanOptions{percentage: true, contextLines: 1})
+		if len(got) != 1 || got[0] < 74 || got[0] > 76 {
+			t.Errorf("Expected a single match at about 75%%, got %v", got)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		if got := percentages("Holmes", scanOptions{}); len(got) != 1 || got[0] != 0 {
+			t.Errorf("Expected no percentage by default, got %v", got)
+		}
+	})
+
+	t.Run("TextFiles", func(t *testing.T) {
+		textPath := filepath.Join(tempDir, "text.epub")
+		line := strings.Repeat("filler text ", 10) + "\n"
+		text := strings.Repeat(line, 10) + "Holmes is here.\n" + strings.Repeat(line, 10)
+		if err := createOrderedTestZIP(textPath, [][2]string{{"a.txt", text}, {"b.txt", text}}); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		for _, opts := range []scanOptions{{percentage: true}, {percentage: true, contextLines: 1}} {
+			matches, _, err := grepInEpub(context.Background(), textPath, regexp.MustCompile("Holmes"), opts, nil)
+			if err != nil {
+				t.Fatalf("grepInEpub failed: %v", err)
+			}
+			if len(matches) != 2 || matches[0].Percentage < 24 || matches[0].Percentage > 26 ||
+				matches[1].Percentage < 74 || matches[1].Percentage > 76 {
+				t.Errorf("Expected matches at about 25%% and 75%% with %d context lines, got %+v", opts.contextLines, matches)
+			}
+		}
+	})
+}
+
+// TestGrepInEpubDedupeLines tests dropping matches that repeat an earlier line in the same file
+func TestGrepInEpubDedupeLines(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_dedupe_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	epubPath := filepath.Join(tempDir, "dedupe.epub")
+	files := map[string]string{
+		"chapter1.html": "<p>* * *</p><p>First scene.</p><p>*  *  *</p><p>Second scene.</p><p>* * *</p>",
+		"chapter2.html": "<p>* * *</p>",
+	}
+	if err := createTestZIPWithFiles(epubPath, files); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	count := func(dedupe bool) map[string]int {
+		opts := scanOptions{dedupeLines: dedupe}
+		matches, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile(`\*`), opts, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		counts := make(map[string]int)
+		for _, match := range matches {
+			counts[match.FileName]++
+		}
+		return counts
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		// repeats are only dropped within a file, and the first match keeps its paragraph
+		counts := count(true)
+		if counts["chapter1.html"] != 1 || counts["chapter2.html"] != 1 {
+			t.Errorf("Expected one match per file, got %v", counts)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		counts := count(false)
+		if counts["chapter1.html"] != 3 || counts["chapter2.html"] != 1 {
+			t.Errorf("Expected every match to be kept, got %v", counts)
+		}
+	})
+
+	t.Run("DistinctLinesKept", func(t *testing.T) {
+		matches := dedupeMatchLines([]Match{
+			{Line: "Holmes  said", ParagraphIndex: 1},
+			{Line: "Holmes said", ParagraphIndex: 2},
+			{Line: "Holmes replied", ParagraphIndex: 3},
+		})
+		if len(matches) != 2 || matches[0].ParagraphIndex != 1 || matches[1].ParagraphIndex != 3 {
+			t.Errorf("Expected the first and third matches, got %+v", matches)
+		}
+	})
+}
+
+// TestGrepInEpubDocumentMode tests matching a pattern across the files of a book in reading order
+func TestGrepInEpubDocumentMode(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_document_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <manifest>
+    <item id="c1" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="text/two.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="c1"/><itemref idref="c2"/></spine>
+</package>`
+
+	// the second chapter is written first, so a match across chapters depends on the reading order
+	entries := [][2]string{
+		{"META-INF/container.xml", tocContainerXML},
+		{"OEBPS/content.opf", opf},
+		{"OEBPS/text/two.xhtml", "<p>Nothing here.</p><p>The key was under the mat.</p>"},
+		{"OEBPS/text/one.xhtml", "<h1>The Red Room</h1><p>It began.</p>"},
+	}
+
+	epubPath := filepath.Join(tempDir, "document.epub")
+	if err := createOrderedTestZIP(epubPath, entries); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	query, err := compileQuery(SearchRequestQuery{IsRegex: true, Regex: &SearchRequestRegex{Pattern: "Red Room.*key"}}, false)
+	if err != nil {
+		t.Fatalf("Failed to compile query: %v", err)
+	}
+	pattern, err := query.documentPattern()
+	if err != nil {
+		t.Fatalf("Failed to compile document pattern: %v", err)
+	}
+
+	t.Run("AcrossChapters", func(t *testing.T) {
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{documentMode: true}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+
+		match := matches[0]
+		expectedLine := "The Red Room\nIt began.\nNothing here.\nThe key was under the mat."
+		if match.Line != expectedLine {
+			t.Errorf("Expected line %q, got %q", expectedLine, match.Line)
+		}
+		if match.FileName != "OEBPS/text/one.xhtml" || match.ParagraphIndex != 1 {
+			t.Errorf("Expected the match to start in paragraph 1 of one.xhtml, got %s paragraph %d", match.FileName, match.ParagraphIndex)
+		}
+		expectedEnd := MatchPosition{FileName: "OEBPS/text/two.xhtml", ParagraphIndex: 2}
+		if match.End == nil || *match.End != expectedEnd {
+			t.Errorf("Expected the match to end at %+v, got %+v", expectedEnd, match.End)
+		}
+	})
+
+	t.Run("PerFile", func(t *testing.T) {
+		matches, _, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		if len(matches) != 0 {
+			t.Errorf("Expected no matches without document mode, got %+v", matches)
+		}
+	})
+
+	t.Run("ByteLimit", func(t *testing.T) {
+		// the limit stops reading before the second chapter, so the pattern cannot match
+		matches, info, err := grepInEpub(context.Background(), epubPath, pattern, scanOptions{documentMode: true, maxBytes: 50}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		if len(matches) != 0 || !info.truncated {
+			t.Errorf("Expected a truncated document without matches, got %+v (truncated %t)", matches, info.truncated)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		phrase, err := compileQuery(SearchRequestQuery{Text: &SearchRequestText{Value: "key"}}, true)
+		if err != nil {
+			t.Fatalf("Failed to compile query: %v", err)
+		}
+		if _, err := phrase.documentPattern(); err == nil {
+			t.Error("Expected an error combining document mode with phrase mode")
+		}
+
+		fuzzy, err := compileQuery(SearchRequestQuery{Text: &SearchRequestText{Value: "key", Fuzzy: &FuzzyConfig{MaxDistance: 1}}}, false)
+		if err != nil {
+			t.Fatalf("Failed to compile query: %v", err)
+		}
+		if _, err := fuzzy.documentPattern(); err == nil {
+			t.Error("Expected an error for document mode with fuzzy matching")
+		}
+	})
+}
+
+// TestGrepInEpubTraceLogging tests that each match is logged with its details at trace level only
+func TestGrepInEpubTraceLogging(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_trace_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	epubPath := filepath.Join(tempDir, "trace.epub")
+	if err := createTestZIPWithFiles(epubPath, map[string]string{"chapter1.html": "<p>Intro.</p><p>Holmes arrived.</p>"}); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	originalLogger, originalLevel := log.Logger, zerolog.GlobalLevel()
+	defer func() {
+		log.Logger = originalLogger
+		zerolog.SetGlobalLevel(originalLevel)
+	}()
+
+	var output bytes.Buffer
+	log.Logger = zerolog.New(&output)
+
+	search := func(level zerolog.Level) string {
+		output.Reset()
+		zerolog.SetGlobalLevel(level)
+		if _, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile("Holmes"), scanOptions{}, nil); err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		return output.String()
+	}
+
+	t.Run("Trace", func(t *testing.T) {
+		logged := search(zerolog.TraceLevel)
+
+		var event map[string]any
+		if err := json.Unmarshal([]byte(strings.TrimSpace(logged)), &event); err != nil {
+			t.Fatalf("Expected a single JSON log event, got %q: %v", logged, err)
+		}
+
+		expected := map[string]any{
+			"level":     "trace",
+			"message":   "match found",
+			"epub":      epubPath,
+			"file":      "chapter1.html",
+			"paragraph": float64(2),
+			"line":      "Holmes arrived.",
+		}
+		for key, value := range expected {
+			if event[key] != value {
+				t.Errorf("Expected %s to be %v, got %v", key, value, event[key])
+			}
+		}
+	})
+
+	t.Run("Debug", func(t *testing.T) {
+		if logged := search(zerolog.DebugLevel); logged != "" {
+			t.Errorf("Expected no match logging above trace level, got %q", logged)
+		}
+	})
+}
+
+// TestGrepInEpubMaxFiles tests scanning only the first content files of an epub
+func TestGrepInEpubMaxFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_max_files_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <manifest>
+    <item id="c1" href="one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="two.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c3" href="three.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c4" href="four.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="c1"/><itemref idref="c2"/><itemref idref="c3"/><itemref idref="c4"/></spine>
+</package>`
+
+	// chapters are written out of reading order
+	chapters := [][2]string{
+		{"OEBPS/four.xhtml", "<p>Holmes in four.</p>"},
+		{"OEBPS/two.xhtml", "<p>Holmes in two.</p>"},
+		{"OEBPS/three.xhtml", "<p>Holmes in three.</p>"},
+		{"OEBPS/one.xhtml", "<p>Holmes in one.</p>"},
+	}
+
+	scannedFiles := func(t *testing.T, name string, entries [][2]string, maxFiles int) []string {
+		t.Helper()
+		epubPath := filepath.Join(tempDir, name)
+		if err := createOrderedTestZIP(epubPath, entries); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		matches, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile("Holmes"), scanOptions{maxFiles: maxFiles}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		var files []string
+		for _, match := range matches {
+			files = append(files, match.FileName)
+		}
+		return files
+	}
+
+	withPackage := append([][2]string{{"META-INF/container.xml", tocContainerXML}}, chapters...)
+	withPackage = append(withPackage, [2]string{"OEBPS/content.opf", opf})
+
+	t.Run("SpineOrder", func(t *testing.T) {
+		expected := []string{"OEBPS/one.xhtml", "OEBPS/two.xhtml"}
+		if got := scannedFiles(t, "spine.epub", withPackage, 2); !slices.Equal(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("ArchiveOrderWithoutSpine", func(t *testing.T) {
+		expected := []string{"OEBPS/four.xhtml", "OEBPS/two.xhtml"}
+		if got := scannedFiles(t, "no_spine.epub", chapters, 2); !slices.Equal(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("NoLimit", func(t *testing.T) {
+		if got := scannedFiles(t, "no_limit.epub", withPackage, 0); len(got) != 4 {
+			t.Errorf("Expected all 4 files to be scanned, got %v", got)
+		}
+	})
+
+	t.Run("ChapterNames", func(t *testing.T) {
+		// content.opf comes after the limit is reached, but is still read for chapter names
+		epubPath := filepath.Join(tempDir, "chapters.epub")
+		if err := createOrderedTestZIP(epubPath, withPackage); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+		matches, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile("Holmes"), scanOptions{maxFiles: 1}, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		if len(matches) != 1 || matches[0].Metadata == nil || *matches[0].Metadata.Chapter != "c1" {
+			t.Errorf("Expected 1 match in chapter c1, got %+v", matches)
+		}
+	})
+}
+
+// TestGrepInEpubSpineRange tests scanning only the files within a range of spine positions
+func TestGrepInEpubSpineRange(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_spine_range_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <manifest>
+    <item id="c1" href="one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="two.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c3" href="three.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c4" href="four.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="c1"/><itemref idref="c2"/><itemref idref="c3"/><itemref idref="c4"/></spine>
+</package>`
+
+	// chapters are written out of reading order, with a file outside the spine
+	chapters := [][2]string{
+		{"OEBPS/four.xhtml", "<p>Holmes in four.</p>"},
+		{"OEBPS/two.xhtml", "<p>Holmes in two.</p>"},
+		{"OEBPS/five.xhtml", "<p>Holmes outside the spine.</p>"},
+		{"OEBPS/three.xhtml", "<p>Holmes in three.</p>"},
+		{"OEBPS/one.xhtml", "<p>Holmes in one.</p>"},
+	}
+	withPackage := append([][2]string{{"META-INF/container.xml", tocContainerXML}, {"OEBPS/content.opf", opf}}, chapters...)
+
+	scannedFiles := func(t *testing.T, name string, entries [][2]string, opts scanOptions) []string {
+		t.Helper()
+		epubPath := filepath.Join(tempDir, name)
+		if err := createOrderedTestZIP(epubPath, entries); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		opts.readingOrder = true
+		matches, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile("Holmes"), opts, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		var files []string
+		for _, match := range matches {
+			files = append(files, match.FileName)
+		}
+		return files
+	}
+
+	testCases := []struct {
+		name     string
+		from, to int
+		expected []string
+	}{
+		{"Range", 2, 3, []string{"OEBPS/two.xhtml", "OEBPS/three.xhtml"}},
+		{"FromOnward", 3, 0, []string{"OEBPS/three.xhtml", "OEBPS/four.xhtml"}},
+		{"UpTo", 0, 1, []string{"OEBPS/one.xhtml"}},
+		{"PastEnd", 5, 0, nil},
+		{"NoRange", 0, 0, []string{"OEBPS/one.xhtml", "OEBPS/two.xhtml", "OEBPS/three.xhtml", "OEBPS/four.xhtml", "OEBPS/five.xhtml"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := scannedFiles(t, tc.name+".epub", withPackage, scanOptions{spineFrom: tc.from, spineTo: tc.to})
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+
+	t.Run("NoSpine", func(t *testing.T) {
+		if got := scannedFiles(t, "no_spine.epub", chapters, scanOptions{spineFrom: 2, spineTo: 3}); len(got) != 5 {
+			t.Errorf("Expected all 5 files to be scanned without a spine, got %v", got)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, request := range []*SearchRequest{{SpineFrom: -1}, {SpineFrom: 3, SpineTo: 2}} {
+			request.Query = SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}}
+			err := NewFileSearch(tempDir, 1, false).Search(context.Background(), request, func(*SearchResult) error { return nil })
+			if err == nil || !strings.Contains(err.Error(), "invalid spine range") {
+				t.Errorf("Expected an invalid spine range error, got %v", err)
+			}
+		}
+	})
+}
+
+// TestGrepInEpubFirstMatchOnly tests stopping at the first match in reading order, with its detail and context
+func TestGrepInEpubFirstMatchOnly(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_first_match_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <manifest>
+    <item id="c1" href="one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="two.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c3" href="three.txt" media-type="text/plain"/>
+  </manifest>
+  <spine><itemref idref="c1"/><itemref idref="c2"/><itemref idref="c3"/></spine>
+</package>`
+
+	// chapters are written out of reading order, and the first chapter does not match
+	epubPath := filepath.Join(tempDir, "book.epub")
+	err = createOrderedTestZIP(epubPath, [][2]string{
+		{"META-INF/container.xml", tocContainerXML},
+		{"OEBPS/three.txt", "Holmes in three.\nHolmes again in three."},
+		{"OEBPS/two.xhtml", "<p>Intro.</p><p>Holmes first.</p><p>Middle.</p><p>Filler.</p><p>More filler.</p><p>Holmes second.</p>"},
+		{"OEBPS/one.xhtml", "<p>No match here.</p>"},
+		{"OEBPS/content.opf", opf},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	grep := func(opts scanOptions) []Match {
+		t.Helper()
+		opts.firstMatchOnly = true
+		matches, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile("Holmes"), opts, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		return matches
+	}
+
+	t.Run("NoContext", func(t *testing.T) {
+		matches := grep(scanOptions{})
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d: %+v", len(matches), matches)
+		}
+		match := matches[0]
+		if match.FileName != "OEBPS/two.xhtml" || match.Line != "Holmes first." || match.ParagraphIndex != 2 {
+			t.Errorf("Expected the first match of OEBPS/two.xhtml in paragraph 2, got %+v", match)
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		matches := grep(scanOptions{contextLines: 1, includeHTML: true})
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d: %+v", len(matches), matches)
+		}
+		match := matches[0]
+		if match.Line != "Intro.\nHolmes first.\nMiddle." || match.ParagraphIndex != 2 {
+			t.Errorf("Expected the first match with its context in paragraph 2, got %+v", match)
+		}
+		if match.HTML != "<p>Intro.</p>\n<p>Holmes first.</p>\n<p>Middle.</p>" {
+			t.Errorf("Expected the HTML of the context window, got %q", match.HTML)
+		}
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		matches := grep(scanOptions{includeGlobs: []string{"*.txt"}})
+		if len(matches) != 1 || matches[0].Line != "Holmes in three." {
+			t.Errorf("Expected only the first line of three.txt, got %+v", matches)
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		if _, err := createTestEPUB(tempDir, "other.epub", "<p>Holmes one.</p><p>Holmes two.</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		request := &SearchRequest{
+			Query:          SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}},
+			FirstMatchOnly: true,
+		}
+		var mutex sync.Mutex
+		counts := make(map[string]int)
+		err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			counts[filepath.Base(result.Path)] = len(result.Matches)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if expected := map[string]int{"book.epub": 1, "other.epub": 1}; !maps.Equal(counts, expected) {
+			t.Errorf("Expected %v, got %v", expected, counts)
+		}
+
+		request.MinMatches = 2
+		if err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(*SearchResult) error { return nil }); err == nil {
+			t.Error("Expected an error with a minimum match count above 1")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package epubproc
+
+import (
+	"archive/zip"
+	"context"
+	"strings"
+	"unicode"
+)
+
+// languageSampleBytes is the amount of text sampled from the content files of a book to detect its language.
+const languageSampleBytes = 16 << 10
+
+// languageMinHits is the number of common words of a language a sample must contain for the language to be reported.
+const languageMinHits = 10
+
+// languageStopwords lists frequent function words of the detectable languages, keyed by ISO 639-1 code. Words shared
+// by several languages count for each of them, so the distinctive words decide between related languages.
+var languageStopwords = map[string][]string{
+	"de": {
+		"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "mit", "sich", "den", "dem", "auf", "ich",
+		"sie", "war", "auch", "von", "wie", "aber", "wir", "hat", "wird",
+	},
+	"en": {
+		"the", "and", "of", "to", "is", "was", "that", "with", "he", "she", "it", "his", "her", "you", "for", "not",
+		"but", "had", "have", "this", "they", "which", "were", "be",
+	},
+	"es": {
+		"el", "la", "los", "las", "y", "es", "que", "de", "en", "un", "una", "por", "con", "no", "se", "del", "lo",
+		"su", "para", "como", "pero", "estaba", "muy", "sus",
+	},
+	"fr": {
+		"le", "la", "les", "et", "est", "des", "une", "un", "du", "que", "qui", "dans", "pour", "pas", "il", "elle",
+		"ne", "sur", "avec", "au", "mais", "était", "je", "nous", "vous",
+	},
+	"it": {
+		"il", "di", "che", "è", "e", "non", "un", "una", "per", "con", "del", "della", "sono", "si", "lo", "gli", "era",
+		"ma", "anche", "nel",
+	},
+	"nl": {
+		"de", "het", "een", "en", "van", "is", "niet", "dat", "die", "op", "te", "met", "zijn", "ik", "je", "hij",
+		"was", "maar", "voor", "ook",
+	},
+	"pt": {
+		"o", "os", "as", "e", "não", "um", "uma", "do", "da", "dos", "em", "com", "para", "que", "se", "ao", "mas",
+		"foi", "ele", "ela", "você",
+	},
+}
+
+// stopwordLanguages maps each word of languageStopwords to the languages it is common in.
+var stopwordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for language, words := range languageStopwords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// detectLanguage guesses the language of a text from the frequent function words it contains, returning the ISO 639-1
+// code of the language or "" when the text is too short or not clearly in one of the detectable languages.
+func detectLanguage(text string) string {
+	hits := make(map[string]int, len(languageStopwords))
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		for _, language := range stopwordLanguages[word] {
+			hits[language]++
+		}
+	}
+
+	best, bestHits, secondHits := "", 0, 0
+	for language, count := range hits {
+		switch {
+		case count > bestHits || (count == bestHits && language < best):
+			best, bestHits, secondHits = language, count, max(bestHits, secondHits)
+		case count > secondHits:
+			secondHits = count
+		}
+	}
+
+	// a language is only reported when it clearly outscores the closest other language
+	if bestHits < languageMinHits || bestHits*2 < secondHits*3 {
+		return ""
+	}
+	return best
+}
+
+// sampleText returns about limit bytes of the text of the content files of an epub, one line per line of a text file
+// or block of an html file, in reading order (archive order without a readable spine), skipping the files that are not
+// part of the text such as the cover or table of contents.
+func sampleText(ctx context.Context, r *zip.Reader, limit int) (string, error) {
+	var sample strings.Builder
+	err := walkContentText(ctx, r, nil, func(line string) bool {
+		sample.WriteString(line)
+		sample.WriteByte('\n')
+		return sample.Len() < limit
+	})
+	if err != nil {
+		return "", err
+	}
+	return sample.String(), nil
+}
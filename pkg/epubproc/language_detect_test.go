@@ -0,0 +1,157 @@
+package epubproc
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// englishSample and frenchSample are clearly English and French chapter paragraphs
+const (
+	englishSample = `It was a cold morning in London, and the fog had not yet lifted from the street. Holmes stood at the
+window with his hands behind his back, and he watched the people who were hurrying to their work. "You have been in
+Afghanistan, I perceive," he said to me, but I could not tell how he knew that. It was the first of many such
+surprises, for he had a way of seeing what the rest of us had missed.`
+	frenchSample = `C'était un matin froid à Paris, et le brouillard ne s'était pas encore levé sur la rue. Holmes se
+tenait à la fenêtre, les mains dans le dos, et il regardait les passants qui se pressaient vers leur travail. « Vous
+êtes allé en Afghanistan, je le vois », me dit-il, mais je ne pouvais pas savoir comment il le savait. C'était la
+première de nombreuses surprises, car il avait une manière de voir ce que nous avions tous manqué.`
+)
+
+// TestDetectLanguage tests guessing the language of a text from its frequent function words
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "English", text: englishSample, expected: "en"},
+		{name: "French", text: frenchSample, expected: "fr"},
+		{name: "TooShort", text: "Holmes and the pipe.", expected: ""},
+		{name: "Mixed", text: englishSample + "\n" + frenchSample, expected: ""},
+		{name: "Empty", text: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage(tt.text); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestLanguageDetection tests that the extractor only detects the language of books without a dc:language when enabled
+func TestLanguageDetection(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "language_detection_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	createEPUB := func(name, language, chapter string) string {
+		opf := fmt.Sprintf(`<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>%s</dc:title>%s</metadata>
+</package>`, name, language)
+
+		path := filepath.Join(tempDir, name+".epub")
+		err := createOrderedTestZIP(path, [][2]string{
+			{"META-INF/container.xml", tocContainerXML},
+			{"OEBPS/content.opf", opf},
+			{"OEBPS/toc.xhtml", "<p>Contents</p>"},
+			{"OEBPS/chapter1.xhtml", "<h1>Chapter 1</h1><p>" + chapter + "</p>"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+		return path
+	}
+
+	english := createEPUB("english", "", englishSample)
+	french := createEPUB("french", "", frenchSample)
+	tagged := createEPUB("tagged", "<dc:language> de </dc:language><dc:language>en</dc:language>", englishSample)
+
+	tests := []struct {
+		name             string
+		path             string
+		opts             []MetadataExtractorOption
+		expectedLanguage string
+		expectedDetected string
+	}{
+		{name: "English", path: english, opts: []MetadataExtractorOption{WithLanguageDetection()}, expectedDetected: "en"},
+		{name: "French", path: french, opts: []MetadataExtractorOption{WithLanguageDetection()}, expectedDetected: "fr"},
+		{name: "Disabled", path: french},
+		{
+			name:             "DeclaredLanguage",
+			path:             tagged,
+			opts:             []MetadataExtractorOption{WithLanguageDetection()},
+			expectedLanguage: "de",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := NewMetadataExtractor(1, tt.opts...).ProcessFile(context.Background(), tt.path)
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			if metadata.Language != tt.expectedLanguage {
+				t.Errorf("Expected language %q, got %q", tt.expectedLanguage, metadata.Language)
+			}
+			if metadata.DetectedLanguage != tt.expectedDetected {
+				t.Errorf("Expected detected language %q, got %q", tt.expectedDetected, metadata.DetectedLanguage)
+			}
+		})
+	}
+}
+
+// TestSampleText tests sampling the text of a book in reading order, without entries escaping the archive root
+func TestSampleText(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sample_text_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Order</dc:title></metadata>
+  <manifest>
+    <item id="one" href="chapter1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="two" href="chapter2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="one"/><itemref idref="two"/></spine>
+</package>`
+
+	// the second chapter and an entry outside the archive root are stored before the first chapter
+	path := filepath.Join(tempDir, "order.epub")
+	err = createOrderedTestZIP(path, [][2]string{
+		{"META-INF/container.xml", tocContainerXML},
+		{"OEBPS/content.opf", opf},
+		{"../escaped.xhtml", "<p>Escaped text.</p>"},
+		{"OEBPS/chapter2.xhtml", "<p>Second chapter.</p>"},
+		{"OEBPS/chapter1.xhtml", "<p>First chapter.</p>"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open test ePUB: %v", err)
+	}
+	defer r.Close()
+
+	sample, err := sampleText(context.Background(), &r.Reader, languageSampleBytes)
+	if err != nil {
+		t.Fatalf("sampleText failed: %v", err)
+	}
+	if expected := "First chapter.\nSecond chapter.\n"; sample != expected {
+		t.Errorf("Expected sample %q, got %q", expected, sample)
+	}
+}
@@ -0,0 +1,82 @@
+package epubproc
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// IdentifierReport lists the distinct identifiers found across a library, and the books likely to be duplicates.
+type IdentifierReport struct {
+	// Identifiers maps each identifier scheme (e.g. "isbn") to its distinct values, sorted.
+	Identifiers map[string][]string `json:"identifiers"`
+
+	// Duplicates lists the groups of books sharing an ISBN, sorted by ISBN.
+	Duplicates []DuplicateBooks `json:"duplicates"`
+}
+
+// DuplicateBooks represents several books sharing the same ISBN, which are likely copies of the same edition.
+type DuplicateBooks struct {
+	// The ISBN, normalized without hyphens or spaces.
+	ISBN string `json:"isbn"`
+
+	// The paths of the books with this ISBN, sorted.
+	Paths []string `json:"paths"`
+}
+
+// ListIdentifiers extracts the metadata of every epub in a directory and reports the distinct identifiers of each
+// scheme, to deduplicate a collection. ISBNs and ASINs are normalized before they are compared, and books sharing an
+// ISBN are reported as likely duplicates. Files whose metadata cannot be extracted are logged and skipped.
+func ListIdentifiers(ctx context.Context, extractor MetadataExtractor, epubDir string) (*IdentifierReport, error) {
+	var mu sync.Mutex
+	values := make(map[string]map[string]bool)
+	pathsByISBN := make(map[string][]string)
+
+	err := extractor.ProcessDirectory(ctx, epubDir, func(epubPath string, metadata *Metadata) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for scheme, value := range metadata.Identifiers {
+			value = normalizeIdentifierValue(scheme, value, true)
+			if value == "" {
+				continue
+			}
+
+			if values[scheme] == nil {
+				values[scheme] = make(map[string]bool)
+			}
+			values[scheme][value] = true
+
+			if scheme == "isbn" {
+				pathsByISBN[value] = append(pathsByISBN[value], epubPath)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IdentifierReport{
+		Identifiers: make(map[string][]string, len(values)),
+		Duplicates:  []DuplicateBooks{},
+	}
+	for scheme, set := range values {
+		report.Identifiers[scheme] = slices.Sorted(maps.Keys(set))
+	}
+
+	for isbn, paths := range pathsByISBN {
+		if len(paths) < 2 {
+			continue
+		}
+		slices.Sort(paths)
+		report.Duplicates = append(report.Duplicates, DuplicateBooks{ISBN: isbn, Paths: paths})
+	}
+	slices.SortFunc(report.Duplicates, func(a, b DuplicateBooks) int {
+		return cmp.Compare(a.ISBN, b.ISBN)
+	})
+
+	return report, nil
+}
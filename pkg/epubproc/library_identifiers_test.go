@@ -0,0 +1,49 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestListIdentifiers tests listing distinct identifiers and flagging books that share an ISBN
+func TestListIdentifiers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "list_identifiers_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]TestEPUBMetadata{
+		"copy1.epub":  {Title: "A Study in Scarlet", Identifiers: map[string]string{"ISBN": "978-0-14-043908-6"}},
+		"copy2.epub":  {Title: "A Study in Scarlet", Identifiers: map[string]string{"ISBN": "9780140439086", "ASIN": "b000fc1pj8"}},
+		"unique.epub": {Title: "The Sign of Four", Identifiers: map[string]string{"ISBN": "9780140439076", "ASIN": "B000FC1PJ8"}},
+	}
+	for name, metadata := range books {
+		if _, err := createTestEPUBWithMetadata(tempDir, name, metadata); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	report, err := ListIdentifiers(context.Background(), NewMetadataExtractor(2), tempDir)
+	if err != nil {
+		t.Fatalf("ListIdentifiers failed: %v", err)
+	}
+
+	if expected := []string{"9780140439076", "9780140439086"}; !slices.Equal(report.Identifiers["isbn"], expected) {
+		t.Errorf("Expected ISBNs %v, got %v", expected, report.Identifiers["isbn"])
+	}
+	if expected := []string{"B000FC1PJ8"}; !slices.Equal(report.Identifiers["asin"], expected) {
+		t.Errorf("Expected ASINs %v, got %v", expected, report.Identifiers["asin"])
+	}
+
+	if len(report.Duplicates) != 1 {
+		t.Fatalf("Expected 1 group of duplicates, got %+v", report.Duplicates)
+	}
+	expectedPaths := []string{filepath.Join(tempDir, "copy1.epub"), filepath.Join(tempDir, "copy2.epub")}
+	if report.Duplicates[0].ISBN != "9780140439086" || !slices.Equal(report.Duplicates[0].Paths, expectedPaths) {
+		t.Errorf("Expected ISBN 9780140439086 shared by %v, got %+v", expectedPaths, report.Duplicates[0])
+	}
+}
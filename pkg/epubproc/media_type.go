@@ -0,0 +1,74 @@
+package epubproc
+
+import (
+	"archive/zip"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// extensionMediaTypes are the media types of common epub content files, used when the manifest does not list a file.
+// They are checked before the system mime table, which often lacks .xhtml and varies between platforms.
+var extensionMediaTypes = map[string]string{
+	".xhtml": "application/xhtml+xml",
+	".html":  "text/html",
+	".htm":   "text/html",
+	".xml":   "application/xml",
+	".txt":   "text/plain",
+	".svg":   "image/svg+xml",
+	".css":   "text/css",
+	".ncx":   "application/x-dtbncx+xml",
+	".opf":   "application/oebps-package+xml",
+}
+
+// manifestMediaTypes maps the archive paths of the files listed in the OPF manifest to their media types, or returns
+// nil when the epub has no readable package.
+func manifestMediaTypes(r *zip.Reader) map[string]string {
+	opfPath, opfData, err := readPackage(r)
+	if err != nil {
+		log.Debug().Err(err).Msg("no readable manifest, guessing media types from extensions")
+		return nil
+	}
+
+	opfDir := path.Dir(opfPath)
+	mediaTypes := make(map[string]string, len(opfData.Manifest))
+	for _, item := range opfData.Manifest {
+		if item.MediaType == "" {
+			continue
+		}
+		target, _, _ := strings.Cut(resolveHref(opfDir, item.Href), "#")
+		mediaTypes[target] = item.MediaType
+	}
+	return mediaTypes
+}
+
+// guessMediaType returns the media type of a file from its extension, without parameters such as the charset, or ""
+// when the extension is unknown.
+func guessMediaType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if mediaType, ok := extensionMediaTypes[ext]; ok {
+		return mediaType
+	}
+
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+	return strings.TrimSpace(mediaType)
+}
+
+// setMediaTypes sets the media type of the file of each match from the manifest, guessing it from the extension for
+// files the manifest does not list.
+func setMediaTypes(r *zip.Reader, matches []Match) {
+	if len(matches) == 0 {
+		return
+	}
+
+	mediaTypes := manifestMediaTypes(r)
+	for i := range matches {
+		if mediaType, ok := mediaTypes[matches[i].FileName]; ok {
+			matches[i].MediaType = mediaType
+		} else {
+			matches[i].MediaType = guessMediaType(matches[i].FileName)
+		}
+	}
+}
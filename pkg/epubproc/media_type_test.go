@@ -0,0 +1,88 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestGrepInEpubMediaType tests setting the media type of matched files from the manifest or their extension
+func TestGrepInEpubMediaType(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "grep_epub_media_type_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// the manifest declares the .html chapter as XHTML, while extra.html is not listed at all
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <manifest>
+    <item id="c1" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="c2" href="text/two.html" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="c1"/><itemref idref="c2"/></spine>
+</package>`
+
+	epubPath := filepath.Join(tempDir, "book.epub")
+	err = createOrderedTestZIP(epubPath, [][2]string{
+		{"META-INF/container.xml", tocContainerXML},
+		{"OEBPS/content.opf", opf},
+		{"OEBPS/text/one.xhtml", "<p>Holmes one.</p>"},
+		{"OEBPS/text/two.html", "<p>Holmes two.</p>"},
+		{"OEBPS/extra.html", "<p>Holmes outside the manifest.</p>"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	mediaTypes := func(opts scanOptions) map[string]string {
+		matches, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile("Holmes"), opts, nil)
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		result := make(map[string]string, len(matches))
+		for _, match := range matches {
+			result[match.FileName] = match.MediaType
+		}
+		return result
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		expected := map[string]string{
+			"OEBPS/text/one.xhtml": "application/xhtml+xml",
+			"OEBPS/text/two.html":  "application/xhtml+xml",
+			"OEBPS/extra.html":     "text/html",
+		}
+		got := mediaTypes(scanOptions{mediaType: true})
+		for name, mediaType := range expected {
+			if got[name] != mediaType {
+				t.Errorf("Expected media type %q for %s, got %q", mediaType, name, got[name])
+			}
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		for name, mediaType := range mediaTypes(scanOptions{}) {
+			if mediaType != "" {
+				t.Errorf("Expected no media type for %s, got %q", name, mediaType)
+			}
+		}
+	})
+
+	t.Run("Streamed", func(t *testing.T) {
+		var streamed []Match
+		_, _, err := grepInEpub(context.Background(), epubPath, regexp.MustCompile("one"), scanOptions{mediaType: true}, func(match Match) error {
+			streamed = append(streamed, match)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("grepInEpub failed: %v", err)
+		}
+		if len(streamed) != 1 || streamed[0].MediaType != "application/xhtml+xml" {
+			t.Errorf("Expected 1 streamed XHTML match, got %+v", streamed)
+		}
+	})
+}
@@ -7,14 +7,16 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"os"
+	"net/url"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/sourcegraph/conc/pool"
 	"golang.org/x/text/encoding/ianaindex"
@@ -28,6 +30,10 @@ type MetadataExtractor interface {
 	// ProcessDirectory recursively processes epub files in a directory and passes metadata to a handler function.
 	ProcessDirectory(ctx context.Context, epubDir string, handler MetadataHandler) error
 
+	// ProcessFiles processes an explicit list of epub files concurrently and passes metadata to a handler function.
+	// Files that cannot be processed, such as missing paths, are logged and skipped.
+	ProcessFiles(ctx context.Context, epubPaths []string, handler MetadataHandler) error
+
 	// ProcessFile extracts complete metadata from a single epub file.
 	ProcessFile(ctx context.Context, epubPath string) (*Metadata, error)
 }
@@ -35,10 +41,206 @@ type MetadataExtractor interface {
 type metadataExtractorImpl struct {
 	// maxThreads is the maximum number of worker goroutines to use
 	maxThreads int
+
+	// options holds optional extraction settings
+	options metadataOptions
+}
+
+// metadataOptions holds optional settings used while extracting metadata.
+type metadataOptions struct {
+	// schemeAliases maps lowercase custom identifier schemes to the keys they should be stored under
+	schemeAliases map[string]string
+
+	// provenance controls whether the source of each metadata field is recorded
+	provenance bool
+
+	// normalizeIdentifiers controls whether known identifier values are normalized (e.g. hyphens stripped from ISBNs)
+	normalizeIdentifiers bool
+
+	// identifierSchemes lists the normalized identifier schemes to keep, or nil to keep every scheme
+	identifierSchemes map[string]bool
+
+	// fields limits which metadata fields are extracted, or 0 for all fields
+	fields MetadataFields
+
+	// openRetries is the number of times opening an epub is retried after a transient error
+	openRetries int
+
+	// failFast makes ProcessDirectory and ProcessFiles return the first file error instead of skipping the file
+	failFast bool
+
+	// detectLanguage controls whether the language of books without a dc:language is guessed from their text
+	detectLanguage bool
+
+	// preview controls whether the first words of the text of books are extracted into Metadata.Preview
+	preview bool
+
+	// identifierStrictness controls how identifiers without a scheme are classified from their value
+	identifierStrictness IdentifierStrictness
+}
+
+// IdentifierStrictness defines how identifiers without a scheme are classified from their value.
+type IdentifierStrictness string
+
+const (
+	// IdentifierLenient classifies values by their length and prefix, which may misclassify some values, e.g. any
+	// 10-digit number as an ISBN.
+	IdentifierLenient IdentifierStrictness = "lenient"
+
+	// IdentifierStrict only classifies values with a valid check digit (ISBN) or in a strict format (ASIN, DOI, URI and
+	// URN), leaving other values without a scheme.
+	IdentifierStrict IdentifierStrictness = "strict"
+)
+
+// validateIdentifierStrictness checks that an identifier strictness is one of the supported strictnesses.
+func validateIdentifierStrictness(strictness IdentifierStrictness) error {
+	switch strictness {
+	case "", IdentifierLenient, IdentifierStrict:
+		return nil
+	default:
+		return fmt.Errorf("invalid identifier strictness '%s': must be %s or %s", strictness, IdentifierLenient, IdentifierStrict)
+	}
+}
+
+// MetadataFields is a bitmask of metadata fields to extract.
+type MetadataFields uint
+
+const (
+	// MetadataTitle extracts Title.
+	MetadataTitle MetadataFields = 1 << iota
+
+	// MetadataAuthors extracts Authors.
+	MetadataAuthors
+
+	// MetadataGenres extracts Genres.
+	MetadataGenres
+
+	// MetadataDescription extracts Description.
+	MetadataDescription
+
+	// MetadataYear extracts YearReleased.
+	MetadataYear
+
+	// MetadataSeries extracts Series and SeriesPosition.
+	MetadataSeries
+
+	// MetadataIdentifiers extracts Identifiers.
+	MetadataIdentifiers
+
+	// MetadataAll extracts every field.
+	MetadataAll = MetadataTitle | MetadataAuthors | MetadataGenres | MetadataDescription | MetadataYear | MetadataSeries | MetadataIdentifiers
+)
+
+// has reports whether any of the given fields are included, treating 0 as every field.
+func (f MetadataFields) has(fields MetadataFields) bool {
+	return f == 0 || f&fields != 0
+}
+
+// MetadataExtractorOption configures optional behavior of a MetadataExtractor.
+type MetadataExtractorOption func(options *metadataOptions)
+
+// WithIdentifierSchemeAliases maps custom identifier schemes to canonical keys, e.g. "kobo" to "amazon".
+// Aliases are matched case-insensitively and are consulted before the built-in scheme handling.
+func WithIdentifierSchemeAliases(aliases map[string]string) MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		if options.schemeAliases == nil {
+			options.schemeAliases = make(map[string]string, len(aliases))
+		}
+
+		for scheme, key := range aliases {
+			options.schemeAliases[strings.ToLower(strings.TrimSpace(scheme))] = strings.ToLower(strings.TrimSpace(key))
+		}
+	}
+}
+
+// WithProvenance records which part of the OPF filled each metadata field in Metadata.Provenance.
+// This is a diagnostics aid for messy libraries and is disabled by default.
+func WithProvenance() MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		options.provenance = true
+	}
+}
+
+// WithNormalizedIdentifiers normalizes known identifier values so equality comparisons are reliable.
+// ISBNs have hyphens and spaces removed and are uppercased (for a trailing "X"), while ASINs are uppercased.
+func WithNormalizedIdentifiers() MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		options.normalizeIdentifiers = true
+	}
+}
+
+// WithIdentifierSchemes keeps only identifiers of the given normalized schemes (e.g. "isbn", "asin") in
+// Metadata.Identifiers, dropping custom identifiers a catalog does not need. Schemes are matched after aliases and the
+// built-in scheme handling, so "ISBN-13" keeps ISBNs, and the default keeps every scheme.
+func WithIdentifierSchemes(schemes ...string) MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		if options.identifierSchemes == nil {
+			options.identifierSchemes = make(map[string]bool, len(schemes))
+		}
+
+		for _, scheme := range schemes {
+			options.identifierSchemes[normalizeIdentifierKey(scheme, nil)] = true
+		}
+	}
+}
+
+// keepsIdentifier reports whether identifiers stored under a normalized key are extracted.
+func (o metadataOptions) keepsIdentifier(key string) bool {
+	return key != "" && (o.identifierSchemes == nil || o.identifierSchemes[key])
+}
+
+// WithIdentifierStrictness sets how identifiers without a scheme are classified from their value. Catalogs that care
+// about false positives can use IdentifierStrict, and the default is IdentifierLenient. The strictness is matched
+// case-insensitively, and extraction fails with any other value.
+func WithIdentifierStrictness(strictness IdentifierStrictness) MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		options.identifierStrictness = IdentifierStrictness(strings.ToLower(strings.TrimSpace(string(strictness))))
+	}
+}
+
+// WithMetadataFields limits extraction to the given fields, e.g. MetadataAuthors for a search that only filters by author.
+// Fields that are not requested are left empty, and the default is MetadataAll.
+func WithMetadataFields(fields MetadataFields) MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		options.fields = fields
+	}
+}
+
+// WithOpenRetries retries opening an epub up to retries times, with exponential backoff, after an error that may be
+// transient, such as on a flaky network mount. Missing files, permission errors and invalid archives are never retried.
+func WithOpenRetries(retries int) MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		options.openRetries = retries
+	}
+}
+
+// WithFailFast makes ProcessDirectory and ProcessFiles stop at the first epub that cannot be processed and return its
+// error, cancelling the remaining work, instead of logging the error and moving on to the next epub.
+func WithFailFast() MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		options.failFast = true
+	}
+}
+
+// WithLanguageDetection guesses the language of books without a dc:language from a sample of their text, reporting it
+// in Metadata.DetectedLanguage. This reads content files in addition to the OPF and is disabled by default.
+func WithLanguageDetection() MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		options.detectLanguage = true
+	}
+}
+
+// WithPreview extracts the first 500 words of the text of books in reading order, usually their title page and the
+// start of the first chapter, into Metadata.Preview for catalog previews. The text is read from the same archive as the
+// OPF, so it costs one pass over the start of each book; it is disabled by default.
+func WithPreview() MetadataExtractorOption {
+	return func(options *metadataOptions) {
+		options.preview = true
+	}
 }
 
 // NewMetadataExtractor creates a new MetadataExtractor instance with the specified concurrency level.
-func NewMetadataExtractor(maxThreads int) MetadataExtractor {
+func NewMetadataExtractor(maxThreads int, opts ...MetadataExtractorOption) MetadataExtractor {
 	if maxThreads <= 0 {
 		// default to number of CPU cores if not specified
 		maxThreads = runtime.NumCPU()
@@ -46,11 +248,66 @@ func NewMetadataExtractor(maxThreads int) MetadataExtractor {
 
 	return &metadataExtractorImpl{
 		maxThreads: maxThreads,
+		options:    newMetadataOptions(opts),
 	}
 }
 
+// newMetadataOptions applies extractor options on top of the defaults.
+func newMetadataOptions(opts []MetadataExtractorOption) metadataOptions {
+	var options metadataOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
 // ProcessDirectory recursively processes epub files in a directory and extracts their metadata.
 func (m *metadataExtractorImpl) ProcessDirectory(ctx context.Context, epubDir string, handler MetadataHandler) error {
+	logger := log.With().Str("directory", epubDir).Logger()
+	return m.processPaths(ctx, logger, func(send func(path string) error) error {
+		return filepath.WalkDir(epubDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return fmt.Errorf("error walking directory '%s': %w", epubDir, err)
+			}
+
+			if !d.IsDir() && strings.HasSuffix(strings.ToLower(d.Name()), ".epub") {
+				return send(path)
+			}
+
+			return nil
+		})
+	}, handler)
+}
+
+// ProcessFiles extracts the metadata of each epub in a list of paths concurrently, skipping blank entries.
+func (m *metadataExtractorImpl) ProcessFiles(ctx context.Context, epubPaths []string, handler MetadataHandler) error {
+	logger := log.With().Int("files", len(epubPaths)).Logger()
+	return m.processPaths(ctx, logger, func(send func(path string) error) error {
+		for _, path := range epubPaths {
+			if path = strings.TrimSpace(path); path == "" {
+				continue
+			}
+			if err := send(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, handler)
+}
+
+// processPaths extracts the metadata of every path passed to send by produce, using up to maxThreads workers.
+// Files that cannot be processed are logged and skipped unless failFast is set, while handler errors cancel the
+// remaining work.
+func (m *metadataExtractorImpl) processPaths(
+	ctx context.Context,
+	logger zerolog.Logger,
+	produce func(send func(path string) error) error,
+	handler MetadataHandler,
+) error {
+	if err := validateIdentifierStrictness(m.options.identifierStrictness); err != nil {
+		return err
+	}
+
 	p := pool.New().WithContext(ctx).WithCancelOnError()
 	paths := make(chan string)
 
@@ -58,24 +315,18 @@ func (m *metadataExtractorImpl) ProcessDirectory(ctx context.Context, epubDir st
 	var totalFiles, processedFiles, errorFiles int64
 	var fileCountMutex sync.RWMutex
 
-	// producer goroutine to find all .epub files
+	// producer goroutine to find all epub files
 	p.Go(func(ctx context.Context) error {
 		defer close(paths)
-		return filepath.WalkDir(epubDir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return fmt.Errorf("error walking directory '%s': %w", epubDir, err)
-			}
-
-			if !d.IsDir() && strings.HasSuffix(strings.ToLower(d.Name()), ".epub") {
-				fileCountMutex.Lock()
-				totalFiles++
-				fileCountMutex.Unlock()
-
-				select {
-				case paths <- path:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
+		return produce(func(path string) error {
+			fileCountMutex.Lock()
+			totalFiles++
+			fileCountMutex.Unlock()
+
+			select {
+			case paths <- path:
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 
 			return nil
@@ -94,6 +345,10 @@ func (m *metadataExtractorImpl) ProcessDirectory(ctx context.Context, epubDir st
 
 				metadata, err := m.ProcessFile(ctx, path)
 				if err != nil {
+					if m.options.failFast {
+						return fmt.Errorf("failed to process '%s': %w", path, err)
+					}
+
 					// a single corrupt file shouldn't stop the whole process.
 					fileCountMutex.Lock()
 					errorFiles++
@@ -102,7 +357,7 @@ func (m *metadataExtractorImpl) ProcessDirectory(ctx context.Context, epubDir st
 					currentErrorFiles := errorFiles
 					fileCountMutex.Unlock()
 
-					log.Err(err).
+					logger.Error().Err(err).
 						Str("path", path).
 						Int64("processed", currentProcessedFiles).
 						Int64("errors", currentErrorFiles).
@@ -135,17 +390,15 @@ func (m *metadataExtractorImpl) ProcessDirectory(ctx context.Context, epubDir st
 	fileCountMutex.RUnlock()
 
 	if finalErrorFiles > 0 {
-		log.Info().
-			Str("directory", epubDir).
+		logger.Info().
 			Int64("total_found", finalTotalFiles).
 			Int64("processed", finalProcessedFiles).
 			Int64("errors", finalErrorFiles).
-			Msg("completed directory processing with some errors")
+			Msg("completed processing with some errors")
 	} else {
-		log.Info().
-			Str("directory", epubDir).
+		logger.Info().
 			Int64("total_processed", finalProcessedFiles).
-			Msg("completed directory processing successfully")
+			Msg("completed processing successfully")
 	}
 
 	return err
@@ -153,18 +406,16 @@ func (m *metadataExtractorImpl) ProcessDirectory(ctx context.Context, epubDir st
 
 // ProcessFile extracts complete metadata from a single epub file.
 func (m *metadataExtractorImpl) ProcessFile(ctx context.Context, epubPath string) (*Metadata, error) {
-	// get file info for better error context
-	fileInfo, fileErr := os.Stat(epubPath)
+	if err := validateIdentifierStrictness(m.options.identifierStrictness); err != nil {
+		return nil, err
+	}
 
-	r, err := zip.OpenReader(epubPath)
+	r, err := openEpubWithRetry(ctx, epubPath, m.options.openRetries)
 	if err != nil {
-		if fileErr == nil {
-			return nil, fmt.Errorf("failed to open epub '%s' (size: %d bytes): %w", epubPath, fileInfo.Size(), err)
-		}
-		return nil, fmt.Errorf("failed to open epub '%s': %w", epubPath, err)
+		return nil, err
 	}
 	defer func() {
-		if err := r.Close(); err != nil {
+		if err := closeZipReader(r); err != nil {
 			log.Warn().Err(err).Str("epub", epubPath).Msg("failed to close epub reader")
 		}
 	}()
@@ -174,6 +425,10 @@ func (m *metadataExtractorImpl) ProcessFile(ctx context.Context, epubPath string
 		return nil, fmt.Errorf("failed to find opf path in %s: %w", epubPath, err)
 	}
 
+	if !isSafeArchivePath(opfPath) {
+		return nil, fmt.Errorf("opf path '%s' escapes the archive root in epub '%s'", opfPath, epubPath)
+	}
+
 	var opfFile *zip.File
 	for _, f := range r.File {
 		// OPF path may be relative to the root of the zip archive
@@ -198,87 +453,367 @@ func (m *metadataExtractorImpl) ProcessFile(ctx context.Context, epubPath string
 		}
 	}()
 
-	var opfData opfPackageFile
-	decoder := xml.NewDecoder(rc)
+	metadata, err := parseOPF(rc, m.options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse opf file '%s' in epub '%s': %w", opfPath, epubPath, err)
+	}
 
-	// some epubs have invalid charsets declared, but are utf-8
-	// this is a common issue so configure the decoder to be lenient
-	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
-		enc, err := ianaindex.IANA.Encoding(charset)
-		if err != nil || enc == nil {
-			// fall back to raw bytes
-			return input, nil
+	// detection is a best effort, so a book whose text cannot be read keeps its other metadata
+	if m.options.detectLanguage && metadata.Language == "" {
+		sample, err := sampleText(ctx, &r.Reader, languageSampleBytes)
+		if err != nil {
+			log.Warn().Err(err).Str("epub", epubPath).Msg("failed to sample text for language detection")
+		} else if metadata.DetectedLanguage = detectLanguage(sample); metadata.DetectedLanguage != "" && metadata.Provenance != nil {
+			metadata.Provenance["detectedLanguage"] = "text"
 		}
-		return enc.NewDecoder().Reader(input), nil
 	}
 
-	if err := decoder.Decode(&opfData); err != nil {
-		return nil, fmt.Errorf("failed to parse opf file '%s' in epub '%s': %w", opfPath, epubPath, err)
+	// like detection, a preview is a best effort on top of the metadata
+	if m.options.preview {
+		if metadata.Preview, err = previewText(ctx, &r.Reader, previewWords); err != nil {
+			log.Warn().Err(err).Str("epub", epubPath).Msg("failed to extract preview text")
+		}
+	}
+
+	return metadata, nil
+}
+
+// ParseOPF extracts metadata from the contents of an OPF package file, for callers that already have the OPF bytes.
+func ParseOPF(r io.Reader, opts ...MetadataExtractorOption) (*Metadata, error) {
+	options := newMetadataOptions(opts)
+	if err := validateIdentifierStrictness(options.identifierStrictness); err != nil {
+		return nil, err
+	}
+
+	metadata, err := parseOPF(r, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse opf: %w", err)
+	}
+	return metadata, nil
+}
+
+// parseOPF decodes an OPF package file and builds metadata from it.
+func parseOPF(r io.Reader, options metadataOptions) (*Metadata, error) {
+	section, err := decodeOPFMetadata(newLenientXMLDecoder(r), options.fields)
+	if err != nil {
+		return nil, err
 	}
 
+	fields := options.fields
 	metadata := &Metadata{
-		Title:       opfData.Metadata.Title,
-		Authors:     opfData.Metadata.Creator,
-		Genres:      opfData.Metadata.Subject,
+		Authors:     section.Creator,
+		Genres:      section.Subject,
+		Description: strings.TrimSpace(section.Description),
+		Language:    strings.TrimSpace(section.Language),
 		Identifiers: make(map[string]string),
 	}
 
-	if opfData.Metadata.Date != "" {
+	// setSource records which part of the OPF filled a field, when provenance is enabled
+	setSource := func(field, source string) {}
+	if options.provenance {
+		metadata.Provenance = make(map[string]string)
+		setSource = func(field, source string) {
+			metadata.Provenance[field] = source
+		}
+	}
+
+	// the title is also decoded for the series it may embed, but only reported when requested
+	if fields.has(MetadataTitle) && section.Title != "" {
+		metadata.Title = section.Title
+		setSource("title", "dc:title")
+	}
+	if len(metadata.Authors) > 0 {
+		setSource("authors", "dc:creator")
+	}
+	if len(metadata.Genres) > 0 {
+		setSource("genres", "dc:subject")
+	}
+	if metadata.Description != "" {
+		setSource("description", "dc:description")
+	}
+	if metadata.Language != "" {
+		setSource("language", "dc:language")
+	}
+
+	if section.Date != "" {
 		// date can be several formats: "2004", "2004-10-02", "2004-10-02T11:00:00Z", and we only want the year
-		if t, err := time.Parse(time.RFC3339, opfData.Metadata.Date); err == nil {
+		if t, err := time.Parse(time.RFC3339, section.Date); err == nil {
 			metadata.YearReleased = t.Year()
-		} else if len(opfData.Metadata.Date) >= 4 {
-			if year, err := strconv.Atoi(opfData.Metadata.Date[:4]); err == nil {
+			setSource("yearReleased", "dc:date")
+		} else if len(section.Date) >= 4 {
+			if year, err := strconv.Atoi(section.Date[:4]); err == nil {
 				metadata.YearReleased = year
+				setSource("yearReleased", "dc:date")
 			}
 		}
 	}
 
 	// extract identifiers from <identifier> elements
-	for _, identifier := range opfData.Metadata.Identifier {
+	for _, identifier := range section.Identifier {
 		if identifier.Value != "" {
-			key := normalizeIdentifierKey(identifier.Scheme)
+			key := normalizeIdentifierKey(identifier.Scheme, options.schemeAliases)
 			if key == "" {
 				// no scheme, try to detect identifier type from the value
-				key = detectIdentifierType(identifier.Value)
+				key = detectIdentifierType(identifier.Value, options.identifierStrictness)
 			}
 
-			if key != "" {
-				metadata.Identifiers[key] = strings.TrimSpace(identifier.Value)
+			if options.keepsIdentifier(key) {
+				metadata.Identifiers[key] = normalizeIdentifierValue(key, identifier.Value, options.normalizeIdentifiers)
+				setSource("identifiers."+key, "dc:identifier")
 			}
 		}
 	}
 
-	for _, meta := range opfData.Metadata.Meta {
-		switch meta.Name {
-		case "calibre:series":
+	for _, meta := range section.Meta {
+		switch {
+		case !fields.has(MetadataSeries):
+		case meta.Name == "calibre:series":
 			metadata.Series = meta.Content
-		case "calibre:series_index":
+			setSource("series", "calibre:series")
+		case meta.Name == "calibre:series_index":
 			if pos, err := strconv.ParseFloat(meta.Content, 64); err == nil {
 				metadata.SeriesPosition = pos
+				setSource("seriesPosition", "calibre:series_index")
 			}
 		}
 
+		if !fields.has(MetadataIdentifiers) {
+			continue
+		}
+
 		// extract identifiers from meta tags
 		if meta.Name != "" && meta.Content != "" {
-			key := extractIdentifierFromMetaName(meta.Name)
-			if key != "" {
-				metadata.Identifiers[key] = strings.TrimSpace(meta.Content)
+			key := extractIdentifierFromMetaName(meta.Name, options.schemeAliases)
+			if options.keepsIdentifier(key) {
+				metadata.Identifiers[key] = normalizeIdentifierValue(key, meta.Content, options.normalizeIdentifiers)
+				setSource("identifiers."+key, meta.Name)
 			}
 		}
 
 		// handle EPUB3 property-based identifiers - only extract known identifier properties
 		if meta.Property != "" && meta.Value != "" {
 			key := extractIdentifierFromProperty(meta.Property)
-			if key != "" {
-				metadata.Identifiers[key] = strings.TrimSpace(meta.Value)
+			if options.keepsIdentifier(key) {
+				metadata.Identifiers[key] = normalizeIdentifierValue(key, meta.Value, options.normalizeIdentifiers)
+				setSource("identifiers."+key, meta.Property)
 			}
 		}
 	}
 
+	// fall back to EPUB3 collection refinements when calibre series metadata is absent
+	if metadata.Series == "" && fields.has(MetadataSeries) {
+		if series, position, ok := findEpub3Series(section.Meta); ok {
+			metadata.Series = series
+			setSource("series", "belongs-to-collection")
+
+			if position != nil {
+				metadata.SeriesPosition = *position
+				setSource("seriesPosition", "group-position")
+			}
+		}
+	}
+
+	// then to a plain "series" meta, and as a last resort to a series embedded in the title, e.g. "Series #3: Title"
+	if metadata.Series == "" && fields.has(MetadataSeries) {
+		for _, meta := range section.Meta {
+			if meta.Name == "series" && strings.TrimSpace(meta.Content) != "" {
+				metadata.Series = strings.TrimSpace(meta.Content)
+				setSource("series", "series")
+				break
+			}
+		}
+
+		if series, position, ok := seriesFromTitle(section.Title); ok && (metadata.Series == "" || metadata.Series == series) {
+			metadata.Series = series
+			setSource("series", "dc:title")
+			metadata.SeriesPosition = position
+			setSource("seriesPosition", "dc:title")
+		}
+	}
+
 	return metadata, nil
 }
 
+// decodeOPFMetadata decodes the <metadata> section of an OPF package file, skipping elements for fields that are not requested.
+// Decoding stops at the end of the metadata section, so the manifest and spine are never read.
+func decodeOPFMetadata(decoder *xml.Decoder, fields MetadataFields) (*opfMetadata, error) {
+	var section opfMetadata
+	inMetadata := false
+	seenElement := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			if !seenElement {
+				// match xml.Decoder.Decode, which fails on a document without elements
+				return nil, io.EOF
+			}
+			return &section, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			seenElement = true
+			if !inMetadata {
+				inMetadata = t.Name.Local == "metadata"
+				continue
+			}
+
+			var target any
+			switch t.Name.Local {
+			case "title":
+				if fields.has(MetadataTitle | MetadataSeries) {
+					target = &section.Title
+				}
+			case "creator":
+				if fields.has(MetadataAuthors) {
+					var creator string
+					if err := decoder.DecodeElement(&creator, &t); err != nil {
+						return nil, err
+					}
+					section.Creator = append(section.Creator, creator)
+					continue
+				}
+			case "subject":
+				if fields.has(MetadataGenres) {
+					var subject string
+					if err := decoder.DecodeElement(&subject, &t); err != nil {
+						return nil, err
+					}
+					section.Subject = append(section.Subject, subject)
+					continue
+				}
+			case "description":
+				if fields.has(MetadataDescription) {
+					target = &section.Description
+				}
+			case "date":
+				if fields.has(MetadataYear) {
+					target = &section.Date
+				}
+			case "language":
+				// only the first (primary) language is kept
+				if section.Language == "" {
+					target = &section.Language
+				}
+			case "identifier":
+				if fields.has(MetadataIdentifiers) {
+					var identifier opfIdentifier
+					if err := decoder.DecodeElement(&identifier, &t); err != nil {
+						return nil, err
+					}
+					section.Identifier = append(section.Identifier, identifier)
+					continue
+				}
+			case "meta":
+				if fields.has(MetadataSeries | MetadataIdentifiers) {
+					var meta opfMeta
+					if err := decoder.DecodeElement(&meta, &t); err != nil {
+						return nil, err
+					}
+					section.Meta = append(section.Meta, meta)
+					continue
+				}
+			}
+
+			if target != nil {
+				if err := decoder.DecodeElement(target, &t); err != nil {
+					return nil, err
+				}
+			} else if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
+
+		case xml.EndElement:
+			if inMetadata && t.Name.Local == "metadata" {
+				return &section, nil
+			}
+		}
+	}
+}
+
+// newLenientXMLDecoder creates an XML decoder that falls back to the raw bytes for unknown charsets.
+func newLenientXMLDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+
+	// some epubs have invalid charsets declared, but are utf-8
+	// this is a common issue so configure the decoder to be lenient
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		enc, err := ianaindex.IANA.Encoding(charset)
+		if err != nil || enc == nil {
+			// fall back to raw bytes
+			return input, nil
+		}
+		return enc.NewDecoder().Reader(input), nil
+	}
+
+	return decoder
+}
+
+// findEpub3Series finds the first EPUB3 "belongs-to-collection" meta that describes a series, and its position.
+func findEpub3Series(metas []opfMeta) (string, *float64, bool) {
+	for _, collection := range metas {
+		if collection.Property != "belongs-to-collection" || strings.TrimSpace(collection.Value) == "" {
+			continue
+		}
+
+		isSeries := true
+		var position *float64
+
+		// refinements point back to the collection using "#id"
+		if collection.ID != "" {
+			for _, refine := range metas {
+				if refine.Refines != "#"+collection.ID {
+					continue
+				}
+
+				switch refine.Property {
+				case "collection-type":
+					// collections without a type are treated as series, "set" and others are not
+					isSeries = strings.TrimSpace(refine.Value) == "series"
+				case "group-position":
+					if pos, err := strconv.ParseFloat(strings.TrimSpace(refine.Value), 64); err == nil {
+						position = &pos
+					}
+				}
+			}
+		}
+
+		if isSeries {
+			return strings.TrimSpace(collection.Value), position, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// titleSeriesPatterns match a series and position embedded in a title, either leading as in "Series Name #3: Title" or
+// "Series Name #3 - Title", or trailing as in "Title (Series Name #3)" or "Title (Series Name, #3)"
+var titleSeriesPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^\s*(.+?),?\s+#(\d+(?:\.\d+)?)\s*(?::|\s[-–—])\s*\S`),
+	regexp.MustCompile(`[(\[]\s*([^()\[\]]+?),?\s+#(\d+(?:\.\d+)?)\s*[)\]]\s*$`),
+}
+
+// seriesFromTitle extracts a series name and position embedded in a title, for books without series metadata.
+func seriesFromTitle(title string) (string, float64, bool) {
+	for _, pattern := range titleSeriesPatterns {
+		groups := pattern.FindStringSubmatch(title)
+		if groups == nil {
+			continue
+		}
+
+		position, err := strconv.ParseFloat(groups[2], 64)
+		if series := strings.TrimSpace(groups[1]); err == nil && series != "" {
+			return series, position, true
+		}
+	}
+
+	return "", 0, false
+}
+
 // findOpfPath locates the OPF (Open Packaging Format) file within an epub archive.
 func findOpfPath(r *zip.Reader) (string, error) {
 	var containerFile *zip.File
@@ -292,7 +827,7 @@ func findOpfPath(r *zip.Reader) (string, error) {
 	if containerFile == nil {
 		// fallback for non-standard epubs: find the first .opf file.
 		for _, f := range r.File {
-			if strings.HasSuffix(strings.ToLower(f.Name), ".opf") {
+			if strings.HasSuffix(strings.ToLower(f.Name), ".opf") && isSafeArchivePath(f.Name) {
 				return f.Name, nil
 			}
 		}
@@ -324,9 +859,14 @@ func findOpfPath(r *zip.Reader) (string, error) {
 }
 
 // normalizeIdentifierKey converts various identifier scheme names to standardized keys.
-func normalizeIdentifierKey(scheme string) string {
+func normalizeIdentifierKey(scheme string, aliases map[string]string) string {
 	scheme = strings.ToLower(strings.TrimSpace(scheme))
 
+	// custom aliases take priority over the built-in schemes
+	if key, ok := aliases[scheme]; ok {
+		return key
+	}
+
 	switch scheme {
 	case "isbn", "isbn-10", "isbn-13":
 		return "isbn"
@@ -353,10 +893,34 @@ func normalizeIdentifierKey(scheme string) string {
 	}
 }
 
+// normalizeIdentifierValue trims an identifier value and, if enabled, normalizes the format of known identifier types.
+func normalizeIdentifierValue(key, value string, normalize bool) string {
+	value = strings.TrimSpace(value)
+	if !normalize {
+		return value
+	}
+
+	switch key {
+	case "isbn":
+		value = strings.ReplaceAll(value, "-", "")
+		value = strings.ReplaceAll(value, " ", "")
+		return strings.ToUpper(value)
+	case "asin", "amazon":
+		return strings.ToUpper(value)
+	default:
+		return value
+	}
+}
+
 // extractIdentifierFromMetaName extracts identifier keys from EPUB2-style meta name attributes.
-func extractIdentifierFromMetaName(name string) string {
+func extractIdentifierFromMetaName(name string, aliases map[string]string) string {
 	name = strings.ToLower(strings.TrimSpace(name))
 
+	// custom aliases take priority over the built-in meta names
+	if key, ok := aliases[name]; ok {
+		return key
+	}
+
 	// only extract from explicitly known identifier meta names
 	switch name {
 	case "dc:identifier", "dtb:uid":
@@ -386,7 +950,7 @@ func extractIdentifierFromMetaName(name string) string {
 	if strings.HasPrefix(name, "calibre:") && strings.HasSuffix(name, "_id") {
 		// extract the identifier type from calibre meta names like "calibre:google_id"
 		identType := strings.TrimSuffix(strings.TrimPrefix(name, "calibre:"), "_id")
-		return normalizeIdentifierKey(identType)
+		return normalizeIdentifierKey(identType, aliases)
 	}
 
 	return ""
@@ -413,9 +977,12 @@ func extractIdentifierFromProperty(property string) string {
 	return ""
 }
 
-// detectIdentifierType attempts to automatically detect the identifier type from its value.
-func detectIdentifierType(value string) string {
+// detectIdentifierType attempts to automatically detect the identifier type from its value, with the given strictness.
+func detectIdentifierType(value string, strictness IdentifierStrictness) string {
 	value = strings.TrimSpace(value)
+	if strictness == IdentifierStrict {
+		return detectStrictIdentifierType(value)
+	}
 
 	// remove common prefixes and clean the value
 	cleanValue := strings.ReplaceAll(value, "-", "")
@@ -452,6 +1019,67 @@ func detectIdentifierType(value string) string {
 	return ""
 }
 
+// asinPattern matches an Amazon Standard Identification Number of a book sold on Kindle
+var asinPattern = regexp.MustCompile(`^B[0-9A-Z]{9}$`)
+
+// doiPattern matches a Digital Object Identifier with a registrant code of 4 to 9 digits, as recommended by Crossref
+var doiPattern = regexp.MustCompile(`^10\.\d{4,9}/\S+$`)
+
+// urnPattern matches a URN with a namespace identifier as defined by RFC 8141
+var urnPattern = regexp.MustCompile(`(?i)^urn:[a-z0-9][a-z0-9-]{0,31}:\S+$`)
+
+// detectStrictIdentifierType detects the identifier type of a trimmed value, only when its check digit is valid or it
+// strictly matches the format of the type.
+func detectStrictIdentifierType(value string) string {
+	cleanValue := strings.ReplaceAll(strings.ReplaceAll(value, "-", ""), " ", "")
+
+	switch {
+	case isValidISBN(cleanValue):
+		return "isbn"
+	case asinPattern.MatchString(value):
+		return "asin"
+	case doiPattern.MatchString(value):
+		return "doi"
+	case urnPattern.MatchString(value):
+		return "urn"
+	}
+
+	if u, err := url.Parse(value); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return "uri"
+	}
+	return ""
+}
+
+// isValidISBN checks whether a string without hyphens or spaces is an ISBN-10 or ISBN-13 with a valid check digit.
+func isValidISBN(s string) bool {
+	switch {
+	case len(s) == 10 && isISBN10(s):
+		// the digits are weighted 10 down to 1, with a final X standing for 10
+		sum := 0
+		for i, r := range s {
+			digit := int(r - '0')
+			if r == 'X' || r == 'x' {
+				digit = 10
+			}
+			sum += (10 - i) * digit
+		}
+		return sum%11 == 0
+	case len(s) == 13 && isNumeric(s):
+		// the digits are weighted alternately 1 and 3
+		sum := 0
+		for i, r := range s {
+			digit := int(r - '0')
+			if i%2 == 1 {
+				digit *= 3
+			}
+			sum += digit
+		}
+		return sum%10 == 0
+	default:
+		return false
+	}
+}
+
 // isNumeric checks if a string contains only numeric digits (0-9).
 func isNumeric(s string) bool {
 	for _, r := range s {
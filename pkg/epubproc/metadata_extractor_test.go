@@ -3,7 +3,10 @@ package epubproc
 import (
 	"archive/zip"
 	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
@@ -56,6 +59,7 @@ func createTestEPUBWithMetadata(dir, filename string, metadata TestEPUBMetadata)
     <dc:title>%s</dc:title>
     %s
     %s
+    %s
     <dc:language>en</dc:language>
     %s
     %s
@@ -71,6 +75,7 @@ func createTestEPUBWithMetadata(dir, filename string, metadata TestEPUBMetadata)
 		metadata.Title,
 		createAuthorsXML(metadata.Authors),
 		createGenresXML(metadata.Genres),
+		createDescriptionXML(metadata.Description),
 		createDateXML(metadata.Date),
 		createIdentifiersXML(metadata.Identifiers),
 		createMetaTagsXML(metadata.MetaTags))
@@ -97,11 +102,24 @@ type TestEPUBMetadata struct {
 	Title       string
 	Authors     []string
 	Genres      []string
+	Description string
 	Date        string
 	Identifiers map[string]string // scheme -> value
 	MetaTags    map[string]string // name -> content
 }
 
+func createDescriptionXML(description string) string {
+	if description == "" {
+		return ""
+	}
+
+	var result strings.Builder
+	result.WriteString("<dc:description>")
+	xml.EscapeText(&result, []byte(description))
+	result.WriteString("</dc:description>")
+	return result.String()
+}
+
 func createAuthorsXML(authors []string) string {
 	if len(authors) == 0 {
 		return ""
@@ -314,6 +332,158 @@ func TestProcessFile(t *testing.T) {
 	})
 }
 
+// TestParseOPF tests metadata parsing from raw OPF content without a surrounding epub
+func TestParseOPF(t *testing.T) {
+	t.Run("CompleteMetadata", func(t *testing.T) {
+		opf := `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:title>A Study in Scarlet</dc:title>
+    <dc:creator>Arthur Conan Doyle</dc:creator>
+    <dc:subject>Detective and mystery stories</dc:subject>
+    <dc:date>1887-11-01</dc:date>
+    <dc:identifier opf:scheme="ISBN">978-0-14-043908-9</dc:identifier>
+    <dc:identifier>B000JQUT7M</dc:identifier>
+    <meta name="calibre:series" content="Sherlock Holmes"/>
+    <meta name="calibre:series_index" content="1"/>
+  </metadata>
+</package>`
+
+		metadata, err := ParseOPF(strings.NewReader(opf))
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+
+		if metadata.Title != "A Study in Scarlet" {
+			t.Errorf("Expected title 'A Study in Scarlet', got '%s'", metadata.Title)
+		}
+		if len(metadata.Authors) != 1 || metadata.Authors[0] != "Arthur Conan Doyle" {
+			t.Errorf("Expected author 'Arthur Conan Doyle', got %v", metadata.Authors)
+		}
+		if len(metadata.Genres) != 1 {
+			t.Errorf("Expected 1 genre, got %v", metadata.Genres)
+		}
+		if metadata.YearReleased != 1887 {
+			t.Errorf("Expected year 1887, got %d", metadata.YearReleased)
+		}
+		if metadata.Series != "Sherlock Holmes" || metadata.SeriesPosition != 1 {
+			t.Errorf("Expected series 'Sherlock Holmes' #1, got '%s' #%v", metadata.Series, metadata.SeriesPosition)
+		}
+		if metadata.Identifiers["isbn"] != "978-0-14-043908-9" {
+			t.Errorf("Expected isbn identifier, got %v", metadata.Identifiers)
+		}
+		if metadata.Identifiers["asin"] != "B000JQUT7M" {
+			t.Errorf("Expected detected asin identifier, got %v", metadata.Identifiers)
+		}
+	})
+
+	t.Run("WithOptions", func(t *testing.T) {
+		opf := `<package><metadata><identifier scheme="kobo">KOBO-1</identifier></metadata></package>`
+
+		metadata, err := ParseOPF(strings.NewReader(opf), WithIdentifierSchemeAliases(map[string]string{"kobo": "amazon"}))
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+
+		if metadata.Identifiers["amazon"] != "KOBO-1" {
+			t.Errorf("Expected aliased amazon identifier, got %v", metadata.Identifiers)
+		}
+	})
+
+	t.Run("InvalidXML", func(t *testing.T) {
+		_, err := ParseOPF(strings.NewReader("<package><metadata>"))
+		if err == nil {
+			t.Error("Expected error for invalid OPF")
+		} else if !strings.Contains(err.Error(), "failed to parse opf") {
+			t.Errorf("Expected parse error, got: %v", err)
+		}
+	})
+}
+
+// TestSeriesFromTitle tests extracting a series and position embedded in a title
+func TestSeriesFromTitle(t *testing.T) {
+	tests := []struct {
+		title    string
+		series   string
+		position float64
+		ok       bool
+	}{
+		{title: "Sherlock Holmes #3: The Hound of the Baskervilles", series: "Sherlock Holmes", position: 3, ok: true},
+		{title: "Sherlock Holmes #2 - The Sign of the Four", series: "Sherlock Holmes", position: 2, ok: true},
+		{title: "Discworld, #1.5: A Novella", series: "Discworld", position: 1.5, ok: true},
+		{title: "The Valley of Fear (Sherlock Holmes #7)", series: "Sherlock Holmes", position: 7, ok: true},
+		{title: "The Valley of Fear (Sherlock Holmes, #7)", series: "Sherlock Holmes", position: 7, ok: true},
+		{title: "A Study in Scarlet", ok: false},
+		{title: "We Are #1", ok: false},
+		{title: "#1: Untitled", ok: false},
+		{title: "", ok: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			series, position, ok := seriesFromTitle(test.title)
+			if series != test.series || position != test.position || ok != test.ok {
+				t.Errorf("Expected %q #%v (%v), got %q #%v (%v)", test.series, test.position, test.ok, series, position, ok)
+			}
+		})
+	}
+}
+
+// TestSeriesFallbacks tests that structured series metadata wins over the series meta, which wins over the title
+func TestSeriesFallbacks(t *testing.T) {
+	parse := func(t *testing.T, metadata string, opts ...MetadataExtractorOption) *Metadata {
+		t.Helper()
+		opf := `<package><metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + metadata + `</metadata></package>`
+		parsed, err := ParseOPF(strings.NewReader(opf), opts...)
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+		return parsed
+	}
+
+	t.Run("Title", func(t *testing.T) {
+		metadata := parse(t, `<dc:title>Sherlock Holmes #3: The Hound of the Baskervilles</dc:title>`, WithProvenance())
+		if metadata.Series != "Sherlock Holmes" || metadata.SeriesPosition != 3 {
+			t.Errorf("Expected series 'Sherlock Holmes' #3, got '%s' #%v", metadata.Series, metadata.SeriesPosition)
+		}
+		if metadata.Title != "Sherlock Holmes #3: The Hound of the Baskervilles" {
+			t.Errorf("Expected the title to be kept as written, got '%s'", metadata.Title)
+		}
+		if metadata.Provenance["series"] != "dc:title" {
+			t.Errorf("Expected series provenance 'dc:title', got %v", metadata.Provenance)
+		}
+	})
+
+	t.Run("Calibre", func(t *testing.T) {
+		metadata := parse(t, `<dc:title>Holmes Stories #3: The Hound</dc:title>
+			<meta name="calibre:series" content="Sherlock Holmes"/><meta name="calibre:series_index" content="5"/>`)
+		if metadata.Series != "Sherlock Holmes" || metadata.SeriesPosition != 5 {
+			t.Errorf("Expected calibre series 'Sherlock Holmes' #5, got '%s' #%v", metadata.Series, metadata.SeriesPosition)
+		}
+	})
+
+	t.Run("SeriesMeta", func(t *testing.T) {
+		metadata := parse(t, `<dc:title>The Hound of the Baskervilles</dc:title><meta name="series" content="Sherlock Holmes"/>`)
+		if metadata.Series != "Sherlock Holmes" || metadata.SeriesPosition != 0 {
+			t.Errorf("Expected series 'Sherlock Holmes' without a position, got '%s' #%v", metadata.Series, metadata.SeriesPosition)
+		}
+	})
+
+	t.Run("SeriesMetaWithTitlePosition", func(t *testing.T) {
+		metadata := parse(t, `<dc:title>Sherlock Holmes #3: The Hound</dc:title><meta name="series" content="Sherlock Holmes"/>`)
+		if metadata.Series != "Sherlock Holmes" || metadata.SeriesPosition != 3 {
+			t.Errorf("Expected series 'Sherlock Holmes' #3, got '%s' #%v", metadata.Series, metadata.SeriesPosition)
+		}
+	})
+
+	t.Run("SeriesFieldOnly", func(t *testing.T) {
+		metadata := parse(t, `<dc:title>Sherlock Holmes #3: The Hound</dc:title>`, WithMetadataFields(MetadataSeries))
+		if metadata.Series != "Sherlock Holmes" || metadata.Title != "" {
+			t.Errorf("Expected only the series, got title '%s' and series '%s'", metadata.Title, metadata.Series)
+		}
+	})
+}
+
 // TestProcessFileErrors tests error handling in ProcessFile
 func TestProcessFileErrors(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "metadata_error_test_*")
@@ -400,6 +570,51 @@ func TestProcessFileErrors(t *testing.T) {
 		}
 	})
 
+	// test with a container.xml pointing outside the archive root
+	t.Run("UnsafeOPFPath", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "unsafe_opf.epub")
+
+		zipFile, err := os.Create(epubPath)
+		if err != nil {
+			t.Fatalf("Failed to create ZIP: %v", err)
+		}
+		defer zipFile.Close()
+
+		writer := zip.NewWriter(zipFile)
+
+		containerFile, err := writer.Create("META-INF/container.xml")
+		if err != nil {
+			t.Fatalf("Failed to create container.xml: %v", err)
+		}
+		containerFile.Write([]byte(`<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="../content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`))
+
+		opfFile, err := writer.Create("../content.opf")
+		if err != nil {
+			t.Fatalf("Failed to create OPF: %v", err)
+		}
+		opfFile.Write([]byte(`<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Evil</dc:title>
+  </metadata>
+</package>`))
+
+		writer.Close()
+		zipFile.Close()
+
+		_, err = extractor.ProcessFile(ctx, epubPath)
+		if err == nil {
+			t.Error("Expected error for OPF path outside the archive root")
+		} else if !strings.Contains(err.Error(), "escapes the archive root") {
+			t.Errorf("Expected archive root error, got: %v", err)
+		}
+	})
+
 	// test with no OPF file found
 	t.Run("NoOPFFile", func(t *testing.T) {
 		epubPath := filepath.Join(tempDir, "no_opf.epub")
@@ -579,6 +794,84 @@ func TestProcessDirectory(t *testing.T) {
 	})
 }
 
+// TestProcessFiles tests extracting metadata for an explicit list of files
+func TestProcessFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "metadata_files_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var validPaths []string
+	for i, title := range []string{"Listed One", "Listed Two"} {
+		path, err := createTestEPUBWithMetadata(tempDir, fmt.Sprintf("listed%d.epub", i+1), TestEPUBMetadata{Title: title})
+		if err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+		validPaths = append(validPaths, path)
+	}
+
+	// not in the list, so never processed
+	if _, err := createTestEPUBWithMetadata(tempDir, "unlisted.epub", TestEPUBMetadata{Title: "Unlisted"}); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	invalidPath := filepath.Join(tempDir, "invalid.epub")
+	if err := os.WriteFile(invalidPath, []byte("not a zip archive"), 0o644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	paths := []string{validPaths[0], filepath.Join(tempDir, "missing.epub"), "", invalidPath, validPaths[1]}
+
+	t.Run("ValidFilesOnly", func(t *testing.T) {
+		titles := make(map[string]string)
+		var mu sync.Mutex
+		err := NewMetadataExtractor(2).ProcessFiles(context.Background(), paths, func(epubPath string, metadata *Metadata) error {
+			mu.Lock()
+			titles[epubPath] = metadata.Title
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ProcessFiles failed: %v", err)
+		}
+
+		expected := map[string]string{validPaths[0]: "Listed One", validPaths[1]: "Listed Two"}
+		if !maps.Equal(titles, expected) {
+			t.Errorf("Expected %v, got %v", expected, titles)
+		}
+	})
+
+	t.Run("HandlerError", func(t *testing.T) {
+		handlerErr := fmt.Errorf("handler failed")
+		err := NewMetadataExtractor(1).ProcessFiles(context.Background(), paths, func(epubPath string, metadata *Metadata) error {
+			return handlerErr
+		})
+		if !errors.Is(err, handlerErr) {
+			t.Errorf("Expected the handler error, got %v", err)
+		}
+	})
+
+	t.Run("FailFast", func(t *testing.T) {
+		err := NewMetadataExtractor(1, WithFailFast()).ProcessFiles(context.Background(), paths, func(epubPath string, metadata *Metadata) error {
+			return nil
+		})
+		if err == nil || !strings.Contains(err.Error(), "missing.epub") {
+			t.Errorf("Expected an error for missing.epub, got %v", err)
+		}
+	})
+
+	t.Run("EmptyList", func(t *testing.T) {
+		err := NewMetadataExtractor(2).ProcessFiles(context.Background(), nil, func(epubPath string, metadata *Metadata) error {
+			t.Errorf("Expected no calls, got %s", epubPath)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+}
+
 // TestIdentifierNormalization tests the normalizeIdentifierKey function
 func TestIdentifierNormalization(t *testing.T) {
 	testCases := []struct {
@@ -598,7 +891,7 @@ func TestIdentifierNormalization(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(fmt.Sprintf("Normalize_%s", tc.input), func(t *testing.T) {
-			result := normalizeIdentifierKey(tc.input)
+			result := normalizeIdentifierKey(tc.input, nil)
 			if result != tc.expected {
 				t.Errorf("normalizeIdentifierKey(%q) = %q, expected %q", tc.input, result, tc.expected)
 			}
@@ -606,6 +899,304 @@ func TestIdentifierNormalization(t *testing.T) {
 	}
 }
 
+// TestIdentifierSchemeAliases tests custom identifier scheme aliases
+func TestIdentifierSchemeAliases(t *testing.T) {
+	aliases := map[string]string{"KOBO": "amazon", "mybooks_id": "mybooks"}
+	extractor := NewMetadataExtractor(1, WithIdentifierSchemeAliases(aliases)).(*metadataExtractorImpl)
+
+	t.Run("NormalizeIdentifierKey", func(t *testing.T) {
+		testCases := []struct {
+			input    string
+			expected string
+		}{
+			{"kobo", "amazon"},
+			{"Kobo", "amazon"},
+			{"mybooks_id", "mybooks"},
+			{"ISBN", "isbn"},
+			{"custom", "custom"},
+		}
+
+		for _, tc := range testCases {
+			result := normalizeIdentifierKey(tc.input, extractor.options.schemeAliases)
+			if result != tc.expected {
+				t.Errorf("normalizeIdentifierKey(%q) = %q, expected %q", tc.input, result, tc.expected)
+			}
+		}
+	})
+
+	t.Run("ExtractIdentifierFromMetaName", func(t *testing.T) {
+		testCases := []struct {
+			input    string
+			expected string
+		}{
+			{"calibre:kobo_id", "amazon"},
+			{"calibre:isbn", "isbn"},
+			{"calibre:unknown", ""},
+		}
+
+		for _, tc := range testCases {
+			result := extractIdentifierFromMetaName(tc.input, extractor.options.schemeAliases)
+			if result != tc.expected {
+				t.Errorf("extractIdentifierFromMetaName(%q) = %q, expected %q", tc.input, result, tc.expected)
+			}
+		}
+	})
+
+	t.Run("ProcessFile", func(t *testing.T) {
+		tempDir, err := os.MkdirTemp("", "metadata_alias_test_*")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		epubPath, err := createTestEPUBWithMetadata(tempDir, "kobo.epub", TestEPUBMetadata{
+			Title:       "Kobo Book",
+			Identifiers: map[string]string{"kobo": "KOBO-123"},
+			MetaTags:    map[string]string{"calibre:isbn": "9781234567890"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		metadata, err := extractor.ProcessFile(context.Background(), epubPath)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+
+		if metadata.Identifiers["amazon"] != "KOBO-123" {
+			t.Errorf("Expected kobo identifier under amazon, got %v", metadata.Identifiers)
+		}
+		if _, ok := metadata.Identifiers["kobo"]; ok {
+			t.Errorf("Expected no kobo key when aliased, got %v", metadata.Identifiers)
+		}
+		if metadata.Identifiers["isbn"] != "9781234567890" {
+			t.Errorf("Expected isbn to be unaffected, got %v", metadata.Identifiers)
+		}
+	})
+}
+
+// TestNormalizedIdentifiers tests normalizing identifier values
+func TestNormalizedIdentifiers(t *testing.T) {
+	t.Run("NormalizeIdentifierValue", func(t *testing.T) {
+		testCases := []struct {
+			key      string
+			input    string
+			expected string
+		}{
+			{"isbn", "978-1-234-56789-0", "9781234567890"},
+			{"isbn", " 0 306 40615 x ", "030640615X"},
+			{"asin", "b00abc1234", "B00ABC1234"},
+			{"amazon", "b00abc1234", "B00ABC1234"},
+			{"doi", " 10.1000/Abc-1 ", "10.1000/Abc-1"},
+		}
+
+		for _, tc := range testCases {
+			result := normalizeIdentifierValue(tc.key, tc.input, true)
+			if result != tc.expected {
+				t.Errorf("normalizeIdentifierValue(%q, %q) = %q, expected %q", tc.key, tc.input, result, tc.expected)
+			}
+		}
+
+		if result := normalizeIdentifierValue("isbn", " 978-1-234-56789-0 ", false); result != "978-1-234-56789-0" {
+			t.Errorf("Expected only trimming when disabled, got %q", result)
+		}
+	})
+
+	t.Run("ProcessFile", func(t *testing.T) {
+		tempDir, err := os.MkdirTemp("", "metadata_normalize_test_*")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		epubPath, err := createTestEPUBWithMetadata(tempDir, "normalize.epub", TestEPUBMetadata{
+			Title:       "Normalized Book",
+			Identifiers: map[string]string{"isbn": "978-1-234-56789-0"},
+			MetaTags:    map[string]string{"calibre:asin": "b00abc1234"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		metadata, err := NewMetadataExtractor(1, WithNormalizedIdentifiers()).ProcessFile(context.Background(), epubPath)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		if metadata.Identifiers["isbn"] != "9781234567890" {
+			t.Errorf("Expected normalized isbn, got %v", metadata.Identifiers)
+		}
+		if metadata.Identifiers["asin"] != "B00ABC1234" {
+			t.Errorf("Expected uppercased asin, got %v", metadata.Identifiers)
+		}
+
+		metadata, err = NewMetadataExtractor(1).ProcessFile(context.Background(), epubPath)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		if metadata.Identifiers["isbn"] != "978-1-234-56789-0" {
+			t.Errorf("Expected isbn to be unchanged by default, got %v", metadata.Identifiers)
+		}
+	})
+}
+
+// TestIdentifierSchemes tests keeping only the allowed identifier schemes
+func TestIdentifierSchemes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "metadata_schemes_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	epubPath, err := createTestEPUBWithMetadata(tempDir, "schemes.epub", TestEPUBMetadata{
+		Title:       "Many Identifiers",
+		Identifiers: map[string]string{"ISBN-13": "9781234567890", "doi": "10.1000/182", "calibre": "42"},
+		MetaTags:    map[string]string{"calibre:asin": "B00ABC1234"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	t.Run("Allowed", func(t *testing.T) {
+		metadata, err := NewMetadataExtractor(1, WithIdentifierSchemes("ISBN", " asin ")).ProcessFile(context.Background(), epubPath)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+
+		expected := map[string]string{"isbn": "9781234567890", "asin": "B00ABC1234"}
+		if !maps.Equal(metadata.Identifiers, expected) {
+			t.Errorf("Expected identifiers %v, got %v", expected, metadata.Identifiers)
+		}
+	})
+
+	t.Run("DefaultKeepsAll", func(t *testing.T) {
+		metadata, err := NewMetadataExtractor(1).ProcessFile(context.Background(), epubPath)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+
+		for _, key := range []string{"isbn", "doi", "calibre", "asin"} {
+			if _, ok := metadata.Identifiers[key]; !ok {
+				t.Errorf("Expected identifier %s, got %v", key, metadata.Identifiers)
+			}
+		}
+	})
+}
+
+// TestMetadataFields tests limiting extraction to specific metadata fields
+func TestMetadataFields(t *testing.T) {
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:title>The Hound</dc:title>
+    <dc:creator>Arthur Conan Doyle</dc:creator>
+    <dc:subject>Mystery</dc:subject>
+    <dc:description>A spectral hound.</dc:description>
+    <dc:date>1902</dc:date>
+    <dc:identifier opf:scheme="ISBN">9781234567890</dc:identifier>
+    <meta name="calibre:series" content="Sherlock Holmes"/>
+    <meta name="calibre:series_index" content="5"/>
+  </metadata>
+  <manifest><item id="broken" href="chapter1.html" media-type="application/xhtml+xml"></manifest>
+</package>`
+
+	t.Run("AuthorsOnly", func(t *testing.T) {
+		metadata, err := ParseOPF(strings.NewReader(opf), WithMetadataFields(MetadataAuthors))
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+
+		if len(metadata.Authors) != 1 || metadata.Authors[0] != "Arthur Conan Doyle" {
+			t.Errorf("Expected author, got %v", metadata.Authors)
+		}
+		if metadata.Title != "" || len(metadata.Genres) != 0 || metadata.Description != "" || metadata.YearReleased != 0 {
+			t.Errorf("Expected no other fields, got %+v", metadata)
+		}
+		if metadata.Series != "" || metadata.SeriesPosition != 0 || len(metadata.Identifiers) != 0 {
+			t.Errorf("Expected no series or identifiers, got %+v", metadata)
+		}
+	})
+
+	t.Run("SeriesAndIdentifiers", func(t *testing.T) {
+		metadata, err := ParseOPF(strings.NewReader(opf), WithMetadataFields(MetadataSeries|MetadataIdentifiers))
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+
+		if metadata.Series != "Sherlock Holmes" || metadata.SeriesPosition != 5 {
+			t.Errorf("Expected series, got '%s' #%v", metadata.Series, metadata.SeriesPosition)
+		}
+		if metadata.Identifiers["isbn"] != "9781234567890" {
+			t.Errorf("Expected isbn, got %v", metadata.Identifiers)
+		}
+		if len(metadata.Authors) != 0 {
+			t.Errorf("Expected no authors, got %v", metadata.Authors)
+		}
+	})
+
+	t.Run("AllByDefault", func(t *testing.T) {
+		metadata, err := ParseOPF(strings.NewReader(opf))
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+
+		// the malformed manifest is never read
+		if metadata.Title != "The Hound" || metadata.YearReleased != 1902 || metadata.Description != "A spectral hound." {
+			t.Errorf("Expected every field, got %+v", metadata)
+		}
+	})
+}
+
+// BenchmarkMetadataFields compares full metadata extraction with author-only extraction
+func BenchmarkMetadataFields(b *testing.B) {
+	tempDir, err := os.MkdirTemp("", "metadata_fields_bench_*")
+	if err != nil {
+		b.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	identifiers := make(map[string]string, 20)
+	metaTags := make(map[string]string, 20)
+	for i := range 20 {
+		identifiers[fmt.Sprintf("custom%d", i)] = fmt.Sprintf("value-%d", i)
+		metaTags[fmt.Sprintf("calibre:custom%d_id", i)] = fmt.Sprintf("value-%d", i)
+	}
+
+	epubPath, err := createTestEPUBWithMetadata(tempDir, "bench.epub", TestEPUBMetadata{
+		Title:       "Benchmark Book",
+		Authors:     []string{"Author One", "Author Two"},
+		Genres:      []string{"Fiction", "Mystery", "Thriller"},
+		Description: strings.Repeat("A long description of the book. ", 50),
+		Date:        "2020-01-01",
+		Identifiers: identifiers,
+		MetaTags:    metaTags,
+	})
+	if err != nil {
+		b.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	benchmarks := []struct {
+		name   string
+		fields MetadataFields
+	}{
+		{name: "Full", fields: MetadataAll},
+		{name: "AuthorsOnly", fields: MetadataAuthors},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			extractor := NewMetadataExtractor(1, WithMetadataFields(bm.fields))
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := extractor.ProcessFile(ctx, epubPath); err != nil {
+					b.Fatalf("ProcessFile failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
 // TestIdentifierDetection tests the detectIdentifierType function
 func TestIdentifierDetection(t *testing.T) {
 	testCases := []struct {
@@ -623,7 +1214,7 @@ func TestIdentifierDetection(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(fmt.Sprintf("Detect_%s", tc.value), func(t *testing.T) {
-			result := detectIdentifierType(tc.value)
+			result := detectIdentifierType(tc.value, IdentifierLenient)
 			if result != tc.expected {
 				t.Errorf("detectIdentifierType(%q) = %q, expected %q", tc.value, result, tc.expected)
 			}
@@ -631,6 +1222,92 @@ func TestIdentifierDetection(t *testing.T) {
 	}
 }
 
+// TestIdentifierDetectionStrictness tests that strict detection only classifies borderline values with a valid check
+// digit or in a strict format, while lenient detection classifies them by length and prefix
+func TestIdentifierDetectionStrictness(t *testing.T) {
+	testCases := []struct {
+		value   string
+		lenient string
+		strict  string
+	}{
+		{"978-0-306-40615-7", "isbn", "isbn"},
+		{"0-306-40615-2", "isbn", "isbn"},
+		{"080442957X", "isbn", "isbn"},
+		{"978-1234567890", "isbn", ""},
+		{"1234567890", "isbn", ""},
+		{"B07ABCDEFG", "asin", "asin"},
+		{"b07abcdefg", "asin", ""},
+		{"BOOK-12345", "asin", ""},
+		{"10.1000/123456", "doi", "doi"},
+		{"10.5 percent", "doi", ""},
+		{"https://example.com/book", "uri", "uri"},
+		{"https://", "uri", ""},
+		{"urn:uuid:0f4e5e6a-8d3f-4b8e-9a4e-1c2b3d4e5f60", "urn", "urn"},
+		{"urn:", "urn", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			if result := detectIdentifierType(tc.value, IdentifierLenient); result != tc.lenient {
+				t.Errorf("Lenient detection of %q = %q, expected %q", tc.value, result, tc.lenient)
+			}
+			if result := detectIdentifierType(tc.value, IdentifierStrict); result != tc.strict {
+				t.Errorf("Strict detection of %q = %q, expected %q", tc.value, result, tc.strict)
+			}
+		})
+	}
+
+	t.Run("ParseOPF", func(t *testing.T) {
+		opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier>1234567890</dc:identifier>
+    <dc:identifier>978-0-306-40615-7</dc:identifier>
+  </metadata>
+</package>`
+
+		metadata, err := ParseOPF(strings.NewReader(opf), WithIdentifierStrictness(IdentifierStrict))
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+		if len(metadata.Identifiers) != 1 || metadata.Identifiers["isbn"] != "978-0-306-40615-7" {
+			t.Errorf("Expected only the valid ISBN, got %v", metadata.Identifiers)
+		}
+	})
+
+	// the strictness is matched case-insensitively, and unknown values are rejected instead of treated as lenient
+	t.Run("Validation", func(t *testing.T) {
+		opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier>1234567890</dc:identifier>
+  </metadata>
+</package>`
+
+		metadata, err := ParseOPF(strings.NewReader(opf), WithIdentifierStrictness(" Strict "))
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+		if len(metadata.Identifiers) != 0 {
+			t.Errorf("Expected no identifiers with strict detection, got %v", metadata.Identifiers)
+		}
+
+		if _, err := ParseOPF(strings.NewReader(opf), WithIdentifierStrictness("fuzzy")); err == nil {
+			t.Error("Expected an error for an unknown strictness from ParseOPF")
+		}
+
+		extractor := NewMetadataExtractor(1, WithIdentifierStrictness("fuzzy"))
+		if _, err := extractor.ProcessFile(context.Background(), "missing.epub"); err == nil || !strings.Contains(err.Error(), "strictness") {
+			t.Errorf("Expected a strictness error from ProcessFile, got %v", err)
+		}
+		if err := extractor.ProcessFiles(context.Background(), []string{"missing.epub"}, func(string, *Metadata) error {
+			return nil
+		}); err == nil || !strings.Contains(err.Error(), "strictness") {
+			t.Errorf("Expected a strictness error from ProcessFiles, got %v", err)
+		}
+	})
+}
+
 // TestISBNValidation tests ISBN validation functions
 func TestISBNValidation(t *testing.T) {
 	testCases := []struct {
@@ -723,3 +1400,118 @@ func TestConcurrentProcessing(t *testing.T) {
 
 	t.Logf("Processed %d books in %v", numBooks, duration)
 }
+
+func TestMetadataProvenance(t *testing.T) {
+	calibreOPF := `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:title>The Sign of the Four</dc:title>
+    <dc:creator>Arthur Conan Doyle</dc:creator>
+    <dc:date>1890</dc:date>
+    <dc:identifier opf:scheme="ISBN">978-0-14-043907-2</dc:identifier>
+    <meta name="calibre:series" content="Sherlock Holmes"/>
+    <meta name="calibre:series_index" content="2"/>
+  </metadata>
+</package>`
+
+	epub3OPF := `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>The Hound of the Baskervilles</dc:title>
+    <meta property="belongs-to-collection" id="c01">Sherlock Holmes</meta>
+    <meta refines="#c01" property="collection-type">series</meta>
+    <meta refines="#c01" property="group-position">5</meta>
+  </metadata>
+</package>`
+
+	t.Run("CalibreSeries", func(t *testing.T) {
+		metadata, err := ParseOPF(strings.NewReader(calibreOPF), WithProvenance())
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+
+		expected := map[string]string{
+			"title":            "dc:title",
+			"authors":          "dc:creator",
+			"yearReleased":     "dc:date",
+			"series":           "calibre:series",
+			"seriesPosition":   "calibre:series_index",
+			"identifiers.isbn": "dc:identifier",
+		}
+		for field, source := range expected {
+			if metadata.Provenance[field] != source {
+				t.Errorf("Expected %s source '%s', got '%s'", field, source, metadata.Provenance[field])
+			}
+		}
+		if _, ok := metadata.Provenance["genres"]; ok {
+			t.Errorf("Expected no genres source, got %v", metadata.Provenance)
+		}
+	})
+
+	t.Run("EPUB3Series", func(t *testing.T) {
+		metadata, err := ParseOPF(strings.NewReader(epub3OPF), WithProvenance())
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+
+		if metadata.Series != "Sherlock Holmes" || metadata.SeriesPosition != 5 {
+			t.Errorf("Expected series 'Sherlock Holmes' #5, got '%s' #%v", metadata.Series, metadata.SeriesPosition)
+		}
+		if metadata.Provenance["series"] != "belongs-to-collection" {
+			t.Errorf("Expected series source 'belongs-to-collection', got '%s'", metadata.Provenance["series"])
+		}
+		if metadata.Provenance["seriesPosition"] != "group-position" {
+			t.Errorf("Expected seriesPosition source 'group-position', got '%s'", metadata.Provenance["seriesPosition"])
+		}
+	})
+
+	t.Run("EPUB3SetIsNotSeries", func(t *testing.T) {
+		opf := strings.Replace(epub3OPF, `property="collection-type">series`, `property="collection-type">set`, 1)
+
+		metadata, err := ParseOPF(strings.NewReader(opf))
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+
+		if metadata.Series != "" {
+			t.Errorf("Expected no series for a set collection, got '%s'", metadata.Series)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		metadata, err := ParseOPF(strings.NewReader(calibreOPF))
+		if err != nil {
+			t.Fatalf("ParseOPF failed: %v", err)
+		}
+
+		if metadata.Provenance != nil {
+			t.Errorf("Expected nil provenance, got %v", metadata.Provenance)
+		}
+	})
+
+	t.Run("ProcessFile", func(t *testing.T) {
+		tempDir, err := os.MkdirTemp("", "provenance_test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		epubPath, err := createTestEPUBWithMetadata(tempDir, "series.epub", TestEPUBMetadata{
+			Title:    "The Valley of Fear",
+			MetaTags: map[string]string{"calibre:series": "Sherlock Holmes"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+
+		extractor := NewMetadataExtractor(1, WithProvenance())
+		metadata, err := extractor.ProcessFile(context.Background(), epubPath)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+
+		if metadata.Provenance["series"] != "calibre:series" {
+			t.Errorf("Expected series source 'calibre:series', got %v", metadata.Provenance)
+		}
+	})
+}
@@ -1,5 +1,7 @@
 package epubproc
 
+import "time"
+
 // SearchRequestRegex represents regex search configuration.
 type SearchRequestRegex struct {
 	// Pattern is the regex pattern to match
@@ -13,8 +15,77 @@ type SearchRequestText struct {
 
 	// IgnoreCase controls whether to perform case-insensitive search
 	IgnoreCase bool `json:"ignoreCase"`
+
+	// Fuzzy enables approximate matching of whole words (if set), which is slower than the default search
+	Fuzzy *FuzzyConfig `json:"fuzzy,omitempty"`
 }
 
+// FuzzyConfig represents approximate text matching configuration.
+type FuzzyConfig struct {
+	// MaxDistance is the maximum Levenshtein distance between the value and the matched words
+	MaxDistance int `json:"maxDistance"`
+}
+
+// QueryCombine defines how the sub-queries of a query are combined.
+type QueryCombine string
+
+const (
+	// CombineOr reports a book when any sub-query matches.
+	CombineOr QueryCombine = "or"
+
+	// CombineAnd reports a book only when every sub-query matches somewhere in it.
+	CombineAnd QueryCombine = "and"
+)
+
+// ResultSort defines the order in which buffered results are passed to the handler.
+type ResultSort string
+
+const (
+	// SortByPath orders results by path.
+	SortByPath ResultSort = "path"
+
+	// SortByRelevance orders results by their number of matches, most first, and then by path.
+	SortByRelevance ResultSort = "relevance"
+)
+
+// BookSection restricts a search to a section of a book, located by the landmarks of the epub.
+type BookSection string
+
+const (
+	// SectionAll searches the whole book.
+	SectionAll BookSection = "all"
+
+	// SectionFront searches only the front matter, the spine files before the start of the body.
+	SectionFront BookSection = "front"
+
+	// SectionBody searches only the body, from the start of the body up to the first back matter such as an appendix or
+	// index.
+	SectionBody BookSection = "body"
+)
+
+// SkipCategory identifies a kind of file inside an epub that is not searched by default, as it is not part of the text.
+type SkipCategory string
+
+const (
+	// SkipCover covers cover and title pages.
+	SkipCover SkipCategory = "cover"
+
+	// SkipNavigation covers tables of contents and indexes.
+	SkipNavigation SkipCategory = "navigation"
+
+	// SkipLegal covers copyright, imprint, license and colophon pages.
+	SkipLegal SkipCategory = "legal"
+
+	// SkipNotes covers notes, glossaries, bibliographies and appendices.
+	SkipNotes SkipCategory = "notes"
+
+	// SkipExtra covers dedications, about pages, acknowledgments, afterwords, epilogues and other extras.
+	SkipExtra SkipCategory = "extra"
+
+	// SkipPromo covers ads, trailers and files named like samples, adverts, promos or teasers (see PromoKeywords).
+	SkipPromo SkipCategory = "promo"
+)
+
 // SearchRequestQuery represents the query configuration for searching.
 type SearchRequestQuery struct {
 	// Regex contains regex search configuration
@@ -25,6 +96,12 @@ type SearchRequestQuery struct {
 
 	// Text contains text search configuration
 	Text *SearchRequestText `json:"text,omitempty"`
+
+	// SubQueries contains queries that are each regex or text, combined using Combine (replaces Regex and Text when set)
+	SubQueries []SearchRequestQuery `json:"subQueries,omitempty"`
+
+	// Combine defines how SubQueries are combined (defaults to CombineOr)
+	Combine QueryCombine `json:"combine,omitempty"`
 }
 
 // SearchRequestFilters represents filters used for searching.
@@ -38,6 +115,13 @@ type SearchRequestFilters struct {
 	// TitleEquals will filter search results to a specific title
 	TitleEquals string `json:"titleEquals,omitempty"`
 
+	// TitleContains will filter search results to titles containing this text, ignoring case
+	TitleContains string `json:"titleContains,omitempty"`
+
+	// NormalizeTitle compares titles for TitleEquals and TitleContains without a trailing subtitle after a colon, and
+	// ignoring punctuation and extra whitespace, so "The Hobbit" matches "The Hobbit: There and Back Again"
+	NormalizeTitle bool `json:"normalizeTitle,omitempty"`
+
 	// FilesIn will filter search results to a specific list of files
 	FilesIn []string `json:"filesIn,omitempty"`
 }
@@ -50,8 +134,213 @@ type SearchRequest struct {
 	// Filters contains optional search filters
 	Filters *SearchRequestFilters `json:"filters,omitempty"`
 
+	// ExtractForFilter extracts metadata to evaluate the metadata filters (and SearchDescription) even when the search
+	// does not extract metadata, without including it in the results
+	ExtractForFilter bool `json:"extractForFilter,omitempty"`
+
 	// Context is the number of context lines to show around each match
 	Context int `json:"context"`
+
+	// ContextJoiner separates the lines joined into a match's Line when context or phrase matches span several lines (defaults to "\n")
+	ContextJoiner string `json:"contextJoiner,omitempty"`
+
+	// IncludeInternalGlobs limits scanning to files inside the epub whose base name matches one of these globs
+	IncludeInternalGlobs []string `json:"includeInternalGlobs,omitempty"`
+
+	// ExcludeInternalGlobs skips files inside the epub whose base name matches one of these globs
+	ExcludeInternalGlobs []string `json:"excludeInternalGlobs,omitempty"`
+
+	// IgnoreGlobCase matches IncludeInternalGlobs and ExcludeInternalGlobs without regard to case, since the
+	// case of file names inside epubs varies, e.g. so "chapter*.xhtml" also matches "Chapter01.XHTML"
+	IgnoreGlobCase bool `json:"ignoreGlobCase,omitempty"`
+
+	// PhraseMode matches against the whole text of each file with whitespace collapsed, so phrases split across blocks or lines are found.
+	// The text of each file is held in memory while it is matched, unlike other searches, which read files a line at a time.
+	PhraseMode bool `json:"phraseMode,omitempty"`
+
+	// DocumentMode matches against the text of the whole book at once, with its blocks and lines in reading (spine) order
+	// joined by newlines and "." matching newlines too, for structural queries such as a heading followed later by a
+	// phrase. Each match reports every line it spans, where it starts and where it ends (Match.End).
+	// The text of each book is held in memory while it is searched, which MaxBytesPerEpub caps. Fuzzy queries and
+	// phrase mode are not supported.
+	DocumentMode bool `json:"documentMode,omitempty"`
+
+	// IncludeHTML controls whether the original HTML of the matching blocks is returned with each match
+	IncludeHTML bool `json:"includeHTML"`
+
+	// Highlight wraps every occurrence of the query in each match's Line with HighlightStart and HighlightEnd.
+	// Fuzzy queries are not supported, and in phrase mode occurrences are found with whitespace collapsed, as when matching.
+	Highlight bool `json:"highlight,omitempty"`
+
+	// HighlightStart is inserted before each highlighted occurrence (defaults to "\x02")
+	HighlightStart string `json:"highlightStart,omitempty"`
+
+	// HighlightEnd is inserted after each highlighted occurrence (defaults to "\x03")
+	HighlightEnd string `json:"highlightEnd,omitempty"`
+
+	// MarkHTML sets each match's MarkedHTML to its Line with HTML special characters escaped and every occurrence of the
+	// query wrapped in <mark>, ready to be shown by a browser. Like Highlight, fuzzy queries are not supported.
+	MarkHTML bool `json:"markHTML,omitempty"`
+
+	// ExtraTextExtensions are additional file extensions inside the epub (e.g. ".css", ".json") to scan as plain text
+	ExtraTextExtensions []string `json:"extraTextExtensions,omitempty"`
+
+	// IncludeSkipped searches files of these categories too, which are skipped by default (e.g. SkipNotes for footnotes)
+	IncludeSkipped []SkipCategory `json:"includeSkipped,omitempty"`
+
+	// PromoKeywords replaces the words in the base name of a file that mark it as promotional content (SkipPromo), which
+	// are "sample", "advert", "advertisement", "promo" and "teaser" by default. Keywords match whole words and their
+	// plurals, e.g. "sample_chapter.xhtml" and "samples.xhtml" but not "sampler.xhtml".
+	PromoKeywords []string `json:"promoKeywords,omitempty"`
+
+	// PromoSubstring matches PromoKeywords anywhere in the base name instead of as whole words
+	PromoSubstring bool `json:"promoSubstring,omitempty"`
+
+	// ContentTypes replaces the default mapping of file extensions inside the epub to their content type, "text" or
+	// "html" (e.g. {".md": "text", ".svg": "html"}). Extensions not in the map are not scanned, unless they are in
+	// ExtraTextExtensions. Nil keeps the default mapping of .txt to text and .html, .xhtml and .xml to html.
+	ContentTypes map[string]string `json:"contentTypes,omitempty"`
+
+	// ReadingOrder sorts the matches of each book by the spine position of their file instead of the archive order.
+	// Matches within a file stay in line order, and books without a readable spine keep the archive order.
+	ReadingOrder bool `json:"readingOrder,omitempty"`
+
+	// IncludePercentage reports the approximate position of each match through the book (e.g. "34% through the book").
+	// The position is estimated from the uncompressed sizes of the content files in reading (spine) order and the byte
+	// offset of the match within its file, so it ignores how much of each file is markup.
+	IncludePercentage bool `json:"includePercentage,omitempty"`
+
+	// IncludeMediaType reports the media type of the file of each match, so consumers can decide how to render it.
+	IncludeMediaType bool `json:"includeMediaType,omitempty"`
+
+	// DedupeLines drops matches whose Line repeats an earlier match in the same file, ignoring differences in whitespace.
+	// This keeps repeated identical paragraphs (e.g. scene breaks) from cluttering the results, at the cost of hiding
+	// where else in the file they occur.
+	DedupeLines bool `json:"dedupeLines,omitempty"`
+
+	// RepairText repairs scanned text before matching: invalid UTF-8 is decoded as Windows-1252 (the usual encoding of
+	// legacy epubs that mislabel Latin-1 content as UTF-8), and mojibake such as "cafÃ©" from double-encoded UTF-8 is
+	// turned back into "café". Results with repaired text have Repaired set.
+	RepairText bool `json:"repairText,omitempty"`
+
+	// IncludeEntryStats controls whether compressed and uncompressed sizes are reported for each scanned content file.
+	// They are only reported with a result, so books without matches are not covered.
+	IncludeEntryStats bool `json:"includeEntryStats"`
+
+	// SearchDescription also matches the query against the book description, reported with the FileName "description".
+	// This requires metadata extraction, and metadata is extracted before the content is scanned.
+	SearchDescription bool `json:"searchDescription,omitempty"`
+
+	// SearchMetadata also matches the query against the title, authors and series of a book joined into one text, so a
+	// query such as "scarlet arthur conan" spanning the title and authors matches. A matching book gets a single match
+	// with the FileName "metadata" and the joined text as its Line. This requires metadata extraction, like
+	// SearchDescription.
+	SearchMetadata bool `json:"searchMetadata,omitempty"`
+
+	// ReportContentErrors reports books whose content could not be fully read, with ContentError set, instead of skipping them.
+	// When metadata extraction is enabled, metadata is extracted before the content is scanned.
+	ReportContentErrors bool `json:"reportContentErrors,omitempty"`
+
+	// MaxBytesPerEpub stops scanning an epub once this many decompressed content bytes were read across its entries,
+	// reporting the matches found so far with Truncated set on the result (0 means no limit)
+	MaxBytesPerEpub int64 `json:"maxBytesPerEpub,omitempty"`
+
+	// MaxFilesPerEpub scans only the first content files of each epub, in reading (spine) order when the epub has a
+	// readable spine and archive order otherwise, e.g. to check whether a book mentions something early on (0 means no limit)
+	MaxFilesPerEpub int `json:"maxFilesPerEpub,omitempty"`
+
+	// SpineFrom and SpineTo scan only the files at these 1-based positions of the spine (reading order), inclusive,
+	// e.g. SpineFrom 5 to search from the fifth chapter onward. Files outside the spine are skipped, 0 leaves the range
+	// open at that end, and books without a readable spine are scanned in full.
+	SpineFrom int `json:"spineFrom,omitempty"`
+	SpineTo   int `json:"spineTo,omitempty"`
+
+	// MaxHTMLBlockBytes splits HTML blocks (paragraphs, headings, etc.) longer than this into several lines, and stops
+	// scanning a file at any single tag or text run longer than this with Truncated set on the result (0 means no limit)
+	MaxHTMLBlockBytes int `json:"maxHTMLBlockBytes,omitempty"`
+
+	// MaxHTMLBlocks stops scanning an HTML file after this many non-empty blocks, with Truncated set on the result
+	// (0 means no limit)
+	MaxHTMLBlocks int `json:"maxHTMLBlocks,omitempty"`
+
+	// MinLineLength ignores matched lines shorter than this many characters after trimming, such as stray characters
+	// split off by unusual markup (0 means no minimum). It is not supported in phrase or document mode, which match
+	// across lines.
+	MinLineLength int `json:"minLineLength,omitempty"`
+
+	// Section restricts the search to the front matter or the body of each book, located with the EPUB3 landmarks of the
+	// nav document or the EPUB2 guide. The body starts at the "bodymatter" landmark ("text" in a guide) and ends at the
+	// first back matter landmark such as "backmatter", "appendix" or "index". Files outside the spine are not searched,
+	// and books without the landmarks bounding the section are searched in full. Empty or SectionAll searches everything.
+	Section BookSection `json:"section,omitempty"`
+
+	// Files is an explicit list of epub paths to search instead of walking the search directory
+	Files []string `json:"files,omitempty"`
+
+	// OpenRetries is the number of times opening an epub is retried, with exponential backoff, after an error that may be
+	// transient (e.g. on a network mount); missing files, permission errors and invalid archives are never retried
+	OpenRetries int `json:"openRetries,omitempty"`
+
+	// StrictWalk fails the search on any directory that cannot be read, instead of logging and skipping it
+	StrictWalk bool `json:"strictWalk,omitempty"`
+
+	// FailFast fails the search on the first epub that cannot be opened, read or have its metadata extracted, cancelling
+	// the remaining work, instead of logging the error and moving on to the next epub
+	FailFast bool `json:"failFast,omitempty"`
+
+	// FollowSymlinks descends into symlinked directories while walking the search directory, visiting each directory only once
+	FollowSymlinks bool `json:"followSymlinks,omitempty"`
+
+	// ModifiedSince searches only epubs last modified at or after this time, e.g. to update an index incrementally.
+	// It applies to explicit Files as well as the directory walk, and the zero time searches every epub.
+	ModifiedSince time.Time `json:"modifiedSince,omitzero"`
+
+	// LimitPerDirectory searches at most this many epubs in each directory of the walk, e.g. to sanity-check a query
+	// against a sample of a huge library (0 means no limit). Explicit Files are not limited.
+	LimitPerDirectory int `json:"limitPerDirectory,omitempty"`
+
+	// SlowFileThreshold logs a warning with the path and duration of each epub whose scan takes at least this long, to
+	// find pathological books that slow down searches (0 disables the warning). Every scan duration is logged at debug level.
+	SlowFileThreshold time.Duration `json:"slowFileThreshold,omitempty"`
+
+	// Offset skips this many results, in SortBy order, before any are passed to the handler
+	Offset int `json:"offset,omitempty"`
+
+	// Limit is the maximum number of results passed to the handler (0 means no limit).
+	// Setting Offset or Limit buffers and sorts every result before delivery, so results are no longer streamed.
+	Limit int `json:"limit,omitempty"`
+
+	// MinMatches skips books with fewer matches than this, to leave out books that only mention the pattern in passing.
+	// Unlike Limit, which caps the number of results, it filters each book on its own (0 means no minimum).
+	MinMatches int `json:"minMatches,omitempty"`
+
+	// FirstMatchOnly reports only the first match of each book in reading order, with its full detail and context, for
+	// preview lists. Scanning stops at the first match, and the description is only searched when the content has no
+	// match. It is not supported with the "and" combine mode or a MinMatches above 1.
+	FirstMatchOnly bool `json:"firstMatchOnly,omitempty"`
+
+	// SortBy sorts the results before they are passed to the handler, which buffers every result like Offset and Limit.
+	// Results are streamed as they are found when it is empty, or ordered by path when paginating.
+	SortBy ResultSort `json:"sortBy,omitempty"`
+
+	// MatchHandler, when set, also receives each match as soon as the content file it was found in has been scanned,
+	// so a UI can render the matches of a large book incrementally. Files are scanned in reading order, the result of
+	// the book is still passed to the search handler afterwards, and the handler may be called concurrently for
+	// different books like the search handler. It is not supported with the "and" combine mode, Offset, Limit or MinMatches.
+	MatchHandler MatchHandler `json:"-"`
+}
+
+// ProgressEvent reports that a search has started processing an epub file.
+type ProgressEvent struct {
+	// Path is the path of the epub file being processed
+	Path string `json:"path"`
+
+	// Directory is the directory of the file relative to the search directory ("." for the search directory itself),
+	// so a UI can show which author or series folder of a hierarchical library is being processed
+	Directory string `json:"directory"`
+
+	// Started is the number of files started so far, including this one
+	Started int `json:"started"`
 }
 
 // Metadata represents the complete metadata extracted from an epub file.
@@ -65,7 +354,12 @@ type Metadata struct {
 	// Genres is the list of book genres.
 	Genres []string `json:"genres"`
 
+	// Description is the book's description or blurb, which may contain HTML.
+	Description string `json:"description,omitempty"`
+
 	// Series is the name of the book series, if applicable.
+	// It is read from calibre metadata, then EPUB3 collections, then a "series" meta, and as a last resort from a title
+	// such as "Series Name #3: Title".
 	Series string `json:"series"`
 
 	// SeriesPosition is the position within the series.
@@ -76,10 +370,29 @@ type Metadata struct {
 
 	// Identifiers contains book identifiers (ISBN, ASIN, DOI, etc.).
 	Identifiers map[string]string `json:"identifiers"`
+
+	// Language is the primary language of the book from dc:language, e.g. "en".
+	Language string `json:"language,omitempty"`
+
+	// DetectedLanguage is the ISO 639-1 code of the language guessed from the text of a book without a Language
+	// (if enabled), or empty when the text is not clearly in one of the detectable languages.
+	DetectedLanguage string `json:"detectedLanguage,omitempty"`
+
+	// Preview is the first 500 words of the text of the book in reading order, one line per paragraph (if enabled).
+	Preview string `json:"preview,omitempty"`
+
+	// Provenance maps field names (e.g. "series" or "identifiers.isbn") to the OPF source that filled them (if enabled).
+	Provenance map[string]string `json:"provenance,omitempty"`
 }
 
 // opfMeta represents a <meta> tag in the OPF file.
 type opfMeta struct {
+	// ID is the id attribute of the meta tag.
+	ID string `xml:"id,attr"`
+
+	// Refines is the refines attribute of the meta tag, pointing to the "#id" of the element it describes.
+	Refines string `xml:"refines,attr"`
+
 	// Name is the name attribute of the meta tag.
 	Name string `xml:"name,attr"`
 
@@ -111,25 +424,103 @@ type opfIdentifier struct {
 // opfPackageFile represents the package file (.opf) in an epub.
 type opfPackageFile struct {
 	// Metadata contains the metadata section of the OPF file.
-	Metadata struct {
-		// Title is the book title from the OPF metadata.
-		Title string `xml:"title"`
+	Metadata opfMetadata `xml:"metadata"`
 
-		// Creator is the list of creators (authors) from the OPF metadata.
-		Creator []string `xml:"creator"`
+	// Manifest is the list of files in the epub.
+	Manifest []opfManifestItem `xml:"manifest>item"`
 
-		// Subject is the list of subjects (genres) from the OPF metadata.
-		Subject []string `xml:"subject"`
+	// Spine defines the reading order of the epub.
+	Spine opfSpine `xml:"spine"`
 
-		// Date is the publication date from the OPF metadata.
-		Date string `xml:"date"`
+	// Guide is the list of EPUB2 guide references, which mark structural parts of the book such as the start of the text.
+	Guide []opfGuideReference `xml:"guide>reference"`
+}
 
-		// Identifier is the list of identifiers from the OPF metadata.
-		Identifier []opfIdentifier `xml:"identifier"`
+// opfGuideReference represents a <reference> in the EPUB2 guide of the OPF file.
+type opfGuideReference struct {
+	// Type is the kind of part referenced, e.g. "text" or "index".
+	Type string `xml:"type,attr"`
 
-		// Meta is the list of meta elements from the OPF metadata.
-		Meta []opfMeta `xml:"meta"`
-	} `xml:"metadata"`
+	// Href is the path to the file, relative to the OPF file.
+	Href string `xml:"href,attr"`
+}
+
+// opfMetadata represents the <metadata> section of the OPF file.
+type opfMetadata struct {
+	// Title is the book title from the OPF metadata.
+	Title string `xml:"title"`
+
+	// Creator is the list of creators (authors) from the OPF metadata.
+	Creator []string `xml:"creator"`
+
+	// Subject is the list of subjects (genres) from the OPF metadata.
+	Subject []string `xml:"subject"`
+
+	// Description is the book description from the OPF metadata.
+	Description string `xml:"description"`
+
+	// Date is the publication date from the OPF metadata.
+	Date string `xml:"date"`
+
+	// Language is the first language from the OPF metadata.
+	Language string `xml:"language"`
+
+	// Identifier is the list of identifiers from the OPF metadata.
+	Identifier []opfIdentifier `xml:"identifier"`
+
+	// Meta is the list of meta elements from the OPF metadata.
+	Meta []opfMeta `xml:"meta"`
+}
+
+// opfManifestItem represents an <item> in the OPF manifest.
+type opfManifestItem struct {
+	// ID is the identifier other elements use to refer to the item.
+	ID string `xml:"id,attr"`
+
+	// Href is the path to the file, relative to the OPF file.
+	Href string `xml:"href,attr"`
+
+	// MediaType is the media type of the file.
+	MediaType string `xml:"media-type,attr"`
+
+	// Properties is a space-separated list of EPUB3 item properties, e.g. "nav".
+	Properties string `xml:"properties,attr"`
+}
+
+// opfSpine represents the <spine> element in the OPF file.
+type opfSpine struct {
+	// Toc is the manifest ID of the EPUB2 NCX file.
+	Toc string `xml:"toc,attr"`
+
+	// ItemRefs is the list of manifest items in reading order.
+	ItemRefs []opfItemRef `xml:"itemref"`
+}
+
+// opfItemRef represents an <itemref> in the OPF spine.
+type opfItemRef struct {
+	// IDRef is the manifest ID of the item.
+	IDRef string `xml:"idref,attr"`
+}
+
+// ncxFile represents an EPUB2 toc.ncx file.
+type ncxFile struct {
+	// NavPoints is the list of top-level navigation points.
+	NavPoints []ncxNavPoint `xml:"navMap>navPoint"`
+}
+
+// ncxNavPoint represents a <navPoint> in the NCX navigation map.
+type ncxNavPoint struct {
+	// Label is the text of the navigation point.
+	Label string `xml:"navLabel>text"`
+
+	// Content contains the target of the navigation point.
+	Content struct {
+		// Src is the path to the target, relative to the NCX file.
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+
+	// Children is the list of nested navigation points.
+	Children []ncxNavPoint `xml:"navPoint"`
 }
 
 // containerXML represents the container.xml file in an epub.
@@ -147,6 +538,57 @@ type rootfile struct {
 	MediaType string `xml:"media-type,attr"`
 }
 
+// TOCEntry represents a single entry in the table of contents of an epub.
+type TOCEntry struct {
+	// The title of the entry.
+	Title string `json:"title"`
+
+	// The target of the entry relative to the archive root, including any fragment (empty for headings without a link).
+	Href string `json:"href,omitempty"`
+
+	// The nesting level of the entry, starting at 1 for top-level entries.
+	Level int `json:"level"`
+}
+
+// VerifyResult represents the integrity check result for a single epub file.
+type VerifyResult struct {
+	// Path to the epub file.
+	Path string `json:"path"`
+
+	// Whether the epub could be opened and its package file read.
+	OK bool `json:"ok"`
+
+	// A description of the problem (if the epub is corrupt).
+	Error string `json:"error,omitempty"`
+}
+
+// OccurrenceReport represents the number of occurrences of a query across a library.
+type OccurrenceReport struct {
+	// The total number of occurrences across every book.
+	Total int `json:"total"`
+
+	// The number of occurrences in each book with at least one, ordered by path.
+	Books []BookOccurrences `json:"books"`
+}
+
+// BookOccurrences represents the number of occurrences of a query in a single epub file.
+type BookOccurrences struct {
+	// Path to the epub file.
+	Path string `json:"path"`
+
+	// The number of occurrences in the epub file.
+	Occurrences int `json:"occurrences"`
+}
+
+// MatchPosition identifies a block or line of a book.
+type MatchPosition struct {
+	// The name of the file inside the epub.
+	FileName string `json:"fileName"`
+
+	// The 1-based index of the block within its file (0 if the file is not HTML).
+	ParagraphIndex int `json:"paragraphIndex,omitempty"`
+}
+
 // MatchMetadata represents extracted metadata from a single search result.
 type MatchMetadata struct {
 	// The name of the chapter (if found).
@@ -161,8 +603,41 @@ type Match struct {
 	// The name of the file inside the epub where the match was found.
 	FileName string `json:"fileName"`
 
+	// The original HTML of the blocks containing the match (if enabled and the file is HTML).
+	HTML string `json:"html,omitempty"`
+
+	// Line with HTML special characters escaped and every occurrence of the query wrapped in <mark> (if enabled).
+	MarkedHTML string `json:"markedHTML,omitempty"`
+
+	// The 1-based index of the block (paragraph, heading, list item, etc.) containing the match within its file (0 if the file is not HTML).
+	ParagraphIndex int `json:"paragraphIndex,omitempty"`
+
+	// The sub-queries that matched this line, identified by their pattern or text value (only set for queries with sub-queries).
+	Patterns []string `json:"patterns,omitempty"`
+
+	// The text of each capture group of a regex pattern in its first occurrence in Line, in group order, with "" for groups
+	// that did not participate (only set for patterns with capture groups).
+	Captures []string `json:"captures,omitempty"`
+
+	// The approximate position of the match through the content of the book in reading order, from 0 to 100 (if enabled).
+	Percentage float64 `json:"percentage,omitempty"`
+
+	// The media type of the file, e.g. "application/xhtml+xml", from the OPF manifest or guessed from the file extension
+	// when the manifest does not list it (if enabled).
+	MediaType string `json:"mediaType,omitempty"`
+
+	// Where a match in document mode ends, which may be in a later file than the one it starts in.
+	End *MatchPosition `json:"end,omitempty"`
+
 	// Optional metadata related to the match (if enabled and found).
 	Metadata *MatchMetadata `json:"metadata,omitempty"`
+
+	// offset is the byte offset of the match within its file, used to compute the percentage
+	offset int64
+
+	// hits holds the text of each line (or span of lines in phrase and document mode) the scanning pattern matched, as
+	// it was matched, so sub-queries are checked against it rather than against Line with its context and joiners
+	hits []string
 }
 
 // SearchResult represents the complete search result for a single epub file.
@@ -170,9 +645,39 @@ type SearchResult struct {
 	// Path to the epub file.
 	Path string `json:"path"`
 
-	// Metadata of the epub file.
-	Metadata `json:"metadata"`
+	// Metadata of the epub file (if extracted).
+	Metadata *Metadata `json:"metadata,omitempty"`
 
 	// A list of matches found in the epub file.
 	Matches []Match `json:"matches"`
+
+	// How many of the sub-queries of SearchRequest.Query matched in the epub file (0 without sub-queries).
+	DistinctPatternMatches int `json:"distinctPatternMatches,omitempty"`
+
+	// Size statistics for each scanned content file (if enabled).
+	EntryStats []EntryStats `json:"entryStats,omitempty"`
+
+	// A description of the content that could not be read (if content errors are reported).
+	ContentError string `json:"contentError,omitempty"`
+
+	// Whether scanning stopped at SearchRequest.MaxBytesPerEpub or an HTML limit, so some matches may be missing.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Whether any scanned text was repaired before matching (see SearchRequest.RepairText).
+	Repaired bool `json:"repaired,omitempty"`
+}
+
+// EntryStats represents size statistics for a single content file inside an epub.
+type EntryStats struct {
+	// The name of the file inside the epub.
+	FileName string `json:"fileName"`
+
+	// The compressed size of the file in bytes.
+	CompressedSize uint64 `json:"compressedSize"`
+
+	// The uncompressed size of the file in bytes.
+	UncompressedSize uint64 `json:"uncompressedSize"`
+
+	// The uncompressed size divided by the compressed size (0 when the compressed size is unknown).
+	CompressionRatio float64 `json:"compressionRatio"`
 }
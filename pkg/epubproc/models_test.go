@@ -0,0 +1,59 @@
+package epubproc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestSearchResultJSON verifies that metadata is only serialized when it was extracted.
+func TestSearchResultJSON(t *testing.T) {
+	t.Run("WithoutMetadata", func(t *testing.T) {
+		result := SearchResult{
+			Path:    "/books/book.epub",
+			Matches: []Match{{Line: "Holmes", FileName: "chapter1.html"}},
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			t.Fatalf("Failed to marshal result: %v", err)
+		}
+
+		if strings.Contains(string(data), `"metadata"`) {
+			t.Errorf("Expected no metadata in JSON, got %s", data)
+		}
+		if strings.Contains(string(data), `"title"`) {
+			t.Errorf("Expected metadata fields not to be flattened into the result, got %s", data)
+		}
+	})
+
+	t.Run("WithMetadata", func(t *testing.T) {
+		result := SearchResult{
+			Path:     "/books/book.epub",
+			Metadata: &Metadata{Title: "A Study in Scarlet", Authors: []string{"Arthur Conan Doyle"}},
+			Matches:  []Match{{Line: "Holmes", FileName: "chapter1.html"}},
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			t.Fatalf("Failed to marshal result: %v", err)
+		}
+
+		var decoded map[string]json.RawMessage
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Failed to unmarshal result: %v", err)
+		}
+
+		if _, ok := decoded["title"]; ok {
+			t.Errorf("Expected metadata to be nested, got %s", data)
+		}
+
+		var metadata Metadata
+		if err := json.Unmarshal(decoded["metadata"], &metadata); err != nil {
+			t.Fatalf("Failed to unmarshal metadata: %v", err)
+		}
+		if metadata.Title != "A Study in Scarlet" {
+			t.Errorf("Expected title 'A Study in Scarlet', got '%s'", metadata.Title)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package epubproc
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// CountOccurrences counts every occurrence of a query across the books a search finds, rather than the matching lines.
+// Context, pagination, HTML capture, the options that drop matching lines (FirstMatchOnly and DedupeLines), matching
+// against the description and metadata, and MatchHandler in the request are ignored, and fuzzy queries are not supported.
+func CountOccurrences(ctx context.Context, search FileSearch, request *SearchRequest) (*OccurrenceReport, error) {
+	query, err := compileQuery(request.Query, request.PhraseMode)
+	if err != nil {
+		return nil, err
+	}
+
+	indexer, ok := query.pattern.(phraseMatcher)
+	if !ok {
+		return nil, fmt.Errorf("occurrence counting is not supported with fuzzy matching")
+	}
+
+	// each match must hold exactly the lines that matched, so occurrences in context lines are not counted, and every
+	// matching line of the content must be kept, so no occurrence is dropped and none is counted outside the text
+	countRequest := *request
+	countRequest.Context = 0
+	countRequest.ContextJoiner = ""
+	countRequest.IncludeHTML = false
+	countRequest.Highlight = false
+	countRequest.Offset = 0
+	countRequest.Limit = 0
+	countRequest.FirstMatchOnly = false
+	countRequest.DedupeLines = false
+	countRequest.SearchDescription = false
+	countRequest.SearchMetadata = false
+	countRequest.MatchHandler = nil
+
+	report := &OccurrenceReport{Books: []BookOccurrences{}}
+	var mu sync.Mutex
+
+	if err := search.Search(ctx, &countRequest, func(result *SearchResult) error {
+		var count int
+		for _, match := range result.Matches {
+			count += countMatchOccurrences(indexer, match.Line, request.PhraseMode)
+		}
+		if count == 0 {
+			return nil
+		}
+
+		mu.Lock()
+		report.Books = append(report.Books, BookOccurrences{Path: result.Path, Occurrences: count})
+		report.Total += count
+		mu.Unlock()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(report.Books, func(a, b BookOccurrences) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return report, nil
+}
+
+// countMatchOccurrences counts the occurrences of a pattern in the line of a match.
+// In phrase mode the lines of a match are whitespace-collapsed first, as they were when matched.
+func countMatchOccurrences(indexer phraseMatcher, line string, phraseMode bool) int {
+	if phraseMode {
+		line = strings.Join(strings.Fields(line), " ")
+	}
+	return len(indexer.FindAllStringIndex(line, -1))
+}
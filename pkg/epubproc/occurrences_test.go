@@ -0,0 +1,141 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// TestCountOccurrences tests counting every occurrence of a query across books
+func TestCountOccurrences(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "occurrences_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{
+		"book1.epub": "<p>The cat sat with another cat.</p><p>No felines here.</p><p>A cat again.</p>",
+		"book2.epub": "<p>Cat, cat and CAT.</p>",
+		"book3.epub": "<p>Only dogs.</p>",
+		"book4.epub": "<p>A dog and a cat.</p><p>A dog and a cat.</p><p>A dog and a cat.</p>",
+	}
+	for name, content := range books {
+		if _, err := createTestEPUB(tempDir, name, content); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	search := NewFileSearch(tempDir, 2, false)
+
+	tests := []struct {
+		name     string
+		request  *SearchRequest
+		expected []BookOccurrences
+	}{
+		{
+			name:    "CaseSensitive",
+			request: &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "cat"}}},
+			expected: []BookOccurrences{
+				{Path: filepath.Join(tempDir, "book1.epub"), Occurrences: 3},
+				{Path: filepath.Join(tempDir, "book2.epub"), Occurrences: 1},
+				{Path: filepath.Join(tempDir, "book4.epub"), Occurrences: 3},
+			},
+		},
+		{
+			name:    "IgnoreCase",
+			request: &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "cat", IgnoreCase: true}}},
+			expected: []BookOccurrences{
+				{Path: filepath.Join(tempDir, "book1.epub"), Occurrences: 3},
+				{Path: filepath.Join(tempDir, "book2.epub"), Occurrences: 3},
+				{Path: filepath.Join(tempDir, "book4.epub"), Occurrences: 3},
+			},
+		},
+		{
+			name:    "ContextLinesNotCounted",
+			request: &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "cat"}}, Context: 2, Limit: 1},
+			expected: []BookOccurrences{
+				{Path: filepath.Join(tempDir, "book1.epub"), Occurrences: 3},
+				{Path: filepath.Join(tempDir, "book2.epub"), Occurrences: 1},
+				{Path: filepath.Join(tempDir, "book4.epub"), Occurrences: 3},
+			},
+		},
+		{
+			name:    "FirstMatchOnlyIgnored",
+			request: &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "cat"}}, FirstMatchOnly: true},
+			expected: []BookOccurrences{
+				{Path: filepath.Join(tempDir, "book1.epub"), Occurrences: 3},
+				{Path: filepath.Join(tempDir, "book2.epub"), Occurrences: 1},
+				{Path: filepath.Join(tempDir, "book4.epub"), Occurrences: 3},
+			},
+		},
+		{
+			name:    "DedupeLinesIgnored",
+			request: &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "cat"}}, DedupeLines: true},
+			expected: []BookOccurrences{
+				{Path: filepath.Join(tempDir, "book1.epub"), Occurrences: 3},
+				{Path: filepath.Join(tempDir, "book2.epub"), Occurrences: 1},
+				{Path: filepath.Join(tempDir, "book4.epub"), Occurrences: 3},
+			},
+		},
+		{
+			// the title of every test book is "Test Book", which must not count as an occurrence in the text
+			name:     "SearchMetadataIgnored",
+			request:  &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "Book"}}, SearchMetadata: true},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := CountOccurrences(context.Background(), search, tt.request)
+			if err != nil {
+				t.Fatalf("CountOccurrences failed: %v", err)
+			}
+
+			if !slices.Equal(report.Books, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, report.Books)
+			}
+
+			var total int
+			for _, book := range tt.expected {
+				total += book.Occurrences
+			}
+			if report.Total != total {
+				t.Errorf("Expected total %d, got %d", total, report.Total)
+			}
+		})
+	}
+
+	t.Run("MatchHandlerIgnored", func(t *testing.T) {
+		var calls atomic.Int64
+		request := &SearchRequest{
+			Query: SearchRequestQuery{Text: &SearchRequestText{Value: "cat"}},
+			MatchHandler: func(string, Match) error {
+				calls.Add(1)
+				return nil
+			},
+		}
+
+		report, err := CountOccurrences(context.Background(), search, request)
+		if err != nil {
+			t.Fatalf("CountOccurrences failed: %v", err)
+		}
+		if report.Total != 7 {
+			t.Errorf("Expected total 7, got %d", report.Total)
+		}
+		if calls.Load() != 0 {
+			t.Errorf("Expected the match handler not to be called, got %d calls", calls.Load())
+		}
+	})
+
+	t.Run("FuzzyUnsupported", func(t *testing.T) {
+		request := &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "cat", Fuzzy: &FuzzyConfig{MaxDistance: 1}}}}
+		if _, err := CountOccurrences(context.Background(), search, request); err == nil {
+			t.Error("Expected an error for a fuzzy query")
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package epubproc
+
+import (
+	"archive/zip"
+	"context"
+	"strings"
+)
+
+// previewWords is the number of words of text kept in Metadata.Preview, enough for the title page and the start of the
+// first chapter.
+const previewWords = 500
+
+// previewText returns up to limit words of the text of the content files of an epub in reading order (archive order
+// without a readable spine), one line per block, skipping the files that are not part of the text such as the table of
+// contents. The cover and title pages are kept.
+func previewText(ctx context.Context, r *zip.Reader, limit int) (string, error) {
+	preview := &previewBuilder{limit: limit}
+	if preview.full() {
+		return "", nil
+	}
+	if err := walkContentText(ctx, r, []SkipCategory{SkipCover}, preview.add); err != nil {
+		return "", err
+	}
+	return strings.Join(preview.lines, "\n"), nil
+}
+
+// previewBuilder collects the lines of a preview until it holds limit words.
+type previewBuilder struct {
+	lines []string
+	words int
+	limit int
+}
+
+// add appends the words of a line, cutting the line short when it would exceed the limit, and reports whether more
+// words are wanted.
+func (b *previewBuilder) add(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return !b.full()
+	}
+	if remaining := b.limit - b.words; len(fields) > remaining {
+		fields = fields[:remaining]
+	}
+
+	b.lines = append(b.lines, strings.Join(fields, " "))
+	b.words += len(fields)
+	return !b.full()
+}
+
+// full reports whether the preview holds the words it was limited to.
+func (b *previewBuilder) full() bool {
+	return b.words >= b.limit
+}
@@ -0,0 +1,74 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPreview tests extracting the metadata and the first words of the text of a book in reading order in one pass
+func TestPreview(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "preview_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opf := `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>A Study in Scarlet</dc:title><dc:creator>Arthur Conan Doyle</dc:creator></metadata>
+  <manifest>
+    <item id="title" href="titlepage.xhtml" media-type="application/xhtml+xml"/>
+    <item id="one" href="chapter1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="two" href="chapter2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="title"/><itemref idref="one"/><itemref idref="two"/></spine>
+</package>`
+
+	// chapter 2 comes first in the archive, but after the preview limit in reading order
+	path := filepath.Join(tempDir, "book.epub")
+	err = createOrderedTestZIP(path, [][2]string{
+		{"META-INF/container.xml", tocContainerXML},
+		{"OEBPS/content.opf", opf},
+		{"OEBPS/chapter2.xhtml", "<p>Lauriston Gardens.</p>"},
+		{"OEBPS/toc.xhtml", "<p>Contents</p>"},
+		{"OEBPS/titlepage.xhtml", "<h1>A Study in Scarlet</h1>"},
+		{"OEBPS/chapter1.xhtml", "<h1>Mr. Sherlock Holmes</h1><p>" + strings.Repeat("word ", 600) + "</p>"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	metadata, err := NewMetadataExtractor(1, WithPreview()).ProcessFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	if metadata.Title != "A Study in Scarlet" || len(metadata.Authors) != 1 {
+		t.Errorf("Expected the title and author, got %q and %v", metadata.Title, metadata.Authors)
+	}
+	if metadata.Preview == "" {
+		t.Fatal("Expected a preview")
+	}
+	if expected := "A Study in Scarlet\nMr. Sherlock Holmes\nword word"; !strings.HasPrefix(metadata.Preview, expected) {
+		t.Errorf("Expected the preview to start with %q, got %q", expected, metadata.Preview[:min(len(metadata.Preview), 60)])
+	}
+	if words := len(strings.Fields(metadata.Preview)); words != previewWords {
+		t.Errorf("Expected %d words, got %d", previewWords, words)
+	}
+	if strings.Contains(metadata.Preview, "Contents") || strings.Contains(metadata.Preview, "Lauriston") {
+		t.Errorf("Expected no table of contents or later chapters in the preview, got %q", metadata.Preview)
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		metadata, err := NewMetadataExtractor(1).ProcessFile(context.Background(), path)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		if metadata.Preview != "" {
+			t.Errorf("Expected no preview, got %q", metadata.Preview)
+		}
+	})
+}
@@ -74,5 +74,22 @@ func (rc *regexCache) get(pattern string) (*regexp.Regexp, error) {
 	return re, nil
 }
 
+// clear removes every compiled regex from the cache.
+func (rc *regexCache) clear() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	clear(rc.cache)
+	clear(rc.accesses)
+}
+
+// len returns the number of compiled regexes in the cache.
+func (rc *regexCache) len() int {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	return len(rc.cache)
+}
+
 // Global regex cache with reasonable size limit
 var patternCache = newRegexCache(128)
@@ -1,6 +1,8 @@
 package epubproc
 
 import (
+	"context"
+	"os"
 	"sync"
 	"testing"
 )
@@ -134,3 +136,55 @@ func TestRegexCacheConcurrency(t *testing.T) {
 		}
 	}
 }
+
+// TestRegexCacheClear verifies that clearing the cache removes every pattern.
+func TestRegexCacheClear(t *testing.T) {
+	cache := newRegexCache(5)
+
+	for _, pattern := range []string{"one", "two", "three"} {
+		if _, err := cache.get(pattern); err != nil {
+			t.Fatalf("Failed to get pattern: %v", err)
+		}
+	}
+	if cache.len() != 3 {
+		t.Fatalf("Expected 3 cached patterns, got %d", cache.len())
+	}
+
+	cache.clear()
+	if cache.len() != 0 {
+		t.Errorf("Expected an empty cache, got %d patterns", cache.len())
+	}
+	if len(cache.accesses) != 0 {
+		t.Errorf("Expected no access counts, got %d", len(cache.accesses))
+	}
+
+	// the cache is still usable after clearing
+	if _, err := cache.get("one"); err != nil || cache.len() != 1 {
+		t.Errorf("Expected the cache to work after clearing, got %d patterns and error %v", cache.len(), err)
+	}
+}
+
+// TestFileSearchReset verifies that resetting a FileSearch empties the pattern cache.
+func TestFileSearchReset(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "reset_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	search := NewFileSearch(tempDir, 1, false)
+	request := &SearchRequest{
+		Query: SearchRequestQuery{Text: &SearchRequestText{Value: "reset test pattern"}},
+	}
+	if err := search.Search(context.Background(), request, func(result *SearchResult) error { return nil }); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if patternCache.len() == 0 {
+		t.Fatal("Expected the search to cache its pattern")
+	}
+
+	search.Reset()
+	if patternCache.len() != 0 {
+		t.Errorf("Expected an empty pattern cache after reset, got %d patterns", patternCache.len())
+	}
+}
@@ -0,0 +1,53 @@
+package epubproc
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+)
+
+// SearchByBook runs a search and returns its results keyed by a stable book identifier, to merge them with an
+// external catalog. A book is keyed by its ISBN, normalized without hyphens or spaces, or else by its path. Books
+// without metadata (when the search does not extract it) are keyed by path, as is every book sharing an ISBN with
+// a book whose path sorts before it.
+func SearchByBook(ctx context.Context, search FileSearch, request *SearchRequest) (map[string]*SearchResult, error) {
+	var mu sync.Mutex
+	var results []*SearchResult
+
+	err := search.Search(ctx, request, func(result *SearchResult) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// results are handled in any order, so sort them to assign duplicated ISBNs the same way in every search
+	slices.SortFunc(results, func(a, b *SearchResult) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+
+	byBook := make(map[string]*SearchResult, len(results))
+	for _, result := range results {
+		key := bookKey(result)
+		if _, ok := byBook[key]; ok {
+			key = result.Path
+		}
+		byBook[key] = result
+	}
+	return byBook, nil
+}
+
+// bookKey returns the ISBN of the book of a result, or its path if it has none.
+func bookKey(result *SearchResult) string {
+	if result.Metadata != nil {
+		if isbn := normalizeIdentifierValue("isbn", result.Metadata.Identifiers["isbn"], true); isbn != "" {
+			return isbn
+		}
+	}
+	return result.Path
+}
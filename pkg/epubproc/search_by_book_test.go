@@ -0,0 +1,76 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSearchByBook tests keying search results by ISBN, with a fallback to the path
+func TestSearchByBook(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "search_by_book_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]TestEPUBMetadata{
+		"isbn.epub":      {Title: "With ISBN", Identifiers: map[string]string{"ISBN": "978-0-14-043908-9"}},
+		"duplicate.epub": {Title: "Same ISBN", Identifiers: map[string]string{"isbn": "9780140439089"}},
+		"asin.epub":      {Title: "Only ASIN", Identifiers: map[string]string{"ASIN": "B000FC0PDA"}},
+	}
+	for name, metadata := range books {
+		if _, err := createTestEPUBWithMetadata(tempDir, name, metadata); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	request := func() *SearchRequest {
+		return &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "Test content"}}}
+	}
+
+	t.Run("KeyedByISBN", func(t *testing.T) {
+		results, err := SearchByBook(context.Background(), NewFileSearch(tempDir, 2, true), request())
+		if err != nil {
+			t.Fatalf("SearchByBook failed: %v", err)
+		}
+
+		// duplicate.epub sorts before isbn.epub, so it keeps the ISBN key
+		expected := map[string]string{
+			"9780140439089":                     "Same ISBN",
+			filepath.Join(tempDir, "isbn.epub"): "With ISBN",
+			filepath.Join(tempDir, "asin.epub"): "Only ASIN",
+		}
+		if len(results) != len(expected) {
+			t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+		}
+		for key, title := range expected {
+			result, ok := results[key]
+			if !ok {
+				t.Errorf("Expected a result keyed by %s", key)
+				continue
+			}
+			if result.Metadata.Title != title {
+				t.Errorf("Expected '%s' keyed by %s, got '%s'", title, key, result.Metadata.Title)
+			}
+		}
+	})
+
+	t.Run("PathFallbackWithoutMetadata", func(t *testing.T) {
+		results, err := SearchByBook(context.Background(), NewFileSearch(tempDir, 2, false), request())
+		if err != nil {
+			t.Fatalf("SearchByBook failed: %v", err)
+		}
+
+		if len(results) != len(books) {
+			t.Fatalf("Expected %d results, got %d", len(books), len(results))
+		}
+		for name := range books {
+			path := filepath.Join(tempDir, name)
+			if result, ok := results[path]; !ok || result.Path != path {
+				t.Errorf("Expected a result keyed by %s", path)
+			}
+		}
+	})
+}
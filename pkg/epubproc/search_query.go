@@ -0,0 +1,453 @@
+package epubproc
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// lineMatcher reports whether a line of content matches a query; *regexp.Regexp satisfies it.
+type lineMatcher interface {
+	MatchString(s string) bool
+}
+
+// phraseMatcher is a line matcher that can also locate its matches, which phrase mode needs to map them back to lines.
+type phraseMatcher interface {
+	lineMatcher
+	FindAllStringIndex(s string, n int) [][]int
+}
+
+// anyMatcher matches a line when any of its matchers does.
+type anyMatcher []lineMatcher
+
+// MatchString reports whether any of the matchers match the line.
+func (m anyMatcher) MatchString(s string) bool {
+	for _, matcher := range m {
+		if matcher.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// compiledQuery holds the compiled form of a search query.
+type compiledQuery struct {
+	// pattern is used to scan content and matches anything any part of the query matches
+	pattern lineMatcher
+
+	// subPatterns contains the compiled sub-queries (if any), in request order
+	subPatterns []lineMatcher
+
+	// subLabels identifies each sub-query in matches, in request order
+	subLabels []string
+
+	// combine defines how the sub-queries are combined
+	combine QueryCombine
+
+	// phraseMode controls whether matches are found across whitespace-collapsed document text instead of per line
+	phraseMode bool
+}
+
+// compileQuery builds and compiles the matchers for a search query.
+func compileQuery(query SearchRequestQuery, phraseMode bool) (*compiledQuery, error) {
+	pattern, err := compileMatcher(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := pattern.(phraseMatcher); phraseMode && !ok {
+		return nil, fmt.Errorf("phrase mode is not supported with fuzzy matching")
+	}
+
+	compiled := &compiledQuery{
+		pattern:    pattern,
+		combine:    query.Combine,
+		phraseMode: phraseMode,
+	}
+
+	if compiled.combine == "" {
+		compiled.combine = CombineOr
+	}
+
+	for _, subQuery := range query.SubQueries {
+		subPattern, err := compileMatcher(subQuery)
+		if err != nil {
+			return nil, err
+		}
+		compiled.subPatterns = append(compiled.subPatterns, subPattern)
+		compiled.subLabels = append(compiled.subLabels, queryLabel(subQuery))
+	}
+
+	return compiled, nil
+}
+
+// documentPattern returns the pattern of a compiled query for document mode, where "." also matches the newlines that
+// join the lines of a book.
+func (q *compiledQuery) documentPattern() (lineMatcher, error) {
+	if q.phraseMode {
+		return nil, fmt.Errorf("document mode cannot be combined with phrase mode")
+	}
+
+	re, ok := q.pattern.(*regexp.Regexp)
+	if !ok {
+		return nil, fmt.Errorf("document mode is not supported with fuzzy matching")
+	}
+
+	pattern, err := patternCache.get("(?s)" + re.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %w", re.String(), err)
+	}
+	return pattern, nil
+}
+
+// compileMatcher compiles a search query into a line matcher.
+// Queries are compiled into a single regex unless part of them uses fuzzy matching.
+func compileMatcher(query SearchRequestQuery) (lineMatcher, error) {
+	if !usesFuzzy(query) {
+		pattern, err := buildPattern(query)
+		if err != nil {
+			return nil, err
+		}
+
+		patternRegex, err := patternCache.get(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		return patternRegex, nil
+	}
+
+	if len(query.SubQueries) > 0 {
+		if err := validateCombine(query.Combine); err != nil {
+			return nil, err
+		}
+
+		matchers := make(anyMatcher, 0, len(query.SubQueries))
+		for _, subQuery := range query.SubQueries {
+			matcher, err := compileMatcher(subQuery)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, matcher)
+		}
+		return matchers, nil
+	}
+
+	return newFuzzyMatcher(query.Text)
+}
+
+// ExplainQuery returns the effective pattern a query is matched with, for debugging searches that match nothing.
+// Regex and text queries are shown as the compiled regex, and fuzzy text queries as fuzzy("value", maxDistance=N).
+func ExplainQuery(query SearchRequestQuery) (string, error) {
+	if !usesFuzzy(query) {
+		pattern, err := buildPattern(query)
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := patternCache.get(pattern); err != nil {
+			return "", fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		return pattern, nil
+	}
+
+	if len(query.SubQueries) > 0 {
+		if err := validateCombine(query.Combine); err != nil {
+			return "", err
+		}
+
+		explained := make([]string, 0, len(query.SubQueries))
+		for _, subQuery := range query.SubQueries {
+			subExplained, err := ExplainQuery(subQuery)
+			if err != nil {
+				return "", err
+			}
+			explained = append(explained, "(?:"+subExplained+")")
+		}
+		return strings.Join(explained, "|"), nil
+	}
+
+	explained := fmt.Sprintf("fuzzy(%q, maxDistance=%d)", query.Text.Value, query.Text.Fuzzy.MaxDistance)
+	if query.Text.IgnoreCase {
+		explained = "(?i)" + explained
+	}
+	return explained, nil
+}
+
+// usesFuzzy checks if a query or any of its sub-queries uses fuzzy text matching.
+func usesFuzzy(query SearchRequestQuery) bool {
+	if len(query.SubQueries) > 0 {
+		return slices.ContainsFunc(query.SubQueries, usesFuzzy)
+	}
+	return !query.IsRegex && query.Text != nil && query.Text.Fuzzy != nil
+}
+
+// validateCombine checks that a combine mode is supported.
+func validateCombine(combine QueryCombine) error {
+	switch combine {
+	case "", CombineOr, CombineAnd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported combine mode '%s'", combine)
+	}
+}
+
+// buildPattern converts a search query into a regex pattern string.
+func buildPattern(query SearchRequestQuery) (string, error) {
+	if len(query.SubQueries) > 0 {
+		if err := validateCombine(query.Combine); err != nil {
+			return "", err
+		}
+
+		// scan for any of the sub-queries, each one keeps its own flags inside its group
+		subPatterns := make([]string, 0, len(query.SubQueries))
+		for _, subQuery := range query.SubQueries {
+			subPattern, err := buildPattern(subQuery)
+			if err != nil {
+				return "", err
+			}
+			subPatterns = append(subPatterns, "(?:"+subPattern+")")
+		}
+		return strings.Join(subPatterns, "|"), nil
+	}
+
+	if query.IsRegex {
+		if query.Regex == nil {
+			return "", fmt.Errorf("regex configuration is required when IsRegex is true")
+		}
+
+		return query.Regex.Pattern, nil
+	}
+
+	if query.Text == nil {
+		return "", fmt.Errorf("text configuration is required when IsRegex is false")
+	}
+
+	pattern := regexp.QuoteMeta(query.Text.Value)
+	if query.Text.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return pattern, nil
+}
+
+// queryLabel describes a query by its pattern or text value, so matches can be attributed to it.
+func queryLabel(query SearchRequestQuery) string {
+	if len(query.SubQueries) > 0 {
+		separator := " OR "
+		if query.Combine == CombineAnd {
+			separator = " AND "
+		}
+
+		labels := make([]string, 0, len(query.SubQueries))
+		for _, subQuery := range query.SubQueries {
+			labels = append(labels, queryLabel(subQuery))
+		}
+		return "(" + strings.Join(labels, separator) + ")"
+	}
+
+	if query.IsRegex && query.Regex != nil {
+		return query.Regex.Pattern
+	}
+	if query.Text != nil {
+		return query.Text.Value
+	}
+	return ""
+}
+
+// matchingSubPatterns reports which sub-queries match the hits of a match, i.e. the lines the scanning pattern matched
+// without their context lines and joiners, falling back to its line for matches without recorded hits.
+func (q *compiledQuery) matchingSubPatterns(match *Match) []bool {
+	hits := match.hits
+	if hits == nil {
+		hits = []string{match.Line}
+	}
+
+	found := make([]bool, len(q.subPatterns))
+	for _, hit := range hits {
+		if q.phraseMode {
+			// phrase matches may span lines, so compare them the way they were found
+			hit = strings.Join(strings.Fields(hit), " ")
+		}
+
+		for i, subPattern := range q.subPatterns {
+			if !found[i] && subPattern.MatchString(hit) {
+				found[i] = true
+			}
+		}
+	}
+	return found
+}
+
+// tagMatches records which sub-queries matched the lines of each match.
+func (q *compiledQuery) tagMatches(matches []Match) {
+	if len(q.subPatterns) == 0 {
+		return
+	}
+
+	for i := range matches {
+		for idx, found := range q.matchingSubPatterns(&matches[i]) {
+			if found {
+				matches[i].Patterns = append(matches[i].Patterns, q.subLabels[idx])
+			}
+		}
+	}
+}
+
+// distinctPatterns returns how many sub-queries matched at least one of the tagged matches, or 0 for queries without
+// sub-queries.
+func (q *compiledQuery) distinctPatterns(matches []Match) int {
+	seen := make(map[string]bool, len(q.subLabels))
+	for i := range matches {
+		for _, label := range matches[i].Patterns {
+			seen[label] = true
+		}
+	}
+	return len(seen)
+}
+
+// captureMatches records the capture groups of the first occurrence of the scanning pattern in the line of each match.
+// Patterns without capture groups, and fuzzy ones, are skipped so matches are not scanned again for nothing.
+func (q *compiledQuery) captureMatches(matches []Match) {
+	re, ok := q.pattern.(*regexp.Regexp)
+	if !ok || re.NumSubexp() == 0 {
+		return
+	}
+
+	for i := range matches {
+		line := matches[i].Line
+		if q.phraseMode {
+			// phrase matches may span lines, so capture them the way they were found
+			line = strings.Join(strings.Fields(line), " ")
+		}
+
+		if submatches := re.FindStringSubmatch(line); submatches != nil {
+			matches[i].Captures = submatches[1:]
+		}
+	}
+}
+
+// matchesCombined checks if the matches found in a book satisfy the combine mode of the query.
+func (q *compiledQuery) matchesCombined(matches []Match) bool {
+	if q.combine != CombineAnd || len(matches) == 0 {
+		// any match of the scanning pattern already satisfies an OR query
+		return len(matches) > 0
+	}
+
+	// every line matching a sub-query is reported, so checking the matched lines covers the whole book
+	found := make([]bool, len(q.subPatterns))
+	for i := range matches {
+		for idx, matched := range q.matchingSubPatterns(&matches[i]) {
+			found[idx] = found[idx] || matched
+		}
+	}
+
+	return !slices.Contains(found, false)
+}
+
+// highlightMatches wraps every occurrence of the scanning pattern in the line of each match with the start and end markers.
+func (q *compiledQuery) highlightMatches(matches []Match, start, end string) {
+	indexer, ok := q.pattern.(phraseMatcher)
+	if !ok {
+		return
+	}
+
+	for i := range matches {
+		matches[i].Line = highlightLine(indexer, matches[i].Line, start, end, q.phraseMode)
+	}
+}
+
+// markMatches sets the MarkedHTML of each match to its line with HTML special characters escaped and every
+// occurrence of the query wrapped in <mark>.
+func (q *compiledQuery) markMatches(matches []Match) {
+	indexer, ok := q.pattern.(phraseMatcher)
+	if !ok {
+		return
+	}
+
+	for i := range matches {
+		matches[i].MarkedHTML = wrapOccurrences(indexer, matches[i].Line, "<mark>", "</mark>", q.phraseMode, html.EscapeString)
+	}
+}
+
+// highlightLine wraps every non-empty occurrence of a pattern in a line with the start and end markers.
+// In phrase mode occurrences are found in the whitespace-collapsed line, as they were when matched, and mapped back to the line.
+func highlightLine(indexer phraseMatcher, line, start, end string, phraseMode bool) string {
+	return wrapOccurrences(indexer, line, start, end, phraseMode, nil)
+}
+
+// wrapOccurrences wraps every non-empty occurrence of a pattern in a line with the start and end markers like
+// highlightLine, passing the text of the line through escape, when set, while the markers are written as they are.
+func wrapOccurrences(indexer phraseMatcher, line, start, end string, phraseMode bool, escape func(string) string) string {
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+	text := line
+
+	// spans holds the start and end offsets in line of each byte of text, when text is collapsed
+	var spans [][2]int
+	if phraseMode {
+		text, spans = collapseWhitespace(line)
+	}
+
+	var highlighted strings.Builder
+	last := 0
+	for _, loc := range indexer.FindAllStringIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+
+		from, to := loc[0], loc[1]
+		if spans != nil {
+			from, to = spans[from][0], spans[to-1][1]
+		}
+
+		highlighted.WriteString(escape(line[last:from]))
+		highlighted.WriteString(start)
+		highlighted.WriteString(escape(line[from:to]))
+		highlighted.WriteString(end)
+		last = to
+	}
+	if last == 0 {
+		return escape(line)
+	}
+
+	highlighted.WriteString(escape(line[last:]))
+	return highlighted.String()
+}
+
+// collapseWhitespace collapses whitespace runs in s into single spaces and trims it, like strings.Fields,
+// returning the start and end offsets in s of the character each byte of the result came from.
+func collapseWhitespace(s string) (string, [][2]int) {
+	var collapsed strings.Builder
+	spans := make([][2]int, 0, len(s))
+
+	// space holds the offsets of the first character of a pending whitespace run, if any
+	var space *[2]int
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		if unicode.IsSpace(r) {
+			if space == nil && collapsed.Len() > 0 {
+				space = &[2]int{i, i + size}
+			}
+			i += size
+			continue
+		}
+
+		if space != nil {
+			collapsed.WriteByte(' ')
+			spans = append(spans, *space)
+			space = nil
+		}
+		collapsed.WriteString(s[i : i+size])
+		for range size {
+			spans = append(spans, [2]int{i, i + size})
+		}
+		i += size
+	}
+
+	return collapsed.String(), spans
+}
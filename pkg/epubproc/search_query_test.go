@@ -0,0 +1,561 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestBuildPattern tests conversion of queries into regex patterns
+func TestBuildPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    SearchRequestQuery
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "Text",
+			query:    SearchRequestQuery{Text: &SearchRequestText{Value: "a.b"}},
+			expected: `a\.b`,
+		},
+		{
+			name:     "TextIgnoreCase",
+			query:    SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes", IgnoreCase: true}},
+			expected: `(?i)Holmes`,
+		},
+		{
+			name:     "Regex",
+			query:    SearchRequestQuery{IsRegex: true, Regex: &SearchRequestRegex{Pattern: `Wat.on`}},
+			expected: `Wat.on`,
+		},
+		{
+			name: "SubQueries",
+			query: SearchRequestQuery{
+				SubQueries: []SearchRequestQuery{
+					{Text: &SearchRequestText{Value: "Baker St.", IgnoreCase: true}},
+					{IsRegex: true, Regex: &SearchRequestRegex{Pattern: `22[0-9]B`}},
+				},
+				Combine: CombineAnd,
+			},
+			expected: `(?:(?i)Baker St\.)|(?:22[0-9]B)`,
+		},
+		{
+			name: "InvalidCombine",
+			query: SearchRequestQuery{
+				SubQueries: []SearchRequestQuery{{Text: &SearchRequestText{Value: "a"}}},
+				Combine:    "xor",
+			},
+			wantErr: "unsupported combine mode",
+		},
+		{
+			name: "InvalidSubQuery",
+			query: SearchRequestQuery{
+				SubQueries: []SearchRequestQuery{{IsRegex: true}},
+			},
+			wantErr: "regex configuration is required",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pattern, err := buildPattern(test.query)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("Expected error containing %q, got: %v", test.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("buildPattern failed: %v", err)
+			}
+			if pattern != test.expected {
+				t.Errorf("Expected pattern %q, got %q", test.expected, pattern)
+			}
+		})
+	}
+}
+
+// TestExplainQuery tests describing the effective pattern of a query
+func TestExplainQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    SearchRequestQuery
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "TextIgnoreCase",
+			query:    SearchRequestQuery{Text: &SearchRequestText{Value: "Mr. Holmes?", IgnoreCase: true}},
+			expected: `(?i)Mr\. Holmes\?`,
+		},
+		{
+			name:     "Regex",
+			query:    SearchRequestQuery{IsRegex: true, Regex: &SearchRequestRegex{Pattern: `\bWat.on\b`}},
+			expected: `\bWat.on\b`,
+		},
+		{
+			name: "FuzzySubQuery",
+			query: SearchRequestQuery{
+				SubQueries: []SearchRequestQuery{
+					{Text: &SearchRequestText{Value: "Holmes", IgnoreCase: true, Fuzzy: &FuzzyConfig{MaxDistance: 1}}},
+					{Text: &SearchRequestText{Value: "Watson"}},
+				},
+			},
+			expected: `(?:(?i)fuzzy("Holmes", maxDistance=1))|(?:Watson)`,
+		},
+		{
+			name:    "InvalidRegex",
+			query:   SearchRequestQuery{IsRegex: true, Regex: &SearchRequestRegex{Pattern: `(unclosed`}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			explained, err := ExplainQuery(tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got pattern '%s'", explained)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExplainQuery failed: %v", err)
+			}
+			if explained != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, explained)
+			}
+		})
+	}
+}
+
+// TestSearchSubQueries tests searching with a literal and a regex sub-query combined by AND and OR
+func TestSearchSubQueries(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sub_query_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{
+		"both.epub":    "<p>Holmes lived on Baker Street.</p><p>The address was 221B.</p>",
+		"literal.epub": "<p>Holmes was a detective.</p>",
+		"regex.epub":   "<p>The flat was number 221B.</p>",
+		"none.epub":    "<p>Nothing relevant here.</p>",
+	}
+	for name, content := range books {
+		if _, err := createTestEPUB(tempDir, name, content); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	subQueries := []SearchRequestQuery{
+		{Text: &SearchRequestText{Value: "holmes", IgnoreCase: true}},
+		{IsRegex: true, Regex: &SearchRequestRegex{Pattern: `\d{3}B`}},
+	}
+
+	tests := []struct {
+		name     string
+		combine  QueryCombine
+		expected []string
+	}{
+		{name: "And", combine: CombineAnd, expected: []string{"both.epub"}},
+		{name: "Or", combine: CombineOr, expected: []string{"both.epub", "literal.epub", "regex.epub"}},
+		{name: "DefaultIsOr", combine: "", expected: []string{"both.epub", "literal.epub", "regex.epub"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := &SearchRequest{
+				Query: SearchRequestQuery{
+					SubQueries: subQueries,
+					Combine:    test.combine,
+				},
+			}
+
+			var found []string
+			var mu sync.Mutex
+			err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+				mu.Lock()
+				defer mu.Unlock()
+				found = append(found, strings.TrimPrefix(result.Path, tempDir+string(os.PathSeparator)))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+
+			sort.Strings(found)
+			if strings.Join(found, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("Expected results %v, got %v", test.expected, found)
+			}
+		})
+	}
+}
+
+// TestSearchSubQueriesWithContext tests that the AND combine mode is evaluated on the matched lines, not on the context
+// windows joined around them
+func TestSearchSubQueriesWithContext(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sub_query_context_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	books := map[string]string{
+		"anchored.epub": "<p>Intro text.</p><p>Holmes met Watson.</p>",
+		"joiner.epub":   "<p>Holmes alone.</p><p>Later that day.</p>",
+	}
+	for name, content := range books {
+		if _, err := createTestEPUB(tempDir, name, content); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		subQueries []SearchRequestQuery
+		joiner     string
+		expected   []string
+	}{
+		{
+			// the matched line starts with Holmes, while the window starts with its leading context line
+			name: "AnchoredSubQuery",
+			subQueries: []SearchRequestQuery{
+				{IsRegex: true, Regex: &SearchRequestRegex{Pattern: `^Holmes`}},
+				{Text: &SearchRequestText{Value: "Watson"}},
+			},
+			expected: []string{"anchored.epub"},
+		},
+		{
+			// the joiner is not part of the text, so it cannot satisfy a sub-query
+			name: "JoinerText",
+			subQueries: []SearchRequestQuery{
+				{Text: &SearchRequestText{Value: "Holmes"}},
+				{Text: &SearchRequestText{Value: "--"}},
+			},
+			joiner:   " -- ",
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := &SearchRequest{
+				Query:         SearchRequestQuery{SubQueries: test.subQueries, Combine: CombineAnd},
+				Context:       1,
+				ContextJoiner: test.joiner,
+			}
+
+			var found []string
+			var mu sync.Mutex
+			err := NewFileSearch(tempDir, 2, false).Search(context.Background(), request, func(result *SearchResult) error {
+				mu.Lock()
+				defer mu.Unlock()
+				found = append(found, strings.TrimPrefix(result.Path, tempDir+string(os.PathSeparator)))
+
+				for _, match := range result.Matches {
+					if len(match.Patterns) != len(test.subQueries) {
+						t.Errorf("Expected every sub-query to tag %q, got %v", match.Line, match.Patterns)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+
+			sort.Strings(found)
+			if strings.Join(found, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("Expected results %v, got %v", test.expected, found)
+			}
+		})
+	}
+}
+
+// TestTagMatches tests attributing matches to the sub-queries that matched them
+func TestTagMatches(t *testing.T) {
+	query, err := compileQuery(SearchRequestQuery{
+		SubQueries: []SearchRequestQuery{
+			{Text: &SearchRequestText{Value: "holmes", IgnoreCase: true}},
+			{IsRegex: true, Regex: &SearchRequestRegex{Pattern: `\d{3}B`}},
+		},
+	}, false)
+	if err != nil {
+		t.Fatalf("compileQuery failed: %v", err)
+	}
+
+	matches := []Match{
+		{Line: "Holmes lived at 221B."},
+		{Line: "Holmes was a detective."},
+		{Line: "The flat was 221B."},
+	}
+	query.tagMatches(matches)
+
+	expected := [][]string{
+		{"holmes", `\d{3}B`},
+		{"holmes"},
+		{`\d{3}B`},
+	}
+	for i, match := range matches {
+		if strings.Join(match.Patterns, ",") != strings.Join(expected[i], ",") {
+			t.Errorf("Match %d: expected patterns %v, got %v", i, expected[i], match.Patterns)
+		}
+	}
+
+	// queries without sub-queries are not tagged
+	single, err := compileQuery(SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}}, false)
+	if err != nil {
+		t.Fatalf("compileQuery failed: %v", err)
+	}
+
+	untagged := []Match{{Line: "Holmes"}}
+	single.tagMatches(untagged)
+	if untagged[0].Patterns != nil {
+		t.Errorf("Expected no patterns, got %v", untagged[0].Patterns)
+	}
+}
+
+// TestCaptureMatches tests recording the capture groups of the pattern in each match
+func TestCaptureMatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		line       string
+		phraseMode bool
+		expected   []string
+	}{
+		{name: "Numbered", pattern: `Chapter (\d+)`, line: "Chapter 12 and Chapter 13", expected: []string{"12"}},
+		{name: "Named", pattern: `(?P<street>\d+)(?P<flat>[A-Z]) Baker`, line: "He lived at 221B Baker Street", expected: []string{"221", "B"}},
+		{name: "NonParticipating", pattern: `(Holmes)|(Watson)`, line: "Dr. Watson", expected: []string{"", "Watson"}},
+		{name: "NonCapturing", pattern: `(?:Sherlock) Holmes`, line: "Sherlock Holmes", expected: nil},
+		{name: "NoGroups", pattern: `Holmes`, line: "Holmes", expected: nil},
+		{name: "PhraseAcrossLines", pattern: `Sherlock (\w+)`, line: "said Sherlock\nHolmes", phraseMode: true, expected: []string{"Holmes"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := &compiledQuery{pattern: regexp.MustCompile(test.pattern), phraseMode: test.phraseMode}
+			matches := []Match{{Line: test.line}}
+			query.captureMatches(matches)
+
+			if !slices.Equal(matches[0].Captures, test.expected) {
+				t.Errorf("Expected captures %q, got %q", test.expected, matches[0].Captures)
+			}
+		})
+	}
+}
+
+// TestSearchCaptures tests that a search reports the capture groups of the unhighlighted line
+func TestSearchCaptures(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "captures_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "book.epub", "<h2>Case 7</h2><p>Holmes returns.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	request := &SearchRequest{
+		Query:     SearchRequestQuery{IsRegex: true, Regex: &SearchRequestRegex{Pattern: `Case (?P<number>\d+)`}},
+		Highlight: true,
+	}
+
+	var captures [][]string
+	err = NewFileSearch(tempDir, 1, false).Search(context.Background(), request, func(result *SearchResult) error {
+		for _, match := range result.Matches {
+			captures = append(captures, match.Captures)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	if len(captures) != 1 || !slices.Equal(captures[0], []string{"7"}) {
+		t.Errorf("Expected captures [[7]], got %q", captures)
+	}
+}
+
+// TestHighlightLine tests wrapping every occurrence of a pattern in markers
+func TestHighlightLine(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		line       string
+		phraseMode bool
+		expected   string
+	}{
+		{name: "Single", pattern: "Holmes", line: "Mr. Holmes said", expected: "Mr. [Holmes] said"},
+		{name: "Multiple", pattern: "o", line: "Holmes and Watson", expected: "H[o]lmes and Wats[o]n"},
+		{name: "Alternation", pattern: "Holmes|Watson", line: "Holmes and Watson", expected: "[Holmes] and [Watson]"},
+		{name: "NoMatch", pattern: "Moriarty", line: "Holmes and Watson", expected: "Holmes and Watson"},
+		{name: "EmptyMatchesSkipped", pattern: "x*", line: "Holmes", expected: "Holmes"},
+		{name: "Unicode", pattern: "café", line: "a café — the café", expected: "a [café] — the [café]"},
+		{name: "PhraseAcrossLines", pattern: "Sherlock Holmes", line: "said Sherlock\nHolmes, and Sherlock  Holmes", phraseMode: true, expected: "said [Sherlock\nHolmes], and [Sherlock  Holmes]"},
+		{name: "PhraseLeadingSpace", pattern: "a b", line: "  a\tb ", phraseMode: true, expected: "  [a\tb] "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := highlightLine(regexp.MustCompile(test.pattern), test.line, "[", "]", test.phraseMode)
+			if got != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+// TestSearchHighlight tests highlighting matches during a search, with default and custom markers
+func TestSearchHighlight(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "highlight_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "book.epub", "<p>Holmes met holmes.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	search := func(t *testing.T, request *SearchRequest) (string, error) {
+		var lines []string
+		err := NewFileSearch(tempDir, 1, false).Search(context.Background(), request, func(result *SearchResult) error {
+			for _, match := range result.Matches {
+				lines = append(lines, match.Line)
+			}
+			return nil
+		})
+		return strings.Join(lines, "|"), err
+	}
+
+	query := SearchRequestQuery{Text: &SearchRequestText{Value: "holmes", IgnoreCase: true}}
+
+	t.Run("DefaultMarkers", func(t *testing.T) {
+		line, err := search(t, &SearchRequest{Query: query, Highlight: true})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		expected := "\x02Holmes\x03 met \x02holmes\x03."
+		if line != expected {
+			t.Errorf("Expected %q, got %q", expected, line)
+		}
+	})
+
+	t.Run("CustomMarkers", func(t *testing.T) {
+		line, err := search(t, &SearchRequest{Query: query, Highlight: true, HighlightStart: "«", HighlightEnd: "»"})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		expected := "«Holmes» met «holmes»."
+		if line != expected {
+			t.Errorf("Expected %q, got %q", expected, line)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		line, err := search(t, &SearchRequest{Query: query, HighlightStart: "«", HighlightEnd: "»"})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if line != "Holmes met holmes." {
+			t.Errorf("Expected no markers, got %q", line)
+		}
+	})
+
+	t.Run("FuzzyUnsupported", func(t *testing.T) {
+		fuzzy := SearchRequestQuery{Text: &SearchRequestText{Value: "holmes", Fuzzy: &FuzzyConfig{MaxDistance: 1}}}
+		if _, err := search(t, &SearchRequest{Query: fuzzy, Highlight: true}); err == nil {
+			t.Error("Expected an error for fuzzy highlighting")
+		}
+	})
+}
+
+// TestSearchMarkHTML tests escaping matched lines as HTML with every occurrence wrapped in <mark>
+func TestSearchMarkHTML(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "mark_html_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := createTestEPUB(tempDir, "book.epub", "<p>If a &lt; b then Holmes &amp; Watson's <b>holmes</b> wins.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	search := func(t *testing.T, request *SearchRequest) ([]Match, error) {
+		var matches []Match
+		err := NewFileSearch(tempDir, 1, false).Search(context.Background(), request, func(result *SearchResult) error {
+			matches = append(matches, result.Matches...)
+			return nil
+		})
+		return matches, err
+	}
+
+	query := SearchRequestQuery{Text: &SearchRequestText{Value: "holmes", IgnoreCase: true}}
+
+	t.Run("Marked", func(t *testing.T) {
+		matches, err := search(t, &SearchRequest{Query: query, MarkHTML: true})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match, got %d", len(matches))
+		}
+
+		expected := "If a &lt; b then <mark>Holmes</mark> &amp; Watson&#39;s <mark>holmes</mark> wins."
+		if matches[0].MarkedHTML != expected {
+			t.Errorf("Expected %q, got %q", expected, matches[0].MarkedHTML)
+		}
+		if matches[0].Line != "If a < b then Holmes & Watson's holmes wins." {
+			t.Errorf("Expected the line to be left unescaped, got %q", matches[0].Line)
+		}
+	})
+
+	t.Run("MarkedBeforeHighlight", func(t *testing.T) {
+		matches, err := search(t, &SearchRequest{Query: query, MarkHTML: true, Highlight: true, HighlightStart: "<", HighlightEnd: ">"})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(matches) != 1 || strings.Contains(matches[0].MarkedHTML, "&lt;Holmes") {
+			t.Errorf("Expected the highlight markers to be left out of the marked HTML, got %+v", matches)
+		}
+	})
+
+	t.Run("MatchedSpanEscaped", func(t *testing.T) {
+		special := SearchRequestQuery{Text: &SearchRequestText{Value: "a < b"}}
+		matches, err := search(t, &SearchRequest{Query: special, MarkHTML: true})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(matches) != 1 || !strings.HasPrefix(matches[0].MarkedHTML, "If <mark>a &lt; b</mark> then") {
+			t.Errorf("Expected the marked span to be escaped, got %+v", matches)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		matches, err := search(t, &SearchRequest{Query: query})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(matches) != 1 || matches[0].MarkedHTML != "" {
+			t.Errorf("Expected no marked HTML, got %+v", matches)
+		}
+	})
+
+	t.Run("FuzzyUnsupported", func(t *testing.T) {
+		fuzzy := SearchRequestQuery{Text: &SearchRequestText{Value: "holmes", Fuzzy: &FuzzyConfig{MaxDistance: 1}}}
+		if _, err := search(t, &SearchRequest{Query: fuzzy, MarkHTML: true}); err == nil {
+			t.Error("Expected an error for fuzzy marking")
+		}
+	})
+}
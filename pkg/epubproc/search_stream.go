@@ -0,0 +1,52 @@
+package epubproc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// SearchNDJSON runs a search in the background and streams its results as newline-delimited JSON, one SearchResult
+// per line in the order they are found. The reader returns the error of a failed search once the results found before
+// it were read, and io.EOF after a successful one. Closing the reader cancels the search.
+func SearchNDJSON(ctx context.Context, search FileSearch, request *SearchRequest) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer cancel()
+
+		// results may be handled concurrently, while each line must be written in one piece
+		var mu sync.Mutex
+		encoder := json.NewEncoder(pw)
+
+		err := search.Search(ctx, request, func(result *SearchResult) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err := encoder.Encode(result); err != nil {
+				return fmt.Errorf("failed to write result: %w", err)
+			}
+			return nil
+		})
+
+		// a nil error closes the stream with io.EOF
+		pw.CloseWithError(err)
+	}()
+
+	return &searchStream{PipeReader: pr, cancel: cancel}
+}
+
+// searchStream is the reader of a streamed search, which cancels the search when closed.
+type searchStream struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+// Close cancels the search and closes the reader, so pending and later reads fail with io.ErrClosedPipe.
+func (s *searchStream) Close() error {
+	s.cancel()
+	return s.PipeReader.Close()
+}
@@ -0,0 +1,89 @@
+package epubproc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSearchNDJSON tests streaming search results as newline-delimited JSON
+func TestSearchNDJSON(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "search_stream_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for i := range 5 {
+		if _, err := createTestEPUB(tempDir, fmt.Sprintf("book%d.epub", i), "<p>Holmes and Watson.</p>"); err != nil {
+			t.Fatalf("Failed to create test ePUB: %v", err)
+		}
+	}
+	if _, err := createTestEPUB(tempDir, "other.epub", "<p>Only Watson.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	search := NewFileSearch(tempDir, 2, false)
+	request := func() *SearchRequest {
+		return &SearchRequest{Query: SearchRequestQuery{Text: &SearchRequestText{Value: "Holmes"}}}
+	}
+
+	t.Run("Results", func(t *testing.T) {
+		stream := SearchNDJSON(context.Background(), search, request())
+		defer stream.Close()
+
+		count := 0
+		scanner := bufio.NewScanner(stream)
+		for scanner.Scan() {
+			var result SearchResult
+			if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to parse line %q: %v", scanner.Text(), err)
+			}
+			if len(result.Matches) != 1 || result.Matches[0].Line != "Holmes and Watson." {
+				t.Errorf("Expected a single match in %s, got %+v", result.Path, result.Matches)
+			}
+			count++
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatalf("Failed to read stream: %v", err)
+		}
+
+		if count != 5 {
+			t.Errorf("Expected 5 results, got %d", count)
+		}
+	})
+
+	t.Run("SearchError", func(t *testing.T) {
+		invalid := request()
+		invalid.Limit = -1
+
+		stream := SearchNDJSON(context.Background(), search, invalid)
+		defer stream.Close()
+
+		if _, err := io.ReadAll(stream); err == nil || !strings.Contains(err.Error(), "invalid limit") {
+			t.Errorf("Expected the search error from the stream, got %v", err)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		stream := SearchNDJSON(context.Background(), search, request())
+
+		// read the first line only, leaving the search blocked on the next result
+		if _, err := bufio.NewReader(stream).ReadString('\n'); err != nil {
+			t.Fatalf("Failed to read first result: %v", err)
+		}
+		if err := stream.Close(); err != nil {
+			t.Fatalf("Failed to close stream: %v", err)
+		}
+
+		if _, err := stream.Read(make([]byte, 1)); !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("Expected io.ErrClosedPipe after closing, got %v", err)
+		}
+	})
+}
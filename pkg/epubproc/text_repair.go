@@ -0,0 +1,56 @@
+package epubproc
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// mojibakeMarkers are the characters that UTF-8 lead bytes turn into when UTF-8 text is decoded as Windows-1252,
+// e.g. "é" read as "Ã©" or "’" read as "â€™"
+const mojibakeMarkers = "ÃÂâ"
+
+// repairText fixes a line that is not valid UTF-8 or looks like double-encoded UTF-8, reporting whether it changed.
+// Bytes that are not valid UTF-8 are assumed to be Windows-1252 (a superset of the Latin-1 most legacy epubs use) and
+// decoded as such one by one, keeping the valid UTF-8 around them, while valid text is only re-encoded when every
+// character fits Windows-1252 and the result is valid UTF-8, so genuine accented text is left alone.
+func repairText(line string) (string, bool) {
+	if !utf8.ValidString(line) {
+		var decoded strings.Builder
+		decoded.Grow(len(line) + 8)
+		for i := 0; i < len(line); {
+			r, size := utf8.DecodeRuneInString(line[i:])
+			if r == utf8.RuneError && size == 1 {
+				decoded.WriteRune(charmap.Windows1252.DecodeByte(line[i]))
+			} else {
+				decoded.WriteString(line[i : i+size])
+			}
+			i += size
+		}
+		return decoded.String(), true
+	}
+
+	if !strings.ContainsAny(line, mojibakeMarkers) {
+		return line, false
+	}
+
+	encoded, err := charmap.Windows1252.NewEncoder().String(line)
+	if err != nil || encoded == line || !utf8.ValidString(encoded) {
+		return line, false
+	}
+	return encoded, true
+}
+
+// repair applies repairText to a scanned line when repairing is enabled, counting the repaired lines.
+func (o scanOptions) repair(line string) string {
+	if !o.repairText {
+		return line
+	}
+
+	repaired, changed := repairText(line)
+	if changed && o.repairedLines != nil {
+		*o.repairedLines++
+	}
+	return repaired
+}
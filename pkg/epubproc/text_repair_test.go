@@ -0,0 +1,98 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRepairText tests decoding invalid UTF-8 and undoing double-encoded UTF-8 while leaving valid text alone
+func TestRepairText(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+		changed  bool
+	}{
+		{name: "Latin1", line: "caf\xe9 au lait", expected: "café au lait", changed: true},
+		{name: "Windows1252Quotes", line: "\x93quoted\x94", expected: "“quoted”", changed: true},
+		{name: "MixedWithValidUTF8", line: "café \x92s", expected: "café ’s", changed: true},
+		{name: "Mojibake", line: "cafÃ© au lait", expected: "café au lait", changed: true},
+		{name: "MojibakeQuote", line: "Holmesâ€™ pipe", expected: "Holmes’ pipe", changed: true},
+		{name: "ASCII", line: "plain text", expected: "plain text", changed: false},
+		{name: "Accented", line: "café au lait", expected: "café au lait", changed: false},
+		{name: "GenuineCapitals", line: "Âge Ãtre", expected: "Âge Ãtre", changed: false},
+		{name: "OutsideWindows1252", line: "Ã© → ok", expected: "Ã© → ok", changed: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, changed := repairText(test.line)
+			if got != test.expected || changed != test.changed {
+				t.Errorf("Expected %q (changed %v), got %q (changed %v)", test.expected, test.changed, got, changed)
+			}
+		})
+	}
+}
+
+// TestSearchRepairText tests matching a chapter with invalid UTF-8 only once its text is repaired
+func TestSearchRepairText(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "repair_text_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// a Latin-1 chapter mislabelled as UTF-8, and a chapter with double-encoded UTF-8
+	if _, err := createTestEPUB(tempDir, "latin1.epub", "<p>Watson ordered a caf\xe9 noir.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+	if _, err := createTestEPUB(tempDir, "mojibake.epub", "<p>Holmes ordered a cafÃ© noir.</p>"); err != nil {
+		t.Fatalf("Failed to create test ePUB: %v", err)
+	}
+
+	search := func(repair bool) []*SearchResult {
+		request := &SearchRequest{
+			Query:      SearchRequestQuery{Text: &SearchRequestText{Value: "café noir"}},
+			RepairText: repair,
+		}
+
+		var results []*SearchResult
+		err := NewFileSearch(tempDir, 1, false).Search(context.Background(), request, func(result *SearchResult) error {
+			results = append(results, result)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return results
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		if results := search(false); len(results) != 0 {
+			t.Errorf("Expected 0 results, got %d", len(results))
+		}
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		results := search(true)
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 results, got %d", len(results))
+		}
+
+		expected := map[string]string{
+			"latin1.epub":   "Watson ordered a café noir.",
+			"mojibake.epub": "Holmes ordered a café noir.",
+		}
+		for _, result := range results {
+			if !result.Repaired {
+				t.Errorf("Expected %s to be marked repaired", result.Path)
+			}
+			name := filepath.Base(result.Path)
+			if len(result.Matches) != 1 || result.Matches[0].Line != expected[name] {
+				t.Errorf("Expected match %q in %s, got %+v", expected[name], name, result.Matches)
+			}
+		}
+	})
+}
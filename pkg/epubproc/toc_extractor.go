@@ -0,0 +1,292 @@
+package epubproc
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/html"
+)
+
+// ExtractTOC extracts the table of contents of an epub, from the EPUB3 nav document or the EPUB2 toc.ncx.
+func ExtractTOC(ctx context.Context, epubPath string) ([]TOCEntry, error) {
+	r, err := zip.OpenReader(epubPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open epub '%s': %w", epubPath, err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			log.Warn().Err(err).Str("epub", epubPath).Msg("failed to close epub reader")
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	opfPath, opfData, err := readPackage(&r.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package in epub '%s': %w", epubPath, err)
+	}
+
+	navPath, isNCX := findNavPath(opfPath, opfData)
+	if navPath == "" {
+		return nil, fmt.Errorf("no table of contents found in epub '%s'", epubPath)
+	}
+
+	navFile := findZipFile(&r.Reader, navPath)
+	if navFile == nil {
+		return nil, fmt.Errorf("table of contents '%s' not found in epub '%s'", navPath, epubPath)
+	}
+
+	rc, err := navFile.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open table of contents '%s' in epub '%s': %w", navPath, epubPath, err)
+	}
+	defer func() {
+		if err := rc.Close(); err != nil {
+			log.Warn().Err(err).Str("file", navPath).Msg("failed to close table of contents")
+		}
+	}()
+
+	var entries []TOCEntry
+	if isNCX {
+		entries, err = parseNCX(rc, navPath)
+	} else {
+		entries, err = parseNavDocument(rc, navPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse table of contents '%s' in epub '%s': %w", navPath, epubPath, err)
+	}
+
+	return entries, nil
+}
+
+// readPackage locates and decodes the OPF package file of an epub.
+func readPackage(r *zip.Reader) (string, *opfPackageFile, error) {
+	opfPath, err := findOpfPath(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !isSafeArchivePath(opfPath) {
+		return "", nil, fmt.Errorf("opf path '%s' escapes the archive root", opfPath)
+	}
+
+	opfFile := findZipFile(r, opfPath)
+	if opfFile == nil {
+		return "", nil, fmt.Errorf("opf file '%s' not found", opfPath)
+	}
+
+	rc, err := opfFile.Open()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open opf file '%s': %w", opfPath, err)
+	}
+	defer func() {
+		if err := rc.Close(); err != nil {
+			log.Warn().Err(err).Str("file", opfPath).Msg("failed to close opf file")
+		}
+	}()
+
+	var opfData opfPackageFile
+	if err := newLenientXMLDecoder(rc).Decode(&opfData); err != nil {
+		return "", nil, fmt.Errorf("failed to parse opf file '%s': %w", opfPath, err)
+	}
+
+	return opfPath, &opfData, nil
+}
+
+// findZipFile finds a file in a zip archive by its exact name.
+func findZipFile(r *zip.Reader, name string) *zip.File {
+	for _, f := range r.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// findNavPath finds the archive path of the navigation file, preferring the EPUB3 nav document over the NCX.
+func findNavPath(opfPath string, opfData *opfPackageFile) (string, bool) {
+	opfDir := path.Dir(opfPath)
+
+	for _, item := range opfData.Manifest {
+		if containsField(item.Properties, "nav") {
+			return resolveHref(opfDir, item.Href), false
+		}
+	}
+
+	for _, item := range opfData.Manifest {
+		if item.ID == opfData.Spine.Toc || item.MediaType == "application/x-dtbncx+xml" {
+			return resolveHref(opfDir, item.Href), true
+		}
+	}
+
+	return "", false
+}
+
+// containsField checks if a space-separated list contains a value.
+func containsField(list, value string) bool {
+	for _, field := range strings.Fields(list) {
+		if field == value {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveHref resolves an href relative to a directory inside the archive, keeping any fragment.
+func resolveHref(dir, href string) string {
+	if href == "" || strings.HasPrefix(href, "#") {
+		return href
+	}
+
+	target, fragment, hasFragment := strings.Cut(href, "#")
+	resolved := path.Join(dir, target)
+	if hasFragment {
+		resolved += "#" + fragment
+	}
+	return resolved
+}
+
+// parseNCX parses the navigation map of an EPUB2 toc.ncx file.
+func parseNCX(r io.Reader, ncxPath string) ([]TOCEntry, error) {
+	var ncx ncxFile
+	if err := newLenientXMLDecoder(r).Decode(&ncx); err != nil {
+		return nil, err
+	}
+
+	ncxDir := path.Dir(ncxPath)
+	var entries []TOCEntry
+
+	var addPoints func(points []ncxNavPoint, level int)
+	addPoints = func(points []ncxNavPoint, level int) {
+		for _, point := range points {
+			entries = append(entries, TOCEntry{
+				Title: strings.Join(strings.Fields(point.Label), " "),
+				Href:  resolveHref(ncxDir, point.Content.Src),
+				Level: level,
+			})
+			addPoints(point.Children, level+1)
+		}
+	}
+	addPoints(ncx.NavPoints, 1)
+
+	return entries, nil
+}
+
+// parseNavDocument parses the "toc" nav element of an EPUB3 navigation document.
+func parseNavDocument(r io.Reader, navPath string) ([]TOCEntry, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	nav := findTOCNav(doc)
+	if nav == nil {
+		return nil, fmt.Errorf("no nav element found")
+	}
+
+	navDir := path.Dir(navPath)
+	var entries []TOCEntry
+
+	// addList adds the entries of an <ol> and its nested lists
+	var addList func(list *html.Node, level int)
+	addList = func(list *html.Node, level int) {
+		for li := list.FirstChild; li != nil; li = li.NextSibling {
+			if li.Type != html.ElementNode || li.Data != "li" {
+				continue
+			}
+
+			for child := li.FirstChild; child != nil; child = child.NextSibling {
+				if child.Type != html.ElementNode {
+					continue
+				}
+
+				switch child.Data {
+				case "a", "span":
+					entries = append(entries, TOCEntry{
+						Title: strings.Join(strings.Fields(nodeText(child)), " "),
+						Href:  resolveHref(navDir, nodeAttr(child, "href")),
+						Level: level,
+					})
+				case "ol":
+					addList(child, level+1)
+				}
+			}
+		}
+	}
+
+	for child := nav.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.Data == "ol" {
+			addList(child, 1)
+		}
+	}
+
+	return entries, nil
+}
+
+// findTOCNav finds the nav element with epub:type "toc", falling back to the first nav element.
+func findTOCNav(doc *html.Node) *html.Node {
+	var first, toc *html.Node
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if toc != nil {
+			return
+		}
+
+		if n.Type == html.ElementNode && n.Data == "nav" {
+			if first == nil {
+				first = n
+			}
+			if containsField(nodeAttr(n, "epub:type"), "toc") {
+				toc = n
+				return
+			}
+		}
+
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	if toc != nil {
+		return toc
+	}
+	return first
+}
+
+// nodeAttr returns the value of an attribute of an HTML node.
+func nodeAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// nodeText returns the text content of an HTML node and its descendants.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteString(" ")
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	return b.String()
+}
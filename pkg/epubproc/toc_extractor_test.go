@@ -0,0 +1,141 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const tocContainerXML = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+func TestExtractTOC(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "toc_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	expected := []TOCEntry{
+		{Title: "Part One", Href: "OEBPS/text/part1.html", Level: 1},
+		{Title: "Chapter 1", Href: "OEBPS/text/chapter1.html#start", Level: 2},
+		{Title: "Chapter 2", Href: "OEBPS/text/chapter2.html", Level: 2},
+		{Title: "Epilogue", Href: "OEBPS/text/epilogue.html", Level: 1},
+	}
+
+	t.Run("NCX", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "ncx.epub")
+		err := createTestZIPWithFiles(epubPath, map[string]string{
+			"META-INF/container.xml": tocContainerXML,
+			"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>NCX Book</dc:title></metadata>
+  <manifest>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="part1" href="text/part1.html" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine toc="ncx"><itemref idref="part1"/></spine>
+</package>`,
+			"OEBPS/toc.ncx": `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <navMap>
+    <navPoint id="p1" playOrder="1">
+      <navLabel><text>Part One</text></navLabel>
+      <content src="text/part1.html"/>
+      <navPoint id="c1" playOrder="2">
+        <navLabel><text>Chapter 1</text></navLabel>
+        <content src="text/chapter1.html#start"/>
+      </navPoint>
+      <navPoint id="c2" playOrder="3">
+        <navLabel><text>Chapter 2</text></navLabel>
+        <content src="text/chapter2.html"/>
+      </navPoint>
+    </navPoint>
+    <navPoint id="e" playOrder="4">
+      <navLabel><text>Epilogue</text></navLabel>
+      <content src="text/epilogue.html"/>
+    </navPoint>
+  </navMap>
+</ncx>`,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test epub: %v", err)
+		}
+
+		entries, err := ExtractTOC(context.Background(), epubPath)
+		if err != nil {
+			t.Fatalf("ExtractTOC failed: %v", err)
+		}
+		if !slices.Equal(entries, expected) {
+			t.Errorf("Expected %v, got %v", expected, entries)
+		}
+	})
+
+	t.Run("NavDocument", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "nav.epub")
+		err := createTestZIPWithFiles(epubPath, map[string]string{
+			"META-INF/container.xml": tocContainerXML,
+			"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Nav Book</dc:title></metadata>
+  <manifest>
+    <item id="nav" href="text/nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="part1" href="text/part1.html" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="part1"/></spine>
+</package>`,
+			"OEBPS/text/nav.xhtml": `<?xml version="1.0"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<body>
+  <nav epub:type="landmarks"><ol><li><a href="cover.html">Cover</a></li></ol></nav>
+  <nav epub:type="toc">
+    <h1>Contents</h1>
+    <ol>
+      <li><a href="part1.html">Part One</a>
+        <ol>
+          <li><a href="chapter1.html#start">Chapter
+            1</a></li>
+          <li><a href="chapter2.html">Chapter 2</a></li>
+        </ol>
+      </li>
+      <li><a href="epilogue.html">Epilogue</a></li>
+    </ol>
+  </nav>
+</body>
+</html>`,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test epub: %v", err)
+		}
+
+		entries, err := ExtractTOC(context.Background(), epubPath)
+		if err != nil {
+			t.Fatalf("ExtractTOC failed: %v", err)
+		}
+		if !slices.Equal(entries, expected) {
+			t.Errorf("Expected %v, got %v", expected, entries)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		epubPath := filepath.Join(tempDir, "missing.epub")
+		err := createTestZIPWithFiles(epubPath, map[string]string{
+			"META-INF/container.xml": tocContainerXML,
+			"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0"><manifest/><spine/></package>`,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create test epub: %v", err)
+		}
+
+		if _, err := ExtractTOC(context.Background(), epubPath); err == nil {
+			t.Error("Expected an error for an epub without a table of contents, got nil")
+		}
+	})
+}
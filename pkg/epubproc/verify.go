@@ -0,0 +1,48 @@
+package epubproc
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// VerifyHandler defines a handler function for verify results.
+type VerifyHandler func(result *VerifyResult) error
+
+// VerifyEpub checks that an epub can be opened and that its OPF package file can be located and parsed, without reading its content.
+func VerifyEpub(epubPath string) error {
+	r, err := openEpub(epubPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := closeZipReader(r); err != nil {
+			log.Warn().Err(err).Str("epub", epubPath).Msg("failed to close epub reader")
+		}
+	}()
+
+	if _, _, err := readPackage(&r.Reader); err != nil {
+		return fmt.Errorf("failed to read package in epub '%s': %w", epubPath, err)
+	}
+
+	return nil
+}
+
+// VerifyDirectory verifies every epub file in a directory tree, streaming a result for each file via a handler function.
+func VerifyDirectory(ctx context.Context, epubDir string, handler VerifyHandler) error {
+	return walkEpubFiles(os.DirFS(epubDir), epubDir, walkOptions{}, func(path string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		result := &VerifyResult{Path: path, OK: true}
+		if err := VerifyEpub(path); err != nil {
+			result.OK = false
+			result.Error = err.Error()
+		}
+
+		return handler(result)
+	})
+}
@@ -0,0 +1,68 @@
+package epubproc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestVerifyDirectory tests verifying a mix of valid and corrupt epubs
+func TestVerifyDirectory(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "verify_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	validPath, err := createTestEPUB(tempDir, "valid.epub", "<p>Some content</p>")
+	if err != nil {
+		t.Fatalf("Failed to create test epub: %v", err)
+	}
+
+	notZipPath := filepath.Join(tempDir, "not-zip.epub")
+	if err := os.WriteFile(notZipPath, []byte("this is not a zip archive"), 0o644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	noContainerPath := filepath.Join(tempDir, "no-container.epub")
+	if err := createTestZIPWithFiles(noContainerPath, map[string]string{
+		"OEBPS/chapter1.html": "<p>Some content</p>",
+	}); err != nil {
+		t.Fatalf("Failed to create test zip: %v", err)
+	}
+
+	missingOpfPath := filepath.Join(tempDir, "missing-opf.epub")
+	if err := createTestZIPWithFiles(missingOpfPath, map[string]string{
+		"META-INF/container.xml": tocContainerXML,
+	}); err != nil {
+		t.Fatalf("Failed to create test zip: %v", err)
+	}
+
+	results := make(map[string]*VerifyResult)
+	err = VerifyDirectory(context.Background(), tempDir, func(result *VerifyResult) error {
+		results[result.Path] = result
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("VerifyDirectory failed: %v", err)
+	}
+
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+
+	if result := results[validPath]; !result.OK || result.Error != "" {
+		t.Errorf("Expected valid epub to be ok, got %+v", result)
+	}
+
+	for _, path := range []string{notZipPath, noContainerPath, missingOpfPath} {
+		result := results[path]
+		if result.OK {
+			t.Errorf("Expected %s to be corrupt", filepath.Base(path))
+		}
+		if result.Error == "" {
+			t.Errorf("Expected an error for %s", filepath.Base(path))
+		}
+	}
+}